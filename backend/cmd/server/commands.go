@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"classkeeper/internal/anonymizer"
+	"classkeeper/internal/config"
+	"classkeeper/internal/database"
+	"classkeeper/internal/seed"
+
+	"gorm.io/gorm/logger"
+)
+
+// command - подкоманда сервера: server <name> [флаги]. Результат печатается в stdout
+// в формате JSON, сообщения и ошибки - в stderr.
+type command struct {
+	usage string
+	run   func(cfg *config.Config, args []string) (interface{}, error)
+}
+
+var commands = map[string]command{
+	"anonymize":      {"copy one school into a new SQLite file with fake names and text", runAnonymize},
+	"backup":         {"back up the instance into BACKUP_DIR or one school into a ZIP archive", runBackup},
+	"check":          {"check data integrity; exit code 3 if problems are found", runCheck},
+	"create-school":  {"create a school with its first administrator", runCreateSchool},
+	"migrate":        {"create and update database tables", runMigrate},
+	"repair":         {"show or apply the proposed fixes of integrity problems", runRepair},
+	"reset-password": {"set a new password for a user and unlock the login", runResetPassword},
+	"restore":        {"validate or restore a school archive", runRestore},
+	"seed":           {"fill a new or existing school with generated demo data", runSeed},
+	"unlock":         {"unlock the login of a user after failed attempts", runUnlock},
+	"users":          {"list users", runUsers},
+}
+
+// runCommand выполняет подкоманду и возвращает код выхода
+func runCommand(cfg *config.Config, name string, args []string) int {
+	cmd, ok := commands[name]
+	if !ok {
+		printUsage()
+		return 2
+	}
+	// Журнал SQL в режиме development не должен смешиваться с результатом в stdout
+	logger.Default = logger.New(log.New(os.Stderr, "\r\n", log.LstdFlags), logger.Config{
+		SlowThreshold: 200 * time.Millisecond,
+		LogLevel:      logger.Warn,
+		Colorful:      false,
+	})
+
+	result, err := cmd.run(cfg, args)
+	if err == flag.ErrHelp {
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		return 1
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(result); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		return 1
+	}
+	if f, ok := result.(failer); ok && f.Failed() {
+		return 3
+	}
+	return 0
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: server [command] [flags]")
+	fmt.Fprintln(os.Stderr, "Without a command the HTTP server is started. Commands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-15s %s\n", name, commands[name].usage)
+	}
+}
+
+// connect подключается к базе из настроек без миграций
+func connect(cfg *config.Config) error {
+	if err := database.Connect(cfg); err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	return nil
+}
+
+// runAnonymize: server anonymize -school 1 -out dev.db [-files dev-files] [-password p] [-salt s]
+func runAnonymize(cfg *config.Config, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("anonymize", flag.ContinueOnError)
+	schoolID := fs.Uint("school", 0, "school ID to copy")
+	out := fs.String("out", "", "path of the new SQLite file")
+	files := fs.String("files", "", "directory for placeholder attachment files (empty - attachments are not copied)")
+	password := fs.String("password", anonymizer.DefaultPassword, "password of every user in the copy")
+	salt := fs.String("salt", "", "salt for fake values; the same salt gives the same fakes (default random)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if *schoolID == 0 || *out == "" {
+		fs.Usage()
+		return nil, flag.ErrHelp
+	}
+
+	if err := connect(cfg); err != nil {
+		return nil, err
+	}
+	defer database.Close()
+
+	return anonymizer.Run(context.Background(), database.DB, cfg, anonymizer.Options{
+		SchoolID: *schoolID,
+		Output:   *out,
+		FilesDir: *files,
+		Password: *password,
+		Salt:     *salt,
+	})
+}
+
+// runSeed: server seed [-size small|medium|large] [-classes n] [-students n]
+// [-from 2025-09-01] [-to 2025-12-31] [-seed n] [-school id | -name "Школа №1"] [-prefix p] [-password p]
+func runSeed(cfg *config.Config, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	size := fs.String("size", "small", "school size: small, medium or large")
+	classes := fs.Int("classes", 0, "number of classes (overrides -size)")
+	students := fs.Int("students", 0, "students per class (overrides -size)")
+	from := fs.String("from", "", "first day of lessons, YYYY-MM-DD (default start of the academic year)")
+	to := fs.String("to", "", "last day of lessons, YYYY-MM-DD (default today or end of the academic year)")
+	seedValue := fs.Int64("seed", 1, "random seed; the same seed and options give the same data")
+	schoolID := fs.Uint("school", 0, "existing school ID to fill (default create a new school)")
+	name := fs.String("name", "", "name of the new school")
+	prefix := fs.String("prefix", "", "prefix of generated usernames")
+	password := fs.String("password", seed.DefaultPassword, "password of every generated user")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	preset, ok := seed.Sizes[*size]
+	if !ok {
+		return nil, fmt.Errorf("unknown size %q", *size)
+	}
+	if *classes > 0 {
+		preset.Classes = *classes
+	}
+	if *students > 0 {
+		preset.StudentsPerClass = *students
+	}
+	opts := seed.Options{
+		SchoolID:   *schoolID,
+		SchoolName: *name,
+		Size:       preset,
+		Seed:       *seedValue,
+		Password:   *password,
+		Prefix:     strings.TrimSpace(*prefix),
+	}
+	var err error
+	if *from != "" {
+		if opts.From, err = time.Parse("2006-01-02", *from); err != nil {
+			return nil, fmt.Errorf("invalid -from: %w", err)
+		}
+	}
+	if *to != "" {
+		if opts.To, err = time.Parse("2006-01-02", *to); err != nil {
+			return nil, fmt.Errorf("invalid -to: %w", err)
+		}
+	}
+	if opts.From.IsZero() != opts.To.IsZero() {
+		return nil, fmt.Errorf("-from and -to must be set together")
+	}
+
+	if err := connect(cfg); err != nil {
+		return nil, err
+	}
+	defer database.Close()
+	if err := database.Migrate(); err != nil {
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	return seed.Run(context.Background(), database.DB, opts)
+}
@@ -1,12 +1,21 @@
 package main
 
 import (
+	"classkeeper/internal/alerts"
+	"classkeeper/internal/backup"
 	"classkeeper/internal/config"
 	"classkeeper/internal/database"
+	"classkeeper/internal/demo"
 	"classkeeper/internal/handlers"
 	"classkeeper/internal/middleware"
+	"classkeeper/internal/privacy"
+	"classkeeper/internal/recurring"
+	"classkeeper/internal/storage"
+	"classkeeper/internal/trash"
 	"log"
 	"os"
+	"time"
+	_ "time/tzdata" // Часовые пояса для iCalendar без системной tzdata
 
 	"github.com/gin-gonic/gin"
 )
@@ -15,6 +24,11 @@ func main() {
 	// Загружаем конфигурацию
 	cfg := config.Load()
 
+	// Подкоманды (server anonymize ...) выполняются вместо запуска сервера
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(cfg, os.Args[1], os.Args[2:]))
+	}
+
 	// Подключаемся к базе данных
 	if err := database.Connect(cfg); err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
@@ -26,6 +40,32 @@ func main() {
 		log.Fatalf("Failed to run migrations: %v", err)
 	}
 
+	// Хранилище файлов вложений
+	store, err := storage.New(&cfg.Storage)
+	if err != nil {
+		log.Fatalf("Failed to initialize file storage: %v", err)
+	}
+
+	// Автоматическая выдача повторяющихся ДЗ
+	recurring.Start(database.DB, time.Hour)
+	alerts.Start(database.DB, time.Hour)
+
+	// Автоматическое резервное копирование
+	backupScheduler, err := backup.NewScheduler(database.DB, store, cfg)
+	if err != nil {
+		log.Fatalf("Invalid backup configuration: %v", err)
+	}
+	backupScheduler.Start()
+
+	// Автоматическая очистка корзины
+	trash.Start(database.DB, time.Duration(cfg.Trash.RetentionDays)*24*time.Hour, time.Hour)
+	privacy.Start(database.DB, store, cfg.Privacy.GraduateRetentionYears, 24*time.Hour)
+
+	// Демо-режим: удаление истёкших песочниц
+	if cfg.Demo.Enabled {
+		demo.Start(database.DB, store, 5*time.Minute)
+	}
+
 	// Настраиваем Gin
 	if cfg.Server.Environment == "production" {
 		gin.SetMode(gin.ReleaseMode)
@@ -44,26 +84,65 @@ func main() {
 	subjectHandler := handlers.NewSubjectHandler()
 	scheduleHandler := handlers.NewScheduleHandler()
 	attendanceHandler := handlers.NewAttendanceHandler()
+	checkInHandler := handlers.NewCheckInHandler(cfg)
 	gradeHandler := handlers.NewGradeHandler()
 	homeworkHandler := handlers.NewHomeworkHandler()
+	homeworkTemplateHandler := handlers.NewHomeworkTemplateHandler()
 	announcementHandler := handlers.NewAnnouncementHandler()
 	analyticsHandler := handlers.NewAnalyticsHandler()
 	exportHandler := handlers.NewExportHandler()
 	parentHandler := handlers.NewParentHandler()
+	absenceHandler := handlers.NewAbsenceHandler()
+	alertHandler := handlers.NewAlertHandler()
+	syncHandler := handlers.NewSyncHandler()
+	importHandler := handlers.NewImportHandler()
 	settingsHandler := handlers.NewSettingsHandler()
+	calendarHandler := handlers.NewCalendarHandler()
+	feedHandler := handlers.NewFeedHandler(cfg)
+	submissionHandler := handlers.NewSubmissionHandler()
+	attachmentHandler := handlers.NewAttachmentHandler(cfg, store)
+	reportCardHandler := handlers.NewReportCardHandler(cfg, store)
+	backupHandler := handlers.NewBackupHandler(store, backupScheduler)
+	auditHandler := handlers.NewAuditHandler(cfg)
+	trashHandler := handlers.NewTrashHandler(cfg)
+	privacyHandler := handlers.NewPrivacyHandler(cfg, store)
+	integrityHandler := handlers.NewIntegrityHandler()
+	demoHandler := handlers.NewDemoHandler(cfg, store, authHandler)
 
 	// API routes
 	api := router.Group("/api")
+	api.Use(middleware.AuditMiddleware())
 	{
 		// Публичные роуты (без аутентификации)
 		auth := api.Group("/auth")
 		{
-			auth.POST("/register", authHandler.Register)
+			auth.POST("/register", middleware.BlockInDemo(cfg), authHandler.Register)
 			auth.POST("/login", authHandler.Login)
 		}
 
 		// Создание школы (публично)
-		api.POST("/schools", schoolHandler.CreateSchool)
+		api.POST("/schools", middleware.BlockInDemo(cfg), schoolHandler.CreateSchool)
+
+		// Песочницы демо-режима
+		if cfg.Demo.Enabled {
+			demoRoutes := api.Group("/demo")
+			{
+				demoRoutes.GET("", demoHandler.GetDemoInfo)
+				demoRoutes.POST("/sandboxes", demoHandler.CreateSandbox)
+				demoRoutes.GET("/sandbox", demoHandler.GetSandbox)
+				demoRoutes.POST("/login", demoHandler.Login)
+				demoRoutes.POST("/reset", demoHandler.ResetSandbox)
+			}
+		}
+
+		// iCalendar-ленты (аутентификация по токену в URL)
+		api.GET("/ical/:token/:feed", feedHandler.ServeFeed)
+
+		// Скачивание файлов по подписанной ссылке
+		api.GET("/files/:id", attachmentHandler.ServeSignedFile)
+
+		// Аватары и логотипы по ссылке из профиля
+		api.GET("/images/:id/:checksum", attachmentHandler.ServeImage)
 
 		// Защищенные роуты (требуют аутентификации)
 		protected := api.Group("")
@@ -76,8 +155,8 @@ func main() {
 			schools := protected.Group("/schools")
 			schools.Use(middleware.RequireRole("admin"))
 			{
-				schools.GET("", schoolHandler.ListSchools)
-				schools.GET("/:id", schoolHandler.GetSchool)
+				schools.GET("", middleware.BlockInDemo(cfg), schoolHandler.ListSchools)
+				schools.GET("/:id", middleware.BlockInDemo(cfg), schoolHandler.GetSchool)
 				schools.PUT("/:id", schoolHandler.UpdateSchool)
 			}
 
@@ -85,6 +164,7 @@ func main() {
 			users := protected.Group("/users")
 			{
 				users.POST("", middleware.RequireRole("admin"), authHandler.Register)
+				users.POST("/bulk", middleware.RequireRole("admin"), userHandler.BulkCreateUsers)
 				users.GET("", userHandler.ListUsers)
 				users.GET("/:id", userHandler.GetUser)
 				users.PUT("/:id", userHandler.UpdateUser)
@@ -125,6 +205,38 @@ func main() {
 				schedules.PUT("/:id", middleware.RequireRole("admin", "teacher"), scheduleHandler.UpdateSchedule)
 				schedules.DELETE("/:id", middleware.RequireRole("admin"), scheduleHandler.DeleteSchedule)
 				schedules.GET("/class/:id", scheduleHandler.GetClassSchedule)
+				schedules.GET("/class/:id/day", scheduleHandler.GetClassScheduleForDate)
+			}
+
+			// Школьный календарь (праздники, каникулы, переносы)
+			calendarRoutes := protected.Group("/calendar")
+			{
+				calendarRoutes.GET("", calendarHandler.ListEvents)
+				calendarRoutes.POST("", middleware.RequireRole("admin"), calendarHandler.CreateEvent)
+				calendarRoutes.PUT("/:id", middleware.RequireRole("admin"), calendarHandler.UpdateEvent)
+				calendarRoutes.DELETE("/:id", middleware.RequireRole("admin"), calendarHandler.DeleteEvent)
+				calendarRoutes.GET("/working-days", calendarHandler.GetWorkingDays)
+				calendarRoutes.GET("/export.ics", calendarHandler.ExportICS)
+				calendarRoutes.POST("/import", middleware.RequireRole("admin"), calendarHandler.ImportICS)
+			}
+
+			// Персональные iCalendar-ленты
+			feeds := protected.Group("/feeds")
+			{
+				feeds.POST("", feedHandler.CreateFeed)
+				feeds.GET("", feedHandler.ListFeeds)
+				feeds.DELETE("/:id", feedHandler.RevokeFeed)
+			}
+
+			// Файлы вложений
+			attachments := protected.Group("/attachments")
+			{
+				attachments.POST("", attachmentHandler.UploadAttachment)
+				attachments.GET("/usage", middleware.RequireRole("admin"), attachmentHandler.GetStorageUsage)
+				attachments.GET("/:id", attachmentHandler.GetAttachment)
+				attachments.GET("/:id/link", attachmentHandler.GetAttachmentLink)
+				attachments.GET("/:id/download", attachmentHandler.DownloadAttachment)
+				attachments.DELETE("/:id", attachmentHandler.DeleteAttachment)
 			}
 
 			// Посещаемость
@@ -133,6 +245,14 @@ func main() {
 				attendance.POST("", middleware.RequireRole("admin", "teacher", "starosta"), attendanceHandler.MarkAttendance)
 				attendance.POST("/bulk", middleware.RequireRole("admin", "teacher", "starosta"), attendanceHandler.BulkMarkAttendance)
 				attendance.GET("", attendanceHandler.GetAttendance)
+				attendance.GET("/register", middleware.RequireRole("admin", "teacher"), attendanceHandler.GetRegister)
+				attendance.POST("/register", middleware.RequireRole("admin", "teacher"), attendanceHandler.TakeRegister)
+				attendance.GET("/lessons", middleware.RequireRole("admin", "teacher"), attendanceHandler.GetLessonCompletion)
+				attendance.POST("/checkin", middleware.RequireRole("student"), checkInHandler.Redeem)
+				attendance.POST("/checkin/sessions", middleware.RequireRole("admin", "teacher"), checkInHandler.OpenSession)
+				attendance.GET("/checkin/sessions/:id", middleware.RequireRole("admin", "teacher"), checkInHandler.GetSession)
+				attendance.GET("/checkin/sessions/:id/code", middleware.RequireRole("admin", "teacher"), checkInHandler.GetCode)
+				attendance.POST("/checkin/sessions/:id/close", middleware.RequireRole("admin", "teacher"), checkInHandler.CloseSession)
 				attendance.GET("/student/:id/stats", attendanceHandler.GetStudentStats)
 				attendance.DELETE("/:id", middleware.RequireRole("admin"), attendanceHandler.DeleteAttendance)
 			}
@@ -141,6 +261,7 @@ func main() {
 			grades := protected.Group("/grades")
 			{
 				grades.POST("", middleware.RequireRole("admin", "teacher"), gradeHandler.CreateGrade)
+				grades.POST("/bulk", middleware.RequireRole("admin", "teacher"), gradeHandler.BulkCreateGrades)
 				grades.GET("", gradeHandler.ListGrades)
 				grades.GET("/:id", gradeHandler.GetGrade)
 				grades.PUT("/:id", middleware.RequireRole("admin", "teacher"), gradeHandler.UpdateGrade)
@@ -153,12 +274,38 @@ func main() {
 			homework := protected.Group("/homework")
 			{
 				homework.POST("", middleware.RequireRole("admin", "teacher"), homeworkHandler.CreateHomework)
+				homework.POST("/bulk", middleware.RequireRole("admin", "teacher"), homeworkHandler.BulkCreateHomework)
 				homework.GET("", homeworkHandler.ListHomework)
 				homework.GET("/:id", homeworkHandler.GetHomework)
 				homework.PUT("/:id", middleware.RequireRole("admin", "teacher"), homeworkHandler.UpdateHomework)
 				homework.DELETE("/:id", middleware.RequireRole("admin", "teacher"), homeworkHandler.DeleteHomework)
 				homework.GET("/class/:id/upcoming", homeworkHandler.GetUpcomingHomework)
 				homework.GET("/class/:id/overdue", homeworkHandler.GetOverdueHomework)
+				homework.GET("/class/:id/load", middleware.RequireRole("admin", "teacher"), homeworkHandler.GetClassLoad)
+				homework.GET("/load-limits", homeworkHandler.GetLoadLimits)
+				homework.PUT("/load-limits", middleware.RequireRole("admin"), homeworkHandler.SetLoadLimit)
+				homework.DELETE("/load-limits/:grade", middleware.RequireRole("admin"), homeworkHandler.DeleteLoadLimit)
+
+				// Шаблоны и повторяющиеся ДЗ
+				homework.POST("/templates", middleware.RequireRole("admin", "teacher"), homeworkTemplateHandler.CreateTemplate)
+				homework.GET("/templates", middleware.RequireRole("admin", "teacher"), homeworkTemplateHandler.ListTemplates)
+				homework.POST("/templates/copy", middleware.RequireRole("admin", "teacher"), homeworkTemplateHandler.CopyTemplates)
+				homework.GET("/templates/:id", middleware.RequireRole("admin", "teacher"), homeworkTemplateHandler.GetTemplate)
+				homework.PUT("/templates/:id", middleware.RequireRole("admin", "teacher"), homeworkTemplateHandler.UpdateTemplate)
+				homework.DELETE("/templates/:id", middleware.RequireRole("admin", "teacher"), homeworkTemplateHandler.DeleteTemplate)
+				homework.POST("/templates/:id/assign", middleware.RequireRole("admin", "teacher"), homeworkTemplateHandler.AssignTemplate)
+				homework.POST("/recurrences", middleware.RequireRole("admin", "teacher"), homeworkTemplateHandler.CreateRecurrence)
+				homework.GET("/recurrences", middleware.RequireRole("admin", "teacher"), homeworkTemplateHandler.ListRecurrences)
+				homework.PUT("/recurrences/:id", middleware.RequireRole("admin", "teacher"), homeworkTemplateHandler.UpdateRecurrence)
+				homework.DELETE("/recurrences/:id", middleware.RequireRole("admin", "teacher"), homeworkTemplateHandler.DeleteRecurrence)
+				homework.POST("/recurrences/:id/generate", middleware.RequireRole("admin", "teacher"), homeworkTemplateHandler.GenerateRecurrence)
+
+				// Сдача ДЗ учениками и проверка учителями
+				homework.GET("/:id/submission", middleware.RequireRole("student", "starosta"), submissionHandler.GetMySubmission)
+				homework.PUT("/:id/submission", middleware.RequireRole("student", "starosta"), submissionHandler.SubmitHomework)
+				homework.GET("/:id/submissions", middleware.RequireRole("admin", "teacher"), submissionHandler.ListSubmissions)
+				homework.GET("/:id/stats", submissionHandler.GetHomeworkStats)
+				homework.POST("/submissions/:id/review", middleware.RequireRole("admin", "teacher"), submissionHandler.ReviewSubmission)
 			}
 
 			// Объявления
@@ -194,6 +341,15 @@ func main() {
 				export.GET("/school/report", exportHandler.ExportSchoolReport)
 			}
 
+			// Табели успеваемости (PDF)
+			reportCards := protected.Group("/report-cards")
+			{
+				reportCards.GET("/student/:id", reportCardHandler.StudentReportCard)
+				reportCards.GET("/class/:id", middleware.RequireRole("admin", "teacher"), reportCardHandler.ClassReportCards)
+				reportCards.GET("/comments", middleware.RequireRole("admin", "teacher"), reportCardHandler.GetComments)
+				reportCards.PUT("/comments", middleware.RequireRole("admin", "teacher"), reportCardHandler.SaveComment)
+			}
+
 			// Родители
 			parents := protected.Group("/parents")
 			{
@@ -205,6 +361,54 @@ func main() {
 				parents.GET("/child/:id/grades", parentHandler.GetChildGrades)
 				parents.GET("/child/:id/attendance", parentHandler.GetChildAttendance)
 				parents.GET("/child/:id/homework", parentHandler.GetChildHomework)
+				parents.POST("/child/:id/absences", middleware.RequireRole("parent"), absenceHandler.SubmitAbsenceNotice)
+				parents.GET("/child/:id/absences", middleware.RequireRole("parent"), absenceHandler.GetChildAbsenceNotices)
+				parents.DELETE("/absences/:id", middleware.RequireRole("parent"), absenceHandler.WithdrawAbsenceNotice)
+			}
+
+			// Заявления об отсутствии (рассмотрение классным руководителем)
+			absences := protected.Group("/absences")
+			{
+				absences.GET("", middleware.RequireRole("admin", "teacher"), absenceHandler.ListAbsenceNotices)
+				absences.POST("/:id/review", middleware.RequireRole("admin", "teacher"), absenceHandler.ReviewAbsenceNotice)
+			}
+
+			// Офлайн-синхронизация посещаемости и оценок
+			syncRoutes := protected.Group("/sync")
+			{
+				syncRoutes.POST("/attendance", middleware.RequireRole("admin", "teacher"), syncHandler.PushAttendance)
+				syncRoutes.POST("/grades", middleware.RequireRole("admin", "teacher"), syncHandler.PushGrades)
+				syncRoutes.GET("/changes", middleware.RequireRole("admin", "teacher"), syncHandler.GetChanges)
+			}
+
+			// Импорт пользователей, классов и связей родителей из CSV/XLSX
+			importRoutes := protected.Group("/import")
+			importRoutes.Use(middleware.RequireRole("admin"))
+			{
+				importRoutes.GET("/fields", importHandler.GetImportFields)
+				importRoutes.POST("/:entity", importHandler.Import)
+			}
+
+			// Раннее предупреждение: правила и предупреждения по ученикам
+			alertRoutes := protected.Group("/alerts")
+			{
+				alertRoutes.GET("", middleware.RequireRole("admin", "teacher"), alertHandler.ListAlerts)
+				alertRoutes.GET("/rules", middleware.RequireRole("admin"), alertHandler.ListRules)
+				alertRoutes.POST("/rules", middleware.RequireRole("admin"), alertHandler.CreateRule)
+				alertRoutes.PUT("/rules/:id", middleware.RequireRole("admin"), alertHandler.UpdateRule)
+				alertRoutes.DELETE("/rules/:id", middleware.RequireRole("admin"), alertHandler.DeleteRule)
+				alertRoutes.POST("/run", middleware.RequireRole("admin"), alertHandler.RunRules)
+				alertRoutes.GET("/:id", middleware.RequireRole("admin", "teacher"), alertHandler.GetAlert)
+				alertRoutes.POST("/:id/acknowledge", middleware.RequireRole("admin", "teacher"), alertHandler.AcknowledgeAlert)
+				alertRoutes.POST("/:id/resolve", middleware.RequireRole("admin", "teacher"), alertHandler.ResolveAlert)
+				alertRoutes.POST("/:id/notify-parents", middleware.RequireRole("admin", "teacher"), alertHandler.NotifyParents)
+			}
+
+			// Уведомления текущего пользователя
+			notifications := protected.Group("/notifications")
+			{
+				notifications.GET("", alertHandler.ListNotifications)
+				notifications.POST("/:id/read", alertHandler.MarkNotificationRead)
 			}
 
 			// Связи родителей и детей
@@ -224,8 +428,32 @@ func main() {
 				settings.GET("/school", settingsHandler.GetSchoolSettings)
 				settings.PUT("/school", middleware.RequireRole("admin"), settingsHandler.UpdateSchoolSettings)
 				settings.GET("/system", settingsHandler.GetSystemInfo)
-				settings.GET("/backup", middleware.RequireRole("admin"), settingsHandler.BackupDatabase)
-				settings.GET("/audit", middleware.RequireRole("admin"), settingsHandler.GetAuditLog)
+				settings.GET("/backup", middleware.RequireRole("admin"), backupHandler.ExportSchool)
+				settings.POST("/restore", middleware.RequireRole("admin"), middleware.BlockInDemo(cfg), backupHandler.RestoreSchool)
+				settings.GET("/backups", middleware.RequireBackupOperator(cfg), middleware.BlockInDemo(cfg), backupHandler.GetBackupStatus)
+				settings.POST("/backups/run", middleware.RequireBackupOperator(cfg), middleware.BlockInDemo(cfg), backupHandler.RunBackup)
+				settings.GET("/audit", middleware.RequireRole("admin"), auditHandler.ListAuditLog)
+				settings.GET("/audit/export", middleware.RequireRole("admin"), auditHandler.ExportAuditLog)
+				settings.GET("/integrity", middleware.RequireRole("admin"), integrityHandler.CheckIntegrity)
+				settings.POST("/integrity/repair", middleware.RequireRole("admin"), integrityHandler.RepairIntegrity)
+			}
+
+			// Корзина: удалённые записи школы
+			trashRoutes := protected.Group("/trash")
+			trashRoutes.Use(middleware.RequireRole("admin"))
+			{
+				trashRoutes.GET("", trashHandler.ListTrash)
+				trashRoutes.POST("/:entity/:id/restore", trashHandler.RestoreTrashItem)
+				trashRoutes.DELETE("/:entity/:id", trashHandler.PurgeTrashItem)
+			}
+
+			// Персональные данные: выгрузка, обезличивание и сроки хранения
+			privacyRoutes := protected.Group("/privacy")
+			{
+				privacyRoutes.GET("/users/:id/export", privacyHandler.ExportUserData)
+				privacyRoutes.POST("/users/:id/anonymize", middleware.RequireRole("admin"), privacyHandler.AnonymizeUser)
+				privacyRoutes.GET("/retention", middleware.RequireRole("admin"), privacyHandler.GetRetention)
+				privacyRoutes.POST("/retention/run", middleware.RequireRole("admin"), privacyHandler.RunRetention)
 			}
 		}
 	}
@@ -237,11 +465,9 @@ func main() {
 	router.Static("/pages", "../../../frontend/pages")
 
 	// ═══════════════════════════════════════════════════════════
-	// DEMO MODE - Проверяем переменную окружения DEMO_MODE
+	// DEMO MODE - Лендинг с выбором роли и песочницей посетителя
 	// ═══════════════════════════════════════════════════════════
-	demoMode := os.Getenv("DEMO_MODE") == "false"
-
-	if demoMode {
+	if cfg.Demo.Enabled {
 		log.Println("🎭 DEMO MODE ENABLED - Using demo.html as landing page")
 		router.StaticFile("/", "../../../frontend/demo.html")
 		router.StaticFile("/login", "../../../frontend/pages/index.html")
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"classkeeper/internal/backup"
+	"classkeeper/internal/config"
+	"classkeeper/internal/database"
+	"classkeeper/internal/integrity"
+	"classkeeper/internal/models"
+	"classkeeper/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+// failer - результат, который печатается как обычно, но означает, что команда нашла
+// проблемы: код выхода 3
+type failer interface {
+	Failed() bool
+}
+
+// UserInfo - пользователь в выводе команд users, unlock и reset-password
+type UserInfo struct {
+	ID           uint       `json:"id"`
+	SchoolID     uint       `json:"school_id"`
+	Username     string     `json:"username"`
+	Email        string     `json:"email"`
+	Role         string     `json:"role"`
+	Name         string     `json:"name"`
+	FailedLogins int        `json:"failed_logins"`
+	LockedUntil  *time.Time `json:"locked_until,omitempty"`
+	Deleted      bool       `json:"deleted,omitempty"`
+	Anonymized   bool       `json:"anonymized,omitempty"`
+	Password     string     `json:"password,omitempty"` // Только в ответе reset-password и create-school
+}
+
+func userInfo(u *models.User) UserInfo {
+	return UserInfo{
+		ID:           u.ID,
+		SchoolID:     u.SchoolID,
+		Username:     u.Username,
+		Email:        u.Email,
+		Role:         u.Role,
+		Name:         strings.TrimSpace(u.LastName + " " + u.FirstName),
+		FailedLogins: u.FailedLogins,
+		LockedUntil:  u.LockedUntil,
+		Deleted:      u.DeletedAt.Valid,
+		Anonymized:   u.AnonymizedAt != nil,
+	}
+}
+
+// findUser находит пользователя по логину или ID
+func findUser(db *gorm.DB, ref string) (*models.User, error) {
+	var user models.User
+	query := db.Where("username = ?", ref)
+	if id, err := strconv.ParseUint(ref, 10, 64); err == nil {
+		query = db.Where("id = ?", id)
+	}
+	if err := query.First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("user %q not found", ref)
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// randomPassword генерирует пароль из букв и цифр без похожих символов
+func randomPassword(n int) (string, error) {
+	const alphabet = "abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	b := make([]byte, n)
+	for i := range b {
+		k, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+		if err != nil {
+			return "", err
+		}
+		b[i] = alphabet[k.Int64()]
+	}
+	return string(b), nil
+}
+
+// runMigrate: server migrate
+func runMigrate(cfg *config.Config, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if err := connect(cfg); err != nil {
+		return nil, err
+	}
+	defer database.Close()
+	if err := database.Migrate(); err != nil {
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+	return map[string]interface{}{"migrated": true, "database": cfg.Database.Type}, nil
+}
+
+// runCreateSchool: server create-school -name "Школа №1" -admin admin -email admin@school.ru
+// [-password p] [-first Имя] [-last Фамилия]
+func runCreateSchool(cfg *config.Config, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("create-school", flag.ContinueOnError)
+	name := fs.String("name", "", "school name")
+	username := fs.String("admin", "", "username of the first administrator")
+	email := fs.String("email", "", "email of the first administrator")
+	password := fs.String("password", "", "administrator password (default random)")
+	first := fs.String("first", "", "administrator first name")
+	last := fs.String("last", "", "administrator last name")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(*name) == "" || len(*username) < 3 || *email == "" {
+		fs.Usage()
+		return nil, flag.ErrHelp
+	}
+	if *password == "" {
+		generated, err := randomPassword(12)
+		if err != nil {
+			return nil, err
+		}
+		*password = generated
+	} else if len(*password) < 6 {
+		return nil, fmt.Errorf("password must be at least 6 characters")
+	}
+
+	if err := connect(cfg); err != nil {
+		return nil, err
+	}
+	defer database.Close()
+	if err := database.Migrate(); err != nil {
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	var count int64
+	if err := database.DB.Model(&models.User{}).Unscoped().
+		Where("username = ? OR email = ?", *username, *email).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, fmt.Errorf("username or email already exists")
+	}
+
+	school := models.School{Name: strings.TrimSpace(*name)}
+	admin := models.User{
+		Username:     *username,
+		Email:        *email,
+		PasswordHash: *password, // Пароли хранятся так же, как при регистрации через API
+		Role:         "admin",
+		FirstName:    *first,
+		LastName:     *last,
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&school).Error; err != nil {
+			return err
+		}
+		admin.SchoolID = school.ID
+		if err := tx.Create(&admin).Error; err != nil {
+			return err
+		}
+		school.AdminID = &admin.ID
+		return tx.Model(&school).Update("admin_id", admin.ID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	info := userInfo(&admin)
+	info.Password = *password
+	return map[string]interface{}{"school": school, "admin": info}, nil
+}
+
+// runUsers: server users [-school id] [-role teacher] [-locked] [-deleted]
+func runUsers(cfg *config.Config, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("users", flag.ContinueOnError)
+	schoolID := fs.Uint("school", 0, "only users of this school")
+	role := fs.String("role", "", "only users with this role")
+	locked := fs.Bool("locked", false, "only users whose login is locked")
+	deleted := fs.Bool("deleted", false, "include users in the trash")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if err := connect(cfg); err != nil {
+		return nil, err
+	}
+	defer database.Close()
+
+	query := database.DB.Order("id")
+	if *deleted {
+		query = query.Unscoped()
+	}
+	if *schoolID != 0 {
+		query = query.Where("school_id = ?", *schoolID)
+	}
+	if *role != "" {
+		query = query.Where("role = ?", *role)
+	}
+	if *locked {
+		query = query.Where("locked_until > ?", time.Now())
+	}
+	var users []models.User
+	if err := query.Find(&users).Error; err != nil {
+		return nil, err
+	}
+	result := make([]UserInfo, len(users))
+	for i := range users {
+		result[i] = userInfo(&users[i])
+	}
+	return result, nil
+}
+
+// runUnlock: server unlock -user ivanov
+func runUnlock(cfg *config.Config, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("unlock", flag.ContinueOnError)
+	ref := fs.String("user", "", "username or ID")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if *ref == "" {
+		fs.Usage()
+		return nil, flag.ErrHelp
+	}
+	if err := connect(cfg); err != nil {
+		return nil, err
+	}
+	defer database.Close()
+
+	user, err := findUser(database.DB, *ref)
+	if err != nil {
+		return nil, err
+	}
+	if err := database.DB.Model(user).Updates(map[string]interface{}{"failed_logins": 0, "locked_until": nil}).Error; err != nil {
+		return nil, err
+	}
+	user.FailedLogins, user.LockedUntil = 0, nil
+	return userInfo(user), nil
+}
+
+// runResetPassword: server reset-password -user ivanov [-password p]
+func runResetPassword(cfg *config.Config, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("reset-password", flag.ContinueOnError)
+	ref := fs.String("user", "", "username or ID")
+	password := fs.String("password", "", "new password (default random)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if *ref == "" {
+		fs.Usage()
+		return nil, flag.ErrHelp
+	}
+	if *password == "" {
+		generated, err := randomPassword(12)
+		if err != nil {
+			return nil, err
+		}
+		*password = generated
+	} else if len(*password) < 6 {
+		return nil, fmt.Errorf("password must be at least 6 characters")
+	}
+	if err := connect(cfg); err != nil {
+		return nil, err
+	}
+	defer database.Close()
+
+	user, err := findUser(database.DB, *ref)
+	if err != nil {
+		return nil, err
+	}
+	if user.AnonymizedAt != nil {
+		return nil, fmt.Errorf("user %q is anonymized", *ref)
+	}
+	// Сброс пароля заодно снимает блокировку входа
+	if err := database.DB.Model(user).Updates(map[string]interface{}{
+		"password_hash": *password,
+		"failed_logins": 0,
+		"locked_until":  nil,
+	}).Error; err != nil {
+		return nil, err
+	}
+	user.FailedLogins, user.LockedUntil = 0, nil
+	info := userInfo(user)
+	info.Password = *password
+	return info, nil
+}
+
+// runBackup: server backup [-school id -out school.zip]. Без -school выполняет полное
+// копирование экземпляра в BACKUP_DIR так же, как копирование по расписанию.
+func runBackup(cfg *config.Config, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	schoolID := fs.Uint("school", 0, "export one school into a ZIP archive")
+	out := fs.String("out", "", "path of the school archive (with -school)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if (*schoolID == 0) != (*out == "") {
+		fs.Usage()
+		return nil, flag.ErrHelp
+	}
+	if err := connect(cfg); err != nil {
+		return nil, err
+	}
+	defer database.Close()
+	store, err := storage.New(&cfg.Storage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize file storage: %w", err)
+	}
+
+	if *schoolID == 0 {
+		scheduler, err := backup.NewScheduler(database.DB, store, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return scheduler.Run(backup.TriggerManual)
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := backup.Export(context.Background(), database.DB, store, *schoolID, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(*out)
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// runRestore: server restore -in school.zip [-apply] [-rename-conflicts]. Без -apply
+// архив только проверяется, как при проверке через настройки.
+func runRestore(cfg *config.Config, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	in := fs.String("in", "", "path of the school archive")
+	apply := fs.Bool("apply", false, "restore the school (default only validate the archive)")
+	rename := fs.Bool("rename-conflicts", false, "rename users whose username or email is taken")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if *in == "" {
+		fs.Usage()
+		return nil, flag.ErrHelp
+	}
+	f, err := os.Open(*in)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := connect(cfg); err != nil {
+		return nil, err
+	}
+	defer database.Close()
+	if err := database.Migrate(); err != nil {
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+	store, err := storage.New(&cfg.Storage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize file storage: %w", err)
+	}
+
+	report, err := backup.Restore(context.Background(), database.DB, store, f, stat.Size(), backup.Options{
+		DryRun:          !*apply,
+		RenameConflicts: *rename,
+	})
+	if errors.Is(err, backup.ErrConflicts) {
+		return restoreConflicts{Error: err.Error(), Report: report}, nil
+	}
+	return report, err
+}
+
+// restoreConflicts - отчёт восстановления, остановленного конфликтами логинов и email
+type restoreConflicts struct {
+	Error  string         `json:"error"`
+	Report *backup.Report `json:"report"`
+}
+
+func (restoreConflicts) Failed() bool { return true }
+
+// runCheck: server check [-school id] [-checks orphaned_reference,role_mismatch]. Код
+// выхода 3, если найдены проблемы.
+func runCheck(cfg *config.Config, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	schoolID := fs.Uint("school", 0, "check one school (default the whole instance)")
+	checks := fs.String("checks", "", "comma-separated checks (default all: "+strings.Join(integrity.Checks, ",")+")")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if err := connect(cfg); err != nil {
+		return nil, err
+	}
+	defer database.Close()
+	return integrity.Check(database.DB, *schoolID, splitList(*checks)...)
+}
+
+// runRepair: server repair [-school id] [-checks ...] [-apply]. Без -apply исправления
+// только показываются. Код выхода 3, если после исправления остались проблемы.
+func runRepair(cfg *config.Config, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("repair", flag.ContinueOnError)
+	schoolID := fs.Uint("school", 0, "repair one school (default the whole instance)")
+	checks := fs.String("checks", "", "comma-separated checks (default "+strings.Join(integrity.RepairChecks, ",")+")")
+	apply := fs.Bool("apply", false, "apply the fixes (default dry run)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if err := connect(cfg); err != nil {
+		return nil, err
+	}
+	defer database.Close()
+	return integrity.Repair(database.DB, *schoolID, integrity.RepairOptions{
+		DryRun: !*apply,
+		Checks: splitList(*checks),
+	})
+}
+
+// splitList разбирает список через запятую
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
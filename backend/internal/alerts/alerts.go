@@ -0,0 +1,469 @@
+// Package alerts - правила раннего предупреждения: периодически проверяет
+// посещаемость и оценки и открывает предупреждения классным руководителям.
+package alerts
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"classkeeper/internal/calendar"
+	"classkeeper/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Типы правил
+const (
+	RuleAbsenceRate   = "absence_rate"   // Доля пропусков за последние WindowDays дней больше Threshold %
+	RuleFailingStreak = "failing_streak" // Streak оценок подряд не выше Threshold
+	RuleAverageDrop   = "average_drop"   // Средний балл упал больше чем на Threshold с прошлой четверти
+)
+
+// RuleTypes - допустимые типы правил
+var RuleTypes = map[string]bool{
+	RuleAbsenceRate:   true,
+	RuleFailingStreak: true,
+	RuleAverageDrop:   true,
+}
+
+// Статусы предупреждения
+const (
+	StatusOpen         = "open"
+	StatusAcknowledged = "acknowledged"
+	StatusResolved     = "resolved"
+)
+
+// Важность предупреждения
+const (
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+const (
+	// minLessons - меньше уроков слишком мало для вывода о доле пропусков
+	minLessons = 5
+	// minGrades - минимум оценок в каждом периоде для сравнения средних
+	minGrades = 2
+	// defaultWindow используется, если у правила не задан период
+	defaultWindow = 30
+)
+
+// Finding - ученик (и предмет), для которого сработало правило
+type Finding struct {
+	StudentID uint
+	SubjectID *uint
+	Value     float64
+	Message   string
+}
+
+// Evaluate проверяет правило и открывает предупреждения по новым срабатываниям.
+// По уже открытым предупреждениям обновляется только значение показателя.
+func Evaluate(db *gorm.DB, rule *models.AlertRule, now time.Time) ([]models.StudentAlert, error) {
+	// Ученики школы и их классы
+	var members []struct {
+		StudentID         uint
+		ClassID           uint
+		HomeroomTeacherID *uint
+	}
+	if err := db.Table("class_students").
+		Select("class_students.user_id AS student_id, classes.id AS class_id, classes.homeroom_teacher_id").
+		Joins("JOIN classes ON classes.id = class_students.class_id AND classes.deleted_at IS NULL").
+		Joins("JOIN users ON users.id = class_students.user_id AND users.deleted_at IS NULL").
+		Where("classes.school_id = ? AND users.role IN ?", rule.SchoolID, []string{"student", "starosta"}).
+		Order("classes.id").
+		Scan(&members).Error; err != nil {
+		return nil, err
+	}
+	if len(members) == 0 {
+		return nil, nil
+	}
+
+	type membership struct {
+		classID  uint
+		homeroom *uint
+	}
+	byStudent := make(map[uint]membership)
+	studentIDs := make([]uint, 0, len(members))
+	for _, m := range members {
+		if _, ok := byStudent[m.StudentID]; !ok {
+			byStudent[m.StudentID] = membership{m.ClassID, m.HomeroomTeacherID}
+			studentIDs = append(studentIDs, m.StudentID)
+		}
+	}
+
+	subjects := make(map[uint]string)
+	var subjectList []models.Subject
+	db.Where("school_id = ?", rule.SchoolID).Find(&subjectList)
+	for _, s := range subjectList {
+		subjects[s.ID] = s.Name
+	}
+
+	var findings []Finding
+	var err error
+	switch rule.Type {
+	case RuleAbsenceRate:
+		findings, err = absenceRate(db, rule, studentIDs, subjects, now)
+	case RuleFailingStreak:
+		findings, err = failingStreak(db, rule, studentIDs, subjects, now)
+	case RuleAverageDrop:
+		findings, err = averageDrop(db, rule, studentIDs, subjects, now)
+	default:
+		return nil, fmt.Errorf("unknown rule type %q", rule.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var opened []models.StudentAlert
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, f := range findings {
+			member := byStudent[f.StudentID]
+
+			var existing models.StudentAlert
+			query := tx.Where("rule_id = ? AND student_id = ?", rule.ID, f.StudentID)
+			if f.SubjectID != nil {
+				query = query.Where("subject_id = ?", *f.SubjectID)
+			} else {
+				query = query.Where("subject_id IS NULL")
+			}
+			if err := query.Order("id DESC").First(&existing).Error; err == nil {
+				if existing.Status != StatusResolved {
+					if err := tx.Model(&existing).Updates(map[string]interface{}{"value": f.Value, "message": f.Message}).Error; err != nil {
+						return err
+					}
+					continue
+				}
+				// Недавно закрытое предупреждение не открываем заново, пока не пройдёт период правила
+				if existing.ResolvedAt != nil && now.Sub(*existing.ResolvedAt) < time.Duration(window(rule))*24*time.Hour {
+					continue
+				}
+			}
+
+			alert := models.StudentAlert{
+				SchoolID:   rule.SchoolID,
+				RuleID:     rule.ID,
+				StudentID:  f.StudentID,
+				ClassID:    member.classID,
+				SubjectID:  f.SubjectID,
+				AssignedTo: member.homeroom,
+				Status:     StatusOpen,
+				Severity:   rule.Severity,
+				Message:    f.Message,
+				Value:      f.Value,
+			}
+			if err := tx.Create(&alert).Error; err != nil {
+				return err
+			}
+			if rule.NotifyParents {
+				if _, err := NotifyParents(tx, &alert); err != nil {
+					return err
+				}
+			}
+			opened = append(opened, alert)
+		}
+
+		return tx.Model(rule).Update("last_run_at", now).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return opened, nil
+}
+
+// RunAll проверяет все активные правила
+func RunAll(db *gorm.DB, now time.Time) (int, error) {
+	var rules []models.AlertRule
+	if err := db.Where("active = ?", true).Find(&rules).Error; err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for i := range rules {
+		opened, err := Evaluate(db, &rules[i], now)
+		if err != nil {
+			log.Printf("Alert rule %d: %v", rules[i].ID, err)
+			continue
+		}
+		total += len(opened)
+	}
+	return total, nil
+}
+
+// Start запускает периодическую проверку правил
+func Start(db *gorm.DB, interval time.Duration) {
+	go func() {
+		for {
+			if total, err := RunAll(db, time.Now()); err != nil {
+				log.Printf("Alert rules evaluation failed: %v", err)
+			} else if total > 0 {
+				log.Printf("Alert rules: opened %d alerts", total)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// NotifyParents отправляет родителям ученика уведомление о предупреждении.
+// Возвращает число уведомлённых родителей.
+func NotifyParents(db *gorm.DB, alert *models.StudentAlert) (int, error) {
+	var parentIDs []uint
+	if err := db.Model(&models.ParentStudent{}).
+		Where("student_id = ?", alert.StudentID).
+		Pluck("parent_id", &parentIDs).Error; err != nil {
+		return 0, err
+	}
+	if len(parentIDs) == 0 {
+		return 0, nil
+	}
+
+	for _, parentID := range parentIDs {
+		alertID := alert.ID
+		notification := models.Notification{
+			UserID:  parentID,
+			Type:    "alert",
+			Title:   "Предупреждение об успеваемости ребёнка",
+			Message: alert.Message,
+			RefID:   &alertID,
+		}
+		if err := db.Create(&notification).Error; err != nil {
+			return 0, err
+		}
+	}
+
+	alert.ParentsNotified = true
+	return len(parentIDs), db.Model(alert).Update("parents_notified", true).Error
+}
+
+// window - период анализа правила в днях
+func window(rule *models.AlertRule) int {
+	if rule.WindowDays > 0 {
+		return rule.WindowDays
+	}
+	return defaultWindow
+}
+
+// subjectLabel - название предмета для текста предупреждения
+func subjectLabel(subjects map[uint]string, subjectID *uint) string {
+	if subjectID == nil {
+		return "все предметы"
+	}
+	if name, ok := subjects[*subjectID]; ok {
+		return name
+	}
+	return fmt.Sprintf("предмет #%d", *subjectID)
+}
+
+// absenceRate: доля пропусков (и неуважительных, и уважительных) за последние WindowDays дней
+func absenceRate(db *gorm.DB, rule *models.AlertRule, studentIDs []uint, subjects map[uint]string, now time.Time) ([]Finding, error) {
+	days := window(rule)
+	since := calendar.Date(now).AddDate(0, 0, -days)
+
+	var rows []struct {
+		StudentID uint
+		SubjectID *uint
+		Total     int
+		Missed    int
+	}
+	query := db.Model(&models.Attendance{}).
+		Select("student_id, subject_id, COUNT(*) AS total, SUM(CASE WHEN status IN ('absent', 'excused') THEN 1 ELSE 0 END) AS missed").
+		Where("student_id IN ? AND date >= ?", studentIDs, since)
+	if rule.SubjectID != nil {
+		query = query.Where("subject_id = ?", *rule.SubjectID)
+	}
+	if err := query.Group("student_id, subject_id").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+	for _, r := range rows {
+		if r.Total < minLessons {
+			continue
+		}
+		rate := float64(r.Missed) * 100 / float64(r.Total)
+		if rate <= rule.Threshold {
+			continue
+		}
+		findings = append(findings, Finding{
+			StudentID: r.StudentID,
+			SubjectID: r.SubjectID,
+			Value:     rate,
+			Message: fmt.Sprintf("Пропущено %.0f%% уроков (%d из %d), %s, за последние %d дней",
+				rate, r.Missed, r.Total, subjectLabel(subjects, r.SubjectID), days),
+		})
+	}
+	sortFindings(findings)
+	return findings, nil
+}
+
+// failingStreak: последние Streak оценок по предмету не выше Threshold (по умолчанию три двойки подряд)
+func failingStreak(db *gorm.DB, rule *models.AlertRule, studentIDs []uint, subjects map[uint]string, now time.Time) ([]Finding, error) {
+	streak := rule.Streak
+	if streak <= 0 {
+		streak = 3
+	}
+	limit := int(rule.Threshold)
+	if limit <= 0 {
+		limit = 2
+	}
+	since := calendar.Date(now).AddDate(0, 0, -window(rule))
+
+	var grades []models.Grade
+	query := db.Where("student_id IN ? AND date >= ?", studentIDs, since)
+	if rule.SubjectID != nil {
+		query = query.Where("subject_id = ?", *rule.SubjectID)
+	}
+	if err := query.Order("date DESC, id DESC").Find(&grades).Error; err != nil {
+		return nil, err
+	}
+
+	type key struct{ student, subject uint }
+	recent := make(map[key][]int)
+	for _, g := range grades {
+		k := key{g.StudentID, g.SubjectID}
+		if len(recent[k]) < streak {
+			recent[k] = append(recent[k], g.Grade)
+		}
+	}
+
+	var findings []Finding
+	for k, marks := range recent {
+		if len(marks) < streak {
+			continue
+		}
+		failing := true
+		for _, m := range marks {
+			if m > limit {
+				failing = false
+				break
+			}
+		}
+		if !failing {
+			continue
+		}
+		subjectID := k.subject
+		findings = append(findings, Finding{
+			StudentID: k.student,
+			SubjectID: &subjectID,
+			Value:     float64(streak),
+			Message: fmt.Sprintf("%d оценки подряд не выше %d, %s",
+				streak, limit, subjectLabel(subjects, &subjectID)),
+		})
+	}
+	sortFindings(findings)
+	return findings, nil
+}
+
+// averageDrop: средний балл текущей четверти ниже прошлой больше чем на Threshold
+func averageDrop(db *gorm.DB, rule *models.AlertRule, studentIDs []uint, subjects map[uint]string, now time.Time) ([]Finding, error) {
+	curFrom, prevFrom, prevTo, err := terms(db, rule, now)
+	if err != nil {
+		return nil, err
+	}
+
+	type avg struct {
+		StudentID uint
+		SubjectID uint
+		Average   float64
+		Count     int
+	}
+	averages := func(from, to time.Time) (map[[2]uint]avg, error) {
+		var rows []avg
+		query := db.Model(&models.Grade{}).
+			Select("student_id, subject_id, AVG(grade) AS average, COUNT(*) AS count").
+			Where("student_id IN ? AND date >= ? AND date <= ?", studentIDs, from, to)
+		if rule.SubjectID != nil {
+			query = query.Where("subject_id = ?", *rule.SubjectID)
+		}
+		if err := query.Group("student_id, subject_id").Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+		result := make(map[[2]uint]avg)
+		for _, r := range rows {
+			result[[2]uint{r.StudentID, r.SubjectID}] = r
+		}
+		return result, nil
+	}
+
+	current, err := averages(curFrom, calendar.Date(now))
+	if err != nil {
+		return nil, err
+	}
+	previous, err := averages(prevFrom, prevTo)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+	for k, cur := range current {
+		prev, ok := previous[k]
+		if !ok || cur.Count < minGrades || prev.Count < minGrades {
+			continue
+		}
+		drop := prev.Average - cur.Average
+		if drop <= rule.Threshold {
+			continue
+		}
+		subjectID := k[1]
+		findings = append(findings, Finding{
+			StudentID: k[0],
+			SubjectID: &subjectID,
+			Value:     drop,
+			Message: fmt.Sprintf("Средний балл снизился с %.2f до %.2f, %s",
+				prev.Average, cur.Average, subjectLabel(subjects, &subjectID)),
+		})
+	}
+	sortFindings(findings)
+	return findings, nil
+}
+
+// terms определяет текущую и прошлую четверть по школьным каникулам из календаря.
+// Если каникул в календаре нет, сравниваются два последних периода по WindowDays дней.
+func terms(db *gorm.DB, rule *models.AlertRule, now time.Time) (curFrom, prevFrom, prevTo time.Time, err error) {
+	today := calendar.Date(now)
+
+	var vacations []models.CalendarEvent
+	if err = db.Where("school_id = ? AND class_id IS NULL AND type = ? AND end_date < ?", rule.SchoolID, "vacation", today).
+		Order("end_date DESC").
+		Limit(2).
+		Find(&vacations).Error; err != nil {
+		return
+	}
+
+	if len(vacations) == 0 {
+		days := window(rule)
+		curFrom = today.AddDate(0, 0, -days+1)
+		prevTo = curFrom.AddDate(0, 0, -1)
+		prevFrom = prevTo.AddDate(0, 0, -days+1)
+		return
+	}
+
+	curFrom = calendar.Date(vacations[0].EndDate).AddDate(0, 0, 1)
+	prevTo = calendar.Date(vacations[0].StartDate).AddDate(0, 0, -1)
+	if len(vacations) == 2 {
+		prevFrom = calendar.Date(vacations[1].EndDate).AddDate(0, 0, 1)
+	} else {
+		// Первая четверть года: берём период той же длины, что и текущий
+		prevFrom = prevTo.AddDate(0, 0, -int(today.Sub(curFrom).Hours()/24))
+	}
+	return
+}
+
+// sortFindings упорядочивает срабатывания, чтобы предупреждения создавались предсказуемо
+func sortFindings(findings []Finding) {
+	sort.Slice(findings, func(i, j int) bool {
+		if findings[i].StudentID != findings[j].StudentID {
+			return findings[i].StudentID < findings[j].StudentID
+		}
+		return subjectKey(findings[i].SubjectID) < subjectKey(findings[j].SubjectID)
+	})
+}
+
+func subjectKey(subjectID *uint) uint {
+	if subjectID == nil {
+		return 0
+	}
+	return *subjectID
+}
@@ -0,0 +1,318 @@
+// Package anonymizer копирует данные одной школы в новый файл SQLite, заменяя имена,
+// логины, почту, телефоны, комментарии и другой свободный текст вымышленными значениями.
+// Связи между записями, распределение оценок и посещаемость сохраняются, поэтому копию
+// можно передать разработчикам для воспроизведения ошибок.
+package anonymizer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"classkeeper/internal/backup"
+	"classkeeper/internal/config"
+	"classkeeper/internal/database"
+	"classkeeper/internal/models"
+	"classkeeper/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+// DefaultPassword - пароль всех пользователей копии, если не задан другой
+const DefaultPassword = "password"
+
+var (
+	// ErrOutputExists - файл копии уже существует
+	ErrOutputExists = errors.New("output file already exists")
+	// ErrSchoolNotFound - школы нет в исходной базе
+	ErrSchoolNotFound = errors.New("school not found")
+)
+
+// Options - параметры копирования
+type Options struct {
+	SchoolID uint
+	Output   string // Путь к новому файлу SQLite
+	// FilesDir - каталог для файлов вложений. Содержимое файлов не копируется: каждый
+	// файл заменяется короткой заглушкой. Пусто - вложения в копию не попадают.
+	FilesDir string
+	Password string // Пароль всех пользователей копии; пусто - DefaultPassword
+	// Salt - соль замен. С одной солью одинаковые значения в разных копиях заменяются
+	// одинаково. Пусто - случайная соль.
+	Salt string
+}
+
+// Report - результат копирования
+type Report struct {
+	Output   string               `json:"output"`
+	SchoolID uint                 `json:"school_id"` // ID школы в копии
+	School   string               `json:"school"`    // Вымышленное название
+	Tables   []backup.TableReport `json:"tables"`
+	Files    int                  `json:"files"`
+	Replaced map[string]int       `json:"replaced"` // таблица.столбец -> число заменённых значений
+	Warnings []string             `json:"warnings,omitempty"`
+}
+
+// placeholder - содержимое файлов вложений в копии
+var placeholder = []byte("Файл заменён при обезличивании\n")
+
+// textColumns - свободный текст, который заменяется набором слов той же длины
+var textColumns = []struct {
+	table   string
+	columns []string
+}{
+	{"announcements", []string{"title", "content"}},
+	{"homeworks", []string{"description"}},
+	{"homework_templates", []string{"title", "description"}},
+	{"grades", []string{"comment"}},
+	{"attendances", []string{"comment"}},
+	{"homework_submissions", []string{"answer", "teacher_comment"}},
+	{"absence_notices", []string{"comment", "review_comment"}},
+	{"report_card_comments", []string{"comment"}},
+	{"student_alerts", []string{"resolution"}},
+	{"notifications", []string{"message"}},
+	{"calendar_events", []string{"description"}},
+	{"subjects", []string{"description"}},
+}
+
+// Run копирует школу из db в новый файл SQLite и обезличивает копию. Школа выгружается
+// и загружается так же, как при резервном копировании (backup.Export и backup.Restore),
+// поэтому в копию попадают те же таблицы, а ID перенумеровываются.
+func Run(ctx context.Context, db *gorm.DB, cfg *config.Config, opts Options) (*Report, error) {
+	if _, err := os.Stat(opts.Output); err == nil {
+		return nil, ErrOutputExists
+	}
+	var count int64
+	if err := db.Model(&models.School{}).Where("id = ?", opts.SchoolID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, ErrSchoolNotFound
+	}
+	if opts.Password == "" {
+		opts.Password = DefaultPassword
+	}
+	if opts.Salt == "" {
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		opts.Salt = hex.EncodeToString(salt)
+	}
+
+	tmp, err := os.CreateTemp("", "classkeeper-anonymize-*.zip")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	// Файлы вложений в архив не читаются: вместо них заглушки или ничего
+	if _, err := backup.Export(ctx, db, placeholderStore{files: opts.FilesDir != ""}, opts.SchoolID, tmp); err != nil {
+		return nil, fmt.Errorf("export school: %w", err)
+	}
+	size, err := tmp.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	targetCfg := *cfg
+	targetCfg.Database = config.DatabaseConfig{Type: "sqlite", SQLPath: opts.Output}
+	target, err := database.Open(&targetCfg)
+	if err != nil {
+		return nil, err
+	}
+	if sqlDB, err := target.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+	if err := database.MigrateDB(target); err != nil {
+		os.Remove(opts.Output)
+		return nil, err
+	}
+
+	var targetStore storage.Backend
+	if opts.FilesDir != "" {
+		if targetStore, err = storage.NewLocal(opts.FilesDir); err != nil {
+			os.Remove(opts.Output)
+			return nil, err
+		}
+	}
+
+	restored, err := backup.Restore(ctx, target, targetStore, tmp, size, backup.Options{})
+	if err != nil {
+		os.Remove(opts.Output)
+		return nil, fmt.Errorf("restore copy: %w", err)
+	}
+
+	report := &Report{
+		Output:   opts.Output,
+		SchoolID: restored.SchoolID,
+		Tables:   restored.Tables,
+		Files:    restored.Files,
+		Replaced: make(map[string]int),
+		Warnings: restored.Warnings,
+	}
+	if err := target.Transaction(func(tx *gorm.DB) error {
+		return scrub(tx, newFaker(opts.Salt), opts, report)
+	}); err != nil {
+		os.Remove(opts.Output)
+		return nil, fmt.Errorf("anonymize copy: %w", err)
+	}
+	return report, nil
+}
+
+// scrub заменяет персональные данные в копии
+func scrub(tx *gorm.DB, f *faker, opts Options, report *Report) error {
+	// Журнал аудита копии - только запись о восстановлении с названием исходной школы
+	if err := tx.Where("1 = 1").Delete(&models.AuditLog{}).Error; err != nil {
+		return err
+	}
+
+	var school models.School
+	if err := tx.Unscoped().First(&school, report.SchoolID).Error; err != nil {
+		return err
+	}
+	n := f.hash("school", school.Name)%900 + 100
+	report.School = fmt.Sprintf("Школа №%d", n)
+	if err := tx.Model(&school).Updates(map[string]interface{}{
+		"name":    report.School,
+		"address": emptyOr(school.Address, "г. Примерный, ул. Школьная, д. 1"),
+		"phone":   emptyOr(school.Phone, fmt.Sprintf("+7 900 000-%02d-%02d", n/100, n%100)),
+		"email":   emptyOr(school.Email, fmt.Sprintf("school%d@example.org", n)),
+	}).Error; err != nil {
+		return err
+	}
+	report.Replaced["schools.name"]++
+
+	if err := scrubUsers(tx, f, opts, report); err != nil {
+		return err
+	}
+
+	var classes []models.Class
+	if err := tx.Unscoped().Where("external_id IS NOT NULL").Find(&classes).Error; err != nil {
+		return err
+	}
+	for _, c := range classes {
+		if err := tx.Unscoped().Model(&c).Update("external_id", f.token("class", *c.ExternalID)).Error; err != nil {
+			return err
+		}
+		report.Replaced["classes.external_id"]++
+	}
+
+	for _, t := range textColumns {
+		for _, column := range t.columns {
+			n, err := scrubText(tx, f, t.table, column)
+			if err != nil {
+				return err
+			}
+			if n > 0 {
+				report.Replaced[t.table+"."+column] = n
+			}
+		}
+	}
+
+	// Имена файлов и содержимое-заглушка
+	var attachments []models.Attachment
+	if err := tx.Find(&attachments).Error; err != nil {
+		return err
+	}
+	sum := sha256.Sum256(placeholder)
+	for _, a := range attachments {
+		if err := tx.Model(&a).Updates(map[string]interface{}{
+			"file_name": fileName(a.ID, a.FileName),
+			"size":      len(placeholder),
+			"checksum":  hex.EncodeToString(sum[:]),
+		}).Error; err != nil {
+			return err
+		}
+		report.Replaced["attachments.file_name"]++
+	}
+	return nil
+}
+
+// scrubUsers заменяет ФИО, логины, почту, внешние коды и пароли пользователей.
+// Логин - роль и порядковый номер (teacher3), почта - логин на example.org.
+func scrubUsers(tx *gorm.DB, f *faker, opts Options, report *Report) error {
+	var users []models.User
+	if err := tx.Unscoped().Order("id").Find(&users).Error; err != nil {
+		return err
+	}
+	numbers := map[string]int{}
+	for _, u := range users {
+		numbers[u.Role]++
+		username := fmt.Sprintf("%s%d", u.Role, numbers[u.Role])
+		first, last, middle := f.name(u.FirstName, u.LastName, u.MiddleName)
+		values := map[string]interface{}{
+			"username":      username,
+			"email":         username + "@example.org",
+			"password_hash": opts.Password,
+			"first_name":    first,
+			"last_name":     last,
+			"middle_name":   middle,
+		}
+		if u.ExternalID != nil {
+			values["external_id"] = f.token("user", *u.ExternalID)
+		}
+		if err := tx.Unscoped().Model(&u).Updates(values).Error; err != nil {
+			return err
+		}
+	}
+	report.Replaced["users.name"] = len(users)
+	return nil
+}
+
+// scrubText заменяет непустые значения столбца
+func scrubText(tx *gorm.DB, f *faker, table, column string) (int, error) {
+	var rows []struct {
+		ID    uint
+		Value string
+	}
+	if err := tx.Table(table).
+		Select("id, " + column + " AS value").
+		Where(column + " IS NOT NULL AND " + column + " <> ''").
+		Scan(&rows).Error; err != nil {
+		return 0, err
+	}
+	for _, r := range rows {
+		if err := tx.Table(table).Where("id = ?", r.ID).Update(column, f.text(r.Value)).Error; err != nil {
+			return 0, err
+		}
+	}
+	return len(rows), nil
+}
+
+func emptyOr(value, fake string) string {
+	if strings.TrimSpace(value) == "" {
+		return ""
+	}
+	return fake
+}
+
+// placeholderStore отдаёт заглушку вместо любого файла вложения, а если files = false -
+// сообщает, что файла нет
+type placeholderStore struct {
+	files bool
+}
+
+func (placeholderStore) Name() string { return "placeholder" }
+
+func (s placeholderStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if !s.files {
+		return nil, storage.ErrNotFound
+	}
+	return io.NopCloser(bytes.NewReader(placeholder)), nil
+}
+
+func (placeholderStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	return errors.ErrUnsupported
+}
+
+func (placeholderStore) Delete(ctx context.Context, key string) error {
+	return errors.ErrUnsupported
+}
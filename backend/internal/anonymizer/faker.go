@@ -0,0 +1,183 @@
+package anonymizer
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	maleNames = []string{"Александр", "Алексей", "Андрей", "Артём", "Борис", "Вадим", "Виктор", "Владимир",
+		"Глеб", "Григорий", "Даниил", "Денис", "Дмитрий", "Егор", "Иван", "Игорь", "Кирилл", "Константин",
+		"Лев", "Максим", "Марк", "Матвей", "Михаил", "Никита", "Николай", "Олег", "Павел", "Роман",
+		"Сергей", "Степан", "Тимофей", "Фёдор", "Юрий", "Ярослав"}
+	femaleNames = []string{"Алина", "Алиса", "Анастасия", "Анна", "Валерия", "Варвара", "Вера", "Виктория",
+		"Галина", "Дарья", "Ева", "Екатерина", "Елена", "Елизавета", "Зоя", "Ирина", "Ксения", "Любовь",
+		"Маргарита", "Марина", "Мария", "Надежда", "Наталья", "Ольга", "Полина", "Светлана", "София",
+		"Таисия", "Татьяна", "Ульяна", "Юлия"}
+	// Фамилии в мужской форме; женская образуется окончанием
+	lastNames = []string{"Андреев", "Белов", "Богданов", "Виноградов", "Волков", "Воронцов", "Гаврилов",
+		"Голубев", "Громов", "Давыдов", "Егоров", "Жуков", "Зайцев", "Ильин", "Калинин", "Ковалёв",
+		"Комаров", "Крылов", "Лебедев", "Макаров", "Медведев", "Миронов", "Новиков", "Орлов", "Павлов",
+		"Поляков", "Романов", "Савельев", "Смирнов", "Соколов", "Степанов", "Тарасов", "Фёдоров",
+		"Фролов", "Чернов", "Шевцов", "Щербаков", "Яковлев", "Горский", "Полянский", "Соловьёв"}
+	// Отчества: мужская и женская форма
+	middleNames = [][2]string{{"Александрович", "Александровна"}, {"Андреевич", "Андреевна"},
+		{"Борисович", "Борисовна"}, {"Викторович", "Викторовна"}, {"Владимирович", "Владимировна"},
+		{"Дмитриевич", "Дмитриевна"}, {"Евгеньевич", "Евгеньевна"}, {"Иванович", "Ивановна"},
+		{"Игоревич", "Игоревна"}, {"Максимович", "Максимовна"}, {"Михайлович", "Михайловна"},
+		{"Николаевич", "Николаевна"}, {"Олегович", "Олеговна"}, {"Павлович", "Павловна"},
+		{"Петрович", "Петровна"}, {"Романович", "Романовна"}, {"Сергеевич", "Сергеевна"},
+		{"Юрьевич", "Юрьевна"}}
+	words = []string{"задание", "урок", "тема", "повторить", "параграф", "упражнение", "страница", "выполнить",
+		"письменно", "устно", "проверить", "решение", "задача", "правило", "пример", "работа", "тетрадь",
+		"контрольная", "подготовить", "выучить", "ответ", "вопрос", "таблица", "текст", "конспект",
+		"хорошо", "аккуратно", "внимательно", "ошибки", "исправить", "четверть", "класс", "занятие",
+		"самостоятельно", "стихотворение", "доклад", "презентация", "проект", "опыт", "схема", "вывод",
+		"и", "в", "на", "к", "по", "с", "до", "после", "все", "новый", "следующий", "итоговый"}
+)
+
+// faker заменяет значения вымышленными. Замена зависит только от исходного значения и
+// соли, поэтому одинаковые значения в копии тоже одинаковы (фамилия Петров у ученика и
+// Петрова у его матери становятся одной вымышленной фамилией в нужном роде), а по
+// вымышленному значению без соли нельзя подобрать исходное.
+type faker struct {
+	salt  string
+	texts map[string]string
+}
+
+func newFaker(salt string) *faker {
+	return &faker{salt: salt, texts: make(map[string]string)}
+}
+
+func (f *faker) hash(kind, value string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(f.salt))
+	h.Write([]byte{0})
+	h.Write([]byte(kind))
+	h.Write([]byte{0})
+	h.Write([]byte(value))
+	return h.Sum64()
+}
+
+func (f *faker) pick(kind, value string, list []string) string {
+	return list[f.hash(kind, value)%uint64(len(list))]
+}
+
+// female определяет род по отчеству, затем по имени и фамилии
+func female(first, last, middle string) bool {
+	switch {
+	case strings.HasSuffix(middle, "вна"), strings.HasSuffix(middle, "чна"), strings.HasSuffix(middle, "кызы"):
+		return true
+	case strings.HasSuffix(middle, "ич"), strings.HasSuffix(middle, "оглы"):
+		return false
+	}
+	for _, name := range []string{"Илья", "Никита", "Кузьма", "Фома", "Лука", "Савва"} {
+		if first == name {
+			return false
+		}
+	}
+	if strings.HasSuffix(first, "а") || strings.HasSuffix(first, "я") {
+		return true
+	}
+	return first == "" && (strings.HasSuffix(last, "ва") || strings.HasSuffix(last, "на") || strings.HasSuffix(last, "ая"))
+}
+
+// familyStem приводит фамилию к мужской форме, чтобы родственники получили одну фамилию
+func familyStem(last string) string {
+	switch {
+	case strings.HasSuffix(last, "ская"):
+		return strings.TrimSuffix(last, "ая") + "ий"
+	case strings.HasSuffix(last, "цкая"):
+		return strings.TrimSuffix(last, "ая") + "ий"
+	case strings.HasSuffix(last, "ова"), strings.HasSuffix(last, "ева"), strings.HasSuffix(last, "ёва"),
+		strings.HasSuffix(last, "ина"), strings.HasSuffix(last, "ына"):
+		return strings.TrimSuffix(last, "а")
+	}
+	return last
+}
+
+func feminine(last string) string {
+	if strings.HasSuffix(last, "ий") {
+		return strings.TrimSuffix(last, "ий") + "ая"
+	}
+	return last + "а"
+}
+
+// name возвращает вымышленные имя, фамилию и отчество. Пустые части остаются пустыми.
+func (f *faker) name(first, last, middle string) (string, string, string) {
+	isFemale := female(first, last, middle)
+	if first != "" {
+		if isFemale {
+			first = f.pick("first", first, femaleNames)
+		} else {
+			first = f.pick("first", first, maleNames)
+		}
+	}
+	if last != "" {
+		last = f.pick("last", strings.ToLower(familyStem(last)), lastNames)
+		if isFemale {
+			last = feminine(last)
+		}
+	}
+	if middle != "" {
+		stem := middle
+		for _, suffix := range []string{"ович", "евич", "овна", "евна", "ична", "ич", "на"} {
+			if strings.HasSuffix(stem, suffix) {
+				stem = strings.TrimSuffix(stem, suffix)
+				break
+			}
+		}
+		pair := middleNames[f.hash("middle", stem)%uint64(len(middleNames))]
+		middle = pair[0]
+		if isFemale {
+			middle = pair[1]
+		}
+	}
+	return first, last, middle
+}
+
+// text заменяет свободный текст набором слов примерно той же длины
+func (f *faker) text(value string) string {
+	if strings.TrimSpace(value) == "" {
+		return value
+	}
+	if fake, ok := f.texts[value]; ok {
+		return fake
+	}
+	length := utf8.RuneCountInString(value)
+	rng := rand.New(rand.NewSource(int64(f.hash("text", value))))
+	var b strings.Builder
+	n := 0
+	for n < length {
+		w := words[rng.Intn(len(words))]
+		if n == 0 {
+			r, size := utf8.DecodeRuneInString(w)
+			w = strings.ToUpper(string(r)) + w[size:]
+		} else {
+			b.WriteByte(' ')
+			n++
+		}
+		b.WriteString(w)
+		n += utf8.RuneCountInString(w)
+	}
+	fake := b.String()
+	if strings.HasSuffix(strings.TrimSpace(value), ".") || length > 40 {
+		fake += "."
+	}
+	f.texts[value] = fake
+	return fake
+}
+
+// token - вымышленный код (внешний ID и т.п.)
+func (f *faker) token(kind, value string) string {
+	return fmt.Sprintf("%s-%08x", kind, uint32(f.hash(kind, value)))
+}
+
+// fileName - имя файла вложения с исходным расширением
+func fileName(id uint, name string) string {
+	return fmt.Sprintf("file-%d%s", id, strings.ToLower(path.Ext(name)))
+}
@@ -0,0 +1,203 @@
+// Package audit ведёт журнал аудита: кто, когда и откуда создал, изменил или
+// удалил запись. Изменения перехватываются колбэками GORM, а автор, IP и ID
+// запроса берутся из контекста, который заполняет middleware. Изменения без
+// контекста запроса (фоновые задачи) записываются как системные.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+
+	"classkeeper/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Действия в журнале
+const (
+	ActionCreate    = "create"
+	ActionUpdate    = "update"
+	ActionDelete    = "delete"
+	ActionRestore   = "restore"   // Восстановление школы из архива
+	ActionAnonymize = "anonymize" // Обезличивание пользователя
+	ActionExport    = "export"    // Выгрузка персональных данных
+	ActionSeed      = "seed"      // Заполнение школы демонстрационными данными
+	ActionRepair    = "repair"    // Исправление проблем целостности данных
+)
+
+// Ограничения длины строковых полей записи
+const (
+	maxPathLength = 255
+	maxIPLength   = 45
+)
+
+// Scope - запрос, в рамках которого меняются данные
+type Scope struct {
+	RequestID string
+	IP        string
+	Method    string
+	Path      string
+	UserID    *uint
+	SchoolID  *uint
+	Role      string
+}
+
+// SetUser запоминает автора запроса после проверки токена
+func (s *Scope) SetUser(userID, schoolID uint, role string) {
+	s.UserID = &userID
+	s.SchoolID = &schoolID
+	s.Role = role
+}
+
+type scopeKey struct{}
+
+type skipKey struct{}
+
+type redactKey struct{}
+
+// NewContext возвращает контекст с описанием запроса
+func NewContext(ctx context.Context, scope *Scope) context.Context {
+	return context.WithValue(ctx, scopeKey{}, scope)
+}
+
+// FromContext возвращает описание запроса или nil, если изменения делает фоновая задача
+func FromContext(ctx context.Context) *Scope {
+	if ctx == nil {
+		return nil
+	}
+	scope, _ := ctx.Value(scopeKey{}).(*Scope)
+	return scope
+}
+
+// WithoutLog возвращает контекст, изменения в котором построчно не журналируются.
+// Нужен для массовых операций, о которых делается одна сводная запись (восстановление архива).
+func WithoutLog(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipKey{}, true)
+}
+
+func skipped(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	skip, _ := ctx.Value(skipKey{}).(bool)
+	return skip
+}
+
+// Change - значение поля до и после изменения. Для созданной записи есть только
+// New, для удалённой - только Old.
+type Change struct {
+	Old interface{} `json:"old,omitempty"`
+	New interface{} `json:"new,omitempty"`
+}
+
+// Record добавляет запись о действии, которое не сводится к изменению одной строки,
+// например о восстановлении школы из архива. Автор берётся из контекста db, и запись
+// видна в журнале его школы; schoolID - школа записи для действий без автора.
+func Record(db *gorm.DB, schoolID uint, action, entity string, entityID uint, changes map[string]Change) error {
+	entry := newEntry(FromContext(db.Statement.Context), action, entity)
+	if entry.SchoolID == nil {
+		entry.SchoolID = &schoolID
+	}
+	if entityID != 0 {
+		entry.EntityID = &entityID
+	}
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	entry.Changes = string(data)
+	return db.Create(&entry).Error
+}
+
+// Redact стирает значения полей fields (всех полей, если fields не заданы) в записях
+// журнала о строках entity с ID из ids, а для entity = users - ещё и IP-адреса в записях,
+// автором которых были эти пользователи. Остаются факт и время изменения и список полей.
+// Это единственный способ изменить журнал: он нужен для исполнения запроса на удаление
+// персональных данных.
+func Redact(db *gorm.DB, entity string, ids []uint, fields ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	tx := db.WithContext(context.WithValue(db.Statement.Context, redactKey{}, true))
+
+	var logs []models.AuditLog
+	if err := tx.Where("entity = ? AND entity_id IN ?", entity, ids).Find(&logs).Error; err != nil {
+		return err
+	}
+	only := map[string]bool{}
+	for _, f := range fields {
+		only[f] = true
+	}
+	for _, l := range logs {
+		var changes map[string]Change
+		if err := json.Unmarshal([]byte(l.Changes), &changes); err != nil {
+			continue
+		}
+		changed := false
+		for name, change := range changes {
+			if len(only) > 0 && !only[name] {
+				continue
+			}
+			if hasValue(change.Old) {
+				change.Old = redacted
+				changed = true
+			}
+			if hasValue(change.New) {
+				change.New = redacted
+				changed = true
+			}
+			changes[name] = change
+		}
+		if !changed {
+			continue
+		}
+		data, err := json.Marshal(changes)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&models.AuditLog{}).Where("id = ?", l.ID).Update("changes", string(data)).Error; err != nil {
+			return err
+		}
+	}
+
+	if entity != "users" {
+		return nil
+	}
+	return tx.Model(&models.AuditLog{}).Where("user_id IN ? AND ip <> ''", ids).Update("ip", "").Error
+}
+
+// hasValue - значение, которое нужно скрыть: не пустое и ещё не скрытое
+func hasValue(v interface{}) bool {
+	return v != nil && v != "" && v != redacted
+}
+
+func redacting(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	ok, _ := ctx.Value(redactKey{}).(bool)
+	return ok
+}
+
+// newEntry заполняет автора и запрос новой записи журнала
+func newEntry(scope *Scope, action, entity string) models.AuditLog {
+	entry := models.AuditLog{Action: action, Entity: entity}
+	if scope == nil {
+		return entry
+	}
+	entry.UserID = scope.UserID
+	entry.SchoolID = scope.SchoolID
+	entry.Role = scope.Role
+	entry.IP = truncate(scope.IP, maxIPLength)
+	entry.RequestID = scope.RequestID
+	entry.Method = scope.Method
+	entry.Path = truncate(scope.Path, maxPathLength)
+	return entry
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
@@ -0,0 +1,424 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"classkeeper/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// ErrAppendOnly - попытка изменить или удалить запись журнала
+var ErrAppendOnly = errors.New("audit log is append-only")
+
+const (
+	auditTable = "audit_logs"
+	beforeKey  = "audit:before"
+	redacted   = "[redacted]"
+)
+
+// ignoredTables не журналируются: сам журнал, служебные счётчики синхронизации,
+// история резервного копирования и личные уведомления пользователей
+var ignoredTables = map[string]bool{
+	auditTable:        true,
+	"sync_counters":   true,
+	"sync_tombstones": true,
+	"backup_runs":     true,
+	"notifications":   true,
+}
+
+// ignoredColumns не попадают в разницу: ID уже есть в записи журнала, остальные
+// меняются при каждом сохранении
+var ignoredColumns = map[string]bool{
+	"id":           true,
+	"created_at":   true,
+	"updated_at":   true,
+	"sync_seq":     true,
+	"last_used_at": true,
+}
+
+// secretColumns: вместо значений пишется только факт изменения
+var secretColumns = map[string]bool{
+	"password_hash": true,
+	"token_hash":    true,
+	"secret":        true,
+}
+
+// row - снимок строки таблицы: значения столбцов в JSON и первичный ключ
+type row struct {
+	values map[string]json.RawMessage
+	key    []interface{}
+}
+
+// Register подключает журнал к db: после каждого создания, изменения и удаления
+// в ту же транзакцию добавляются записи с разницей значений
+func Register(db *gorm.DB) error {
+	create, update, del := db.Callback().Create(), db.Callback().Update(), db.Callback().Delete()
+	for _, err := range []error{
+		create.After("gorm:after_create").Register("audit:after_create", afterCreate),
+		update.Before("gorm:update").Register("audit:before_update", beforeUpdate),
+		update.After("gorm:after_update").Register("audit:after_update", afterUpdate),
+		del.Before("gorm:delete").Register("audit:before_delete", beforeChange),
+		del.After("gorm:after_delete").Register("audit:after_delete", afterDelete),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tracked - нужно ли журналировать изменения этого запроса
+func tracked(db *gorm.DB) bool {
+	stmt := db.Statement
+	return db.Error == nil && stmt.Table != "" && !ignoredTables[stmt.Table] && !skipped(stmt.Context)
+}
+
+func afterCreate(db *gorm.DB) {
+	if !tracked(db) || db.Statement.RowsAffected == 0 {
+		return
+	}
+
+	var rows []row
+	var collect func(rv reflect.Value)
+	collect = func(rv reflect.Value) {
+		rv = reflect.Indirect(rv)
+		switch rv.Kind() {
+		case reflect.Struct:
+			if db.Statement.Schema != nil {
+				rows = append(rows, snapshot(db.Statement, rv))
+			}
+		case reflect.Map:
+			rows = append(rows, mapSnapshot(rv))
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < rv.Len(); i++ {
+				collect(rv.Index(i))
+			}
+		}
+	}
+	collect(db.Statement.ReflectValue)
+
+	pairs := make([][2]*row, len(rows))
+	for i := range rows {
+		pairs[i] = [2]*row{nil, &rows[i]}
+	}
+	write(db, ActionCreate, pairs)
+}
+
+// beforeUpdate пропускает только стирание значений журнала через Redact
+func beforeUpdate(db *gorm.DB) {
+	if db.Statement.Table == auditTable && redacting(db.Statement.Context) {
+		return
+	}
+	beforeChange(db)
+}
+
+// beforeChange запрещает менять журнал и запоминает строки, которые будут изменены или удалены
+func beforeChange(db *gorm.DB) {
+	if db.Error != nil {
+		return
+	}
+	if db.Statement.Table == auditTable {
+		db.AddError(ErrAppendOnly)
+		return
+	}
+	if !tracked(db) || db.Statement.Schema == nil {
+		return
+	}
+
+	conds := conditions(db.Statement)
+	if len(conds) == 0 {
+		// Без условий GORM сам откажется выполнять запрос
+		return
+	}
+	rows, err := load(db, db.Statement.Unscoped, conds)
+	if err != nil {
+		db.AddError(fmt.Errorf("audit: %w", err))
+		return
+	}
+	db.InstanceSet(beforeKey, rows)
+}
+
+func afterUpdate(db *gorm.DB) {
+	before := savedRows(db)
+	if !tracked(db) || len(before) == 0 {
+		return
+	}
+
+	keys := make([][]interface{}, 0, len(before))
+	for _, r := range before {
+		if r.key != nil {
+			keys = append(keys, r.key)
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+	column, values := schema.ToQueryValues(db.Statement.Table, db.Statement.Schema.PrimaryFieldDBNames, keys)
+	after, err := load(db, true, []clause.Expression{clause.IN{Column: column, Values: values}})
+	if err != nil {
+		db.AddError(fmt.Errorf("audit: %w", err))
+		return
+	}
+	byKey := make(map[string]*row, len(after))
+	for i := range after {
+		byKey[fmt.Sprint(after[i].key)] = &after[i]
+	}
+
+	var pairs [][2]*row
+	for i := range before {
+		if a, ok := byKey[fmt.Sprint(before[i].key)]; ok {
+			pairs = append(pairs, [2]*row{&before[i], a})
+		}
+	}
+	write(db, ActionUpdate, pairs)
+}
+
+func afterDelete(db *gorm.DB) {
+	before := savedRows(db)
+	if !tracked(db) || len(before) == 0 || db.Statement.RowsAffected == 0 {
+		return
+	}
+
+	pairs := make([][2]*row, len(before))
+	for i := range before {
+		pairs[i] = [2]*row{&before[i], nil}
+	}
+	write(db, ActionDelete, pairs)
+}
+
+func savedRows(db *gorm.DB) []row {
+	v, ok := db.InstanceGet(beforeKey)
+	if !ok {
+		return nil
+	}
+	rows, _ := v.([]row)
+	return rows
+}
+
+// conditions повторяет условия, по которым GORM выберет изменяемые строки:
+// WHERE запроса и первичные ключи переданной модели
+func conditions(stmt *gorm.Statement) []clause.Expression {
+	var conds []clause.Expression
+	if c, ok := stmt.Clauses["WHERE"]; ok {
+		if where, ok := c.Expression.(clause.Where); ok {
+			conds = append(conds, where.Exprs...)
+		}
+	}
+	if stmt.ReflectValue.IsValid() && len(stmt.Schema.PrimaryFields) > 0 {
+		switch stmt.ReflectValue.Kind() {
+		case reflect.Struct, reflect.Slice, reflect.Array:
+			_, keys := schema.GetIdentityFieldValuesMap(stmt.Context, stmt.ReflectValue, stmt.Schema.PrimaryFields)
+			if len(keys) > 0 {
+				column, values := schema.ToQueryValues(stmt.Table, stmt.Schema.PrimaryFieldDBNames, keys)
+				conds = append(conds, clause.IN{Column: column, Values: values})
+			}
+		}
+	}
+	return conds
+}
+
+// load читает строки таблицы запроса в той же транзакции
+func load(db *gorm.DB, unscoped bool, conds []clause.Expression) ([]row, error) {
+	stmt := db.Statement
+	dest := reflect.New(reflect.SliceOf(stmt.Schema.ModelType))
+	tx := db.Session(&gorm.Session{NewDB: true}).Table(stmt.Table).Clauses(clause.Where{Exprs: conds})
+	if unscoped {
+		tx = tx.Unscoped()
+	}
+	if err := tx.Find(dest.Interface()).Error; err != nil {
+		return nil, err
+	}
+
+	list := dest.Elem()
+	rows := make([]row, list.Len())
+	for i := range rows {
+		rows[i] = snapshot(stmt, list.Index(i))
+	}
+	return rows, nil
+}
+
+// snapshot снимает значения столбцов строки-структуры
+func snapshot(stmt *gorm.Statement, rv reflect.Value) row {
+	r := row{values: make(map[string]json.RawMessage, len(stmt.Schema.DBNames))}
+	for _, name := range stmt.Schema.DBNames {
+		value, _ := stmt.Schema.FieldsByDBName[name].ValueOf(stmt.Context, rv)
+		r.values[name] = marshal(value)
+	}
+	if len(stmt.Schema.PrimaryFields) > 0 {
+		r.key = make([]interface{}, len(stmt.Schema.PrimaryFields))
+		for i, field := range stmt.Schema.PrimaryFields {
+			r.key[i], _ = field.ValueOf(stmt.Context, rv)
+		}
+	}
+	return r
+}
+
+// mapSnapshot снимает значения строки, созданной из map (например, связь класса и ученика)
+func mapSnapshot(rv reflect.Value) row {
+	r := row{values: make(map[string]json.RawMessage, rv.Len())}
+	iter := rv.MapRange()
+	for iter.Next() {
+		r.values[fmt.Sprint(iter.Key().Interface())] = marshal(iter.Value().Interface())
+	}
+	return r
+}
+
+func marshal(value interface{}) json.RawMessage {
+	data, err := json.Marshal(value)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(value))
+	}
+	return data
+}
+
+// diff возвращает изменившиеся столбцы. Для созданной или удалённой строки
+// пустые (null) значения пропускаются.
+func diff(before, after *row) map[string]Change {
+	changes := make(map[string]Change)
+	add := func(name string) {
+		if ignoredColumns[name] {
+			return
+		}
+		if _, seen := changes[name]; seen {
+			return
+		}
+
+		var change Change
+		var old, new json.RawMessage
+		if before != nil {
+			old = before.values[name]
+		}
+		if after != nil {
+			new = after.values[name]
+		}
+		switch {
+		case before != nil && after != nil:
+			if bytes.Equal(old, new) {
+				return
+			}
+			change = Change{Old: old, New: new}
+		case before != nil:
+			if isNull(old) {
+				return
+			}
+			change = Change{Old: old}
+		default:
+			if isNull(new) {
+				return
+			}
+			change = Change{New: new}
+		}
+
+		if secretColumns[name] {
+			if change.Old != nil {
+				change.Old = redacted
+			}
+			if change.New != nil {
+				change.New = redacted
+			}
+		}
+		changes[name] = change
+	}
+
+	if before != nil {
+		for name := range before.values {
+			add(name)
+		}
+	}
+	if after != nil {
+		for name := range after.values {
+			add(name)
+		}
+	}
+	return changes
+}
+
+func isNull(value json.RawMessage) bool {
+	return len(value) == 0 || string(value) == "null"
+}
+
+// write добавляет записи журнала для пар строк (до, после) в транзакции запроса
+func write(db *gorm.DB, action string, pairs [][2]*row) {
+	if len(pairs) == 0 {
+		return
+	}
+
+	stmt := db.Statement
+	scope := FromContext(stmt.Context)
+	entries := make([]models.AuditLog, 0, len(pairs))
+	for _, pair := range pairs {
+		changes := diff(pair[0], pair[1])
+		if len(changes) == 0 {
+			continue
+		}
+		data, err := json.Marshal(changes)
+		if err != nil {
+			db.AddError(fmt.Errorf("audit: %w", err))
+			return
+		}
+
+		entry := newEntry(scope, action, stmt.Table)
+		entry.Changes = string(data)
+		current := pair[1]
+		if current == nil {
+			current = pair[0]
+		}
+		if id, ok := uintValue(current.key); ok {
+			entry.EntityID = &id
+		}
+		// Школа самой записи надёжнее школы автора: пользователь регистрируется без
+		// токена, а фоновые задачи работают со всеми школами
+		if id, ok := columnUint(current, "school_id"); ok {
+			entry.SchoolID = &id
+		} else if stmt.Table == "schools" && entry.EntityID != nil {
+			id := *entry.EntityID
+			entry.SchoolID = &id
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) == 0 {
+		return
+	}
+
+	if err := db.Session(&gorm.Session{NewDB: true}).Create(&entries).Error; err != nil {
+		db.AddError(fmt.Errorf("audit: %w", err))
+	}
+}
+
+// uintValue возвращает простой числовой первичный ключ
+func uintValue(key []interface{}) (uint, bool) {
+	if len(key) != 1 {
+		return 0, false
+	}
+	switch v := key[0].(type) {
+	case uint:
+		return v, v != 0
+	case uint64:
+		return uint(v), v != 0
+	case int:
+		return uint(v), v > 0
+	case int64:
+		return uint(v), v > 0
+	}
+	return 0, false
+}
+
+func columnUint(r *row, name string) (uint, bool) {
+	raw, ok := r.values[name]
+	if !ok || isNull(raw) {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(string(raw), 10, 64)
+	if err != nil || n == 0 {
+		return 0, false
+	}
+	return uint(n), true
+}
@@ -0,0 +1,385 @@
+// Package backup - полный архив данных одной школы: строки всех таблиц школы
+// в формате JSON Lines, файлы вложений и манифест с контрольными суммами.
+// Архив восстанавливается как новая школа с перенумерацией всех ID, поэтому
+// подходит и для переноса школы в другой экземпляр, и для восстановления после сбоя.
+package backup
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"classkeeper/internal/models"
+	"classkeeper/internal/storage"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	// Format - идентификатор формата архива в манифесте
+	Format = "classkeeper-school-backup"
+	// Version - версия формата. Восстановление принимает архивы версии не выше текущей.
+	Version = 1
+
+	manifestName = "manifest.json"
+)
+
+// Manifest описывает содержимое архива
+type Manifest struct {
+	Format    string     `json:"format"`
+	Version   int        `json:"version"`
+	CreatedAt time.Time  `json:"created_at"`
+	Database  string     `json:"database"` // sqlite, postgres
+	School    SchoolInfo `json:"school"`
+	Files     []File     `json:"files"`
+	// Вложения, файлов которых не оказалось в хранилище при создании архива
+	MissingFiles []uint `json:"missing_files,omitempty"`
+}
+
+// SchoolInfo - школа, из которой сделан архив
+type SchoolInfo struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+// File - файл архива: таблица или содержимое вложения
+type File struct {
+	Path   string `json:"path"`
+	Table  string `json:"table,omitempty"`
+	Rows   int    `json:"rows,omitempty"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// table описывает таблицу школы в архиве
+type table struct {
+	name  string
+	model interface{}
+	// scope - условие выборки строк школы, параметры - ID школы
+	scope string
+	// refs - колонки со ссылками на строки других таблиц архива
+	refs map[string]string
+	// urls - колонки со ссылкой на скачивание вложения
+	urls []string
+	// prepare вызывается перед вставкой восстановленной строки; false - строка пропускается
+	prepare func(r *restorer, row interface{}, oldID uint) (bool, error)
+}
+
+// Связующие таблицы many2many, у которых нет своих моделей
+type classStudent struct {
+	ClassID uint `gorm:"primaryKey"`
+	UserID  uint `gorm:"primaryKey"`
+}
+
+func (classStudent) TableName() string { return "class_students" }
+
+type teacherSubject struct {
+	SubjectID uint `gorm:"primaryKey"`
+	UserID    uint `gorm:"primaryKey"`
+}
+
+func (teacherSubject) TableName() string { return "teachers_subjects" }
+
+const (
+	schoolClasses   = "(SELECT id FROM classes WHERE school_id = ?)"
+	schoolUsers     = "(SELECT id FROM users WHERE school_id = ?)"
+	schoolHomeworks = "(SELECT id FROM homeworks WHERE class_id IN " + schoolClasses + ")"
+	schoolSchedules = "(SELECT id FROM schedules WHERE class_id IN " + schoolClasses + ")"
+)
+
+// tables - таблицы школы в порядке восстановления: каждая таблица ссылается только
+// на предыдущие (кроме schools.admin_id, который заполняется после пользователей).
+// Ленты календаря и сеансы самостоятельной отметки не переносятся: это личные
+// токены и короткоживущие данные.
+var tables = []*table{
+	{name: "schools", model: &models.School{}, scope: "id = ?",
+		refs: map[string]string{"admin_id": "users"}, urls: []string{"logo_url"}},
+	{name: "users", model: &models.User{}, scope: "school_id = ?",
+		refs: map[string]string{"school_id": "schools"}, urls: []string{"avatar_url"}, prepare: prepareUser},
+	{name: "subjects", model: &models.Subject{}, scope: "school_id = ?",
+		refs: map[string]string{"school_id": "schools"}},
+	{name: "classes", model: &models.Class{}, scope: "school_id = ?",
+		refs: map[string]string{"school_id": "schools", "homeroom_teacher_id": "users", "starosta_id": "users"}},
+	{name: "class_students", model: &classStudent{}, scope: "class_id IN " + schoolClasses,
+		refs: map[string]string{"class_id": "classes", "user_id": "users"}},
+	{name: "teachers_subjects", model: &teacherSubject{}, scope: "subject_id IN (SELECT id FROM subjects WHERE school_id = ?)",
+		refs: map[string]string{"subject_id": "subjects", "user_id": "users"}},
+	{name: "schedules", model: &models.Schedule{}, scope: "class_id IN " + schoolClasses,
+		refs: map[string]string{"class_id": "classes", "subject_id": "subjects", "teacher_id": "users"}},
+	{name: "calendar_events", model: &models.CalendarEvent{}, scope: "school_id = ?",
+		refs: map[string]string{"school_id": "schools", "class_id": "classes"}},
+	{name: "absence_notices", model: &models.AbsenceNotice{}, scope: "class_id IN " + schoolClasses,
+		refs: map[string]string{"student_id": "users", "class_id": "classes", "submitted_by": "users", "reviewed_by": "users"}},
+	{name: "homework_templates", model: &models.HomeworkTemplate{}, scope: "school_id = ?",
+		refs: map[string]string{"school_id": "schools", "subject_id": "subjects", "teacher_id": "users"}},
+	{name: "homework_recurrences", model: &models.HomeworkRecurrence{}, scope: "class_id IN " + schoolClasses,
+		refs: map[string]string{"template_id": "homework_templates", "class_id": "classes", "teacher_id": "users"}},
+	{name: "homeworks", model: &models.Homework{}, scope: "class_id IN " + schoolClasses,
+		refs: map[string]string{"class_id": "classes", "subject_id": "subjects", "teacher_id": "users",
+			"template_id": "homework_templates", "recurrence_id": "homework_recurrences"}},
+	{name: "grades", model: &models.Grade{}, scope: "student_id IN " + schoolUsers,
+		refs: map[string]string{"student_id": "users", "subject_id": "subjects", "teacher_id": "users"}, prepare: prepareClientID},
+	{name: "homework_submissions", model: &models.HomeworkSubmission{}, scope: "homework_id IN " + schoolHomeworks,
+		refs: map[string]string{"homework_id": "homeworks", "student_id": "users", "reviewed_by": "users", "grade_id": "grades"}},
+	{name: "attendances", model: &models.Attendance{}, scope: "class_id IN " + schoolClasses,
+		refs: map[string]string{"student_id": "users", "class_id": "classes", "schedule_id": "schedules",
+			"subject_id": "subjects", "marked_by": "users", "excuse_id": "absence_notices"}, prepare: prepareClientID},
+	{name: "announcements", model: &models.Announcement{}, scope: "school_id = ?",
+		refs: map[string]string{"school_id": "schools", "author_id": "users", "target_class_id": "classes"}},
+	{name: "parent_students", model: &models.ParentStudent{}, scope: "student_id IN " + schoolUsers,
+		refs: map[string]string{"parent_id": "users", "student_id": "users"}},
+	{name: "lesson_registers", model: &models.LessonRegister{}, scope: "schedule_id IN " + schoolSchedules,
+		refs: map[string]string{"schedule_id": "schedules", "taken_by": "users"}},
+	{name: "homework_load_limits", model: &models.HomeworkLoadLimit{}, scope: "school_id = ?",
+		refs: map[string]string{"school_id": "schools"}},
+	{name: "alert_rules", model: &models.AlertRule{}, scope: "school_id = ?",
+		refs: map[string]string{"school_id": "schools", "subject_id": "subjects", "created_by": "users"}},
+	{name: "student_alerts", model: &models.StudentAlert{}, scope: "school_id = ?",
+		refs: map[string]string{"school_id": "schools", "rule_id": "alert_rules", "student_id": "users", "class_id": "classes",
+			"subject_id": "subjects", "assigned_to": "users", "acknowledged_by": "users", "resolved_by": "users"}},
+	{name: "notifications", model: &models.Notification{}, scope: "user_id IN " + schoolUsers,
+		refs: map[string]string{"user_id": "users"}, prepare: prepareNotification},
+	{name: "report_card_comments", model: &models.ReportCardComment{}, scope: "student_id IN " + schoolUsers,
+		refs: map[string]string{"student_id": "users", "subject_id": "subjects", "teacher_id": "users"}},
+	{name: "attachments", model: &models.Attachment{}, scope: "school_id = ?",
+		refs: map[string]string{"school_id": "schools", "uploaded_by": "users"}, prepare: prepareAttachment},
+}
+
+// Tables возвращает имена таблиц, входящих в архив
+func Tables() []string {
+	names := make([]string, len(tables))
+	for i, t := range tables {
+		names[i] = t.name
+	}
+	return names
+}
+
+// Model возвращает модель таблицы архива
+func Model(name string) (interface{}, bool) {
+	for _, t := range tables {
+		if t.name == name {
+			return t.model, true
+		}
+	}
+	return nil, false
+}
+
+// Reference - колонка таблицы со ссылкой на строку другой таблицы
+type Reference struct {
+	Table  string
+	Column string
+	Target string
+}
+
+// References возвращает ссылки между таблицами архива в порядке таблиц
+func References() []Reference {
+	var refs []Reference
+	for _, t := range tables {
+		columns := make([]string, 0, len(t.refs))
+		for column := range t.refs {
+			columns = append(columns, column)
+		}
+		sort.Strings(columns)
+		for _, column := range columns {
+			refs = append(refs, Reference{Table: t.name, Column: column, Target: t.refs[column]})
+		}
+	}
+	return refs
+}
+
+// SchoolScope возвращает условие выборки строк школы из таблицы архива (включая
+// удалённые строки). Все параметры условия - ID школы.
+func SchoolScope(name string) (string, bool) {
+	for _, t := range tables {
+		if t.name == name {
+			return t.scope, true
+		}
+	}
+	return "", false
+}
+
+// schemaCache - разобранные схемы моделей
+var schemaCache = &sync.Map{}
+
+func parseSchema(db *gorm.DB, model interface{}) (*schema.Schema, error) {
+	return schema.Parse(model, schemaCache, db.NamingStrategy)
+}
+
+func dataPath(name string) string {
+	return "data/" + name + ".jsonl"
+}
+
+func attachmentPath(id uint) string {
+	return fmt.Sprintf("attachments/%d", id)
+}
+
+// FileName возвращает имя файла архива
+func FileName(m *Manifest) string {
+	return fmt.Sprintf("classkeeper-school-%d-%s.zip", m.School.ID, m.CreatedAt.Format("20060102-150405"))
+}
+
+// Export записывает в w архив школы schoolID. Выгружаются и удалённые (soft delete)
+// записи. Вложения, файлов которых нет в хранилище, перечисляются в MissingFiles.
+func Export(ctx context.Context, db *gorm.DB, store storage.Backend, schoolID uint, w io.Writer) (*Manifest, error) {
+	var school models.School
+	if err := db.Unscoped().First(&school, schoolID).Error; err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{
+		Format:    Format,
+		Version:   Version,
+		CreatedAt: time.Now(),
+		Database:  db.Dialector.Name(),
+		School:    SchoolInfo{ID: school.ID, Name: school.Name},
+	}
+
+	zw := zip.NewWriter(w)
+	for _, t := range tables {
+		file, err := exportTable(ctx, db, zw, t, schoolID)
+		if err != nil {
+			return nil, fmt.Errorf("export %s: %w", t.name, err)
+		}
+		manifest.Files = append(manifest.Files, *file)
+	}
+
+	var attachments []models.Attachment
+	if err := db.Where("school_id = ?", schoolID).Order("id").Find(&attachments).Error; err != nil {
+		return nil, err
+	}
+	for _, attachment := range attachments {
+		file, err := exportAttachment(ctx, zw, store, &attachment)
+		if errors.Is(err, storage.ErrNotFound) {
+			manifest.MissingFiles = append(manifest.MissingFiles, attachment.ID)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("export attachment %d: %w", attachment.ID, err)
+		}
+		manifest.Files = append(manifest.Files, *file)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: manifestName, Method: zip.Deflate, Modified: manifest.CreatedAt})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// exportTable записывает строки таблицы по одному JSON-объекту "колонка: значение" на строку
+func exportTable(ctx context.Context, db *gorm.DB, zw *zip.Writer, t *table, schoolID uint) (*File, error) {
+	sch, err := parseSchema(db, t.model)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &File{Path: dataPath(t.name), Table: t.name}
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: file.Path, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return nil, err
+	}
+	out := newHashWriter(fw)
+
+	args := make([]interface{}, strings.Count(t.scope, "?"))
+	for i := range args {
+		args[i] = schoolID
+	}
+	rows, err := db.Unscoped().Model(t.model).
+		Where(t.scope, args...).
+		Order(strings.Join(sch.PrimaryFieldDBNames, ", ")).
+		Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		value := reflect.New(sch.ModelType)
+		if err := db.ScanRows(rows, value.Interface()); err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{}, len(sch.DBNames))
+		for _, name := range sch.DBNames {
+			row[name] = sch.FieldsByDBName[name].ReflectValueOf(ctx, value.Elem()).Interface()
+		}
+		line, err := json.Marshal(row)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := out.Write(append(line, '\n')); err != nil {
+			return nil, err
+		}
+		file.Rows++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	file.Size, file.SHA256 = out.size, out.sum()
+	return file, nil
+}
+
+// exportAttachment копирует в архив содержимое вложения из хранилища
+func exportAttachment(ctx context.Context, zw *zip.Writer, store storage.Backend, attachment *models.Attachment) (*File, error) {
+	reader, err := store.Get(ctx, attachment.StorageKey)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	file := &File{Path: attachmentPath(attachment.ID)}
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: file.Path, Method: zip.Deflate, Modified: attachment.CreatedAt})
+	if err != nil {
+		return nil, err
+	}
+	out := newHashWriter(fw)
+	if _, err := io.Copy(out, reader); err != nil {
+		return nil, err
+	}
+	file.Size, file.SHA256 = out.size, out.sum()
+	return file, nil
+}
+
+// hashWriter считает размер и SHA-256 записанных данных
+type hashWriter struct {
+	w      io.Writer
+	digest hash.Hash
+	size   int64
+}
+
+func newHashWriter(w io.Writer) *hashWriter {
+	return &hashWriter{w: w, digest: sha256.New()}
+}
+
+func (h *hashWriter) Write(p []byte) (int, error) {
+	n, err := h.w.Write(p)
+	h.digest.Write(p[:n])
+	h.size += int64(n)
+	return n, err
+}
+
+func (h *hashWriter) sum() string {
+	return hex.EncodeToString(h.digest.Sum(nil))
+}
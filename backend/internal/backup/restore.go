@@ -0,0 +1,609 @@
+package backup
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"classkeeper/internal/audit"
+	"classkeeper/internal/models"
+	"classkeeper/internal/storage"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+var (
+	// ErrInvalidArchive - файл не является архивом школы или повреждён
+	ErrInvalidArchive = errors.New("invalid backup archive")
+	// ErrUnsupportedVersion - архив создан более новой версией программы
+	ErrUnsupportedVersion = errors.New("unsupported backup version")
+	// ErrChecksum - содержимое файла архива не совпадает с манифестом
+	ErrChecksum = errors.New("backup checksum mismatch")
+	// ErrConflicts - логины или email пользователей архива уже заняты
+	ErrConflicts = errors.New("usernames or emails from the backup are already taken")
+
+	// errDryRun откатывает транзакцию проверки
+	errDryRun = errors.New("dry run")
+)
+
+// Options - параметры восстановления
+type Options struct {
+	// DryRun - только проверить архив: восстановление выполняется в транзакции,
+	// которая откатывается, файлы вложений в хранилище не записываются
+	DryRun bool
+	// RenameConflicts - переименовывать пользователей, чьи логин или email уже заняты.
+	// Без этого при конфликтах восстановление завершается ErrConflicts.
+	RenameConflicts bool
+}
+
+// Report - результат восстановления или проверки архива
+type Report struct {
+	DryRun          bool          `json:"dry_run"`
+	Source          SchoolInfo    `json:"source"`
+	BackupCreatedAt time.Time     `json:"backup_created_at"`
+	BackupVersion   int           `json:"backup_version"`
+	SchoolID        uint          `json:"school_id,omitempty"` // ID восстановленной школы
+	Tables          []TableReport `json:"tables"`
+	Files           int           `json:"files"`
+	FileBytes       int64         `json:"file_bytes"`
+	Conflicts       []Conflict    `json:"conflicts,omitempty"`
+	Warnings        []string      `json:"warnings,omitempty"`
+}
+
+// TableReport - строки одной таблицы
+type TableReport struct {
+	Table    string `json:"table"`
+	Rows     int    `json:"rows"`
+	Imported int    `json:"imported"`
+	Skipped  int    `json:"skipped,omitempty"`
+}
+
+// Conflict - значение уникального поля, которое уже занято в этом экземпляре
+type Conflict struct {
+	Table     string `json:"table"`
+	SourceID  uint   `json:"source_id"`
+	Field     string `json:"field"`
+	Value     string `json:"value"`
+	RenamedTo string `json:"renamed_to"`
+}
+
+// pendingRef - ссылка, которую можно заполнить только после восстановления целевой таблицы
+type pendingRef struct {
+	table  *table
+	id     uint
+	column string
+	target string
+	old    uint
+}
+
+type restorer struct {
+	ctx      context.Context
+	tx       *gorm.DB
+	store    storage.Backend
+	files    map[string]*zip.File
+	opts     Options
+	report   *Report
+	schoolID uint
+
+	ids        map[string]map[uint]uint // таблица -> ID в архиве -> новый ID
+	done       map[string]bool
+	pending    []pendingRef // Ссылки на таблицы, восстановленные позже, и на вложения
+	unresolved map[string]int
+	clientIDs  int
+	written    []string // Ключи записанных в хранилище файлов - удаляются при откате
+}
+
+// Restore восстанавливает архив как новую школу. Все ID перенумеровываются, ссылки
+// на строки вне архива обнуляются (или строка пропускается, если ссылка обязательна).
+// Перед импортом проверяются формат, версия и контрольные суммы всех файлов.
+// При ошибке восстановление откатывается целиком, а записанные файлы удаляются.
+// В журнал аудита попадает одна запись о восстановлении, а не каждая строка.
+func Restore(ctx context.Context, db *gorm.DB, store storage.Backend, archive io.ReaderAt, size int64, opts Options) (*Report, error) {
+	zr, err := zip.NewReader(archive, size)
+	if err != nil {
+		return nil, ErrInvalidArchive
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	manifest, err := readManifest(files)
+	if err != nil {
+		return nil, err
+	}
+	// Дальше используются только проверенные файлы из манифеста
+	files, err = verify(manifest, files)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		DryRun:          opts.DryRun,
+		Source:          manifest.School,
+		BackupCreatedAt: manifest.CreatedAt,
+		BackupVersion:   manifest.Version,
+	}
+	r := &restorer{
+		ctx:        ctx,
+		store:      store,
+		files:      files,
+		opts:       opts,
+		report:     report,
+		ids:        make(map[string]map[uint]uint),
+		done:       make(map[string]bool),
+		unresolved: make(map[string]int),
+	}
+	if len(manifest.MissingFiles) > 0 {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("%d attachments had no file when the backup was made and are skipped", len(manifest.MissingFiles)))
+	}
+
+	err = db.WithContext(audit.WithoutLog(ctx)).Transaction(func(tx *gorm.DB) error {
+		r.tx = tx
+		for _, t := range tables {
+			if err := r.restoreTable(t); err != nil {
+				return err
+			}
+		}
+		if err := r.finish(); err != nil {
+			return err
+		}
+		if opts.DryRun {
+			return errDryRun
+		}
+		if len(report.Conflicts) > 0 && !opts.RenameConflicts {
+			return ErrConflicts
+		}
+		return audit.Record(tx, report.SchoolID, audit.ActionRestore, "schools", report.SchoolID, map[string]audit.Change{
+			"source_school_id":  {New: manifest.School.ID},
+			"source_school":     {New: manifest.School.Name},
+			"backup_created_at": {New: manifest.CreatedAt},
+		})
+	})
+	r.summarize()
+
+	if errors.Is(err, errDryRun) {
+		report.SchoolID = 0
+		return report, nil
+	}
+	if err != nil {
+		for _, key := range r.written {
+			store.Delete(context.Background(), key)
+		}
+		report.SchoolID = 0
+		return report, err
+	}
+	return report, nil
+}
+
+// readManifest читает и проверяет манифест архива
+func readManifest(files map[string]*zip.File) (*Manifest, error) {
+	f, ok := files[manifestName]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s not found", ErrInvalidArchive, manifestName)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	defer rc.Close()
+
+	var manifest Manifest
+	if err := json.NewDecoder(rc).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	if manifest.Format != Format {
+		return nil, fmt.Errorf("%w: unknown format %q", ErrInvalidArchive, manifest.Format)
+	}
+	if manifest.Version < 1 || manifest.Version > Version {
+		return nil, fmt.Errorf("%w: %d (supported up to %d)", ErrUnsupportedVersion, manifest.Version, Version)
+	}
+	return &manifest, nil
+}
+
+// verify сверяет размеры и контрольные суммы файлов с манифестом
+func verify(manifest *Manifest, files map[string]*zip.File) (map[string]*zip.File, error) {
+	verified := make(map[string]*zip.File, len(manifest.Files))
+	for _, file := range manifest.Files {
+		f, ok := files[file.Path]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s not found", ErrInvalidArchive, file.Path)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidArchive, file.Path, err)
+		}
+		hash := sha256.New()
+		n, err := io.Copy(hash, rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidArchive, file.Path, err)
+		}
+		if n != file.Size || hex.EncodeToString(hash.Sum(nil)) != file.SHA256 {
+			return nil, fmt.Errorf("%w: %s", ErrChecksum, file.Path)
+		}
+		verified[file.Path] = f
+	}
+	return verified, nil
+}
+
+// restoreTable вставляет строки таблицы, заменяя ссылки на новые ID
+func (r *restorer) restoreTable(t *table) error {
+	r.done[t.name] = true
+	r.ids[t.name] = make(map[uint]uint)
+	tr := TableReport{Table: t.name}
+	defer func() { r.report.Tables = append(r.report.Tables, tr) }()
+
+	// Таблицы нет в архиве более старой версии
+	f, ok := r.files[dataPath(t.name)]
+	if !ok {
+		return nil
+	}
+
+	sch, err := parseSchema(r.tx, t.model)
+	if err != nil {
+		return err
+	}
+	var idField *schema.Field
+	if sch.PrioritizedPrimaryField != nil && sch.PrioritizedPrimaryField.DBName == "id" {
+		idField = sch.PrioritizedPrimaryField
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	defer rc.Close()
+
+	unknown := make(map[string]bool)
+	scanner := bufio.NewScanner(rc)
+	scanner.Buffer(make([]byte, 64*1024), 64<<20)
+	for line := 1; scanner.Scan(); line++ {
+		var raw map[string]json.RawMessage
+		if err := json.Unmarshal(scanner.Bytes(), &raw); err != nil {
+			return fmt.Errorf("%w: %s line %d: %v", ErrInvalidArchive, f.Name, line, err)
+		}
+		tr.Rows++
+
+		value := reflect.New(sch.ModelType)
+		for column, data := range raw {
+			field, ok := sch.FieldsByDBName[column]
+			if !ok {
+				unknown[column] = true
+				continue
+			}
+			dest := field.ReflectValueOf(r.ctx, value.Elem()).Addr().Interface()
+			if err := json.Unmarshal(data, dest); err != nil {
+				return fmt.Errorf("%w: %s line %d: %s: %v", ErrInvalidArchive, f.Name, line, column, err)
+			}
+		}
+
+		var oldID uint
+		if idField != nil {
+			oldID = uint(idField.ReflectValueOf(r.ctx, value.Elem()).Uint())
+		}
+		deferred, ok := r.remap(t, sch, value.Elem())
+		if !ok {
+			tr.Skipped++
+			continue
+		}
+		if t.prepare != nil {
+			ok, err := t.prepare(r, value.Interface(), oldID)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				tr.Skipped++
+				continue
+			}
+		}
+
+		if idField != nil {
+			idField.ReflectValueOf(r.ctx, value.Elem()).SetUint(0)
+		}
+		if err := r.tx.Omit(clause.Associations).Create(value.Interface()).Error; err != nil {
+			return fmt.Errorf("restore %s #%d: %w", t.name, oldID, err)
+		}
+		tr.Imported++
+
+		if idField == nil {
+			continue
+		}
+		newID := uint(idField.ReflectValueOf(r.ctx, value.Elem()).Uint())
+		r.ids[t.name][oldID] = newID
+		if t.name == "schools" {
+			r.schoolID = newID
+			r.report.SchoolID = newID
+		}
+		for _, ref := range deferred {
+			ref.id = newID
+			r.pending = append(r.pending, ref)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidArchive, f.Name, err)
+	}
+
+	if len(unknown) > 0 {
+		columns := make([]string, 0, len(unknown))
+		for column := range unknown {
+			columns = append(columns, column)
+		}
+		sort.Strings(columns)
+		r.report.Warnings = append(r.report.Warnings, fmt.Sprintf("%s: unknown columns ignored: %s", t.name, strings.Join(columns, ", ")))
+	}
+	return nil
+}
+
+// remap заменяет ссылки строки на новые ID. Возвращает ссылки, которые заполняются
+// после восстановления целевых таблиц, и false, если обязательная ссылка указывает
+// на строку вне архива.
+func (r *restorer) remap(t *table, sch *schema.Schema, row reflect.Value) ([]pendingRef, bool) {
+	var deferred []pendingRef
+	for column, target := range t.refs {
+		field := sch.FieldsByDBName[column]
+		value := field.ReflectValueOf(r.ctx, row)
+		nullable := value.Kind() == reflect.Ptr
+		if nullable && value.IsNil() {
+			continue
+		}
+		old := uint(reflect.Indirect(value).Uint())
+		if old == 0 {
+			continue
+		}
+
+		// Целевая таблица восстанавливается позже: ссылка заполняется в finish
+		if !r.done[target] {
+			deferred = append(deferred, pendingRef{table: t, column: column, target: target, old: old})
+			value.Set(reflect.Zero(value.Type()))
+			continue
+		}
+
+		newID, ok := r.ids[target][old]
+		if !ok {
+			r.unresolved[t.name+"."+column]++
+			if !nullable {
+				return nil, false
+			}
+			value.Set(reflect.Zero(value.Type()))
+			continue
+		}
+		if nullable {
+			value.Set(reflect.ValueOf(&newID))
+		} else {
+			value.SetUint(uint64(newID))
+		}
+	}
+
+	for _, column := range t.urls {
+		value := sch.FieldsByDBName[column].ReflectValueOf(r.ctx, row)
+		if id, ok := attachmentURLID(value.String()); ok {
+			deferred = append(deferred, pendingRef{table: t, column: column, target: "attachments", old: id})
+			value.SetString("")
+		}
+	}
+	return deferred, true
+}
+
+// finish заполняет отложенные ссылки и ссылки на вложения
+func (r *restorer) finish() error {
+	for _, ref := range r.pending {
+		newID, ok := r.ids[ref.target][ref.old]
+		if !ok {
+			r.unresolved[ref.table.name+"."+ref.column]++
+			continue
+		}
+		var value interface{} = newID
+		if ref.target == "attachments" {
+			var attachment models.Attachment
+			if err := r.tx.Select("id, checksum").First(&attachment, newID).Error; err != nil {
+				return err
+			}
+			value = storage.ImageURL(attachment.ID, attachment.Checksum)
+		}
+		if err := r.tx.Table(ref.table.name).Where("id = ?", ref.id).Update(ref.column, value).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// summarize добавляет в отчёт предупреждения о потерянных ссылках
+func (r *restorer) summarize() {
+	columns := make([]string, 0, len(r.unresolved))
+	for column := range r.unresolved {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	for _, column := range columns {
+		r.report.Warnings = append(r.report.Warnings,
+			fmt.Sprintf("%s: %d references to rows outside the backup were cleared or skipped", column, r.unresolved[column]))
+	}
+	if r.clientIDs > 0 {
+		r.report.Warnings = append(r.report.Warnings,
+			fmt.Sprintf("%d offline client IDs are already used in this instance and were cleared", r.clientIDs))
+	}
+}
+
+// taken проверяет, занято ли значение уникальной колонки (с учётом удалённых записей)
+func (r *restorer) taken(table, column, value string) (bool, error) {
+	var count int64
+	err := r.tx.Table(table).Where(column+" = ?", value).Count(&count).Error
+	return count > 0, err
+}
+
+// prepareUser переименовывает пользователя, чьи логин или email уже заняты
+func prepareUser(r *restorer, row interface{}, oldID uint) (bool, error) {
+	user := row.(*models.User)
+	for _, f := range []struct {
+		column string
+		value  *string
+	}{{"username", &user.Username}, {"email", &user.Email}} {
+		taken, err := r.taken("users", f.column, *f.value)
+		if err != nil || !taken {
+			if err != nil {
+				return false, err
+			}
+			continue
+		}
+
+		renamed := *f.value
+		for i := 0; taken; i++ {
+			renamed = renameValue(f.column, *f.value, r.schoolID, i)
+			if taken, err = r.taken("users", f.column, renamed); err != nil {
+				return false, err
+			}
+		}
+		r.report.Conflicts = append(r.report.Conflicts, Conflict{
+			Table: "users", SourceID: oldID, Field: f.column, Value: *f.value, RenamedTo: renamed,
+		})
+		*f.value = renamed
+	}
+	return true, nil
+}
+
+// renameValue добавляет к логину или email номер новой школы: ivanov -> ivanov.12,
+// ivanov@school.ru -> ivanov+12@school.ru
+func renameValue(column, value string, schoolID uint, attempt int) string {
+	suffix := strconv.FormatUint(uint64(schoolID), 10)
+	if attempt > 0 {
+		suffix += "-" + strconv.Itoa(attempt)
+	}
+	if column == "email" {
+		if at := strings.LastIndex(value, "@"); at > 0 {
+			return value[:at] + "+" + suffix + value[at:]
+		}
+	}
+	if len(value)+len(suffix)+1 > 50 {
+		value = value[:50-len(suffix)-1]
+	}
+	return value + "." + suffix
+}
+
+// prepareClientID очищает ID офлайн-клиента, если он уже используется в этом экземпляре
+func prepareClientID(r *restorer, row interface{}, oldID uint) (bool, error) {
+	var table string
+	var clientID **string
+	switch v := row.(type) {
+	case *models.Grade:
+		table, clientID = "grades", &v.ClientID
+	case *models.Attendance:
+		table, clientID = "attendances", &v.ClientID
+	default:
+		return true, nil
+	}
+	if *clientID == nil {
+		return true, nil
+	}
+	taken, err := r.taken(table, "client_id", **clientID)
+	if err != nil {
+		return false, err
+	}
+	if taken {
+		*clientID = nil
+		r.clientIDs++
+	}
+	return true, nil
+}
+
+// prepareNotification заменяет ссылку уведомления о предупреждении
+func prepareNotification(r *restorer, row interface{}, oldID uint) (bool, error) {
+	notification := row.(*models.Notification)
+	if notification.RefID == nil {
+		return true, nil
+	}
+	if notification.Type != "alert" {
+		notification.RefID = nil
+		return true, nil
+	}
+	newID, ok := r.ids["student_alerts"][*notification.RefID]
+	if !ok {
+		r.unresolved["notifications.ref_id"]++
+		notification.RefID = nil
+		return true, nil
+	}
+	notification.RefID = &newID
+	return true, nil
+}
+
+// attachmentOwners - таблица владельца вложения по OwnerType
+var attachmentOwners = map[string]string{
+	"homework":       "homeworks",
+	"announcement":   "announcements",
+	"submission":     "homework_submissions",
+	"absence_notice": "absence_notices",
+	"avatar":         "users",
+	"school_logo":    "schools",
+}
+
+// prepareAttachment заменяет владельца вложения и копирует файл в хранилище под новым ключом
+func prepareAttachment(r *restorer, row interface{}, oldID uint) (bool, error) {
+	attachment := row.(*models.Attachment)
+	if target, ok := attachmentOwners[attachment.OwnerType]; ok {
+		newID, found := r.ids[target][attachment.OwnerID]
+		if found {
+			attachment.OwnerID = newID
+		} else {
+			r.unresolved["attachments.owner_id"]++
+			attachment.OwnerType, attachment.OwnerID = "", 0
+		}
+	}
+
+	f, ok := r.files[attachmentPath(oldID)]
+	if !ok {
+		return false, nil
+	}
+	key, err := storage.NewKey(r.schoolID)
+	if err != nil {
+		return false, err
+	}
+	attachment.StorageKey = key
+	r.report.Files++
+	r.report.FileBytes += int64(f.UncompressedSize64)
+	if r.opts.DryRun {
+		attachment.Backend = "local"
+		if r.store != nil {
+			attachment.Backend = r.store.Name()
+		}
+		return true, nil
+	}
+
+	attachment.Backend = r.store.Name()
+	rc, err := f.Open()
+	if err != nil {
+		return false, err
+	}
+	defer rc.Close()
+	if err := r.store.Put(r.ctx, key, rc, int64(f.UncompressedSize64), attachment.ContentType); err != nil {
+		return false, fmt.Errorf("store attachment %d: %w", oldID, err)
+	}
+	r.written = append(r.written, key)
+	return true, nil
+}
+
+// attachmentURLPattern - ссылка на изображение или, в старых архивах, на скачивание вложения
+var attachmentURLPattern = regexp.MustCompile(`^/api/(?:images/(\d+)/[0-9a-f]+|attachments/(\d+)/download)$`)
+
+// attachmentURLID извлекает ID вложения из ссылки на изображение
+func attachmentURLID(url string) (uint, bool) {
+	m := attachmentURLPattern.FindStringSubmatch(url)
+	if m == nil {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(m[1]+m[2], 10, 64)
+	return uint(id), err == nil
+}
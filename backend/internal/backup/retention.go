@@ -0,0 +1,56 @@
+package backup
+
+import (
+	"fmt"
+	"time"
+)
+
+// Retention - политика хранения копий: по одной, самой новой, копии за каждый из
+// последних Daily дней, Weekly недель и Monthly месяцев, в которые копии делались.
+// Самая новая копия хранится всегда; нулевая политика хранит все копии.
+type Retention struct {
+	Daily   int `json:"daily"`
+	Weekly  int `json:"weekly"`
+	Monthly int `json:"monthly"`
+}
+
+// Keep возвращает номера копий, которые нужно оставить. times отсортированы от новых к старым.
+func (p Retention) Keep(times []time.Time) map[int]bool {
+	keep := make(map[int]bool)
+	if len(times) == 0 {
+		return keep
+	}
+	if p.Daily <= 0 && p.Weekly <= 0 && p.Monthly <= 0 {
+		for i := range times {
+			keep[i] = true
+		}
+		return keep
+	}
+
+	keep[0] = true
+	periods := []struct {
+		limit int
+		key   func(t time.Time) string
+	}{
+		{p.Daily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{p.Weekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}},
+		{p.Monthly, func(t time.Time) string { return t.Format("2006-01") }},
+	}
+	for _, period := range periods {
+		last, count := "", 0
+		for i, t := range times {
+			if count >= period.limit {
+				break
+			}
+			if key := period.key(t); key != last {
+				last = key
+				count++
+				keep[i] = true
+			}
+		}
+	}
+	return keep
+}
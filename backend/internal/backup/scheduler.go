@@ -0,0 +1,520 @@
+package backup
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"classkeeper/internal/config"
+	"classkeeper/internal/models"
+	"classkeeper/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+// Способы копирования (BACKUP_METHOD)
+const (
+	MethodDatabase = "database" // Копия базы данных целиком и файлы вложений
+	MethodArchive  = "archive"  // Архив каждой школы, как при выгрузке из настроек
+)
+
+// Статусы запуска копирования
+const (
+	RunRunning = "running"
+	RunSuccess = "success"
+	RunFailed  = "failed"
+)
+
+// Источники запуска
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+// ErrRunning - копирование уже выполняется
+var ErrRunning = errors.New("backup is already running")
+
+// runLayout - формат времени в имени каталога копии: 20260118-030000-12
+const runLayout = "20060102-150405"
+
+// Stored - копия в каталоге BACKUP_DIR
+type Stored struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	Files     int       `json:"files"`
+	Size      int64     `json:"size"`
+}
+
+// Status - состояние автоматического копирования
+type Status struct {
+	Enabled        bool               `json:"enabled"`
+	Schedule       string             `json:"schedule,omitempty"`
+	Method         string             `json:"method"`
+	Directory      string             `json:"directory"`
+	Retention      Retention          `json:"retention"`
+	NextRun        *time.Time         `json:"next_run,omitempty"`
+	Running        bool               `json:"running"`
+	LastRun        *models.BackupRun  `json:"last_run,omitempty"`
+	LastSuccessAt  *time.Time         `json:"last_success_at,omitempty"`
+	Failing        bool               `json:"failing"` // Последний завершённый запуск закончился ошибкой
+	Runs           []models.BackupRun `json:"runs"`
+	Backups        []Stored           `json:"backups"`
+	DirectoryError string             `json:"directory_error,omitempty"` // Каталог копий недоступен
+}
+
+// Scheduler создаёт полные копии экземпляра по cron-расписанию в каталоге BACKUP_DIR
+// и удаляет старые копии по политике хранения. При ошибке администраторы получают
+// уведомление.
+type Scheduler struct {
+	db       *gorm.DB
+	store    storage.Backend
+	cfg      config.BackupConfig
+	database config.DatabaseConfig
+	schedule *Schedule // nil - копирование только вручную
+	loc      *time.Location
+
+	mu      sync.Mutex
+	running bool
+	next    time.Time
+}
+
+// NewScheduler проверяет настройки копирования и создаёт планировщик
+func NewScheduler(db *gorm.DB, store storage.Backend, cfg *config.Config) (*Scheduler, error) {
+	s := &Scheduler{db: db, store: store, cfg: cfg.Backup, database: cfg.Database, loc: time.Local}
+	if s.cfg.Method != MethodDatabase && s.cfg.Method != MethodArchive {
+		return nil, fmt.Errorf("unsupported backup method: %s", s.cfg.Method)
+	}
+	if expr := strings.TrimSpace(s.cfg.Schedule); expr != "" && expr != "off" {
+		schedule, err := ParseSchedule(expr)
+		if err != nil {
+			return nil, err
+		}
+		s.schedule = schedule
+	}
+	if loc, err := time.LoadLocation(cfg.Server.TimeZone); err == nil {
+		s.loc = loc
+	}
+	if s.schedule != nil && s.schedule.Next(time.Now().In(s.loc)).IsZero() {
+		return nil, fmt.Errorf("backup schedule %q never fires", s.cfg.Schedule)
+	}
+	return s, nil
+}
+
+// Start запускает копирование по расписанию. Запуски, прерванные остановкой
+// сервера, помечаются неудачными.
+func (s *Scheduler) Start() {
+	now := time.Now()
+	s.db.Model(&models.BackupRun{}).Where("status = ?", RunRunning).Updates(map[string]interface{}{
+		"status":      RunFailed,
+		"error":       "interrupted by server shutdown",
+		"finished_at": now,
+	})
+
+	if s.schedule == nil {
+		log.Println("Automatic backups are disabled")
+		return
+	}
+	go func() {
+		for {
+			next := s.schedule.Next(time.Now().In(s.loc))
+			s.mu.Lock()
+			s.next = next
+			s.mu.Unlock()
+
+			time.Sleep(time.Until(next))
+			if _, err := s.Run(TriggerSchedule); err != nil && !errors.Is(err, ErrRunning) {
+				log.Printf("Scheduled backup failed: %v", err)
+			}
+		}
+	}()
+}
+
+// Run выполняет копирование и ждёт его завершения
+func (s *Scheduler) Run(trigger string) (*models.BackupRun, error) {
+	run, err := s.begin(trigger, nil)
+	if err != nil {
+		return nil, err
+	}
+	s.execute(run)
+	if run.Status == RunFailed {
+		return run, errors.New(run.Error)
+	}
+	return run, nil
+}
+
+// Trigger начинает копирование в фоне по запросу пользователя
+func (s *Scheduler) Trigger(userID uint) (*models.BackupRun, error) {
+	run, err := s.begin(TriggerManual, &userID)
+	if err != nil {
+		return nil, err
+	}
+	go s.execute(run)
+	return run, nil
+}
+
+func (s *Scheduler) begin(trigger string, userID *uint) (*models.BackupRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		return nil, ErrRunning
+	}
+
+	run := &models.BackupRun{
+		Method:      s.method(),
+		Trigger:     trigger,
+		Status:      RunRunning,
+		TriggeredBy: userID,
+		StartedAt:   time.Now(),
+	}
+	if err := s.db.Create(run).Error; err != nil {
+		return nil, err
+	}
+	s.running = true
+	return run, nil
+}
+
+// method возвращает конкретный способ копирования для текущей базы данных
+func (s *Scheduler) method() string {
+	switch {
+	case s.cfg.Method == MethodArchive:
+		return "archive"
+	case s.db.Dialector.Name() == "postgres":
+		return "pg_dump"
+	default:
+		return "sqlite"
+	}
+}
+
+func (s *Scheduler) execute(run *models.BackupRun) {
+	defer func() {
+		s.mu.Lock()
+		s.running = false
+		s.mu.Unlock()
+	}()
+
+	err := s.write(run)
+	finished := time.Now()
+	run.FinishedAt = &finished
+	if err != nil {
+		run.Status, run.Error = RunFailed, err.Error()
+	} else {
+		run.Status = RunSuccess
+		pruned, err := s.prune()
+		if err != nil {
+			log.Printf("Backup retention failed: %v", err)
+		}
+		run.Pruned = pruned
+	}
+	if err := s.db.Save(run).Error; err != nil {
+		log.Printf("Failed to save backup run %d: %v", run.ID, err)
+	}
+
+	if run.Status == RunFailed {
+		s.alert(run)
+	} else {
+		log.Printf("Backup %s created: %d files, %d bytes, %d old backups removed", run.Name, run.Files, run.Size, run.Pruned)
+	}
+}
+
+// write создаёт копию во временном каталоге и переименовывает его после успешной записи,
+// чтобы в BACKUP_DIR не оставалось неполных копий
+func (s *Scheduler) write(run *models.BackupRun) error {
+	if err := os.MkdirAll(s.cfg.Dir, 0o755); err != nil {
+		return fmt.Errorf("create backup directory: %w", err)
+	}
+	name := fmt.Sprintf("%s-%d", run.StartedAt.In(s.loc).Format(runLayout), run.ID)
+	tmp := filepath.Join(s.cfg.Dir, "."+name+".tmp")
+	if err := os.Mkdir(tmp, 0o755); err != nil {
+		return err
+	}
+	done := false
+	defer func() {
+		if !done {
+			os.RemoveAll(tmp)
+		}
+	}()
+
+	ctx := context.Background()
+	var err error
+	switch run.Method {
+	case "sqlite":
+		// VACUUM INTO - согласованная копия работающей базы без остановки записи
+		err = s.db.Exec("VACUUM INTO ?", filepath.Join(tmp, "classkeeper.db")).Error
+	case "pg_dump":
+		err = s.pgDump(ctx, filepath.Join(tmp, "classkeeper.dump"))
+	case "archive":
+		err = s.exportSchools(ctx, tmp)
+	}
+	if err != nil {
+		return err
+	}
+	if run.Method != "archive" {
+		if err := s.exportFiles(ctx, filepath.Join(tmp, "attachments.zip")); err != nil {
+			return err
+		}
+	}
+
+	run.Files, run.Size, err = dirSize(tmp)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(s.cfg.Dir, name)); err != nil {
+		return err
+	}
+	run.Name = name
+	done = true
+	return nil
+}
+
+// pgDump выгружает базу PostgreSQL в формате pg_dump --format=custom (восстанавливается pg_restore)
+func (s *Scheduler) pgDump(ctx context.Context, path string) error {
+	cmd := exec.CommandContext(ctx, s.cfg.PgDumpPath, "--format=custom", "--no-owner", "--file", path)
+	cmd.Env = append(os.Environ(),
+		"PGHOST="+s.database.Host,
+		"PGPORT="+s.database.Port,
+		"PGUSER="+s.database.User,
+		"PGPASSWORD="+s.database.Password,
+		"PGDATABASE="+s.database.DBName,
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("pg_dump: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// exportFiles копирует файлы всех вложений в ZIP под их ключами хранилища:
+// для локального хранилища архив распаковывается прямо в STORAGE_PATH
+func (s *Scheduler) exportFiles(ctx context.Context, path string) error {
+	var attachments []models.Attachment
+	if err := s.db.Order("id").Find(&attachments).Error; err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+
+	missing := 0
+	for _, attachment := range attachments {
+		reader, err := s.store.Get(ctx, attachment.StorageKey)
+		if errors.Is(err, storage.ErrNotFound) {
+			missing++
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("attachment %d: %w", attachment.ID, err)
+		}
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: attachment.StorageKey, Method: zip.Store, Modified: attachment.CreatedAt})
+		if err == nil {
+			_, err = io.Copy(w, reader)
+		}
+		reader.Close()
+		if err != nil {
+			return fmt.Errorf("attachment %d: %w", attachment.ID, err)
+		}
+	}
+	if missing > 0 {
+		log.Printf("Backup: %d attachment files are missing in storage", missing)
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// exportSchools записывает архив каждой школы
+func (s *Scheduler) exportSchools(ctx context.Context, dir string) error {
+	var schools []models.School
+	if err := s.db.Order("id").Find(&schools).Error; err != nil {
+		return err
+	}
+	for _, school := range schools {
+		f, err := os.Create(filepath.Join(dir, fmt.Sprintf("school-%d.zip", school.ID)))
+		if err != nil {
+			return err
+		}
+		_, err = Export(ctx, s.db, s.store, school.ID, f)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("school %d: %w", school.ID, err)
+		}
+	}
+	return nil
+}
+
+// List возвращает копии из каталога BACKUP_DIR, от новых к старым
+func (s *Scheduler) List() ([]Stored, error) {
+	entries, err := os.ReadDir(s.cfg.Dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []Stored
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() || len(name) < len(runLayout) {
+			continue
+		}
+		created, err := time.ParseInLocation(runLayout, name[:len(runLayout)], s.loc)
+		if err != nil {
+			continue
+		}
+		files, size, err := dirSize(filepath.Join(s.cfg.Dir, name))
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, Stored{Name: name, CreatedAt: created, Files: files, Size: size})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].CreatedAt.After(backups[j].CreatedAt) })
+	return backups, nil
+}
+
+// prune удаляет копии, не попадающие в политику хранения
+func (s *Scheduler) prune() (int, error) {
+	backups, err := s.List()
+	if err != nil {
+		return 0, err
+	}
+	times := make([]time.Time, len(backups))
+	for i, b := range backups {
+		times[i] = b.CreatedAt
+	}
+
+	keep := s.retention().Keep(times)
+	pruned := 0
+	for i, b := range backups {
+		if keep[i] {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(s.cfg.Dir, b.Name)); err != nil {
+			return pruned, err
+		}
+		pruned++
+	}
+	return pruned, nil
+}
+
+func (s *Scheduler) retention() Retention {
+	return Retention{Daily: s.cfg.KeepDaily, Weekly: s.cfg.KeepWeekly, Monthly: s.cfg.KeepMonthly}
+}
+
+// alert уведомляет администраторов школы оператора об ошибке. Если предыдущий запуск тоже был
+// неудачным, повторно не уведомляем.
+func (s *Scheduler) alert(run *models.BackupRun) {
+	log.Printf("Backup failed: %s", run.Error)
+
+	var previous models.BackupRun
+	err := s.db.Where("id <> ? AND status <> ?", run.ID, RunRunning).Order("started_at DESC").First(&previous).Error
+	if err == nil && previous.Status == RunFailed {
+		return
+	}
+
+	// Сбой касается всего экземпляра, поэтому уведомляются только админы школы оператора
+	if s.cfg.OperatorSchoolID == 0 {
+		return
+	}
+	var adminIDs []uint
+	if err := s.db.Model(&models.User{}).
+		Where("school_id = ? AND role = ?", s.cfg.OperatorSchoolID, "admin").
+		Pluck("id", &adminIDs).Error; err != nil {
+		log.Printf("Failed to notify admins about backup failure: %v", err)
+		return
+	}
+	for _, adminID := range adminIDs {
+		runID := run.ID
+		notification := models.Notification{
+			UserID:  adminID,
+			Type:    "backup_failed",
+			Title:   "Ошибка резервного копирования",
+			Message: run.Error,
+			RefID:   &runID,
+		}
+		if err := s.db.Create(&notification).Error; err != nil {
+			log.Printf("Failed to notify admins about backup failure: %v", err)
+			return
+		}
+	}
+}
+
+// Status возвращает настройки, последние запуски и хранящиеся копии
+func (s *Scheduler) Status() (*Status, error) {
+	s.mu.Lock()
+	status := &Status{
+		Enabled:   s.schedule != nil,
+		Method:    s.method(),
+		Directory: s.cfg.Dir,
+		Retention: s.retention(),
+		Running:   s.running,
+	}
+	if !s.next.IsZero() {
+		next := s.next
+		status.NextRun = &next
+	}
+	s.mu.Unlock()
+	if status.Enabled {
+		status.Schedule = s.cfg.Schedule
+	}
+
+	if err := s.db.Order("started_at DESC").Limit(20).Find(&status.Runs).Error; err != nil {
+		return nil, err
+	}
+	if len(status.Runs) > 0 {
+		status.LastRun = &status.Runs[0]
+	}
+	for _, run := range status.Runs {
+		if run.Status == RunRunning {
+			continue
+		}
+		status.Failing = run.Status == RunFailed
+		break
+	}
+
+	var last models.BackupRun
+	if err := s.db.Where("status = ?", RunSuccess).Order("started_at DESC").First(&last).Error; err == nil {
+		status.LastSuccessAt = last.FinishedAt
+	}
+
+	backups, err := s.List()
+	if err != nil {
+		status.DirectoryError = err.Error()
+	}
+	status.Backups = backups
+	return status, nil
+}
+
+// dirSize возвращает число файлов и их общий размер в каталоге
+func dirSize(dir string) (int, int64, error) {
+	files, size := 0, int64(0)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files++
+		size += info.Size()
+		return nil
+	})
+	return files, size, err
+}
@@ -0,0 +1,218 @@
+package calendar
+
+import (
+	"time"
+
+	"classkeeper/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Типы записей школьного календаря
+const (
+	TypeHoliday  = "holiday"  // Праздничный день
+	TypeVacation = "vacation" // Каникулы
+	TypeWorkday  = "workday"  // Перенесённый рабочий день
+	TypeDayOff   = "day_off"  // Неучебный день (например, для одного класса)
+	TypeEvent    = "event"    // Школьное событие, не влияет на учебные дни
+)
+
+// ValidTypes содержит допустимые типы записей календаря
+var ValidTypes = map[string]bool{
+	TypeHoliday:  true,
+	TypeVacation: true,
+	TypeWorkday:  true,
+	TypeDayOff:   true,
+	TypeEvent:    true,
+}
+
+// DateLayout формат дат в API
+const DateLayout = "2006-01-02"
+
+var dayNames = map[time.Weekday]string{
+	time.Monday:    "Понедельник",
+	time.Tuesday:   "Вторник",
+	time.Wednesday: "Среда",
+	time.Thursday:  "Четверг",
+	time.Friday:    "Пятница",
+	time.Saturday:  "Суббота",
+	time.Sunday:    "Воскресенье",
+}
+
+// DayName возвращает название дня недели в формате Schedule.DayOfWeek
+func DayName(d time.Time) string {
+	return dayNames[d.Weekday()]
+}
+
+// ParseDayName возвращает день недели по названию из Schedule.DayOfWeek
+func ParseDayName(name string) (time.Weekday, bool) {
+	for wd, n := range dayNames {
+		if n == name {
+			return wd, true
+		}
+	}
+	return 0, false
+}
+
+// Date обрезает время до начала дня (UTC), как хранятся даты в БД
+func Date(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Calendar рассчитывает учебные дни школы или класса
+type Calendar struct {
+	weekdays map[time.Weekday]bool
+	school   []models.CalendarEvent // Записи для всей школы
+	class    []models.CalendarEvent // Исключения для конкретного класса
+}
+
+// Load загружает календарь школы (и исключения класса, если classID указан)
+// для периода from..to включительно
+func Load(db *gorm.DB, schoolID uint, classID *uint, from, to time.Time) (*Calendar, error) {
+	from, to = Date(from), Date(to)
+
+	query := db.Where("school_id = ? AND start_date <= ? AND end_date >= ? AND type <> ?",
+		schoolID, to, from, TypeEvent)
+	if classID != nil {
+		query = query.Where("class_id IS NULL OR class_id = ?", *classID)
+	} else {
+		query = query.Where("class_id IS NULL")
+	}
+
+	var events []models.CalendarEvent
+	if err := query.Find(&events).Error; err != nil {
+		return nil, err
+	}
+
+	// Рабочие дни недели определяем по расписанию
+	var days []string
+	scheduleQuery := db.Model(&models.Schedule{}).
+		Joins("JOIN classes ON classes.id = schedules.class_id").
+		Where("classes.school_id = ?", schoolID)
+	if classID != nil {
+		scheduleQuery = scheduleQuery.Where("schedules.class_id = ?", *classID)
+	}
+	if err := scheduleQuery.Distinct().Pluck("schedules.day_of_week", &days).Error; err != nil {
+		return nil, err
+	}
+
+	return New(events, days), nil
+}
+
+// New создаёт календарь из записей и списка учебных дней недели.
+// Если дни недели не указаны, учебными считаются понедельник-пятница.
+func New(events []models.CalendarEvent, scheduleDays []string) *Calendar {
+	cal := &Calendar{weekdays: make(map[time.Weekday]bool)}
+
+	for _, name := range scheduleDays {
+		if wd, ok := ParseDayName(name); ok {
+			cal.weekdays[wd] = true
+		}
+	}
+	if len(cal.weekdays) == 0 {
+		for wd := time.Monday; wd <= time.Friday; wd++ {
+			cal.weekdays[wd] = true
+		}
+	}
+
+	for _, e := range events {
+		if e.Type == TypeEvent {
+			continue
+		}
+		if e.ClassID != nil {
+			cal.class = append(cal.class, e)
+		} else {
+			cal.school = append(cal.school, e)
+		}
+	}
+
+	return cal
+}
+
+// ScheduleDay возвращает день недели, по расписанию которого проходят уроки в дату d.
+// Второе значение false, если d - неучебный день.
+func (cal *Calendar) ScheduleDay(d time.Time) (string, bool) {
+	d = Date(d)
+
+	// Исключения класса важнее общешкольных записей
+	for _, events := range [][]models.CalendarEvent{cal.class, cal.school} {
+		if e := find(events, d, TypeWorkday); e != nil {
+			if e.WorkdayAs != "" {
+				return e.WorkdayAs, true
+			}
+			return DayName(d), true
+		}
+		for _, t := range []string{TypeHoliday, TypeVacation, TypeDayOff} {
+			if find(events, d, t) != nil {
+				return "", false
+			}
+		}
+	}
+
+	if cal.weekdays[d.Weekday()] {
+		return DayName(d), true
+	}
+	return "", false
+}
+
+// IsWorkingDay проверяет, является ли дата учебным днём
+func (cal *Calendar) IsWorkingDay(d time.Time) bool {
+	_, ok := cal.ScheduleDay(d)
+	return ok
+}
+
+// WorkingDays возвращает учебные дни в периоде from..to включительно
+func (cal *Calendar) WorkingDays(from, to time.Time) []time.Time {
+	var days []time.Time
+	for d := Date(from); !d.After(Date(to)); d = d.AddDate(0, 0, 1) {
+		if cal.IsWorkingDay(d) {
+			days = append(days, d)
+		}
+	}
+	return days
+}
+
+// NonWorkingDays возвращает неучебные дни в периоде from..to включительно
+func (cal *Calendar) NonWorkingDays(from, to time.Time) []time.Time {
+	var days []time.Time
+	for d := Date(from); !d.After(Date(to)); d = d.AddDate(0, 0, 1) {
+		if !cal.IsWorkingDay(d) {
+			days = append(days, d)
+		}
+	}
+	return days
+}
+
+// CountWorkingDays считает учебные дни в полуинтервале (from, to]
+func (cal *Calendar) CountWorkingDays(from, to time.Time) int {
+	count := 0
+	for d := Date(from).AddDate(0, 0, 1); !d.After(Date(to)); d = d.AddDate(0, 0, 1) {
+		if cal.IsWorkingDay(d) {
+			count++
+		}
+	}
+	return count
+}
+
+// NextWorkingDay возвращает ближайший учебный день начиная с d (включительно).
+// Поиск ограничен годом, чтобы не зациклиться на пустом календаре.
+func (cal *Calendar) NextWorkingDay(d time.Time) time.Time {
+	d = Date(d)
+	for i := 0; i < 366; i++ {
+		if cal.IsWorkingDay(d) {
+			return d
+		}
+		d = d.AddDate(0, 0, 1)
+	}
+	return d
+}
+
+func find(events []models.CalendarEvent, d time.Time, eventType string) *models.CalendarEvent {
+	for i := range events {
+		e := &events[i]
+		if e.Type == eventType && !d.Before(Date(e.StartDate)) && !d.After(Date(e.EndDate)) {
+			return e
+		}
+	}
+	return nil
+}
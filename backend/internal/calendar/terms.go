@@ -0,0 +1,73 @@
+package calendar
+
+import (
+	"time"
+
+	"classkeeper/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Term - учебный период (четверть, триместр) между каникулами
+type Term struct {
+	Number int       `json:"number"`
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+}
+
+// AcademicYear возвращает учебный год, в который попадает дата: с 1 сентября по 31 мая.
+// Летние месяцы относятся к прошедшему учебному году.
+func AcademicYear(d time.Time) (time.Time, time.Time) {
+	d = Date(d)
+	year := d.Year()
+	if d.Month() < time.September {
+		year--
+	}
+	return time.Date(year, time.September, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(year+1, time.May, 31, 0, 0, 0, 0, time.UTC)
+}
+
+// Terms делит период from..to на учебные периоды по каникулам школы из календаря.
+// Если каникул в периоде нет, весь период считается одним учебным периодом.
+func Terms(db *gorm.DB, schoolID uint, from, to time.Time) ([]Term, error) {
+	from, to = Date(from), Date(to)
+
+	var vacations []models.CalendarEvent
+	if err := db.Where("school_id = ? AND class_id IS NULL AND type = ? AND start_date <= ? AND end_date >= ?",
+		schoolID, TypeVacation, to, from).
+		Order("start_date").
+		Find(&vacations).Error; err != nil {
+		return nil, err
+	}
+
+	var terms []Term
+	cur := from
+	for _, v := range vacations {
+		start, end := Date(v.StartDate), Date(v.EndDate)
+		if start.After(cur) {
+			termEnd := start.AddDate(0, 0, -1)
+			if termEnd.After(to) {
+				termEnd = to
+			}
+			terms = append(terms, Term{Number: len(terms) + 1, From: cur, To: termEnd})
+		}
+		if next := end.AddDate(0, 0, 1); next.After(cur) {
+			cur = next
+		}
+	}
+	if !cur.After(to) {
+		terms = append(terms, Term{Number: len(terms) + 1, From: cur, To: to})
+	}
+	return terms, nil
+}
+
+// TermOf возвращает учебный период, в который попадает дата
+func TermOf(terms []Term, d time.Time) (Term, bool) {
+	d = Date(d)
+	for _, t := range terms {
+		if !d.Before(t.From) && !d.After(t.To) {
+			return t, true
+		}
+	}
+	return Term{}, false
+}
@@ -3,6 +3,8 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -12,12 +14,21 @@ type Config struct {
 	Server   ServerConfig
 	Database DatabaseConfig
 	JWT      JWTConfig
+	Login    LoginConfig
+	Storage  StorageConfig
+	Reports  ReportsConfig
+	Backup   BackupConfig
+	Trash    TrashConfig
+	Privacy  PrivacyConfig
+	Demo     DemoConfig
 }
 
 type ServerConfig struct {
 	Port           string
 	Environment    string
 	AllowedOrigins []string
+	TimeZone       string // Часовой пояс школы для расписания и iCalendar
+	PublicURL      string // Внешний адрес сервера для ссылок (iCalendar и т.д.)
 }
 
 type DatabaseConfig struct {
@@ -36,16 +47,81 @@ type JWTConfig struct {
 	RefreshTokenExpiry  time.Duration
 }
 
+type LoginConfig struct {
+	MaxAttempts int           // После стольких неудачных попыток подряд вход блокируется; 0 (по умолчанию) - не блокировать
+	Lockout     time.Duration // На сколько блокируется вход
+}
+
+type StorageConfig struct {
+	Backend       string // local или s3
+	LocalPath     string
+	S3Endpoint    string // host:port, например localhost:9000 для MinIO
+	S3Region      string
+	S3Bucket      string
+	S3AccessKey   string
+	S3SecretKey   string
+	S3UseSSL      bool
+	MaxFileSize   int64    // Максимальный размер файла в байтах
+	SchoolQuota   int64    // Квота на школу в байтах
+	AllowedTypes  []string // Разрешённые MIME-типы, допускается "image/*"
+	LinkTTL       time.Duration
+	SigningSecret string
+}
+
+type ReportsConfig struct {
+	FontPath     string // TrueType-шрифт с кириллицей для PDF; пусто - встроенный Helvetica
+	BoldFontPath string // Жирное начертание; пусто - FontPath
+}
+
+type BackupConfig struct {
+	Schedule    string // Cron-выражение автоматического копирования; off - выключено
+	Dir         string // Каталог для копий
+	Method      string // database (копия БД и файлов вложений) или archive (архив каждой школы)
+	KeepDaily   int    // Сколько последних дней, недель и месяцев хранить по одной копии
+	KeepWeekly  int
+	KeepMonthly int
+	PgDumpPath  string // pg_dump для копирования PostgreSQL
+	// OperatorSchoolID - школа, админы которой управляют копиями всего экземпляра
+	// и получают уведомления о сбоях; 0 - только из командной строки
+	OperatorSchoolID uint
+}
+
+type TrashConfig struct {
+	RetentionDays int // Через сколько дней удалённые записи стираются навсегда; 0 - не стирать
+}
+
+type PrivacyConfig struct {
+	GraduateRetentionYears int // Через сколько лет после выпуска данные ученика обезличиваются; 0 - не обезличивать
+}
+
+type DemoConfig struct {
+	Enabled      bool          // Демо-режим: песочница с демонстрационными данными для каждого посетителя
+	Size         string        // Размер школы песочницы: small, medium, large
+	Weeks        int           // За сколько последних учебных недель создаются оценки и отметки
+	Seed         int64         // Зерно генератора: все песочницы одинаковы
+	TTL          time.Duration // Время жизни песочницы после создания или сброса
+	MaxSandboxes int           // Сколько песочниц может существовать одновременно
+}
+
 func Load() *Config {
 	// Загружаем .env файл (если существует)
 	if err := godotenv.Load(); err != nil {
 		log.Println("Warning: .env file not found, using environment variables")
 	}
 
+	// Без отдельного ключа ссылки на скачивание подписываются ключом токенов
+	signingSecret := os.Getenv("STORAGE_SIGNING_SECRET")
+	if signingSecret == "" {
+		log.Println("Warning: STORAGE_SIGNING_SECRET is not set, download links are signed with JWT_SECRET")
+		signingSecret = getEnv("JWT_SECRET", "default-secret-key-change-me")
+	}
+
 	return &Config{
 		Server: ServerConfig{
 			Port:        getEnv("PORT", "8080"),
 			Environment: getEnv("ENV", "development"),
+			TimeZone:    getEnv("TIMEZONE", "Europe/Moscow"),
+			PublicURL:   getEnv("PUBLIC_URL", ""),
 		},
 		Database: DatabaseConfig{
 			Type:     getEnv("DB_TYPE", "sqlite"),
@@ -61,6 +137,58 @@ func Load() *Config {
 			AccessTokenExpiry:   parseDuration(getEnv("JWT_EXPIRY", "15m")),
 			RefreshTokenExpiry:  parseDuration(getEnv("REFRESH_TOKEN_EXPIRY", "168h")),
 		},
+		Login: LoginConfig{
+			MaxAttempts: int(parseInt64(getEnv("LOGIN_MAX_ATTEMPTS", "0"))),
+			Lockout:     parseDuration(getEnv("LOGIN_LOCKOUT", "15m")),
+		},
+		Storage: StorageConfig{
+			Backend:     getEnv("STORAGE_BACKEND", "local"),
+			LocalPath:   getEnv("STORAGE_PATH", "./uploads"),
+			S3Endpoint:  getEnv("S3_ENDPOINT", "localhost:9000"),
+			S3Region:    getEnv("S3_REGION", "us-east-1"),
+			S3Bucket:    getEnv("S3_BUCKET", "classkeeper"),
+			S3AccessKey: getEnv("S3_ACCESS_KEY", ""),
+			S3SecretKey: getEnv("S3_SECRET_KEY", ""),
+			S3UseSSL:    getEnv("S3_USE_SSL", "false") == "true",
+			MaxFileSize: parseInt64(getEnv("ATTACHMENT_MAX_SIZE_MB", "20")) << 20,
+			SchoolQuota: parseInt64(getEnv("SCHOOL_QUOTA_MB", "2048")) << 20,
+			AllowedTypes: splitList(getEnv("ATTACHMENT_ALLOWED_TYPES",
+				"image/*,application/pdf,text/plain,application/msword,"+
+					"application/vnd.openxmlformats-officedocument.wordprocessingml.document,"+
+					"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet,"+
+					"application/vnd.openxmlformats-officedocument.presentationml.presentation")),
+			LinkTTL:       parseDuration(getEnv("ATTACHMENT_LINK_TTL", "15m")),
+			SigningSecret: signingSecret,
+		},
+		Reports: ReportsConfig{
+			FontPath:     getEnv("REPORT_FONT", ""),
+			BoldFontPath: getEnv("REPORT_FONT_BOLD", ""),
+		},
+		Backup: BackupConfig{
+			Schedule:    getEnv("BACKUP_SCHEDULE", "0 3 * * *"),
+			Dir:         getEnv("BACKUP_DIR", "./backups"),
+			Method:      getEnv("BACKUP_METHOD", "database"),
+			KeepDaily:   int(parseInt64(getEnv("BACKUP_KEEP_DAILY", "7"))),
+			KeepWeekly:  int(parseInt64(getEnv("BACKUP_KEEP_WEEKLY", "4"))),
+			KeepMonthly: int(parseInt64(getEnv("BACKUP_KEEP_MONTHLY", "6"))),
+			PgDumpPath:  getEnv("PG_DUMP_PATH", "pg_dump"),
+
+			OperatorSchoolID: uint(parseInt64(getEnv("BACKUP_OPERATOR_SCHOOL", "0"))),
+		},
+		Trash: TrashConfig{
+			RetentionDays: int(parseInt64(getEnv("TRASH_RETENTION_DAYS", "30"))),
+		},
+		Privacy: PrivacyConfig{
+			GraduateRetentionYears: int(parseInt64(getEnv("GRADUATE_RETENTION_YEARS", "0"))),
+		},
+		Demo: DemoConfig{
+			Enabled:      getEnv("DEMO_MODE", "false") == "true",
+			Size:         getEnv("DEMO_SIZE", "small"),
+			Weeks:        int(parseInt64(getEnv("DEMO_WEEKS", "6"))),
+			Seed:         parseInt64(getEnv("DEMO_SEED", "1")),
+			TTL:          parseDuration(getEnv("DEMO_SANDBOX_TTL", "2h")),
+			MaxSandboxes: int(parseInt64(getEnv("DEMO_MAX_SANDBOXES", "50"))),
+		},
 	}
 }
 
@@ -79,3 +207,22 @@ func parseDuration(s string) time.Duration {
 	}
 	return duration
 }
+
+func parseInt64(s string) int64 {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		log.Printf("Invalid number format for %s, using 0", s)
+		return 0
+	}
+	return n
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -4,12 +4,15 @@ import (
 	"fmt"
 	"log"
 
+	"classkeeper/internal/audit"
 	"classkeeper/internal/config"
 	"classkeeper/internal/models"
+	"classkeeper/internal/storage"
 
 	"gorm.io/driver/postgres"
 	"github.com/glebarez/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 )
 
@@ -17,6 +20,24 @@ var DB *gorm.DB
 
 // Connect устанавливает соединение с базой данных
 func Connect(cfg *config.Config) error {
+	db, err := Open(cfg)
+	if err != nil {
+		return err
+	}
+
+	// Журнал аудита всех изменений
+	if err := audit.Register(db); err != nil {
+		return fmt.Errorf("failed to register audit callbacks: %w", err)
+	}
+
+	DB = db
+	log.Printf("Connected to %s database successfully", cfg.Database.Type)
+	return nil
+}
+
+// Open открывает базу данных из настроек без журнала аудита и не меняет DB.
+// Нужен командам, которые работают со второй базой (например, обезличенной копией).
+func Open(cfg *config.Config) (*gorm.DB, error) {
 	var dialector gorm.Dialector
 
 	switch cfg.Database.Type {
@@ -33,7 +54,7 @@ func Connect(cfg *config.Config) error {
 	case "sqlite":
 		dialector = sqlite.Open(cfg.Database.SQLPath)
 	default:
-		return fmt.Errorf("unsupported database type: %s", cfg.Database.Type)
+		return nil, fmt.Errorf("unsupported database type: %s", cfg.Database.Type)
 	}
 
 	// Настройка логирования
@@ -46,19 +67,26 @@ func Connect(cfg *config.Config) error {
 		Logger: logger.Default.LogMode(logLevel),
 	})
 	if err != nil {
-		return fmt.Errorf("failed to connect to database: %w", err)
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
-
-	DB = db
-	log.Printf("Connected to %s database successfully", cfg.Database.Type)
-	return nil
+	return db, nil
 }
 
 // Migrate выполняет автоматическую миграцию схемы базы данных
 func Migrate() error {
 	log.Println("Running database migrations...")
 
-	err := DB.AutoMigrate(
+	if err := MigrateDB(DB); err != nil {
+		return err
+	}
+
+	log.Println("Database migrations completed successfully")
+	return nil
+}
+
+// MigrateDB создаёт и обновляет таблицы в базе db
+func MigrateDB(db *gorm.DB) error {
+	err := db.AutoMigrate(
 		&models.School{},
 		&models.User{},
 		&models.Class{},
@@ -69,13 +97,79 @@ func Migrate() error {
 		&models.Homework{},
 		&models.Announcement{},
 		&models.ParentStudent{},
+		&models.CalendarEvent{},
+		&models.CalendarFeed{},
+		&models.HomeworkSubmission{},
+		&models.Attachment{},
+		&models.HomeworkLoadLimit{},
+		&models.HomeworkTemplate{},
+		&models.HomeworkRecurrence{},
+		&models.AbsenceNotice{},
+		&models.LessonRegister{},
+		&models.AlertRule{},
+		&models.StudentAlert{},
+		&models.Notification{},
+		&models.CheckInSession{},
+		&models.CheckIn{},
+		&models.SyncCounter{},
+		&models.SyncTombstone{},
+		&models.ReportCardComment{},
+		&models.BackupRun{},
+		&models.AuditLog{},
+		&models.DemoSandbox{},
 	)
 
 	if err != nil {
 		return fmt.Errorf("migration failed: %w", err)
 	}
 
-	log.Println("Database migrations completed successfully")
+	// Счётчик изменений для офлайн-синхронизации
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.SyncCounter{Name: models.SyncCounterChanges}).Error; err != nil {
+		return fmt.Errorf("migration failed: %w", err)
+	}
+
+	if err := migrateImageURLs(db); err != nil {
+		return fmt.Errorf("migration failed: %w", err)
+	}
+	return nil
+}
+
+// migrateImageURLs заменяет в аватарах и логотипах ссылки на скачивание с авторизацией,
+// которые <img> не загружает, на публичные ссылки на изображения
+func migrateImageURLs(db *gorm.DB) error {
+	columns := []struct {
+		model  interface{}
+		column string
+	}{
+		{&models.User{}, "avatar_url"},
+		{&models.School{}, "logo_url"},
+	}
+	for _, col := range columns {
+		var rows []struct {
+			ID  uint
+			URL string
+		}
+		if err := db.Unscoped().Model(col.model).
+			Select("id, "+col.column+" AS url").
+			Where(col.column+" LIKE ?", "/api/attachments/%/download").
+			Scan(&rows).Error; err != nil {
+			return err
+		}
+		for _, row := range rows {
+			url := ""
+			var attachmentID uint
+			if _, err := fmt.Sscanf(row.URL, "/api/attachments/%d/download", &attachmentID); err == nil {
+				var attachment models.Attachment
+				if err := db.Select("id, checksum").First(&attachment, attachmentID).Error; err == nil {
+					url = storage.ImageURL(attachment.ID, attachment.Checksum)
+				}
+			}
+			if err := db.Unscoped().Model(col.model).Where("id = ?", row.ID).UpdateColumn(col.column, url).Error; err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
@@ -0,0 +1,271 @@
+// Package demo - песочницы демо-режима. Каждый посетитель получает отдельную школу,
+// заполненную демонстрационными данными (пакет seed), и входит в неё одним нажатием
+// под любой ролью. Песочница живёт ограниченное время: посетитель может сбросить её
+// к исходным данным, а фоновая задача удаляет истёкшие песочницы вместе со школой.
+package demo
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"classkeeper/internal/audit"
+	"classkeeper/internal/backup"
+	"classkeeper/internal/calendar"
+	"classkeeper/internal/config"
+	"classkeeper/internal/models"
+	"classkeeper/internal/seed"
+	"classkeeper/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+// SchoolName - название школы песочницы
+const SchoolName = "Демо-школа"
+
+// Roles - роли, под которыми можно войти в песочницу
+var Roles = []string{"admin", "teacher", "student", "parent"}
+
+var (
+	// ErrNotFound - песочницы с таким ключом нет или она истекла
+	ErrNotFound = errors.New("demo sandbox not found or expired")
+	// ErrLimit - достигнуто число одновременных песочниц
+	ErrLimit = errors.New("too many demo sandboxes, try again later")
+	// ErrUnknownRole - в песочнице нет пользователя с такой ролью
+	ErrUnknownRole = errors.New("unknown demo role")
+)
+
+// extraTables - таблицы школы, которые не входят в архив школы, но удаляются вместе
+// с песочницей. Параметры условий - ID школы.
+var extraTables = []struct {
+	name  string
+	scope string
+}{
+	{"check_ins", "session_id IN (SELECT id FROM check_in_sessions WHERE schedule_id IN " +
+		"(SELECT id FROM schedules WHERE class_id IN (SELECT id FROM classes WHERE school_id = ?)))"},
+	{"check_in_sessions", "schedule_id IN (SELECT id FROM schedules WHERE class_id IN (SELECT id FROM classes WHERE school_id = ?))"},
+	{"calendar_feeds", "user_id IN (SELECT id FROM users WHERE school_id = ?)"},
+	{"sync_tombstones", "student_id IN (SELECT id FROM users WHERE school_id = ?)"},
+}
+
+// Create создаёт песочницу и возвращает её вместе с ключом посетителя. Ключ
+// показывается один раз; в базе хранится только его хеш.
+func Create(ctx context.Context, db *gorm.DB, cfg *config.DemoConfig) (*models.DemoSandbox, string, error) {
+	var count int64
+	if err := db.Model(&models.DemoSandbox{}).Count(&count).Error; err != nil {
+		return nil, "", err
+	}
+	if cfg.MaxSandboxes > 0 && int(count) >= cfg.MaxSandboxes {
+		return nil, "", ErrLimit
+	}
+
+	key, err := randomHex(24)
+	if err != nil {
+		return nil, "", err
+	}
+	suffix, err := randomHex(3)
+	if err != nil {
+		return nil, "", err
+	}
+	sandbox := &models.DemoSandbox{KeyHash: hashKey(key), Prefix: "demo" + suffix + "_"}
+	if err := fill(ctx, db, cfg, sandbox); err != nil {
+		return nil, "", err
+	}
+	if err := db.WithContext(audit.WithoutLog(ctx)).Create(sandbox).Error; err != nil {
+		return nil, "", err
+	}
+	return sandbox, key, nil
+}
+
+// Find возвращает действующую песочницу по ключу посетителя
+func Find(db *gorm.DB, key string) (*models.DemoSandbox, error) {
+	if key == "" {
+		return nil, ErrNotFound
+	}
+	var sandbox models.DemoSandbox
+	err := db.Where("key_hash = ? AND expires_at > ?", hashKey(key), time.Now()).First(&sandbox).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sandbox, nil
+}
+
+// User возвращает пользователя песочницы для входа под ролью: первого по порядку
+// создания, поэтому это всегда один и тот же учитель, ученик или родитель
+func User(db *gorm.DB, sandbox *models.DemoSandbox, role string) (*models.User, error) {
+	valid := false
+	for _, r := range Roles {
+		valid = valid || r == role
+	}
+	if !valid {
+		return nil, ErrUnknownRole
+	}
+	var user models.User
+	if err := db.Where("school_id = ? AND role = ?", sandbox.SchoolID, role).Order("id").First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUnknownRole
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Logins возвращает логины песочницы по ролям
+func Logins(db *gorm.DB, sandbox *models.DemoSandbox) (map[string]string, error) {
+	logins := make(map[string]string, len(Roles))
+	for _, role := range Roles {
+		user, err := User(db, sandbox, role)
+		if err != nil {
+			return nil, err
+		}
+		logins[role] = user.Username
+	}
+	return logins, nil
+}
+
+// Reset удаляет школу песочницы и заполняет новую теми же данными. Ключ и логины
+// остаются прежними, срок жизни отсчитывается заново. Если заполнить школу не удалось,
+// песочница удаляется.
+func Reset(ctx context.Context, db *gorm.DB, store storage.Backend, cfg *config.DemoConfig, sandbox *models.DemoSandbox) error {
+	db = db.WithContext(audit.WithoutLog(ctx))
+	if err := Purge(ctx, db, store, sandbox.SchoolID); err != nil {
+		return err
+	}
+	if err := fill(ctx, db, cfg, sandbox); err != nil {
+		db.Delete(sandbox)
+		return err
+	}
+	return db.Model(sandbox).Updates(map[string]interface{}{
+		"school_id":  sandbox.SchoolID,
+		"expires_at": sandbox.ExpiresAt,
+	}).Error
+}
+
+// fill создаёт и заполняет школу песочницы за последние cfg.Weeks учебных недель
+func fill(ctx context.Context, db *gorm.DB, cfg *config.DemoConfig, sandbox *models.DemoSandbox) error {
+	size, ok := seed.Sizes[cfg.Size]
+	if !ok {
+		size = seed.Sizes["small"]
+	}
+	now := time.Now()
+	start, end := calendar.AcademicYear(now)
+	to := calendar.Date(now)
+	if to.After(end) {
+		to = end
+	}
+	from := to.AddDate(0, 0, -7*cfg.Weeks)
+	if from.Before(start) {
+		from = start
+	}
+
+	report, err := seed.Run(ctx, db, seed.Options{
+		SchoolName: SchoolName,
+		Size:       size,
+		From:       from,
+		To:         to,
+		Seed:       cfg.Seed,
+		Prefix:     sandbox.Prefix,
+	})
+	if err != nil {
+		return fmt.Errorf("seed demo school: %w", err)
+	}
+	sandbox.SchoolID = report.SchoolID
+	sandbox.ExpiresAt = now.Add(cfg.TTL)
+	return nil
+}
+
+// Purge безвозвратно удаляет школу со всеми данными и файлами вложений. Таблицы
+// очищаются в порядке, обратном восстановлению архива школы, чтобы условия выборки
+// по классам и пользователям работали до удаления самих классов и пользователей.
+// Записи журнала аудита остаются: журнал только дополняется.
+func Purge(ctx context.Context, db *gorm.DB, store storage.Backend, schoolID uint) error {
+	var keys []string
+	if err := db.Model(&models.Attachment{}).Where("school_id = ?", schoolID).
+		Pluck("storage_key", &keys).Error; err != nil {
+		return err
+	}
+
+	err := db.WithContext(audit.WithoutLog(ctx)).Transaction(func(tx *gorm.DB) error {
+		for _, t := range extraTables {
+			if err := tx.Exec("DELETE FROM "+t.name+" WHERE "+t.scope, schoolID).Error; err != nil {
+				return err
+			}
+		}
+		tables := backup.Tables()
+		for i := len(tables) - 1; i >= 0; i-- {
+			scope, _ := backup.SchoolScope(tables[i])
+			args := make([]interface{}, strings.Count(scope, "?"))
+			for j := range args {
+				args[j] = schoolID
+			}
+			if err := tx.Exec("DELETE FROM "+tables[i]+" WHERE "+scope, args...).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if store != nil {
+		for _, key := range keys {
+			store.Delete(ctx, key)
+		}
+	}
+	return nil
+}
+
+// Expire удаляет песочницы, срок жизни которых истёк к now
+func Expire(ctx context.Context, db *gorm.DB, store storage.Backend, now time.Time) (int, error) {
+	var expired []models.DemoSandbox
+	if err := db.Where("expires_at <= ?", now).Find(&expired).Error; err != nil {
+		return 0, err
+	}
+	for i, sandbox := range expired {
+		if err := Purge(ctx, db, store, sandbox.SchoolID); err != nil {
+			return i, err
+		}
+		if err := db.WithContext(audit.WithoutLog(ctx)).Delete(&sandbox).Error; err != nil {
+			return i, err
+		}
+	}
+	return len(expired), nil
+}
+
+// Start запускает фоновое удаление истёкших песочниц
+func Start(db *gorm.DB, store storage.Backend, interval time.Duration) {
+	go func() {
+		for {
+			n, err := Expire(context.Background(), db, store, time.Now())
+			if err != nil {
+				log.Printf("Demo sandbox cleanup failed: %v", err)
+			} else if n > 0 {
+				log.Printf("Demo sandbox cleanup: removed %d sandboxes", n)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,378 @@
+package handlers
+
+import (
+	"classkeeper/internal/calendar"
+	"classkeeper/internal/database"
+	"classkeeper/internal/models"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Статусы заявления об отсутствии
+const (
+	AbsencePending  = "pending"
+	AbsenceApproved = "approved"
+	AbsenceRejected = "rejected"
+)
+
+// Максимальная длина периода в одном заявлении
+const maxAbsenceDays = 90
+
+var absenceReasons = map[string]bool{
+	"illness":     true, // Болезнь
+	"medical":     true, // Медицинское обследование
+	"family":      true, // Семейные обстоятельства
+	"competition": true, // Соревнования, олимпиады
+	"other":       true,
+}
+
+type AbsenceHandler struct{}
+
+func NewAbsenceHandler() *AbsenceHandler {
+	return &AbsenceHandler{}
+}
+
+// AbsenceNoticeRequest структура для подачи заявления родителем
+type AbsenceNoticeRequest struct {
+	StartDate     string `json:"start_date" binding:"required"` // YYYY-MM-DD
+	EndDate       string `json:"end_date" binding:"required"`   // YYYY-MM-DD
+	Reason        string `json:"reason" binding:"required"`     // illness, medical, family, competition, other
+	Comment       string `json:"comment"`
+	AttachmentIDs []uint `json:"attachment_ids"` // Справка, загруженная через /api/attachments
+}
+
+// ReviewAbsenceRequest структура для рассмотрения заявления
+type ReviewAbsenceRequest struct {
+	Action  string `json:"action" binding:"required"` // approve, reject
+	Comment string `json:"comment"`
+}
+
+// SubmitAbsenceNotice подаёт заявление об отсутствии ребёнка
+func (h *AbsenceHandler) SubmitAbsenceNotice(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	childID, ok := parentChildID(c)
+	if !ok {
+		return
+	}
+
+	var req AbsenceNoticeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !absenceReasons[req.Reason] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reason"})
+		return
+	}
+
+	startDate, err := time.Parse(calendar.DateLayout, req.StartDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start_date format (use YYYY-MM-DD)"})
+		return
+	}
+	endDate, err := time.Parse(calendar.DateLayout, req.EndDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_date format (use YYYY-MM-DD)"})
+		return
+	}
+	if endDate.Before(startDate) || endDate.Sub(startDate) > maxAbsenceDays*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date range"})
+		return
+	}
+
+	// Заявление рассматривает классный руководитель класса ученика
+	var classID uint
+	database.DB.Table("class_students").
+		Where("user_id = ?", childID).
+		Limit(1).
+		Pluck("class_id", &classID)
+	if classID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Student is not assigned to a class"})
+		return
+	}
+
+	notice := models.AbsenceNotice{
+		StudentID:   uint(childID),
+		ClassID:     classID,
+		SubmittedBy: userID.(uint),
+		StartDate:   startDate,
+		EndDate:     endDate,
+		Reason:      req.Reason,
+		Comment:     req.Comment,
+		Status:      AbsencePending,
+	}
+
+	err = db(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&notice).Error; err != nil {
+			return err
+		}
+		return attachFiles(tx, req.AttachmentIDs, AttachmentAbsenceNotice, notice.ID, notice.SubmittedBy)
+	})
+	if errors.Is(err, errInvalidAttachments) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment IDs"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit absence notice"})
+		return
+	}
+
+	database.DB.Preload("Student").Preload("Class").Preload("Attachments").First(&notice, notice.ID)
+
+	c.JSON(http.StatusCreated, gin.H{"notice": notice})
+}
+
+// GetChildAbsenceNotices возвращает заявления по ребёнку
+func (h *AbsenceHandler) GetChildAbsenceNotices(c *gin.Context) {
+	childID, ok := parentChildID(c)
+	if !ok {
+		return
+	}
+
+	var notices []models.AbsenceNotice
+	if err := database.DB.Where("student_id = ?", childID).
+		Preload("Reviewer").
+		Preload("Attachments").
+		Order("start_date DESC").
+		Find(&notices).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch absence notices"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"notices": notices})
+}
+
+// WithdrawAbsenceNotice отзывает ещё не рассмотренное заявление (подавший родитель)
+func (h *AbsenceHandler) WithdrawAbsenceNotice(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notice ID"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	var notice models.AbsenceNotice
+	if err := database.DB.Where("id = ? AND submitted_by = ?", id, userID).First(&notice).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Absence notice not found"})
+		return
+	}
+
+	if notice.Status != AbsencePending {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only pending notices can be withdrawn"})
+		return
+	}
+
+	err = db(c).Transaction(func(tx *gorm.DB) error {
+		// Справки отвязываем - их можно приложить к новому заявлению
+		if err := tx.Model(&models.Attachment{}).
+			Where("owner_type = ? AND owner_id = ?", AttachmentAbsenceNotice, notice.ID).
+			Updates(map[string]interface{}{"owner_type": "", "owner_id": 0}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&notice).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to withdraw absence notice"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Absence notice withdrawn successfully"})
+}
+
+// ListAbsenceNotices возвращает заявления для рассмотрения: админу - по школе,
+// учителю - по классам, где он классный руководитель. Фильтры: status, class_id.
+func (h *AbsenceHandler) ListAbsenceNotices(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	schoolID, _ := c.Get("school_id")
+	role, _ := c.Get("role")
+
+	query := database.DB.
+		Joins("JOIN classes ON classes.id = absence_notices.class_id").
+		Where("classes.school_id = ?", schoolID).
+		Preload("Student").
+		Preload("Class").
+		Preload("Parent").
+		Preload("Reviewer").
+		Preload("Attachments")
+
+	if role != "admin" {
+		query = query.Where("classes.homeroom_teacher_id = ?", userID)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("absence_notices.status = ?", status)
+	}
+	if classID := c.Query("class_id"); classID != "" {
+		query = query.Where("absence_notices.class_id = ?", classID)
+	}
+
+	var notices []models.AbsenceNotice
+	if err := query.Order("absence_notices.created_at DESC").Find(&notices).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch absence notices"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"notices": notices})
+}
+
+// ReviewAbsenceNotice одобряет или отклоняет заявление. При одобрении пропуски
+// ученика за период становятся уважительными; отклонение ранее одобренного
+// заявления возвращает им статус absent.
+func (h *AbsenceHandler) ReviewAbsenceNotice(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notice ID"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	schoolID, _ := c.Get("school_id")
+
+	var req ReviewAbsenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var notice models.AbsenceNotice
+	if err := database.DB.
+		Joins("JOIN classes ON classes.id = absence_notices.class_id").
+		Where("absence_notices.id = ? AND classes.school_id = ?", id, schoolID).
+		Preload("Class").
+		First(&notice).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Absence notice not found"})
+		return
+	}
+
+	if !canReviewAbsence(c, &notice) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the homeroom teacher or an admin can review this notice"})
+		return
+	}
+
+	var status string
+	switch req.Action {
+	case "approve":
+		if notice.Status != AbsencePending {
+			c.JSON(http.StatusConflict, gin.H{"error": "Notice has already been reviewed"})
+			return
+		}
+		status = AbsenceApproved
+	case "reject":
+		if notice.Status == AbsenceRejected {
+			c.JSON(http.StatusConflict, gin.H{"error": "Notice has already been rejected"})
+			return
+		}
+		status = AbsenceRejected
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Action must be approve or reject"})
+		return
+	}
+
+	now := time.Now()
+	reviewerID := userID.(uint)
+	var affected int64
+
+	// Отметки меняются одним запросом, номер изменения для синхронизации берётся из счётчика школы
+	ctx := models.WithSyncSchool(c.Request.Context(), schoolID.(uint))
+	err = database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if status == AbsenceApproved {
+			result := tx.Model(&models.Attendance{}).
+				Where("student_id = ? AND status = ? AND date BETWEEN ? AND ?",
+					notice.StudentID, "absent", notice.StartDate, notice.EndDate).
+				Updates(map[string]interface{}{"status": "excused", "excuse_id": notice.ID})
+			if result.Error != nil {
+				return result.Error
+			}
+			affected = result.RowsAffected
+		} else if notice.Status == AbsenceApproved {
+			// Отзыв одобрения: возвращаем пропуски, уважительные только по этому заявлению
+			result := tx.Model(&models.Attendance{}).
+				Where("excuse_id = ?", notice.ID).
+				Updates(map[string]interface{}{"status": "absent", "excuse_id": nil})
+			if result.Error != nil {
+				return result.Error
+			}
+			affected = result.RowsAffected
+		}
+
+		notice.Status = status
+		notice.ReviewedBy = &reviewerID
+		notice.ReviewedAt = &now
+		notice.ReviewComment = req.Comment
+		return tx.Omit("Class").Save(&notice).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to review absence notice"})
+		return
+	}
+
+	database.DB.Preload("Student").Preload("Parent").Preload("Reviewer").Preload("Attachments").First(&notice, notice.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"notice":           notice,
+		"records_affected": affected,
+	})
+}
+
+// applyApprovedExcuse делает отметку об отсутствии уважительной, если на эту дату
+// у ученика есть одобренное заявление. Вызывается при отметке посещаемости,
+// чтобы заявление действовало и на пропуски, отмеченные после одобрения.
+func applyApprovedExcuse(tx *gorm.DB, attendance *models.Attendance) {
+	if attendance.Status != "absent" {
+		// Запись перестала быть пропуском - связь с заявлением больше не нужна
+		if attendance.Status != "excused" {
+			attendance.ExcuseID = nil
+		}
+		return
+	}
+
+	var notice models.AbsenceNotice
+	if err := tx.Where("student_id = ? AND status = ? AND start_date <= ? AND end_date >= ?",
+		attendance.StudentID, AbsenceApproved, attendance.Date, attendance.Date).
+		First(&notice).Error; err != nil {
+		return
+	}
+
+	attendance.Status = "excused"
+	attendance.ExcuseID = &notice.ID
+}
+
+// canReviewAbsence - заявление рассматривает админ или классный руководитель
+func canReviewAbsence(c *gin.Context, notice *models.AbsenceNotice) bool {
+	userID, _ := c.Get("user_id")
+	role, _ := c.Get("role")
+
+	if role == "admin" {
+		return true
+	}
+	return role == "teacher" && notice.Class.HomeroomTeacherID != nil && *notice.Class.HomeroomTeacherID == userID.(uint)
+}
+
+// parentChildID разбирает ID ребёнка и проверяет, что он связан с текущим
+// родителем. При ошибке пишет ответ.
+func parentChildID(c *gin.Context) (int, bool) {
+	userID, _ := c.Get("user_id")
+
+	childID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid child ID"})
+		return 0, false
+	}
+
+	var count int64
+	database.DB.Model(&models.ParentStudent{}).
+		Where("parent_id = ? AND student_id = ?", userID, childID).
+		Count(&count)
+	if count == 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return 0, false
+	}
+	return childID, true
+}
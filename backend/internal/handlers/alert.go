@@ -0,0 +1,426 @@
+package handlers
+
+import (
+	"classkeeper/internal/alerts"
+	"classkeeper/internal/database"
+	"classkeeper/internal/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+type AlertHandler struct{}
+
+func NewAlertHandler() *AlertHandler {
+	return &AlertHandler{}
+}
+
+// AlertRuleRequest структура для создания и изменения правила
+type AlertRuleRequest struct {
+	Name          string  `json:"name" binding:"required"`
+	Type          string  `json:"type" binding:"required"` // absence_rate, failing_streak, average_drop
+	SubjectID     *uint   `json:"subject_id"`
+	Threshold     float64 `json:"threshold"`
+	WindowDays    int     `json:"window_days"`
+	Streak        int     `json:"streak"`
+	Severity      string  `json:"severity"` // warning, critical
+	NotifyParents bool    `json:"notify_parents"`
+	Active        *bool   `json:"active"` // По умолчанию true
+}
+
+// ResolveAlertRequest структура для закрытия предупреждения
+type ResolveAlertRequest struct {
+	Resolution string `json:"resolution" binding:"required"` // Какие меры приняты
+}
+
+// CreateRule создаёт правило раннего предупреждения
+func (h *AlertHandler) CreateRule(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	schoolID, _ := c.Get("school_id")
+
+	var req AlertRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule := models.AlertRule{
+		SchoolID:  schoolID.(uint),
+		CreatedBy: userID.(uint),
+		Active:    true,
+	}
+	if msg := applyRuleRequest(&rule, &req); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	if err := db(c).Create(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create rule"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"rule": rule})
+}
+
+// ListRules возвращает правила школы
+func (h *AlertHandler) ListRules(c *gin.Context) {
+	schoolID, _ := c.Get("school_id")
+
+	var rules []models.AlertRule
+	if err := database.DB.Where("school_id = ?", schoolID).
+		Preload("Subject").
+		Order("id").
+		Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rules": rules})
+}
+
+// UpdateRule изменяет правило
+func (h *AlertHandler) UpdateRule(c *gin.Context) {
+	schoolID, _ := c.Get("school_id")
+
+	var rule models.AlertRule
+	if err := database.DB.Where("id = ? AND school_id = ?", c.Param("id"), schoolID).First(&rule).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+		return
+	}
+
+	var req AlertRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if msg := applyRuleRequest(&rule, &req); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	if err := db(c).Save(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update rule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rule": rule})
+}
+
+// DeleteRule удаляет правило. Уже открытые предупреждения остаются.
+func (h *AlertHandler) DeleteRule(c *gin.Context) {
+	schoolID, _ := c.Get("school_id")
+
+	result := db(c).Where("id = ? AND school_id = ?", c.Param("id"), schoolID).Delete(&models.AlertRule{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete rule"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Rule deleted successfully"})
+}
+
+// RunRules проверяет активные правила школы немедленно, не дожидаясь фоновой проверки
+func (h *AlertHandler) RunRules(c *gin.Context) {
+	schoolID, _ := c.Get("school_id")
+
+	var rules []models.AlertRule
+	query := database.DB.Where("school_id = ? AND active = ?", schoolID, true)
+	if ruleID := c.Query("rule_id"); ruleID != "" {
+		query = query.Where("id = ?", ruleID)
+	}
+	if err := query.Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch rules"})
+		return
+	}
+
+	opened := []models.StudentAlert{}
+	now := time.Now()
+	for i := range rules {
+		created, err := alerts.Evaluate(db(c), &rules[i], now)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to evaluate rule " + strconv.Itoa(int(rules[i].ID))})
+			return
+		}
+		opened = append(opened, created...)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"rules_checked": len(rules),
+		"opened":        len(opened),
+		"alerts":        opened,
+	})
+}
+
+// ListAlerts возвращает предупреждения: админу - по всей школе,
+// учителю - назначенные ему как классному руководителю
+func (h *AlertHandler) ListAlerts(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	schoolID, _ := c.Get("school_id")
+	role, _ := c.Get("role")
+
+	query := database.DB.Where("school_id = ?", schoolID)
+	if role != "admin" {
+		query = query.Where("assigned_to = ?", userID)
+	}
+
+	// По умолчанию показываем незакрытые
+	switch status := c.Query("status"); status {
+	case "":
+		query = query.Where("status <> ?", alerts.StatusResolved)
+	case "all":
+	default:
+		query = query.Where("status = ?", status)
+	}
+	if classID := c.Query("class_id"); classID != "" {
+		query = query.Where("class_id = ?", classID)
+	}
+	if studentID := c.Query("student_id"); studentID != "" {
+		query = query.Where("student_id = ?", studentID)
+	}
+	if severity := c.Query("severity"); severity != "" {
+		query = query.Where("severity = ?", severity)
+	}
+
+	var list []models.StudentAlert
+	if err := query.
+		Preload("Rule").
+		Preload("Student").
+		Preload("Class").
+		Preload("Subject").
+		Order("created_at DESC").
+		Find(&list).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch alerts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"alerts": list})
+}
+
+// GetAlert возвращает предупреждение
+func (h *AlertHandler) GetAlert(c *gin.Context) {
+	alert, ok := findAlert(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"alert": alert})
+}
+
+// AcknowledgeAlert отмечает, что предупреждение взято в работу
+func (h *AlertHandler) AcknowledgeAlert(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	alert, ok := findAlert(c)
+	if !ok {
+		return
+	}
+	if alert.Status != alerts.StatusOpen {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only open alerts can be acknowledged"})
+		return
+	}
+
+	now := time.Now()
+	by := userID.(uint)
+	alert.Status = alerts.StatusAcknowledged
+	alert.AcknowledgedBy = &by
+	alert.AcknowledgedAt = &now
+	if err := db(c).Omit(clause.Associations).Save(alert).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update alert"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"alert": alert})
+}
+
+// ResolveAlert закрывает предупреждение с описанием принятых мер
+func (h *AlertHandler) ResolveAlert(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req ResolveAlertRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	alert, ok := findAlert(c)
+	if !ok {
+		return
+	}
+	if alert.Status == alerts.StatusResolved {
+		c.JSON(http.StatusConflict, gin.H{"error": "Alert is already resolved"})
+		return
+	}
+
+	now := time.Now()
+	by := userID.(uint)
+	alert.Status = alerts.StatusResolved
+	alert.ResolvedBy = &by
+	alert.ResolvedAt = &now
+	alert.Resolution = req.Resolution
+	if err := db(c).Omit(clause.Associations).Save(alert).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update alert"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"alert": alert})
+}
+
+// NotifyParents уведомляет родителей ученика о предупреждении вручную
+func (h *AlertHandler) NotifyParents(c *gin.Context) {
+	alert, ok := findAlert(c)
+	if !ok {
+		return
+	}
+	if alert.ParentsNotified {
+		c.JSON(http.StatusConflict, gin.H{"error": "Parents have already been notified"})
+		return
+	}
+
+	notified, err := alerts.NotifyParents(db(c), alert)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to notify parents"})
+		return
+	}
+	if notified == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Student has no linked parents"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"alert": alert, "notified": notified})
+}
+
+// ListNotifications возвращает уведомления текущего пользователя
+func (h *AlertHandler) ListNotifications(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	query := database.DB.Where("user_id = ?", userID)
+	if c.Query("unread") == "true" {
+		query = query.Where("read_at IS NULL")
+	}
+
+	var notifications []models.Notification
+	if err := query.Order("created_at DESC").Limit(100).Find(&notifications).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"notifications": notifications})
+}
+
+// MarkNotificationRead отмечает уведомление прочитанным
+func (h *AlertHandler) MarkNotificationRead(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var notification models.Notification
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&notification).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return
+	}
+
+	if notification.ReadAt == nil {
+		now := time.Now()
+		notification.ReadAt = &now
+		db(c).Model(&notification).Update("read_at", now)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"notification": notification})
+}
+
+// findAlert загружает предупреждение, доступное текущему пользователю
+func findAlert(c *gin.Context) (*models.StudentAlert, bool) {
+	userID, _ := c.Get("user_id")
+	schoolID, _ := c.Get("school_id")
+	role, _ := c.Get("role")
+
+	var alert models.StudentAlert
+	if err := database.DB.Where("id = ? AND school_id = ?", c.Param("id"), schoolID).
+		Preload("Rule").
+		Preload("Student").
+		Preload("Class").
+		Preload("Subject").
+		First(&alert).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alert not found"})
+		return nil, false
+	}
+
+	if role != "admin" && (alert.AssignedTo == nil || *alert.AssignedTo != userID.(uint)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return nil, false
+	}
+
+	return &alert, true
+}
+
+// applyRuleRequest проверяет параметры правила и переносит их в модель
+func applyRuleRequest(rule *models.AlertRule, req *AlertRuleRequest) string {
+	if !alerts.RuleTypes[req.Type] {
+		return "Invalid rule type (use absence_rate, failing_streak or average_drop)"
+	}
+	if req.WindowDays < 0 || req.WindowDays > 365 {
+		return "window_days must be between 0 and 365"
+	}
+
+	if req.Type != alerts.RuleFailingStreak {
+		req.Streak = 0
+	}
+
+	switch req.Type {
+	case alerts.RuleAbsenceRate:
+		if req.Threshold <= 0 || req.Threshold >= 100 {
+			return "threshold must be a percentage between 0 and 100"
+		}
+	case alerts.RuleFailingStreak:
+		if req.Threshold == 0 {
+			req.Threshold = 2
+		}
+		if req.Threshold < 1 || req.Threshold > 5 {
+			return "threshold must be a grade between 1 and 5"
+		}
+		if req.Streak == 0 {
+			req.Streak = 3
+		}
+		if req.Streak < 2 || req.Streak > 10 {
+			return "streak must be between 2 and 10"
+		}
+	case alerts.RuleAverageDrop:
+		if req.Threshold <= 0 || req.Threshold >= 4 {
+			return "threshold must be a grade difference between 0 and 4"
+		}
+	}
+
+	switch req.Severity {
+	case "":
+		req.Severity = alerts.SeverityWarning
+	case alerts.SeverityWarning, alerts.SeverityCritical:
+	default:
+		return "Invalid severity (use warning or critical)"
+	}
+
+	if req.SubjectID != nil {
+		var count int64
+		database.DB.Model(&models.Subject{}).Where("id = ? AND school_id = ?", *req.SubjectID, rule.SchoolID).Count(&count)
+		if count == 0 {
+			return "Subject not found"
+		}
+	}
+
+	rule.Name = req.Name
+	rule.Type = req.Type
+	rule.SubjectID = req.SubjectID
+	rule.Threshold = req.Threshold
+	rule.WindowDays = req.WindowDays
+	rule.Streak = req.Streak
+	rule.Severity = req.Severity
+	rule.NotifyParents = req.NotifyParents
+	if req.Active != nil {
+		rule.Active = *req.Active
+	}
+	return ""
+}
@@ -1,9 +1,11 @@
 package handlers
 
 import (
+	"classkeeper/internal/calendar"
 	"classkeeper/internal/database"
 	"classkeeper/internal/models"
 	"net/http"
+	"sort"
 	"strconv"
 	"time"
 
@@ -51,15 +53,14 @@ func (h *AnalyticsHandler) GetSchoolStats(c *gin.Context) {
 		Count(&stats.TotalSchedules)
 
 	// Считаем оценки
-	database.DB.Table("grades").
+	database.DB.Model(&models.Grade{}).
 		Joins("JOIN users ON users.id = grades.student_id").
 		Where("users.school_id = ?", schoolID).
 		Count(&stats.TotalGrades)
 
 	// Считаем ДЗ
 	database.DB.Table("homeworks").
-		Joins("JOIN schedules ON schedules.id = homeworks.schedule_id").
-		Joins("JOIN classes ON classes.id = schedules.class_id").
+		Joins("JOIN classes ON classes.id = homeworks.class_id").
 		Where("classes.school_id = ?", schoolID).
 		Count(&stats.TotalHomework)
 
@@ -88,7 +89,7 @@ func (h *AnalyticsHandler) GetClassStats(c *gin.Context) {
 	var avgGrade struct {
 		Average float64
 	}
-	database.DB.Table("grades").
+	database.DB.Model(&models.Grade{}).
 		Joins("JOIN users ON users.id = grades.student_id").
 		Joins("JOIN class_students ON class_students.user_id = users.id").
 		Where("class_students.class_id = ?", classID).
@@ -100,14 +101,12 @@ func (h *AnalyticsHandler) GetClassStats(c *gin.Context) {
 		Total   int64
 		Present int64
 	}
-	database.DB.Table("attendances").
-		Joins("JOIN schedules ON schedules.id = attendances.schedule_id").
-		Where("schedules.class_id = ?", classID).
+	database.DB.Model(&models.Attendance{}).
+		Where("class_id = ?", classID).
 		Count(&attendance.Total)
 
-	database.DB.Table("attendances").
-		Joins("JOIN schedules ON schedules.id = attendances.schedule_id").
-		Where("schedules.class_id = ? AND attendances.status = ?", classID, "present").
+	database.DB.Model(&models.Attendance{}).
+		Where("class_id = ? AND status = ?", classID, "present").
 		Count(&attendance.Present)
 
 	var attendancePercentage float64
@@ -155,37 +154,91 @@ func (h *AnalyticsHandler) GetAttendanceReport(c *gin.Context) {
 		Percentage  float64 `json:"percentage"`
 	}
 
+	from, errFrom := time.Parse(calendar.DateLayout, dateFrom)
+	to, errTo := time.Parse(calendar.DateLayout, dateTo)
+	if errFrom != nil || errTo != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format (use YYYY-MM-DD)"})
+		return
+	}
+
+	// Отметки считаются по дням: праздники и каникулы не учитываются в проценте
+	// посещаемости, а учебный день или нет, решает календарь класса отметки
 	query := `
 		SELECT 
 			users.id as student_id,
-			CONCAT(users.first_name, ' ', users.last_name) as student_name,
+			(users.first_name || ' ' || users.last_name) as student_name,
+			classes.id as class_id,
 			classes.name as class_name,
-			COUNT(*) as total,
-			SUM(CASE WHEN attendances.status = 'present' THEN 1 ELSE 0 END) as present,
-			SUM(CASE WHEN attendances.status = 'absent' THEN 1 ELSE 0 END) as absent,
-			SUM(CASE WHEN attendances.status = 'late' THEN 1 ELSE 0 END) as late,
-			SUM(CASE WHEN attendances.status = 'sick' THEN 1 ELSE 0 END) as sick,
-			SUM(CASE WHEN attendances.status = 'excused' THEN 1 ELSE 0 END) as excused,
-			(SUM(CASE WHEN attendances.status = 'present' THEN 1 ELSE 0 END) * 100.0 / COUNT(*)) as percentage
+			attendances.date as date,
+			attendances.status as status,
+			COUNT(*) as count
 		FROM attendances
 		JOIN users ON users.id = attendances.student_id
-		JOIN schedules ON schedules.id = attendances.schedule_id
-		JOIN classes ON classes.id = schedules.class_id
+		JOIN classes ON classes.id = attendances.class_id
 		WHERE users.school_id = ?
+			AND attendances.deleted_at IS NULL
 			AND attendances.date BETWEEN ? AND ?
 	`
 
-	args := []interface{}{schoolID, dateFrom, dateTo}
+	args := []interface{}{schoolID, from, to}
 
 	if classID != "" {
 		query += " AND classes.id = ?"
 		args = append(args, classID)
 	}
 
-	query += " GROUP BY users.id, student_name, class_name ORDER BY percentage DESC"
+	query += " GROUP BY users.id, student_name, classes.id, class_name, attendances.date, attendances.status ORDER BY users.id, classes.id"
 
-	var reports []AttendanceReport
-	database.DB.Raw(query, args...).Scan(&reports)
+	var days []struct {
+		StudentID   uint
+		StudentName string
+		ClassID     uint
+		ClassName   string
+		Date        string // SQLite отдаёт дату текстом, PostgreSQL - временем
+		Status      string
+		Count       int
+	}
+	if err := database.DB.Raw(query, args...).Scan(&days).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build attendance report"})
+		return
+	}
+
+	working := newWorkingDays(schoolID.(uint), from, to)
+	reports := []AttendanceReport{}
+	index := make(map[[2]uint]int)
+	for _, day := range days {
+		if !working.contains(day.ClassID, day.Date) {
+			continue
+		}
+		key := [2]uint{day.StudentID, day.ClassID}
+		i, ok := index[key]
+		if !ok {
+			i = len(reports)
+			index[key] = i
+			reports = append(reports, AttendanceReport{StudentID: day.StudentID, StudentName: day.StudentName, ClassName: day.ClassName})
+		}
+		report := &reports[i]
+		n := int64(day.Count)
+		report.Total += n
+		switch day.Status {
+		case "present":
+			report.Present += n
+		case "absent":
+			report.Absent += n
+		case "late":
+			report.Late += n
+		case "sick":
+			report.Sick += n
+		case "excused":
+			report.Excused += n
+		}
+	}
+	for i := range reports {
+		reports[i].Percentage = float64(reports[i].Present) * 100.0 / float64(reports[i].Total)
+	}
+	sort.SliceStable(reports, func(i, j int) bool {
+		return reports[i].Percentage > reports[j].Percentage
+	})
 
 	c.JSON(http.StatusOK, gin.H{
 		"date_from": dateFrom,
@@ -225,7 +278,7 @@ func (h *AnalyticsHandler) GetGradesReport(c *gin.Context) {
 	query := `
 		SELECT 
 			users.id as student_id,
-			CONCAT(users.first_name, ' ', users.last_name) as student_name,
+			(users.first_name || ' ' || users.last_name) as student_name,
 			classes.name as class_name,
 			subjects.name as subject_name,
 			AVG(grades.grade) as average,
@@ -241,6 +294,7 @@ func (h *AnalyticsHandler) GetGradesReport(c *gin.Context) {
 		JOIN classes ON classes.id = class_students.class_id
 		WHERE users.school_id = ?
 			AND grades.date BETWEEN ? AND ?
+			AND grades.deleted_at IS NULL
 	`
 
 	args := []interface{}{schoolID, dateFrom, dateTo}
@@ -410,7 +464,7 @@ func (h *AnalyticsHandler) CompareClasses(c *gin.Context) {
 		var avgGrade struct {
 			Average float64
 		}
-		database.DB.Table("grades").
+		database.DB.Model(&models.Grade{}).
 			Joins("JOIN users ON users.id = grades.student_id").
 			Joins("JOIN class_students ON class_students.user_id = users.id").
 			Where("class_students.class_id = ?", class.ID).
@@ -423,14 +477,12 @@ func (h *AnalyticsHandler) CompareClasses(c *gin.Context) {
 			Total   int64
 			Present int64
 		}
-		database.DB.Table("attendances").
-			Joins("JOIN schedules ON schedules.id = attendances.schedule_id").
-			Where("schedules.class_id = ?", class.ID).
+		database.DB.Model(&models.Attendance{}).
+			Where("class_id = ?", class.ID).
 			Count(&attendance.Total)
 
-		database.DB.Table("attendances").
-			Joins("JOIN schedules ON schedules.id = attendances.schedule_id").
-			Where("schedules.class_id = ? AND attendances.status = ?", class.ID, "present").
+		database.DB.Model(&models.Attendance{}).
+			Where("class_id = ? AND status = ?", class.ID, "present").
 			Count(&attendance.Present)
 
 		if attendance.Total > 0 {
@@ -3,10 +3,12 @@ package handlers
 import (
 	"classkeeper/internal/database"
 	"classkeeper/internal/models"
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type AnnouncementHandler struct{}
@@ -21,6 +23,7 @@ type CreateAnnouncementRequest struct {
 	Content       string `json:"content" binding:"required"`
 	TargetRole    string `json:"target_role"`    // all, teachers, students, parents
 	TargetClassID *uint  `json:"target_class_id,omitempty"`
+	AttachmentIDs []uint `json:"attachment_ids"` // Файлы, загруженные через /api/attachments
 }
 
 // CreateAnnouncement создает объявление
@@ -69,13 +72,23 @@ func (h *AnnouncementHandler) CreateAnnouncement(c *gin.Context) {
 		TargetClassID: req.TargetClassID,
 	}
 
-	if err := database.DB.Create(&announcement).Error; err != nil {
+	err := db(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&announcement).Error; err != nil {
+			return err
+		}
+		return attachFiles(tx, req.AttachmentIDs, AttachmentAnnouncement, announcement.ID, announcement.AuthorID)
+	})
+	if errors.Is(err, errInvalidAttachments) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment IDs"})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create announcement"})
 		return
 	}
 
 	// Загружаем связи
-	database.DB.Preload("Author").Preload("TargetClass").First(&announcement, announcement.ID)
+	database.DB.Preload("Author").Preload("TargetClass").Preload("Attachments").First(&announcement, announcement.ID)
 
 	c.JSON(http.StatusCreated, gin.H{"announcement": announcement})
 }
@@ -156,6 +169,7 @@ func (h *AnnouncementHandler) GetAnnouncement(c *gin.Context) {
 	if err := database.DB.Where("id = ? AND school_id = ?", id, schoolID).
 		Preload("Author").
 		Preload("TargetClass").
+		Preload("Attachments").
 		First(&announcement).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Announcement not found"})
 		return
@@ -199,7 +213,7 @@ func (h *AnnouncementHandler) UpdateAnnouncement(c *gin.Context) {
 	announcement.TargetRole = req.TargetRole
 	announcement.TargetClassID = req.TargetClassID
 
-	if err := database.DB.Save(&announcement).Error; err != nil {
+	if err := db(c).Save(&announcement).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update announcement"})
 		return
 	}
@@ -233,7 +247,7 @@ func (h *AnnouncementHandler) DeleteAnnouncement(c *gin.Context) {
 		return
 	}
 
-	if err := database.DB.Delete(&announcement).Error; err != nil {
+	if err := db(c).Delete(&announcement).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete announcement"})
 		return
 	}
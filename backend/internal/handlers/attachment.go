@@ -0,0 +1,582 @@
+package handlers
+
+import (
+	"bytes"
+	"classkeeper/internal/config"
+	"classkeeper/internal/database"
+	"classkeeper/internal/models"
+	"classkeeper/internal/storage"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Типы владельцев вложений
+const (
+	AttachmentHomework      = "homework"
+	AttachmentAnnouncement  = "announcement"
+	AttachmentSubmission    = "submission"
+	AttachmentAvatar        = "avatar"
+	AttachmentSchoolLogo    = "school_logo"
+	AttachmentAbsenceNotice = "absence_notice"
+)
+
+// errQuotaExceeded - файл не помещается в квоту школы
+var errQuotaExceeded = errors.New("school storage quota exceeded")
+
+// errInvalidAttachments - среди переданных ID есть чужие, уже привязанные или несуществующие файлы
+var errInvalidAttachments = errors.New("invalid attachment IDs")
+
+type AttachmentHandler struct {
+	cfg   *config.Config
+	store storage.Backend
+}
+
+func NewAttachmentHandler(cfg *config.Config, store storage.Backend) *AttachmentHandler {
+	return &AttachmentHandler{cfg: cfg, store: store}
+}
+
+// UploadAttachment загружает файл (multipart, поле file).
+// Поле owner_type может быть avatar или school_logo - тогда файл сразу
+// становится аватаром пользователя или логотипом школы. Файлы для ДЗ,
+// объявлений и сдач прикрепляются через attachment_ids соответствующих методов.
+func (h *AttachmentHandler) UploadAttachment(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	schoolID, _ := c.Get("school_id")
+	role, _ := c.Get("role")
+
+	limits := h.cfg.Storage
+	// Запас на служебные части multipart-запроса
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limits.MaxFileSize+1<<20)
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File is required (multipart field 'file')"})
+		return
+	}
+
+	if header.Size > limits.MaxFileSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":    "File is too large",
+			"max_size": limits.MaxFileSize,
+		})
+		return
+	}
+
+	ownerType := c.PostForm("owner_type")
+	switch ownerType {
+	case "", AttachmentAvatar:
+	case AttachmentSchoolLogo:
+		if role != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can upload the school logo"})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "owner_type must be avatar or school_logo"})
+		return
+	}
+
+	// Квота школы. Здесь проверка только отсекает заведомо лишние файлы до записи
+	// в хранилище; окончательная - в транзакции создания вложения.
+	if used := schoolStorageUsed(database.DB, schoolID.(uint)); used+header.Size > limits.SchoolQuota {
+		quotaExceeded(c, used, limits.SchoolQuota)
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer file.Close()
+
+	// Тип определяем по содержимому, а не по заголовку клиента
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(file, head)
+	head = head[:n]
+	contentType := detectContentType(head, header.Filename)
+	if !isAllowedType(contentType, limits.AllowedTypes) {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{
+			"error":        "File type is not allowed",
+			"content_type": contentType,
+		})
+		return
+	}
+	if (ownerType == AttachmentAvatar || ownerType == AttachmentSchoolLogo) && !strings.HasPrefix(contentType, "image/") {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Only images can be used as avatar or logo"})
+		return
+	}
+
+	key, err := storage.NewKey(schoolID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate storage key"})
+		return
+	}
+
+	hash := sha256.New()
+	body := io.TeeReader(io.MultiReader(bytes.NewReader(head), file), hash)
+	if err := h.store.Put(c.Request.Context(), key, body, header.Size, contentType); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store file"})
+		return
+	}
+
+	attachment := models.Attachment{
+		SchoolID:    schoolID.(uint),
+		UploadedBy:  userID.(uint),
+		FileName:    filepath.Base(header.Filename),
+		ContentType: contentType,
+		Size:        header.Size,
+		Checksum:    hex.EncodeToString(hash.Sum(nil)),
+		StorageKey:  key,
+		Backend:     h.store.Name(),
+	}
+
+	var used int64
+	err = db(c).Transaction(func(tx *gorm.DB) error {
+		// Параллельные загрузки школы ждут друг друга на блокировке строки школы
+		// (в SQLite запись и так выполняется по одной), поэтому занятое место
+		// считается вместе с уже сохранёнными файлами
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&models.School{}, schoolID).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&attachment).Error; err != nil {
+			return err
+		}
+		if used = schoolStorageUsed(tx, attachment.SchoolID); used > limits.SchoolQuota {
+			used -= attachment.Size
+			return errQuotaExceeded
+		}
+		return h.applyOwner(tx, &attachment, ownerType)
+	})
+	if err != nil {
+		h.store.Delete(c.Request.Context(), key)
+		if errors.Is(err, errQuotaExceeded) {
+			quotaExceeded(c, used, limits.SchoolQuota)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save attachment"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"attachment": attachment})
+}
+
+// schoolStorageUsed возвращает место, занятое файлами школы
+func schoolStorageUsed(tx *gorm.DB, schoolID uint) int64 {
+	var used int64
+	tx.Model(&models.Attachment{}).
+		Where("school_id = ?", schoolID).
+		Select("COALESCE(SUM(size), 0)").
+		Scan(&used)
+	return used
+}
+
+func quotaExceeded(c *gin.Context, used, quota int64) {
+	c.JSON(http.StatusInsufficientStorage, gin.H{
+		"error": "School storage quota exceeded",
+		"used":  used,
+		"quota": quota,
+	})
+}
+
+// applyOwner делает загруженное изображение аватаром или логотипом, заменяя предыдущее.
+// В профиль записывается публичная ссылка: скачивание с авторизацией <img> не загрузит.
+func (h *AttachmentHandler) applyOwner(tx *gorm.DB, attachment *models.Attachment, ownerType string) error {
+	var ownerID uint
+	var update *gorm.DB
+	url := storage.ImageURL(attachment.ID, attachment.Checksum)
+
+	switch ownerType {
+	case AttachmentAvatar:
+		ownerID = attachment.UploadedBy
+		update = tx.Model(&models.User{}).Where("id = ?", ownerID).Update("avatar_url", url)
+	case AttachmentSchoolLogo:
+		ownerID = attachment.SchoolID
+		update = tx.Model(&models.School{}).Where("id = ?", ownerID).Update("logo_url", url)
+	default:
+		return nil
+	}
+	if update.Error != nil {
+		return update.Error
+	}
+
+	// Старое изображение отвязываем - оно больше не используется
+	if err := tx.Model(&models.Attachment{}).
+		Where("owner_type = ? AND owner_id = ? AND id <> ?", ownerType, ownerID, attachment.ID).
+		Updates(map[string]interface{}{"owner_type": "", "owner_id": 0}).Error; err != nil {
+		return err
+	}
+
+	attachment.OwnerType = ownerType
+	attachment.OwnerID = ownerID
+	return tx.Save(attachment).Error
+}
+
+// GetAttachment возвращает метаданные файла
+func (h *AttachmentHandler) GetAttachment(c *gin.Context) {
+	attachment, ok := findReadableAttachment(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"attachment": attachment})
+}
+
+// GetAttachmentLink выдаёт подписанную ссылку на скачивание с ограниченным сроком действия.
+// По ссылке файл доступен без токена авторизации (для <img>, мобильных клиентов и т.д.)
+func (h *AttachmentHandler) GetAttachmentLink(c *gin.Context) {
+	attachment, ok := findReadableAttachment(c)
+	if !ok {
+		return
+	}
+
+	expires := time.Now().Add(h.cfg.Storage.LinkTTL)
+	signature := storage.SignLink(h.cfg.Storage.SigningSecret, attachment.ID, expires)
+
+	c.JSON(http.StatusOK, gin.H{
+		"url": fmt.Sprintf("%s/api/files/%d?expires=%d&sig=%s",
+			publicBaseURL(c, h.cfg), attachment.ID, expires.Unix(), signature),
+		"expires_at": expires,
+	})
+}
+
+// DownloadAttachment отдаёт файл авторизованному пользователю
+func (h *AttachmentHandler) DownloadAttachment(c *gin.Context) {
+	attachment, ok := findReadableAttachment(c)
+	if !ok {
+		return
+	}
+
+	h.serveFile(c, attachment)
+}
+
+// ServeSignedFile отдаёт файл по подписанной ссылке (публичный маршрут)
+func (h *AttachmentHandler) ServeSignedFile(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment ID"})
+		return
+	}
+
+	if !storage.VerifyLink(h.cfg.Storage.SigningSecret, uint(id), c.Query("expires"), c.Query("sig")) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Link is invalid or expired"})
+		return
+	}
+
+	var attachment models.Attachment
+	if err := database.DB.First(&attachment, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return
+	}
+
+	h.serveFile(c, &attachment)
+}
+
+// ServeImage отдаёт аватар или логотип по публичной ссылке из профиля (публичный
+// маршрут). Отдаются только текущие изображения: заменённое или удалённое перестаёт
+// открываться.
+func (h *AttachmentHandler) ServeImage(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment ID"})
+		return
+	}
+
+	var attachment models.Attachment
+	if err := database.DB.Where("id = ? AND owner_type IN ?", id, []string{AttachmentAvatar, AttachmentSchoolLogo}).
+		First(&attachment).Error; err != nil ||
+		subtle.ConstantTimeCompare([]byte(attachment.Checksum), []byte(c.Param("checksum"))) != 1 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+		return
+	}
+
+	h.serveFile(c, &attachment)
+}
+
+func (h *AttachmentHandler) serveFile(c *gin.Context, attachment *models.Attachment) {
+	if attachment.Backend != h.store.Name() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "File is stored in a different storage backend"})
+		return
+	}
+
+	reader, err := h.store.Get(c.Request.Context(), attachment.StorageKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File content not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer reader.Close()
+
+	disposition := "attachment"
+	if strings.HasPrefix(attachment.ContentType, "image/") || attachment.ContentType == "application/pdf" {
+		disposition = "inline"
+	}
+
+	c.DataFromReader(http.StatusOK, attachment.Size, attachment.ContentType, reader, map[string]string{
+		"Content-Disposition":    mime.FormatMediaType(disposition, map[string]string{"filename": attachment.FileName}),
+		"ETag":                   `"` + attachment.Checksum + `"`,
+		"X-Content-Type-Options": "nosniff",
+	})
+}
+
+// DeleteAttachment удаляет файл (загрузивший пользователь или админ школы)
+func (h *AttachmentHandler) DeleteAttachment(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment ID"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	schoolID, _ := c.Get("school_id")
+	role, _ := c.Get("role")
+
+	var attachment models.Attachment
+	if err := database.DB.Where("id = ? AND school_id = ?", id, schoolID).First(&attachment).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return
+	}
+
+	if attachment.UploadedBy != userID.(uint) && role != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	err = db(c).Transaction(func(tx *gorm.DB) error {
+		// Сбрасываем ссылку на аватар/логотип, если удаляется текущее изображение
+		url := storage.ImageURL(attachment.ID, attachment.Checksum)
+		switch attachment.OwnerType {
+		case AttachmentAvatar:
+			tx.Model(&models.User{}).Where("id = ? AND avatar_url = ?", attachment.OwnerID, url).Update("avatar_url", "")
+		case AttachmentSchoolLogo:
+			tx.Model(&models.School{}).Where("id = ? AND logo_url = ?", attachment.OwnerID, url).Update("logo_url", "")
+		}
+		return tx.Delete(&attachment).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete attachment"})
+		return
+	}
+
+	if attachment.Backend == h.store.Name() {
+		h.store.Delete(c.Request.Context(), attachment.StorageKey)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Attachment deleted successfully"})
+}
+
+// GetStorageUsage возвращает занятое школой место и квоту
+func (h *AttachmentHandler) GetStorageUsage(c *gin.Context) {
+	schoolID, _ := c.Get("school_id")
+
+	var usage struct {
+		Files int64
+		Bytes int64
+	}
+	database.DB.Model(&models.Attachment{}).
+		Where("school_id = ?", schoolID).
+		Select("COUNT(*) AS files, COALESCE(SUM(size), 0) AS bytes").
+		Scan(&usage)
+
+	c.JSON(http.StatusOK, gin.H{
+		"files":         usage.Files,
+		"used_bytes":    usage.Bytes,
+		"quota_bytes":   h.cfg.Storage.SchoolQuota,
+		"max_file_size": h.cfg.Storage.MaxFileSize,
+		"allowed_types": h.cfg.Storage.AllowedTypes,
+	})
+}
+
+// findReadableAttachment находит вложение и проверяет право на чтение. При ошибке пишет ответ.
+func findReadableAttachment(c *gin.Context) (*models.Attachment, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment ID"})
+		return nil, false
+	}
+
+	schoolID, _ := c.Get("school_id")
+
+	var attachment models.Attachment
+	if err := database.DB.Where("id = ? AND school_id = ?", id, schoolID).First(&attachment).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return nil, false
+	}
+
+	if !canReadAttachment(c, &attachment) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return nil, false
+	}
+	return &attachment, true
+}
+
+// canReadAttachment проверяет доступ к файлу по правилам его владельца
+func canReadAttachment(c *gin.Context, attachment *models.Attachment) bool {
+	userID, _ := c.Get("user_id")
+	role, _ := c.Get("role")
+
+	if role == "admin" || attachment.UploadedBy == userID.(uint) {
+		return true
+	}
+
+	switch attachment.OwnerType {
+	case AttachmentAvatar, AttachmentSchoolLogo, AttachmentAnnouncement:
+		// Видны всей школе
+		return true
+
+	case AttachmentHomework:
+		var homework models.Homework
+		if err := database.DB.First(&homework, attachment.OwnerID).Error; err != nil {
+			return false
+		}
+		return canSeeClass(c, homework.ClassID)
+
+	case AttachmentSubmission:
+		var submission models.HomeworkSubmission
+		if err := database.DB.Preload("Homework").First(&submission, attachment.OwnerID).Error; err != nil {
+			return false
+		}
+		if submission.StudentID == userID.(uint) {
+			return true
+		}
+		if role == "parent" {
+			var count int64
+			database.DB.Model(&models.ParentStudent{}).
+				Where("parent_id = ? AND student_id = ?", userID, submission.StudentID).
+				Count(&count)
+			return count > 0
+		}
+		return canReviewHomework(c, &submission.Homework)
+
+	case AttachmentAbsenceNotice:
+		// Справку видят родители ученика и классный руководитель
+		var notice models.AbsenceNotice
+		if err := database.DB.Preload("Class").First(&notice, attachment.OwnerID).Error; err != nil {
+			return false
+		}
+		if role == "parent" {
+			var count int64
+			database.DB.Model(&models.ParentStudent{}).
+				Where("parent_id = ? AND student_id = ?", userID, notice.StudentID).
+				Count(&count)
+			return count > 0
+		}
+		return canReviewAbsence(c, &notice)
+	}
+
+	// Непривязанный файл видит только загрузивший его
+	return false
+}
+
+// canSeeClass проверяет, относится ли класс к пользователю (учителя видят все классы школы)
+func canSeeClass(c *gin.Context, classID uint) bool {
+	userID, _ := c.Get("user_id")
+	role, _ := c.Get("role")
+
+	if role == "admin" || role == "teacher" {
+		return true
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		return false
+	}
+	for _, id := range classIDsForUser(&user) {
+		if id == classID {
+			return true
+		}
+	}
+	return false
+}
+
+// attachFiles привязывает ранее загруженные файлы к владельцу.
+// Прикреплять можно только свои ещё не привязанные файлы.
+func attachFiles(tx *gorm.DB, ids []uint, ownerType string, ownerID, userID uint) error {
+	unique := make(map[uint]bool)
+	for _, id := range ids {
+		unique[id] = true
+	}
+	if len(unique) == 0 {
+		return nil
+	}
+
+	list := make([]uint, 0, len(unique))
+	for id := range unique {
+		list = append(list, id)
+	}
+
+	result := tx.Model(&models.Attachment{}).
+		Where("id IN ? AND uploaded_by = ?", list, userID).
+		Where("owner_type = '' OR (owner_type = ? AND owner_id = ?)", ownerType, ownerID).
+		Updates(map[string]interface{}{"owner_type": ownerType, "owner_id": ownerID})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected != int64(len(list)) {
+		return errInvalidAttachments
+	}
+	return nil
+}
+
+// detectContentType определяет MIME-тип по содержимому файла, уточняя его по
+// расширению для форматов, которые сигнатурой не различить (docx, xlsx - это zip)
+func detectContentType(head []byte, fileName string) string {
+	detected := http.DetectContentType(head)
+	if mediaType, _, err := mime.ParseMediaType(detected); err == nil {
+		detected = mediaType
+	}
+
+	switch detected {
+	case "application/octet-stream", "application/zip", "text/plain":
+		if byExt := mime.TypeByExtension(strings.ToLower(filepath.Ext(fileName))); byExt != "" {
+			if mediaType, _, err := mime.ParseMediaType(byExt); err == nil {
+				// Текстовый файл нельзя выдать за бинарный формат и наоборот
+				if detected != "text/plain" || strings.HasPrefix(mediaType, "text/") {
+					return mediaType
+				}
+			}
+		}
+	}
+	return detected
+}
+
+// isAllowedType проверяет MIME-тип по списку (поддерживается маска вида image/*)
+func isAllowedType(contentType string, allowed []string) bool {
+	for _, pattern := range allowed {
+		if pattern == contentType {
+			return true
+		}
+		if strings.HasSuffix(pattern, "/*") && strings.HasPrefix(contentType, strings.TrimSuffix(pattern, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// publicBaseURL возвращает внешний адрес сервера для ссылок
+func publicBaseURL(c *gin.Context, cfg *config.Config) string {
+	if cfg.Server.PublicURL != "" {
+		return strings.TrimRight(cfg.Server.PublicURL, "/")
+	}
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
@@ -1,13 +1,17 @@
 package handlers
 
 import (
+	"classkeeper/internal/calendar"
 	"classkeeper/internal/database"
 	"classkeeper/internal/models"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type AttendanceHandler struct{}
@@ -18,24 +22,55 @@ func NewAttendanceHandler() *AttendanceHandler {
 
 // BulkAttendanceRequest структура для массовой отметки посещаемости
 type BulkAttendanceRequest struct {
+	Mode    string             `json:"mode"` // atomic (по умолчанию), partial, validate
 	Records []AttendanceRecord `json:"records" binding:"required"`
 }
 
 type AttendanceRecord struct {
 	StudentID    uint   `json:"student_id" binding:"required"`
-	ClassID      uint   `json:"class_id" binding:"required"`
+	ClassID      uint   `json:"class_id"`              // Можно не указывать, если задан schedule_id
+	ScheduleID   *uint  `json:"schedule_id,omitempty"` // Урок расписания: класс, предмет и номер урока берутся из него
 	SubjectID    *uint  `json:"subject_id,omitempty"`
 	Date         string `json:"date" binding:"required"` // YYYY-MM-DD
 	LessonNumber *int   `json:"lesson_number,omitempty"`
 	Status       string `json:"status" binding:"required"` // present, absent, late, excused
+	MinutesLate  int    `json:"minutes_late,omitempty"`     // Только для статуса late
 	Comment      string `json:"comment,omitempty"`
 }
 
-// BulkMarkAttendance массовая отметка посещаемости
+// attendanceStatuses - допустимые статусы отметки
+var attendanceStatuses = map[string]bool{
+	"present": true,
+	"absent":  true,
+	"late":    true,
+	"excused": true,
+}
+
+// maxMinutesLate - опоздание больше урока уже не опоздание, а пропуск
+const maxMinutesLate = 45
+
+// validateLateness проверяет статус и минуты опоздания, обнуляя минуты для прочих статусов
+func validateLateness(status string, minutesLate *int) string {
+	if !attendanceStatuses[status] {
+		return "Invalid status (use present, absent, late or excused)"
+	}
+	if status != "late" {
+		*minutesLate = 0
+		return ""
+	}
+	if *minutesLate < 1 || *minutesLate > maxMinutesLate {
+		return fmt.Sprintf("minutes_late must be between 1 and %d for late status", maxMinutesLate)
+	}
+	return ""
+}
+
+// BulkMarkAttendance массовая отметка посещаемости в одной транзакции с отчётом по каждой записи
 func (h *AttendanceHandler) BulkMarkAttendance(c *gin.Context) {
-	userID, _ := c.Get("user_id")
-	schoolID, _ := c.Get("school_id")
 	role, _ := c.Get("role")
+	if role != "admin" && role != "teacher" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins and teachers can mark attendance"})
+		return
+	}
 
 	var req BulkAttendanceRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -43,80 +78,174 @@ func (h *AttendanceHandler) BulkMarkAttendance(c *gin.Context) {
 		return
 	}
 
-	// Проверяем права
-	if role != "admin" && role != "teacher" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins and teachers can mark attendance"})
+	mode, ok := parseBulkMode(c, req.Mode, len(req.Records), maxBulkItems)
+	if !ok {
 		return
 	}
 
-	var attendances []models.Attendance
-
-	for _, record := range req.Records {
-		// Проверяем класс
-		var class models.Class
-		if err := database.DB.Where("id = ? AND school_id = ?", record.ClassID, schoolID).First(&class).Error; err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Class not found"})
-			return
+	marker := newAttendanceMarker(c)
+	attendances := make([]models.Attendance, 0, len(req.Records))
+	report, err := runBulk(c, mode, len(req.Records), func(tx *gorm.DB, i int) (uint, interface{}, error) {
+		attendance, err := marker.mark(tx, req.Records[i])
+		if err != nil {
+			return 0, nil, err
 		}
+		attendances = append(attendances, *attendance)
+		return attendance.ID, nil, nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark attendance"})
+		return
+	}
 
-		// Проверяем ученика
-		var student models.User
-		if err := database.DB.Where("id = ? AND school_id = ? AND role = ?", record.StudentID, schoolID, "student").First(&student).Error; err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Student not found"})
-			return
+	extra := gin.H{}
+	if report.Committed {
+		extra["attendance"] = attendances
+	}
+	respondBulk(c, report, extra)
+}
+
+// attendanceMarker сохраняет отметки посещаемости, кэшируя классы,
+// уроки и учеников на время запроса
+type attendanceMarker struct {
+	schoolID  interface{}
+	userID    uint
+	classes   map[uint]*models.Class
+	schedules map[uint]*models.Schedule
+	students  map[uint]bool
+}
+
+func newAttendanceMarker(c *gin.Context) *attendanceMarker {
+	userID, _ := c.Get("user_id")
+	schoolID, _ := c.Get("school_id")
+	return &attendanceMarker{
+		schoolID:  schoolID,
+		userID:    userID.(uint),
+		classes:   make(map[uint]*models.Class),
+		schedules: make(map[uint]*models.Schedule),
+		students:  make(map[uint]bool),
+	}
+}
+
+// mark проверяет запись и создаёт или обновляет отметку. Ошибки проверки - ошибки элемента.
+func (m *attendanceMarker) mark(tx *gorm.DB, record AttendanceRecord) (*models.Attendance, error) {
+	if err := validateBulkItem(record); err != nil {
+		return nil, err
+	}
+
+	// Урок расписания задаёт класс, предмет и номер урока
+	if record.ScheduleID != nil {
+		schedule, ok := m.schedules[*record.ScheduleID]
+		if !ok {
+			var found models.Schedule
+			if err := tx.Joins("JOIN classes ON classes.id = schedules.class_id").
+				Where("schedules.id = ? AND classes.school_id = ?", *record.ScheduleID, m.schoolID).
+				First(&found).Error; err == nil {
+				schedule = &found
+			}
+			m.schedules[*record.ScheduleID] = schedule
+		}
+		if schedule == nil {
+			return nil, itemError("Schedule not found")
+		}
+		if record.ClassID != 0 && record.ClassID != schedule.ClassID {
+			return nil, itemError("class_id does not match the scheduled lesson")
 		}
+		record.ClassID = schedule.ClassID
+		record.SubjectID = &schedule.SubjectID
+		record.LessonNumber = &schedule.LessonNumber
+	} else if record.ClassID == 0 {
+		return nil, itemError("class_id or schedule_id is required")
+	}
 
-		// Парсим дату
-		date, err := time.Parse("2006-01-02", record.Date)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format (use YYYY-MM-DD)"})
-			return
+	if msg := validateLateness(record.Status, &record.MinutesLate); msg != "" {
+		return nil, itemError("%s", msg)
+	}
+
+	// Проверяем класс
+	class, ok := m.classes[record.ClassID]
+	if !ok {
+		var found models.Class
+		if err := tx.Where("id = ? AND school_id = ?", record.ClassID, m.schoolID).First(&found).Error; err == nil {
+			class = &found
 		}
+		m.classes[record.ClassID] = class
+	}
+	if class == nil {
+		return nil, itemError("Class not found")
+	}
+
+	// Проверяем ученика
+	valid, ok := m.students[record.StudentID]
+	if !ok {
+		var count int64
+		tx.Model(&models.User{}).
+			Where("id = ? AND school_id = ? AND role = ?", record.StudentID, m.schoolID, "student").
+			Count(&count)
+		valid = count > 0
+		m.students[record.StudentID] = valid
+	}
+	if !valid {
+		return nil, itemError("Student not found")
+	}
 
-		// Проверяем существующую запись
-		var existing models.Attendance
-		query := database.DB.Where("student_id = ? AND class_id = ? AND date = ?", record.StudentID, record.ClassID, date)
+	// Парсим дату
+	date, err := time.Parse("2006-01-02", record.Date)
+	if err != nil {
+		return nil, itemError("Invalid date format (use YYYY-MM-DD)")
+	}
+
+	// Проверяем существующую запись
+	var existing models.Attendance
+	query := tx.Where("student_id = ? AND class_id = ? AND date = ?", record.StudentID, record.ClassID, date)
+	if record.ScheduleID != nil {
+		query = query.Where("schedule_id = ?", *record.ScheduleID)
+	} else {
 		if record.LessonNumber != nil {
 			query = query.Where("lesson_number = ?", *record.LessonNumber)
 		}
 		if record.SubjectID != nil {
 			query = query.Where("subject_id = ?", *record.SubjectID)
 		}
+	}
 
-		if err := query.First(&existing).Error; err == nil {
-			// Обновляем существующую
-			existing.Status = record.Status
-			existing.Comment = record.Comment
-			markedByID := userID.(uint)
-			existing.MarkedBy = &markedByID
-			database.DB.Save(&existing)
-			attendances = append(attendances, existing)
-		} else {
-			// Создаём новую
-			markedByID := userID.(uint)
-			attendance := models.Attendance{
-				StudentID:    record.StudentID,
-				ClassID:      record.ClassID,
-				SubjectID:    record.SubjectID,
-				Date:         date,
-				LessonNumber: record.LessonNumber,
-				Status:       record.Status,
-				Comment:      record.Comment,
-				MarkedBy:     &markedByID,
-			}
-
-			if err := database.DB.Create(&attendance).Error; err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create attendance record"})
-				return
-			}
-			attendances = append(attendances, attendance)
+	markedByID := m.userID
+	if err := query.First(&existing).Error; err == nil {
+		// Обновляем существующую
+		existing.Status = record.Status
+		existing.MinutesLate = record.MinutesLate
+		existing.Comment = record.Comment
+		if record.ScheduleID != nil {
+			existing.ScheduleID = record.ScheduleID
+		}
+		existing.MarkedBy = &markedByID
+		applyApprovedExcuse(tx, &existing)
+		if err := tx.Save(&existing).Error; err != nil {
+			return nil, err
 		}
+		return &existing, nil
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"message":    "Attendance marked successfully",
-		"attendance": attendances,
-	})
+	// Создаём новую
+	attendance := models.Attendance{
+		StudentID:    record.StudentID,
+		ClassID:      record.ClassID,
+		ScheduleID:   record.ScheduleID,
+		SubjectID:    record.SubjectID,
+		Date:         date,
+		LessonNumber: record.LessonNumber,
+		Status:       record.Status,
+		MinutesLate:  record.MinutesLate,
+		Comment:      record.Comment,
+		MarkedBy:     &markedByID,
+	}
+	// Пропуск по одобренному заявлению родителя сразу становится уважительным
+	applyApprovedExcuse(tx, &attendance)
+
+	if err := tx.Create(&attendance).Error; err != nil {
+		return nil, err
+	}
+	return &attendance, nil
 }
 
 // GetAttendanceByClass получает посещаемость для класса по дате
@@ -181,10 +310,10 @@ func (h *AttendanceHandler) GetAttendanceStats(c *gin.Context) {
 		Count  int
 	}
 
-	if err := database.DB.Table("attendance").
+	if err := database.DB.Table("attendances").
 		Select("status, COUNT(*) as count").
-		Joins("JOIN users ON users.id = attendance.student_id").
-		Where("users.school_id = ? AND attendance.date BETWEEN ? AND ?", schoolID, parsedStart, parsedEnd).
+		Joins("JOIN users ON users.id = attendances.student_id").
+		Where("users.school_id = ? AND attendances.date BETWEEN ? AND ?", schoolID, parsedStart, parsedEnd).
 		Group("status").
 		Scan(&stats).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch statistics"})
@@ -207,48 +336,75 @@ func (h *AttendanceHandler) GetAttendanceStats(c *gin.Context) {
 
 // MarkAttendance отмечает посещаемость одного ученика (для совместимости)
 func (h *AttendanceHandler) MarkAttendance(c *gin.Context) {
-	// Используем BulkMarkAttendance с одной записью
+	role, _ := c.Get("role")
+	if role != "admin" && role != "teacher" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins and teachers can mark attendance"})
+		return
+	}
+
 	var record AttendanceRecord
 	if err := c.ShouldBindJSON(&record); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Оборачиваем в массив
-	req := BulkAttendanceRequest{
-		Records: []AttendanceRecord{record},
+	var attendance *models.Attendance
+	err := db(c).Transaction(func(tx *gorm.DB) error {
+		var err error
+		attendance, err = newAttendanceMarker(c).mark(tx, record)
+		return err
+	})
+	var itemErr *bulkItemError
+	if errors.As(err, &itemErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": itemErr.msg})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create attendance record"})
+		return
 	}
 
-	// Подменяем request body
-	c.Set("bulk_request", req)
-	h.BulkMarkAttendance(c)
+	c.JSON(http.StatusCreated, gin.H{
+		"message":    "Attendance marked successfully",
+		"attendance": []models.Attendance{*attendance},
+	})
 }
 
 // GetAttendance получает список посещаемости с фильтрами
 func (h *AttendanceHandler) GetAttendance(c *gin.Context) {
 	schoolID, _ := c.Get("school_id")
 
-	query := database.DB.Joins("JOIN users ON users.id = attendance.student_id").
+	query := database.DB.Joins("JOIN users ON users.id = attendances.student_id").
 		Where("users.school_id = ?", schoolID)
 
 	// Фильтр по классу
 	if classID := c.Query("class_id"); classID != "" {
-		query = query.Where("attendance.class_id = ?", classID)
+		query = query.Where("attendances.class_id = ?", classID)
 	}
 
 	// Фильтр по предмету
 	if subjectID := c.Query("subject_id"); subjectID != "" {
-		query = query.Where("attendance.subject_id = ?", subjectID)
+		query = query.Where("attendances.subject_id = ?", subjectID)
 	}
 
 	// Фильтр по дате
 	if date := c.Query("date"); date != "" {
-		query = query.Where("attendance.date = ?", date)
+		parsedDate, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format (use YYYY-MM-DD)"})
+			return
+		}
+		query = query.Where("attendances.date = ?", parsedDate)
+	}
+
+	// Фильтр по уроку расписания
+	if scheduleID := c.Query("schedule_id"); scheduleID != "" {
+		query = query.Where("attendances.schedule_id = ?", scheduleID)
 	}
 
 	// Фильтр по статусу
 	if status := c.Query("status"); status != "" {
-		query = query.Where("attendance.status = ?", status)
+		query = query.Where("attendances.status = ?", status)
 	}
 
 	var attendance []models.Attendance
@@ -256,7 +412,7 @@ func (h *AttendanceHandler) GetAttendance(c *gin.Context) {
 		Preload("Student").
 		Preload("Class").
 		Preload("Subject").
-		Order("attendance.date DESC").
+		Order("attendances.date DESC").
 		Limit(100).
 		Find(&attendance).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attendance"})
@@ -278,20 +434,26 @@ func (h *AttendanceHandler) GetStudentStats(c *gin.Context) {
 		return
 	}
 
-	// Получаем статистику
-	var stats []struct {
-		Status string
-		Count  int
-	}
-
-	if err := database.DB.Table("attendance").
-		Select("status, COUNT(*) as count").
+	// Отметки за неучебные дни (праздники, каникулы) не учитываем: каждый день
+	// проверяется по календарю класса отметки за период отметок самого ученика
+	var days []attendanceDay
+	if err := database.DB.Model(&models.Attendance{}).
+		Select("class_id, date, status, COUNT(*) AS count").
 		Where("student_id = ?", studentID).
-		Group("status").
-		Scan(&stats).Error; err != nil {
+		Group("class_id, date, status").
+		Scan(&days).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch statistics"})
 		return
 	}
+	from, to := attendanceSpan(days)
+	working := newWorkingDays(student.SchoolID, from, to)
+
+	stats := map[string]int{}
+	for _, day := range days {
+		if working.contains(day.ClassID, day.Date) {
+			stats[day.Status] += day.Count
+		}
+	}
 
 	result := map[string]int{
 		"present": 0,
@@ -301,9 +463,9 @@ func (h *AttendanceHandler) GetStudentStats(c *gin.Context) {
 	}
 
 	total := 0
-	for _, stat := range stats {
-		result[stat.Status] = stat.Count
-		total += stat.Count
+	for status, count := range stats {
+		result[status] = count
+		total += count
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -323,10 +485,76 @@ func (h *AttendanceHandler) DeleteAttendance(c *gin.Context) {
 		return
 	}
 
-	if err := database.DB.Delete(&attendance).Error; err != nil {
+	if err := db(c).Delete(&attendance).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete attendance"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Attendance deleted successfully"})
 }
+
+// attendanceDay - число отметок со статусом за день в классе. Дата сканируется строкой:
+// SQLite отдаёт её текстом, PostgreSQL - временем.
+type attendanceDay struct {
+	ClassID uint
+	Date    string
+	Status  string
+	Count   int
+}
+
+// workingDays проверяет дни отметок по календарям их классов за период from-to.
+// Календари загружаются при первой отметке класса.
+type workingDays struct {
+	schoolID  uint
+	from, to  time.Time
+	calendars map[uint]*calendar.Calendar
+}
+
+func newWorkingDays(schoolID uint, from, to time.Time) *workingDays {
+	return &workingDays{schoolID: schoolID, from: from, to: to, calendars: make(map[uint]*calendar.Calendar)}
+}
+
+// attendanceSpan возвращает первый и последний день отметок
+func attendanceSpan(days []attendanceDay) (from, to time.Time) {
+	for _, day := range days {
+		d, ok := parseAttendanceDate(day.Date)
+		if !ok {
+			continue
+		}
+		if from.IsZero() || d.Before(from) {
+			from = d
+		}
+		if d.After(to) {
+			to = d
+		}
+	}
+	return from, to
+}
+
+// contains сообщает, учебный ли день date в классе classID. Если календарь не
+// загрузился или дата не разобрана, день считается учебным.
+func (w *workingDays) contains(classID uint, date string) bool {
+	d, ok := parseAttendanceDate(date)
+	if !ok {
+		return true
+	}
+	cal, loaded := w.calendars[classID]
+	if !loaded {
+		var err error
+		if cal, err = calendar.Load(database.DB, w.schoolID, &classID, w.from, w.to); err != nil {
+			cal = nil
+		}
+		w.calendars[classID] = cal
+	}
+	return cal == nil || cal.IsWorkingDay(d)
+}
+
+// parseAttendanceDate разбирает дату отметки: "2026-09-01 00:00:00+00:00" из SQLite
+// или "2026-09-01T00:00:00Z" из PostgreSQL
+func parseAttendanceDate(s string) (time.Time, bool) {
+	if len(s) < len(calendar.DateLayout) {
+		return time.Time{}, false
+	}
+	d, err := time.Parse(calendar.DateLayout, s[:len(calendar.DateLayout)])
+	return d, err == nil
+}
@@ -0,0 +1,462 @@
+package handlers
+
+import (
+	"classkeeper/internal/calendar"
+	"classkeeper/internal/database"
+	"classkeeper/internal/models"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LessonRegisterRequest - журнал урока целиком: ученики, не указанные в records, присутствовали
+type LessonRegisterRequest struct {
+	ScheduleID uint            `json:"schedule_id" binding:"required"`
+	Date       string          `json:"date" binding:"required"` // YYYY-MM-DD
+	Records    []RegisterEntry `json:"records"`
+}
+
+// RegisterEntry отметка одного ученика в журнале урока
+type RegisterEntry struct {
+	StudentID   uint   `json:"student_id" binding:"required"`
+	Status      string `json:"status" binding:"required"` // present, absent, late, excused
+	MinutesLate int    `json:"minutes_late,omitempty"`
+	Comment     string `json:"comment,omitempty"`
+}
+
+// RegisterRow строка журнала урока
+type RegisterRow struct {
+	Student      models.User `json:"student"`
+	AttendanceID *uint       `json:"attendance_id,omitempty"` // Пусто, если отметки ещё нет
+	Status       string      `json:"status"`
+	MinutesLate  int         `json:"minutes_late,omitempty"`
+	Comment      string      `json:"comment,omitempty"`
+	ExcuseID     *uint       `json:"excuse_id,omitempty"`
+}
+
+// LessonStatus урок расписания в конкретный день и состояние его журнала
+type LessonStatus struct {
+	Date         string     `json:"date"`
+	ScheduleID   uint       `json:"schedule_id"`
+	ClassID      uint       `json:"class_id"`
+	ClassName    string     `json:"class_name"`
+	SubjectID    uint       `json:"subject_id"`
+	SubjectName  string     `json:"subject_name"`
+	LessonNumber int        `json:"lesson_number"`
+	StartTime    string     `json:"start_time,omitempty"`
+	TeacherID    *uint      `json:"teacher_id,omitempty"`
+	Taken        bool       `json:"taken"`
+	TakenBy      *uint      `json:"taken_by,omitempty"`
+	TakenAt      *time.Time `json:"taken_at,omitempty"`
+}
+
+// maxLessonPeriodDays ограничивает период отчёта по заполнению журналов
+const maxLessonPeriodDays = 92
+
+// GetRegister возвращает журнал урока: состав класса с отметками,
+// для ещё не отмеченных учеников предзаполнен статус present
+func (h *AttendanceHandler) GetRegister(c *gin.Context) {
+	scheduleID, _ := strconv.Atoi(c.Query("schedule_id"))
+
+	schedule, date, ok := findLesson(c, uint(scheduleID), c.Query("date"))
+	if !ok {
+		return
+	}
+
+	rows, err := registerRows(schedule, date)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch register"})
+		return
+	}
+
+	var register *models.LessonRegister
+	var existing models.LessonRegister
+	if err := database.DB.Where("schedule_id = ? AND date = ?", schedule.ID, date).First(&existing).Error; err == nil {
+		register = &existing
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"lesson":   schedule,
+		"date":     date.Format(calendar.DateLayout),
+		"taken":    register != nil,
+		"register": register,
+		"students": rows,
+	})
+}
+
+// TakeRegister сохраняет журнал урока целиком и отмечает урок как заполненный
+func (h *AttendanceHandler) TakeRegister(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req LessonRegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	schedule, date, ok := findLesson(c, req.ScheduleID, req.Date)
+	if !ok {
+		return
+	}
+
+	rows, err := registerRows(schedule, date)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch register"})
+		return
+	}
+
+	entries := make(map[uint]RegisterEntry)
+	for _, entry := range req.Records {
+		if msg := validateLateness(entry.Status, &entry.MinutesLate); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+		entries[entry.StudentID] = entry
+	}
+
+	inClass := make(map[uint]bool)
+	for _, row := range rows {
+		inClass[row.Student.ID] = true
+	}
+	for studentID := range entries {
+		if !inClass[studentID] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Student " + strconv.Itoa(int(studentID)) + " is not in this class"})
+			return
+		}
+	}
+
+	markedBy := userID.(uint)
+	register := models.LessonRegister{
+		ScheduleID: schedule.ID,
+		Date:       date,
+		TakenBy:    markedBy,
+	}
+	var attendances []models.Attendance
+
+	err = db(c).Transaction(func(tx *gorm.DB) error {
+		for _, row := range rows {
+			entry, listed := entries[row.Student.ID]
+			if !listed {
+				entry = RegisterEntry{StudentID: row.Student.ID, Status: row.Status, Comment: row.Comment, MinutesLate: row.MinutesLate}
+				if row.AttendanceID == nil && row.ExcuseID != nil {
+					// Отсутствует по заявлению: applyApprovedExcuse сам сделает пропуск уважительным
+					entry.Status = "absent"
+				}
+			}
+
+			attendance := newLessonAttendance(schedule, date, row.Student.ID)
+			if row.AttendanceID != nil {
+				if err := tx.First(attendance, *row.AttendanceID).Error; err != nil {
+					return err
+				}
+				// Старые отметки по номеру урока заодно привязываются к уроку расписания
+				attendance.ScheduleID = &schedule.ID
+				attendance.SubjectID = &schedule.SubjectID
+				attendance.LessonNumber = &schedule.LessonNumber
+			}
+			attendance.Status = entry.Status
+			attendance.MinutesLate = entry.MinutesLate
+			attendance.Comment = entry.Comment
+			attendance.MarkedBy = &markedBy
+			applyApprovedExcuse(tx, attendance)
+
+			if err := tx.Save(attendance).Error; err != nil {
+				return err
+			}
+			attendances = append(attendances, *attendance)
+
+			switch attendance.Status {
+			case "present":
+				register.Present++
+			case "absent":
+				register.Absent++
+			case "late":
+				register.Late++
+			case "excused":
+				register.Excused++
+			}
+		}
+
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "schedule_id"}, {Name: "date"}},
+			DoUpdates: clause.AssignmentColumns([]string{"taken_by", "present", "absent", "late", "excused", "updated_at"}),
+		}).Create(&register).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save register"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Register saved successfully",
+		"register":   register,
+		"attendance": attendances,
+	})
+}
+
+// GetLessonCompletion показывает, по каким урокам периода журнал заполнен, а по каким нет.
+// Без фильтров учитель видит свои уроки, админ - уроки всей школы.
+func (h *AttendanceHandler) GetLessonCompletion(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	schoolID, _ := c.Get("school_id")
+	role, _ := c.Get("role")
+
+	from, to, err := parsePeriod(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// Будущие уроки ещё не могут быть не заполнены
+	if today := calendar.Date(time.Now()); to.After(today) {
+		to = today
+	}
+	if to.Sub(from) > maxLessonPeriodDays*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Period must not exceed " + strconv.Itoa(maxLessonPeriodDays) + " days"})
+		return
+	}
+
+	query := database.DB.Joins("JOIN classes ON classes.id = schedules.class_id").
+		Where("classes.school_id = ?", schoolID)
+	classID := c.Query("class_id")
+	teacherID := c.Query("teacher_id")
+	if classID != "" {
+		query = query.Where("schedules.class_id = ?", classID)
+	}
+	if teacherID != "" {
+		query = query.Where("schedules.teacher_id = ?", teacherID)
+	}
+	if classID == "" && teacherID == "" && role != "admin" {
+		query = query.Where("schedules.teacher_id = ?", userID)
+	}
+
+	var schedules []models.Schedule
+	if err := query.Preload("Class").Preload("Subject").Find(&schedules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch schedule"})
+		return
+	}
+
+	lessons := []LessonStatus{}
+	taken := 0
+	if len(schedules) > 0 && !from.After(to) {
+		scheduleIDs := make([]uint, 0, len(schedules))
+		byClass := make(map[uint][]models.Schedule)
+		for _, s := range schedules {
+			scheduleIDs = append(scheduleIDs, s.ID)
+			byClass[s.ClassID] = append(byClass[s.ClassID], s)
+		}
+
+		var registers []models.LessonRegister
+		database.DB.Where("schedule_id IN ? AND date BETWEEN ? AND ?", scheduleIDs, from, to).Find(&registers)
+		done := make(map[string]models.LessonRegister)
+		for _, r := range registers {
+			done[strconv.Itoa(int(r.ScheduleID))+"/"+r.Date.Format(calendar.DateLayout)] = r
+		}
+
+		onlyMissing := c.Query("status") == "missing"
+		for _, classSchedules := range byClass {
+			cal, err := loadClassCalendar(&classSchedules[0].Class, from, to)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load calendar"})
+				return
+			}
+
+			for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+				dayName, ok := cal.ScheduleDay(d)
+				if !ok {
+					continue
+				}
+				day := d.Format(calendar.DateLayout)
+				for _, s := range classSchedules {
+					if s.DayOfWeek != dayName {
+						continue
+					}
+					lesson := LessonStatus{
+						Date:         day,
+						ScheduleID:   s.ID,
+						ClassID:      s.ClassID,
+						ClassName:    s.Class.Name,
+						SubjectID:    s.SubjectID,
+						SubjectName:  s.Subject.Name,
+						LessonNumber: s.LessonNumber,
+						StartTime:    s.StartTime,
+						TeacherID:    s.TeacherID,
+					}
+					if r, ok := done[strconv.Itoa(int(s.ID))+"/"+day]; ok {
+						lesson.Taken = true
+						lesson.TakenBy = &r.TakenBy
+						lesson.TakenAt = &r.UpdatedAt
+						taken++
+						if onlyMissing {
+							continue
+						}
+					}
+					lessons = append(lessons, lesson)
+				}
+			}
+		}
+	}
+
+	sort.Slice(lessons, func(i, j int) bool {
+		if lessons[i].Date != lessons[j].Date {
+			return lessons[i].Date < lessons[j].Date
+		}
+		if lessons[i].LessonNumber != lessons[j].LessonNumber {
+			return lessons[i].LessonNumber < lessons[j].LessonNumber
+		}
+		return lessons[i].ClassName < lessons[j].ClassName
+	})
+
+	total := taken
+	for _, l := range lessons {
+		if !l.Taken {
+			total++
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"date_from": from.Format(calendar.DateLayout),
+		"date_to":   to.Format(calendar.DateLayout),
+		"lessons":   lessons,
+		"summary": gin.H{
+			"total":   total,
+			"taken":   taken,
+			"missing": total - taken,
+		},
+	})
+}
+
+// findLesson находит урок расписания и проверяет, что он проводится в указанный день
+// и что текущий пользователь может вести по нему журнал
+func findLesson(c *gin.Context, scheduleID uint, dateStr string) (*models.Schedule, time.Time, bool) {
+	schoolID, _ := c.Get("school_id")
+
+	var schedule models.Schedule
+	if err := database.DB.Joins("JOIN classes ON classes.id = schedules.class_id").
+		Where("schedules.id = ? AND classes.school_id = ?", scheduleID, schoolID).
+		Preload("Class").
+		Preload("Subject").
+		Preload("Teacher").
+		First(&schedule).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Lesson not found"})
+		return nil, time.Time{}, false
+	}
+
+	date, err := time.Parse(calendar.DateLayout, dateStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format (use YYYY-MM-DD)"})
+		return nil, time.Time{}, false
+	}
+
+	if !canTakeRegister(c, &schedule) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only take the register for your own lessons"})
+		return nil, time.Time{}, false
+	}
+
+	cal, err := loadClassCalendar(&schedule.Class, date, date)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load calendar"})
+		return nil, time.Time{}, false
+	}
+	if dayName, ok := cal.ScheduleDay(date); !ok || dayName != schedule.DayOfWeek {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "There is no such lesson on this date"})
+		return nil, time.Time{}, false
+	}
+
+	return &schedule, date, true
+}
+
+// canTakeRegister - журнал урока ведут админ, учитель урока или классный руководитель
+func canTakeRegister(c *gin.Context, schedule *models.Schedule) bool {
+	userID, _ := c.Get("user_id")
+	role, _ := c.Get("role")
+
+	if role == "admin" {
+		return true
+	}
+	if role != "teacher" {
+		return false
+	}
+	if schedule.TeacherID != nil && *schedule.TeacherID == userID.(uint) {
+		return true
+	}
+	return schedule.Class.HomeroomTeacherID != nil && *schedule.Class.HomeroomTeacherID == userID.(uint)
+}
+
+// registerRows собирает состав класса с отметками урока. Ученикам без отметки
+// предзаполняется present, а при одобренном заявлении родителя - excused.
+func registerRows(schedule *models.Schedule, date time.Time) ([]RegisterRow, error) {
+	var students []models.User
+	if err := database.DB.Joins("JOIN class_students ON class_students.user_id = users.id").
+		Where("class_students.class_id = ? AND users.role IN ?", schedule.ClassID, []string{"student", "starosta"}).
+		Order("users.last_name, users.first_name").
+		Find(&students).Error; err != nil {
+		return nil, err
+	}
+
+	var marks []models.Attendance
+	if err := database.DB.Where("class_id = ? AND date = ? AND (schedule_id = ? OR (schedule_id IS NULL AND lesson_number = ?))",
+		schedule.ClassID, date, schedule.ID, schedule.LessonNumber).
+		Order("schedule_id IS NULL").
+		Find(&marks).Error; err != nil {
+		return nil, err
+	}
+	byStudent := make(map[uint]models.Attendance)
+	for _, m := range marks {
+		// Отметка, привязанная к уроку, важнее старой отметки только по номеру урока
+		if _, seen := byStudent[m.StudentID]; !seen {
+			byStudent[m.StudentID] = m
+		}
+	}
+
+	rows := make([]RegisterRow, 0, len(students))
+	for _, student := range students {
+		row := RegisterRow{Student: student, Status: "present"}
+		if m, ok := byStudent[student.ID]; ok {
+			id := m.ID
+			row.AttendanceID = &id
+			row.Status = m.Status
+			row.MinutesLate = m.MinutesLate
+			row.Comment = m.Comment
+			row.ExcuseID = m.ExcuseID
+		} else {
+			probe := models.Attendance{StudentID: student.ID, Date: date, Status: "absent"}
+			applyApprovedExcuse(database.DB, &probe)
+			if probe.ExcuseID != nil {
+				row.Status = probe.Status
+				row.ExcuseID = probe.ExcuseID
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// findLessonAttendance ищет отметку ученика за урок, включая старые отметки только по номеру урока
+func findLessonAttendance(tx *gorm.DB, schedule *models.Schedule, date time.Time, studentID uint) (*models.Attendance, error) {
+	var attendance models.Attendance
+	err := tx.Where("student_id = ? AND class_id = ? AND date = ? AND (schedule_id = ? OR (schedule_id IS NULL AND lesson_number = ?))",
+		studentID, schedule.ClassID, date, schedule.ID, schedule.LessonNumber).
+		Order("schedule_id IS NULL").
+		First(&attendance).Error
+	if err != nil {
+		return nil, err
+	}
+	return &attendance, nil
+}
+
+// newLessonAttendance создаёт (ещё не сохранённую) отметку ученика за урок расписания
+func newLessonAttendance(schedule *models.Schedule, date time.Time, studentID uint) *models.Attendance {
+	return &models.Attendance{
+		StudentID:    studentID,
+		ClassID:      schedule.ClassID,
+		ScheduleID:   &schedule.ID,
+		SubjectID:    &schedule.SubjectID,
+		Date:         date,
+		LessonNumber: &schedule.LessonNumber,
+	}
+}
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"classkeeper/internal/calendar"
+	"classkeeper/internal/config"
+	"classkeeper/internal/database"
+	"classkeeper/internal/models"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Размер страницы журнала аудита
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// db возвращает соединение с контекстом запроса. Изменения данных нужно делать
+// через него: из контекста журнал аудита берёт автора, IP и ID запроса.
+func db(c *gin.Context) *gorm.DB {
+	return database.DB.WithContext(c.Request.Context())
+}
+
+// AuditHandler показывает и выгружает журнал аудита школы
+type AuditHandler struct {
+	cfg *config.Config
+}
+
+func NewAuditHandler(cfg *config.Config) *AuditHandler {
+	return &AuditHandler{cfg: cfg}
+}
+
+// AuditEntry - запись журнала с именем автора и разницей значений
+type AuditEntry struct {
+	models.AuditLog
+	UserName string          `json:"user_name,omitempty"`
+	Changes  json.RawMessage `json:"changes"`
+}
+
+// ListAuditLog возвращает записи журнала от новых к старым. Фильтры: user_id,
+// entity, entity_id, action, request_id, date_from/date_to (YYYY-MM-DD, по часовому
+// поясу школы) и q - поиск по изменённым значениям и пути запроса. Страницы - limit и offset.
+func (h *AuditHandler) ListAuditLog(c *gin.Context) {
+	query, err := h.filter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultAuditLimit)))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+	if limit > maxAuditLimit {
+		limit = maxAuditLimit
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+		return
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get audit log"})
+		return
+	}
+	var logs []models.AuditLog
+	if err := query.Order("created_at DESC, id DESC").Limit(limit).Offset(offset).Find(&logs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get audit log"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"entries": auditEntries(logs),
+		"total":   total,
+		"limit":   limit,
+		"offset":  offset,
+	})
+}
+
+// ExportAuditLog выгружает записи журнала в CSV в порядке добавления, с теми же
+// фильтрами, что и ListAuditLog
+func (h *AuditHandler) ExportAuditLog(c *gin.Context) {
+	query, err := h.filter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	loc := h.location()
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=audit_log_%s.csv", time.Now().In(loc).Format("2006-01-02")))
+
+	writer := csv.NewWriter(c.Writer)
+	defer writer.Flush()
+
+	writer.Write([]string{"Время", "Пользователь", "Роль", "IP", "Действие", "Объект", "ID объекта", "Изменения", "ID запроса", "Запрос"})
+
+	var logs []models.AuditLog
+	query.FindInBatches(&logs, 500, func(tx *gorm.DB, batch int) error {
+		for _, entry := range auditEntries(logs) {
+			entityID := ""
+			if entry.EntityID != nil {
+				entityID = strconv.FormatUint(uint64(*entry.EntityID), 10)
+			}
+			request := ""
+			if entry.Method != "" {
+				request = entry.Method + " " + entry.Path
+			}
+			writer.Write([]string{
+				entry.CreatedAt.In(loc).Format("2006-01-02 15:04:05"),
+				entry.UserName,
+				entry.Role,
+				entry.IP,
+				entry.Action,
+				entry.Entity,
+				entityID,
+				string(entry.Changes),
+				entry.RequestID,
+				request,
+			})
+		}
+		writer.Flush()
+		return writer.Error()
+	})
+}
+
+// filter строит запрос к журналу школы по параметрам из URL
+func (h *AuditHandler) filter(c *gin.Context) (*gorm.DB, error) {
+	schoolID, _ := c.Get("school_id")
+	query := database.DB.Model(&models.AuditLog{}).Where("school_id = ?", schoolID)
+
+	if s := c.Query("user_id"); s != "" {
+		id, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid user_id")
+		}
+		query = query.Where("user_id = ?", id)
+	}
+	if s := c.Query("entity"); s != "" {
+		query = query.Where("entity = ?", s)
+	}
+	if s := c.Query("entity_id"); s != "" {
+		id, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid entity_id")
+		}
+		query = query.Where("entity_id = ?", id)
+	}
+	if s := c.Query("action"); s != "" {
+		query = query.Where("action = ?", s)
+	}
+	if s := c.Query("request_id"); s != "" {
+		query = query.Where("request_id = ?", s)
+	}
+
+	loc := h.location()
+	if s := c.Query("date_from"); s != "" {
+		d, err := time.ParseInLocation(calendar.DateLayout, s, loc)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid date_from format (use YYYY-MM-DD)")
+		}
+		// Время записей хранится в местном поясе сервера; в SQLite это строки,
+		// поэтому границы приводятся к тому же поясу
+		query = query.Where("created_at >= ?", d.Local())
+	}
+	if s := c.Query("date_to"); s != "" {
+		d, err := time.ParseInLocation(calendar.DateLayout, s, loc)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid date_to format (use YYYY-MM-DD)")
+		}
+		query = query.Where("created_at < ?", d.AddDate(0, 0, 1).Local())
+	}
+
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		pattern := "%" + strings.ToLower(q) + "%"
+		query = query.Where("(LOWER(changes) LIKE ? OR LOWER(path) LIKE ?)", pattern, pattern)
+	}
+	return query, nil
+}
+
+// location - часовой пояс школы для фильтра по датам и времени в CSV
+func (h *AuditHandler) location() *time.Location {
+	loc, err := time.LoadLocation(h.cfg.Server.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// auditEntries дополняет записи именами авторов (в том числе удалённых пользователей)
+func auditEntries(logs []models.AuditLog) []AuditEntry {
+	var userIDs []uint
+	for _, l := range logs {
+		if l.UserID != nil {
+			userIDs = append(userIDs, *l.UserID)
+		}
+	}
+	names := make(map[uint]string)
+	if len(userIDs) > 0 {
+		var users []models.User
+		database.DB.Unscoped().Where("id IN ?", userIDs).Find(&users)
+		for _, u := range users {
+			name := strings.TrimSpace(u.LastName + " " + u.FirstName)
+			if name == "" {
+				name = u.Username
+			} else {
+				name = fmt.Sprintf("%s (%s)", name, u.Username)
+			}
+			names[u.ID] = name
+		}
+	}
+
+	entries := make([]AuditEntry, len(logs))
+	for i, l := range logs {
+		entries[i] = AuditEntry{AuditLog: l, Changes: json.RawMessage(l.Changes)}
+		if l.UserID != nil {
+			entries[i].UserName = names[*l.UserID]
+		}
+		if l.Changes == "" {
+			entries[i].Changes = json.RawMessage("{}")
+		}
+	}
+	return entries
+}
@@ -95,7 +95,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		TeacherSubject: req.TeacherSubject,
 	}
 
-	if err := database.DB.Create(&user).Error; err != nil {
+	if err := db(c).Create(&user).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		return
 	}
@@ -126,7 +126,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 
 	// Ищем пользователя
 	var user models.User
-	if err := database.DB.Where("username = ?", req.Username).First(&user).Error; err != nil {
+	if err := database.DB.Where("username = ? AND anonymized_at IS NULL", req.Username).First(&user).Error; err != nil {
 		log.Printf("❌ Login: User not found: %s", req.Username)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
@@ -136,13 +136,27 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	log.Printf("   Password from DB: %s", user.PasswordHash)
 	log.Printf("   Password from request: %s", req.Password)
 
+	// Вход заблокирован после неудачных попыток. Блокировка включается явно: любой,
+	// кто знает логин, может заблокировать чужой вход. После выключения старые
+	// блокировки не действуют.
+	if h.cfg.Login.MaxAttempts > 0 && user.LockedUntil != nil && user.LockedUntil.After(time.Now()) {
+		log.Printf("❌ Login: User %s is locked until %s", req.Username, user.LockedUntil.Format(time.RFC3339))
+		c.JSON(http.StatusLocked, gin.H{"error": "Account is temporarily locked", "locked_until": user.LockedUntil})
+		return
+	}
+
 	// ПРОСТАЯ ПРОВЕРКА ПАРОЛЯ (без bcrypt)
 	if user.PasswordHash != req.Password {
 		log.Printf("❌ Login: Password mismatch for user %s", req.Username)
+		h.recordFailedLogin(c, &user)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
+	if user.FailedLogins > 0 || user.LockedUntil != nil {
+		db(c).Model(&user).Updates(map[string]interface{}{"failed_logins": 0, "locked_until": nil})
+	}
+
 	log.Printf("✅ Login successful for user: %s", req.Username)
 
 	// Генерируем токен
@@ -158,6 +172,23 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	})
 }
 
+// recordFailedLogin считает неудачные попытки входа и блокирует вход после
+// cfg.Login.MaxAttempts попыток подряд
+func (h *AuthHandler) recordFailedLogin(c *gin.Context, user *models.User) {
+	if h.cfg.Login.MaxAttempts <= 0 {
+		return
+	}
+	updates := map[string]interface{}{"failed_logins": user.FailedLogins + 1}
+	if user.FailedLogins+1 >= h.cfg.Login.MaxAttempts {
+		updates["failed_logins"] = 0
+		updates["locked_until"] = time.Now().Add(h.cfg.Login.Lockout)
+		log.Printf("🔒 Login: User %s locked for %s", user.Username, h.cfg.Login.Lockout)
+	}
+	if err := db(c).Model(user).Updates(updates).Error; err != nil {
+		log.Printf("Failed to record failed login: %v", err)
+	}
+}
+
 // Me возвращает информацию о текущем пользователе
 func (h *AuthHandler) Me(c *gin.Context) {
 	userID, _ := c.Get("user_id")
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"classkeeper/internal/backup"
+	"classkeeper/internal/database"
+	"classkeeper/internal/storage"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Режимы восстановления из архива
+const (
+	RestoreModeValidate = "validate" // Только проверить архив и показать, что будет импортировано
+	RestoreModeApply    = "apply"
+)
+
+// BackupHandler выгружает и восстанавливает полный архив школы и управляет
+// автоматическим резервным копированием
+type BackupHandler struct {
+	store     storage.Backend
+	scheduler *backup.Scheduler
+}
+
+func NewBackupHandler(store storage.Backend, scheduler *backup.Scheduler) *BackupHandler {
+	return &BackupHandler{store: store, scheduler: scheduler}
+}
+
+// ExportSchool выгружает архив школы: все таблицы в JSON Lines, файлы вложений
+// и манифест с контрольными суммами
+func (h *BackupHandler) ExportSchool(c *gin.Context) {
+	schoolID, _ := c.Get("school_id")
+
+	// Архив собирается во временном файле, чтобы ошибка не оборвала ответ на середине
+	tmp, err := os.CreateTemp("", "classkeeper-backup-*.zip")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create backup"})
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	manifest, err := backup.Export(c.Request.Context(), database.DB, h.store, schoolID.(uint), tmp)
+	if err != nil {
+		log.Printf("Backup of school %v failed: %v", schoolID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create backup"})
+		return
+	}
+	if len(manifest.MissingFiles) > 0 {
+		log.Printf("Backup of school %v: %d attachment files are missing in storage", schoolID, len(manifest.MissingFiles))
+	}
+
+	c.FileAttachment(tmp.Name(), backup.FileName(manifest))
+}
+
+// RestoreSchool восстанавливает архив как новую школу. По умолчанию (mode=validate)
+// архив только проверяется: в ответе - число строк каждой таблицы, конфликты логинов
+// и email и предупреждения. mode=apply выполняет восстановление; с rename_conflicts=true
+// пользователи с занятыми логинами и email переименовываются.
+func (h *BackupHandler) RestoreSchool(c *gin.Context) {
+	mode := c.DefaultPostForm("mode", RestoreModeValidate)
+	if mode != RestoreModeValidate && mode != RestoreModeApply {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mode (use validate or apply)"})
+		return
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Backup file is required"})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read backup file"})
+		return
+	}
+	defer file.Close()
+
+	report, err := backup.Restore(c.Request.Context(), database.DB, h.store, file, header.Size, backup.Options{
+		DryRun:          mode == RestoreModeValidate,
+		RenameConflicts: c.PostForm("rename_conflicts") == "true",
+	})
+	switch {
+	case errors.Is(err, backup.ErrInvalidArchive), errors.Is(err, backup.ErrUnsupportedVersion), errors.Is(err, backup.ErrChecksum):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, backup.ErrConflicts):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "report": report})
+		return
+	case err != nil:
+		log.Printf("Restore failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore backup", "report": report})
+		return
+	}
+
+	if mode == RestoreModeApply {
+		c.JSON(http.StatusCreated, gin.H{"report": report})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"report": report})
+}
+
+// GetBackupStatus возвращает расписание, политику хранения, последние запуски
+// автоматического копирования и копии в каталоге. failing=true - последний запуск неудачен.
+func (h *BackupHandler) GetBackupStatus(c *gin.Context) {
+	status, err := h.scheduler.Status()
+	if err != nil {
+		log.Printf("Failed to get backup status: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get backup status"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": status})
+}
+
+// RunBackup запускает полное копирование вне расписания. Копирование идёт в фоне,
+// результат виден в статусе.
+func (h *BackupHandler) RunBackup(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	run, err := h.scheduler.Trigger(userID.(uint))
+	if errors.Is(err, backup.ErrRunning) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Backup is already running"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start backup"})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"run": run})
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gorm.io/gorm"
+)
+
+// Режимы массовых операций
+const (
+	BulkModeAtomic   = "atomic"   // Всё или ничего: при любой ошибке ничего не сохраняется
+	BulkModePartial  = "partial"  // Корректные элементы сохраняются, ошибочные пропускаются
+	BulkModeValidate = "validate" // Только проверка: изменения откатываются в любом случае
+)
+
+// Статусы элемента в отчёте
+const (
+	BulkItemOK    = "ok"
+	BulkItemError = "error"
+)
+
+// maxBulkItems - предел элементов в одном запросе
+const maxBulkItems = 1000
+
+// BulkItemResult результат обработки одного элемента
+type BulkItemResult struct {
+	Index   int         `json:"index"`
+	Status  string      `json:"status"`
+	ID      uint        `json:"id,omitempty"`
+	Error   string      `json:"error,omitempty"`
+	Warning interface{} `json:"warning,omitempty"`
+}
+
+// BulkReport отчёт о массовой операции
+type BulkReport struct {
+	Mode      string           `json:"mode"`
+	Committed bool             `json:"committed"` // Изменения сохранены в базе
+	Total     int              `json:"total"`
+	Succeeded int              `json:"succeeded"`
+	Failed    int              `json:"failed"`
+	Results   []BulkItemResult `json:"results"`
+}
+
+// bulkItemError - ошибка элемента, текст которой показывается клиенту
+type bulkItemError struct {
+	msg string
+}
+
+func (e *bulkItemError) Error() string {
+	return e.msg
+}
+
+// itemError создаёт ошибку элемента
+func itemError(format string, args ...interface{}) error {
+	return &bulkItemError{msg: fmt.Sprintf(format, args...)}
+}
+
+var errBulkRollback = errors.New("bulk operation rolled back")
+
+// parseBulkMode проверяет режим (по умолчанию atomic) и число элементов.
+// При ошибке пишет ответ и возвращает false.
+func parseBulkMode(c *gin.Context, mode string, items, limit int) (string, bool) {
+	if mode == "" {
+		mode = BulkModeAtomic
+	}
+	if mode != BulkModeAtomic && mode != BulkModePartial && mode != BulkModeValidate {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mode (use atomic, partial or validate)"})
+		return "", false
+	}
+	if items == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No items to process"})
+		return "", false
+	}
+	if items > limit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Too many items (max %d)", limit)})
+		return "", false
+	}
+	return mode, true
+}
+
+// validateBulkItem проверяет теги binding элемента: gin не проверяет элементы вложенных массивов
+func validateBulkItem(item interface{}) error {
+	if err := binding.Validator.ValidateStruct(item); err != nil {
+		return itemError("%s", err.Error())
+	}
+	return nil
+}
+
+// runBulk применяет apply к каждому элементу в одной транзакции. Каждый элемент
+// выполняется в своей точке сохранения, поэтому ошибка откатывает только его.
+// В режиме atomic любая ошибка откатывает всю транзакцию, в режиме validate она
+// откатывается всегда. apply возвращает ID сохранённой записи и необязательное
+// предупреждение для отчёта.
+func runBulk(c *gin.Context, mode string, n int, apply func(tx *gorm.DB, i int) (uint, interface{}, error)) (*BulkReport, error) {
+	report := &BulkReport{Mode: mode, Total: n, Results: make([]BulkItemResult, n)}
+
+	err := db(c).Transaction(func(tx *gorm.DB) error {
+		for i := 0; i < n; i++ {
+			var id uint
+			var warning interface{}
+			err := tx.Transaction(func(itx *gorm.DB) error {
+				var err error
+				id, warning, err = apply(itx, i)
+				return err
+			})
+
+			result := BulkItemResult{Index: i, Status: BulkItemOK, ID: id, Warning: warning}
+			if err != nil {
+				var itemErr *bulkItemError
+				if !errors.As(err, &itemErr) {
+					log.Printf("bulk: item %d: %v", i, err)
+					itemErr = &bulkItemError{msg: "Failed to save record"}
+				}
+				result = BulkItemResult{Index: i, Status: BulkItemError, Error: itemErr.msg}
+				report.Failed++
+			} else {
+				report.Succeeded++
+			}
+			report.Results[i] = result
+		}
+
+		if mode == BulkModeValidate || (mode == BulkModeAtomic && report.Failed > 0) {
+			return errBulkRollback
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errBulkRollback) {
+		return nil, err
+	}
+
+	report.Committed = err == nil
+	if !report.Committed {
+		// ID откатившихся записей ничего не значат
+		for i := range report.Results {
+			report.Results[i].ID = 0
+		}
+	}
+	return report, nil
+}
+
+// respondBulk пишет отчёт: 201 - всё сохранено, 200 - проверка без ошибок,
+// 207 - сохранена часть элементов, 422 - ничего не сохранено из-за ошибок
+func respondBulk(c *gin.Context, report *BulkReport, extra gin.H) {
+	status := http.StatusCreated
+	switch {
+	case report.Failed > 0 && report.Committed && report.Succeeded > 0:
+		status = http.StatusMultiStatus
+	case report.Failed > 0:
+		status = http.StatusUnprocessableEntity
+	case !report.Committed:
+		status = http.StatusOK
+	}
+
+	body := gin.H{
+		"mode":      report.Mode,
+		"committed": report.Committed,
+		"total":     report.Total,
+		"succeeded": report.Succeeded,
+		"failed":    report.Failed,
+		"results":   report.Results,
+	}
+	for key, value := range extra {
+		body[key] = value
+	}
+	c.JSON(status, body)
+}
@@ -0,0 +1,477 @@
+package handlers
+
+import (
+	"classkeeper/internal/calendar"
+	"classkeeper/internal/database"
+	"classkeeper/internal/ical"
+	"classkeeper/internal/models"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Ограничения запросов к календарю
+const (
+	maxCalendarPeriodDays = 366     // Период выборки: не больше учебного года
+	maxICSFileSize        = 5 << 20 // Импортируемый файл iCalendar
+)
+
+type CalendarHandler struct{}
+
+func NewCalendarHandler() *CalendarHandler {
+	return &CalendarHandler{}
+}
+
+// CalendarEventRequest структура для создания записи календаря
+type CalendarEventRequest struct {
+	ClassID     *uint  `json:"class_id,omitempty"`
+	Type        string `json:"type" binding:"required"` // holiday, vacation, workday, day_off, event
+	Title       string `json:"title" binding:"required"`
+	Description string `json:"description"`
+	StartDate   string `json:"start_date" binding:"required"` // YYYY-MM-DD
+	EndDate     string `json:"end_date"`                      // YYYY-MM-DD, по умолчанию = start_date
+	WorkdayAs   string `json:"workday_as"`                    // Понедельник, Вторник... (только для workday)
+}
+
+// CreateEvent создаёт запись календаря
+func (h *CalendarHandler) CreateEvent(c *gin.Context) {
+	schoolID, _ := c.Get("school_id")
+
+	var req CalendarEventRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	event := models.CalendarEvent{SchoolID: schoolID.(uint)}
+	if err := applyCalendarEventRequest(&event, &req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := db(c).Create(&event).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create calendar event"})
+		return
+	}
+
+	database.DB.Preload("Class").First(&event, event.ID)
+
+	c.JSON(http.StatusCreated, gin.H{"event": event})
+}
+
+// ListEvents возвращает записи календаря за период
+func (h *CalendarHandler) ListEvents(c *gin.Context) {
+	schoolID, _ := c.Get("school_id")
+
+	from, to, err := parsePeriod(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := database.DB.Where("school_id = ? AND start_date <= ? AND end_date >= ?", schoolID, to, from).
+		Preload("Class")
+
+	if classID := c.Query("class_id"); classID != "" {
+		query = query.Where("class_id IS NULL OR class_id = ?", classID)
+	}
+	if eventType := c.Query("type"); eventType != "" {
+		query = query.Where("type = ?", eventType)
+	}
+
+	var events []models.CalendarEvent
+	if err := query.Order("start_date").Find(&events).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch calendar"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"events": events})
+}
+
+// UpdateEvent обновляет запись календаря
+func (h *CalendarHandler) UpdateEvent(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
+		return
+	}
+
+	schoolID, _ := c.Get("school_id")
+
+	var event models.CalendarEvent
+	if err := database.DB.Where("id = ? AND school_id = ?", id, schoolID).First(&event).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Calendar event not found"})
+		return
+	}
+
+	var req CalendarEventRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := applyCalendarEventRequest(&event, &req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := db(c).Save(&event).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update calendar event"})
+		return
+	}
+
+	database.DB.Preload("Class").First(&event, event.ID)
+
+	c.JSON(http.StatusOK, gin.H{"event": event})
+}
+
+// DeleteEvent удаляет запись календаря
+func (h *CalendarHandler) DeleteEvent(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
+		return
+	}
+
+	schoolID, _ := c.Get("school_id")
+
+	var event models.CalendarEvent
+	if err := database.DB.Where("id = ? AND school_id = ?", id, schoolID).First(&event).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Calendar event not found"})
+		return
+	}
+
+	if err := db(c).Delete(&event).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete calendar event"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Calendar event deleted successfully"})
+}
+
+// GetWorkingDays возвращает учебные и неучебные дни за период
+func (h *CalendarHandler) GetWorkingDays(c *gin.Context) {
+	schoolID, _ := c.Get("school_id")
+
+	from, to, err := parsePeriod(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	classID, err := optionalClassID(c, schoolID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cal, err := calendar.Load(database.DB, schoolID.(uint), classID, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load calendar"})
+		return
+	}
+
+	type DayInfo struct {
+		Date        string `json:"date"`
+		Working     bool   `json:"working"`
+		ScheduleDay string `json:"schedule_day,omitempty"` // По расписанию какого дня недели идут уроки
+	}
+
+	var days []DayInfo
+	workingCount := 0
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		scheduleDay, working := cal.ScheduleDay(d)
+		if working {
+			workingCount++
+		}
+		days = append(days, DayInfo{
+			Date:        d.Format(calendar.DateLayout),
+			Working:     working,
+			ScheduleDay: scheduleDay,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"date_from":    from.Format(calendar.DateLayout),
+		"date_to":      to.Format(calendar.DateLayout),
+		"working_days": workingCount,
+		"days":         days,
+	})
+}
+
+// ExportICS экспортирует календарь школы в формате iCalendar
+func (h *CalendarHandler) ExportICS(c *gin.Context) {
+	schoolID, _ := c.Get("school_id")
+
+	var school models.School
+	if err := database.DB.First(&school, schoolID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "School not found"})
+		return
+	}
+
+	query := database.DB.Where("school_id = ?", schoolID)
+	if classID := c.Query("class_id"); classID != "" {
+		query = query.Where("class_id IS NULL OR class_id = ?", classID)
+	} else {
+		query = query.Where("class_id IS NULL")
+	}
+
+	var events []models.CalendarEvent
+	if err := query.Order("start_date").Find(&events).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch calendar"})
+		return
+	}
+
+	cal := ical.Calendar{Name: school.Name}
+	for _, e := range events {
+		cal.Events = append(cal.Events, calendarEventToICal(e))
+	}
+
+	c.Header("Content-Type", "text/calendar; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=calendar_school_%d.ics", school.ID))
+	cal.Write(c.Writer)
+}
+
+// ImportICS импортирует праздники и каникулы из файла iCalendar.
+// Тип записи берётся из CATEGORIES (holiday, vacation, workday, day_off, event),
+// по умолчанию - параметр type или holiday. Повторный импорт обновляет записи по UID.
+func (h *CalendarHandler) ImportICS(c *gin.Context) {
+	schoolID, _ := c.Get("school_id")
+
+	defaultType := c.DefaultQuery("type", calendar.TypeHoliday)
+	if !calendar.ValidTypes[defaultType] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid type"})
+		return
+	}
+
+	classID, err := optionalClassID(c, schoolID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Принимаем как multipart-файл, так и тело запроса text/calendar
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxICSFileSize)
+	body := c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		file, err := c.FormFile("file")
+		if err != nil {
+			if tooLarge(err) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File is too large", "max_size": maxICSFileSize})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": "File is required"})
+			return
+		}
+		f, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+			return
+		}
+		defer f.Close()
+		body = f
+	}
+
+	parsed, err := ical.Parse(body)
+	if tooLarge(err) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File is too large", "max_size": maxICSFileSize})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid iCalendar: " + err.Error()})
+		return
+	}
+
+	created, updated := 0, 0
+	for _, e := range parsed.Events {
+		eventType := defaultType
+		workdayAs := ""
+		for _, category := range e.Categories {
+			if t := strings.ToLower(category); calendar.ValidTypes[t] {
+				eventType = t
+			} else if _, ok := calendar.ParseDayName(category); ok {
+				workdayAs = category
+			}
+		}
+		if eventType != calendar.TypeWorkday {
+			workdayAs = ""
+		}
+
+		// DTEND для событий на целый день не включается в период
+		endDate := e.Start
+		if !e.End.IsZero() && e.End.After(e.Start) {
+			endDate = e.End
+			if e.AllDay {
+				endDate = endDate.AddDate(0, 0, -1)
+			}
+		}
+
+		event := models.CalendarEvent{}
+		if e.UID != "" {
+			database.DB.Where("school_id = ? AND uid = ?", schoolID, e.UID).First(&event)
+		}
+
+		isNew := event.ID == 0
+		event.SchoolID = schoolID.(uint)
+		event.ClassID = classID
+		event.Type = eventType
+		event.Title = e.Summary
+		event.Description = e.Description
+		event.StartDate = calendar.Date(e.Start)
+		event.EndDate = calendar.Date(endDate)
+		event.WorkdayAs = workdayAs
+		event.UID = e.UID
+		if event.Title == "" {
+			event.Title = eventType
+		}
+
+		if err := db(c).Save(&event).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import calendar event"})
+			return
+		}
+
+		if isNew {
+			created++
+		} else {
+			updated++
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Calendar imported successfully",
+		"created": created,
+		"updated": updated,
+	})
+}
+
+// applyCalendarEventRequest проверяет запрос и переносит поля в запись календаря
+func applyCalendarEventRequest(event *models.CalendarEvent, req *CalendarEventRequest) error {
+	if !calendar.ValidTypes[req.Type] {
+		return fmt.Errorf("Invalid type (use holiday, vacation, workday, day_off or event)")
+	}
+
+	startDate, err := time.Parse(calendar.DateLayout, req.StartDate)
+	if err != nil {
+		return fmt.Errorf("Invalid start_date format (use YYYY-MM-DD)")
+	}
+
+	endDate := startDate
+	if req.EndDate != "" {
+		endDate, err = time.Parse(calendar.DateLayout, req.EndDate)
+		if err != nil {
+			return fmt.Errorf("Invalid end_date format (use YYYY-MM-DD)")
+		}
+	}
+	if endDate.Before(startDate) {
+		return fmt.Errorf("end_date must not be before start_date")
+	}
+
+	if req.WorkdayAs != "" {
+		if req.Type != calendar.TypeWorkday {
+			return fmt.Errorf("workday_as is only allowed for workday")
+		}
+		if _, ok := calendar.ParseDayName(req.WorkdayAs); !ok {
+			return fmt.Errorf("Invalid workday_as (use Понедельник, Вторник...)")
+		}
+	}
+
+	if req.ClassID != nil {
+		var class models.Class
+		if err := database.DB.Where("id = ? AND school_id = ?", *req.ClassID, event.SchoolID).
+			First(&class).Error; err != nil {
+			return fmt.Errorf("Class not found")
+		}
+	}
+
+	event.ClassID = req.ClassID
+	event.Type = req.Type
+	event.Title = req.Title
+	event.Description = req.Description
+	event.StartDate = startDate
+	event.EndDate = endDate
+	event.WorkdayAs = req.WorkdayAs
+	return nil
+}
+
+// calendarEventToICal преобразует запись календаря в событие iCalendar
+func calendarEventToICal(e models.CalendarEvent) ical.Event {
+	uid := e.UID
+	if uid == "" {
+		uid = fmt.Sprintf("calendar-%d@classkeeper", e.ID)
+	}
+	// День недели переноса передаём второй категорией, чтобы импорт его восстановил
+	categories := []string{e.Type}
+	if e.WorkdayAs != "" {
+		categories = append(categories, e.WorkdayAs)
+	}
+
+	return ical.Event{
+		UID:         uid,
+		Summary:     e.Title,
+		Description: e.Description,
+		Categories:  categories,
+		Start:       e.StartDate,
+		End:         e.EndDate.AddDate(0, 0, 1),
+		AllDay:      true,
+		Updated:     e.UpdatedAt,
+	}
+}
+
+// parsePeriod разбирает параметры date_from/date_to (по умолчанию - текущий месяц)
+func parsePeriod(c *gin.Context) (time.Time, time.Time, error) {
+	now := calendar.Date(time.Now())
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, -1)
+
+	if s := c.Query("date_from"); s != "" {
+		d, err := time.Parse(calendar.DateLayout, s)
+		if err != nil {
+			return from, to, fmt.Errorf("Invalid date_from format (use YYYY-MM-DD)")
+		}
+		from = d
+	}
+	if s := c.Query("date_to"); s != "" {
+		d, err := time.Parse(calendar.DateLayout, s)
+		if err != nil {
+			return from, to, fmt.Errorf("Invalid date_to format (use YYYY-MM-DD)")
+		}
+		to = d
+	}
+	if to.Before(from) {
+		return from, to, fmt.Errorf("date_to must not be before date_from")
+	}
+	if to.Sub(from) > maxCalendarPeriodDays*24*time.Hour {
+		return from, to, fmt.Errorf("Period must not exceed %d days", maxCalendarPeriodDays)
+	}
+	return from, to, nil
+}
+
+// tooLarge сообщает, что тело запроса превысило ограничение http.MaxBytesReader
+func tooLarge(err error) bool {
+	var maxBytes *http.MaxBytesError
+	return errors.As(err, &maxBytes)
+}
+
+// optionalClassID проверяет параметр class_id, если он указан
+func optionalClassID(c *gin.Context, schoolID interface{}) (*uint, error) {
+	s := c.Query("class_id")
+	if s == "" {
+		return nil, nil
+	}
+
+	var class models.Class
+	if err := database.DB.Where("id = ? AND school_id = ?", s, schoolID).First(&class).Error; err != nil {
+		return nil, fmt.Errorf("Class not found")
+	}
+	return &class.ID, nil
+}
+
+// loadClassCalendar загружает календарь класса с запасом вокруг указанного периода
+func loadClassCalendar(class *models.Class, from, to time.Time) (*calendar.Calendar, error) {
+	return calendar.Load(database.DB, class.SchoolID, &class.ID, from.AddDate(0, 0, -7), to.AddDate(0, 2, 0))
+}
@@ -0,0 +1,504 @@
+package handlers
+
+import (
+	"classkeeper/internal/calendar"
+	"classkeeper/internal/config"
+	"classkeeper/internal/database"
+	"classkeeper/internal/models"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Способы самостоятельной отметки
+const (
+	CheckInQR   = "qr"   // Ученик сканирует QR-код с планшета в классе
+	CheckInCode = "code" // Ученик вводит короткий код, который показывает учитель
+)
+
+const (
+	defaultRotationSeconds = 30
+	defaultLateAfter       = 10
+	defaultCheckInMinutes  = 20
+	// maxCheckInFailures - неверных кодов подряд за минуту, после которых ученик временно блокируется
+	maxCheckInFailures = 5
+)
+
+type CheckInHandler struct {
+	cfg      *config.Config
+	mu       sync.Mutex
+	failures map[uint][]time.Time
+}
+
+func NewCheckInHandler(cfg *config.Config) *CheckInHandler {
+	return &CheckInHandler{cfg: cfg, failures: make(map[uint][]time.Time)}
+}
+
+// OpenCheckInRequest структура для открытия сеанса отметки
+type OpenCheckInRequest struct {
+	ScheduleID      uint `json:"schedule_id" binding:"required"`
+	LateAfter       *int `json:"late_after"`       // Минут от начала урока, по умолчанию 10
+	DurationMinutes int  `json:"duration_minutes"` // Сколько принимать отметки после начала урока, по умолчанию 20
+	RotationSeconds int  `json:"rotation_seconds"` // Как часто меняется код, по умолчанию 30 секунд
+}
+
+// CloseCheckInRequest структура для закрытия сеанса
+type CloseCheckInRequest struct {
+	MarkAbsent bool `json:"mark_absent"` // Отметить не пришедших отсутствующими
+}
+
+// RedeemCheckInRequest структура для отметки ученика: токен из QR или короткий код
+type RedeemCheckInRequest struct {
+	Token string `json:"token"`
+	Code  string `json:"code"`
+}
+
+// OpenSession открывает сеанс самостоятельной отметки на сегодняшнем уроке.
+// Если для урока уже есть действующий сеанс, возвращается он.
+func (h *CheckInHandler) OpenSession(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req OpenCheckInRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	loc := h.location()
+	now := time.Now().In(loc)
+	today := calendar.Date(now)
+
+	schedule, date, ok := findLesson(c, req.ScheduleID, today.Format(calendar.DateLayout))
+	if !ok {
+		return
+	}
+
+	var existing models.CheckInSession
+	if err := database.DB.Where("schedule_id = ? AND date = ? AND closed_at IS NULL AND expires_at > ?", schedule.ID, date, now).
+		First(&existing).Error; err == nil {
+		c.JSON(http.StatusOK, gin.H{"session": existing, "code": h.currentCode(&existing, now)})
+		return
+	}
+
+	lateAfter := defaultLateAfter
+	if req.LateAfter != nil {
+		lateAfter = *req.LateAfter
+	}
+	duration := req.DurationMinutes
+	if duration == 0 {
+		duration = defaultCheckInMinutes
+	}
+	rotation := req.RotationSeconds
+	if rotation == 0 {
+		rotation = defaultRotationSeconds
+	}
+	if lateAfter < 0 || lateAfter >= maxMinutesLate {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("late_after must be between 0 and %d", maxMinutesLate-1)})
+		return
+	}
+	if duration < 1 || duration > maxMinutesLate {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("duration_minutes must be between 1 and %d", maxMinutesLate)})
+		return
+	}
+	if rotation < 10 || rotation > 300 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "rotation_seconds must be between 10 and 300"})
+		return
+	}
+
+	// Начало урока по расписанию; без времени в расписании считаем от открытия сеанса
+	lessonStart := now
+	if schedule.StartTime != "" {
+		if t, err := time.ParseInLocation("2006-01-02 15:04", date.Format(calendar.DateLayout)+" "+schedule.StartTime, loc); err == nil {
+			lessonStart = t
+		}
+	}
+	expiresAt := lessonStart.Add(time.Duration(duration) * time.Minute)
+	if !expiresAt.After(now) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Check-in period for this lesson is already over"})
+		return
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open check-in"})
+		return
+	}
+
+	session := models.CheckInSession{
+		ScheduleID:      schedule.ID,
+		Date:            date,
+		OpenedBy:        userID.(uint),
+		Secret:          hex.EncodeToString(secret),
+		RotationSeconds: rotation,
+		LateAfter:       lateAfter,
+		LessonStart:     lessonStart,
+		ExpiresAt:       expiresAt,
+	}
+	if err := db(c).Create(&session).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open check-in"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"session": session, "code": h.currentCode(&session, now)})
+}
+
+// GetSession возвращает сеанс с уже отметившимися учениками
+func (h *CheckInHandler) GetSession(c *gin.Context) {
+	session, ok := findCheckInSession(c)
+	if !ok {
+		return
+	}
+
+	database.DB.Where("session_id = ?", session.ID).Preload("Student").Order("created_at").Find(&session.CheckIns)
+
+	c.JSON(http.StatusOK, gin.H{"session": session})
+}
+
+// GetCode возвращает текущий код сеанса. Планшет в классе периодически запрашивает его,
+// чтобы показывать сменяющийся QR-код.
+func (h *CheckInHandler) GetCode(c *gin.Context) {
+	session, ok := findCheckInSession(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	if session.ClosedAt != nil || !now.Before(session.ExpiresAt) {
+		c.JSON(http.StatusGone, gin.H{"error": "Check-in session is closed"})
+		return
+	}
+
+	var count int64
+	database.DB.Model(&models.CheckIn{}).Where("session_id = ?", session.ID).Count(&count)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":        h.currentCode(session, now),
+		"checked_in":  count,
+		"expires_at":  session.ExpiresAt,
+		"lesson_late": now.After(session.LessonStart.Add(time.Duration(session.LateAfter) * time.Minute)),
+	})
+}
+
+// CloseSession закрывает сеанс; по желанию не отметившиеся ученики получают absent
+func (h *CheckInHandler) CloseSession(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req CloseCheckInRequest
+	c.ShouldBindJSON(&req)
+
+	session, ok := findCheckInSession(c)
+	if !ok {
+		return
+	}
+	if session.ClosedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Check-in session is already closed"})
+		return
+	}
+
+	markedAbsent := 0
+	err := db(c).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		session.ClosedAt = &now
+		if err := tx.Model(session).Update("closed_at", now).Error; err != nil {
+			return err
+		}
+		if !req.MarkAbsent {
+			return nil
+		}
+
+		var studentIDs []uint
+		if err := tx.Table("class_students").
+			Joins("JOIN users ON users.id = class_students.user_id AND users.deleted_at IS NULL").
+			Where("class_students.class_id = ? AND users.role IN ?", session.Schedule.ClassID, []string{"student", "starosta"}).
+			Pluck("class_students.user_id", &studentIDs).Error; err != nil {
+			return err
+		}
+
+		markedBy := userID.(uint)
+		for _, studentID := range studentIDs {
+			// Отметки, уже выставленные учителем или при регистрации, не трогаем
+			if _, err := findLessonAttendance(tx, session.Schedule, session.Date, studentID); err == nil {
+				continue
+			}
+			attendance := newLessonAttendance(session.Schedule, session.Date, studentID)
+			attendance.Status = "absent"
+			attendance.MarkedBy = &markedBy
+			applyApprovedExcuse(tx, attendance)
+			if err := tx.Create(attendance).Error; err != nil {
+				return err
+			}
+			markedAbsent++
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to close check-in"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Check-in session closed",
+		"session":       session,
+		"marked_absent": markedAbsent,
+	})
+}
+
+// Redeem отмечает ученика на уроке по токену из QR-кода или короткому коду.
+// Код действует только в свой период смены (и предыдущий - на время сканирования),
+// каждый ученик отмечается в сеансе один раз. После порога опоздания ставится late.
+func (h *CheckInHandler) Redeem(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	studentID := userID.(uint)
+
+	var req RedeemCheckInRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if (req.Token == "") == (req.Code == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Either token or code is required"})
+		return
+	}
+
+	if h.blocked(studentID) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many invalid codes, try again in a minute"})
+		return
+	}
+
+	now := time.Now()
+
+	// Действующие сеансы уроков классов ученика
+	var sessions []models.CheckInSession
+	database.DB.Joins("JOIN schedules ON schedules.id = check_in_sessions.schedule_id").
+		Joins("JOIN class_students ON class_students.class_id = schedules.class_id").
+		Where("class_students.user_id = ? AND check_in_sessions.closed_at IS NULL AND check_in_sessions.expires_at > ?", studentID, now).
+		Preload("Schedule").
+		Find(&sessions)
+
+	var session *models.CheckInSession
+	var window int64
+	method := CheckInCode
+	if req.Token != "" {
+		method = CheckInQR
+		sessionID, w, ok := h.verifyToken(req.Token, sessions, now)
+		if ok {
+			window = w
+			for i := range sessions {
+				if sessions[i].ID == sessionID {
+					session = &sessions[i]
+				}
+			}
+		}
+	} else {
+		code := strings.TrimSpace(req.Code)
+		for i := range sessions {
+			if w, ok := h.verifyCode(&sessions[i], code, now); ok {
+				session, window = &sessions[i], w
+				break
+			}
+		}
+	}
+	if session == nil {
+		h.fail(studentID)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired code"})
+		return
+	}
+
+	var already models.CheckIn
+	if err := database.DB.Where("session_id = ? AND student_id = ?", session.ID, studentID).First(&already).Error; err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "You have already checked in for this lesson", "check_in": already})
+		return
+	}
+
+	status, minutesLate := "present", 0
+	if late := int(now.Sub(session.LessonStart).Minutes()); late > session.LateAfter {
+		status, minutesLate = "late", late
+		if minutesLate > maxMinutesLate {
+			minutesLate = maxMinutesLate
+		}
+	}
+
+	checkIn := models.CheckIn{
+		SessionID:   session.ID,
+		StudentID:   studentID,
+		Method:      method,
+		Window:      window,
+		Status:      status,
+		MinutesLate: minutesLate,
+		IPAddress:   c.ClientIP(),
+	}
+	var attendance *models.Attendance
+	err := db(c).Transaction(func(tx *gorm.DB) error {
+		existing, err := findLessonAttendance(tx, session.Schedule, session.Date, studentID)
+		if err == nil && existing.Status != "absent" {
+			// Учитель уже отметил ученика присутствующим - его отметка главнее
+			attendance = existing
+		} else {
+			// Как и при ручной отметке, последняя запись заменяет предыдущую
+			if err == nil {
+				attendance = existing
+			} else {
+				attendance = newLessonAttendance(session.Schedule, session.Date, studentID)
+			}
+			attendance.Status = status
+			attendance.MinutesLate = minutesLate
+			attendance.MarkedBy = &session.OpenedBy
+			applyApprovedExcuse(tx, attendance)
+			if err := tx.Save(attendance).Error; err != nil {
+				return err
+			}
+		}
+
+		checkIn.AttendanceID = attendance.ID
+		// Уникальный индекс (session_id, student_id) не даёт отметиться дважды при гонке запросов
+		return tx.Create(&checkIn).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check in"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":    "Checked in successfully",
+		"check_in":   checkIn,
+		"attendance": attendance,
+	})
+}
+
+// location - часовой пояс школы, в котором задано время уроков
+func (h *CheckInHandler) location() *time.Location {
+	loc, err := time.LoadLocation(h.cfg.Server.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// currentCode возвращает коды текущего периода смены: токен для QR и короткий код
+func (h *CheckInHandler) currentCode(session *models.CheckInSession, now time.Time) gin.H {
+	window := now.Unix() / int64(session.RotationSeconds)
+	return gin.H{
+		"token":       checkInToken(session, window),
+		"short_code":  checkInShortCode(session, window),
+		"valid_until": time.Unix((window+1)*int64(session.RotationSeconds), 0),
+	}
+}
+
+// verifyToken проверяет токен из QR-кода: "<session_id>.<window>.<подпись>"
+func (h *CheckInHandler) verifyToken(token string, sessions []models.CheckInSession, now time.Time) (uint, int64, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return 0, 0, false
+	}
+	sessionID, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	window, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	for i := range sessions {
+		session := &sessions[i]
+		if uint64(session.ID) != sessionID || !windowValid(session, window, now) {
+			continue
+		}
+		if hmac.Equal([]byte(checkInToken(session, window)), []byte(token)) {
+			return session.ID, window, true
+		}
+	}
+	return 0, 0, false
+}
+
+// verifyCode проверяет короткий код для текущего или предыдущего периода смены
+func (h *CheckInHandler) verifyCode(session *models.CheckInSession, code string, now time.Time) (int64, bool) {
+	current := now.Unix() / int64(session.RotationSeconds)
+	for _, window := range []int64{current, current - 1} {
+		if hmac.Equal([]byte(checkInShortCode(session, window)), []byte(code)) {
+			return window, true
+		}
+	}
+	return 0, false
+}
+
+// blocked - ученик превысил число неверных кодов за последнюю минуту
+func (h *CheckInHandler) blocked(studentID uint) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	cutoff := time.Now().Add(-time.Minute)
+	recent := h.failures[studentID][:0]
+	for _, t := range h.failures[studentID] {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) == 0 {
+		delete(h.failures, studentID)
+		return false
+	}
+	h.failures[studentID] = recent
+	return len(recent) >= maxCheckInFailures
+}
+
+func (h *CheckInHandler) fail(studentID uint) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.failures[studentID] = append(h.failures[studentID], time.Now())
+}
+
+// windowValid - токен принимается только в свой период смены или сразу после него
+func windowValid(session *models.CheckInSession, window int64, now time.Time) bool {
+	current := now.Unix() / int64(session.RotationSeconds)
+	return window == current || window == current-1
+}
+
+func checkInMAC(session *models.CheckInSession, purpose string, window int64) []byte {
+	mac := hmac.New(sha256.New, []byte(session.Secret))
+	fmt.Fprintf(mac, "%s:%d:%d", purpose, session.ID, window)
+	return mac.Sum(nil)
+}
+
+func checkInToken(session *models.CheckInSession, window int64) string {
+	return fmt.Sprintf("%d.%d.%s", session.ID, window, hex.EncodeToString(checkInMAC(session, CheckInQR, window))[:20])
+}
+
+func checkInShortCode(session *models.CheckInSession, window int64) string {
+	sum := checkInMAC(session, CheckInCode, window)
+	return fmt.Sprintf("%06d", binary.BigEndian.Uint32(sum[:4])%1000000)
+}
+
+// findCheckInSession загружает сеанс школы, которым может управлять текущий пользователь
+func findCheckInSession(c *gin.Context) (*models.CheckInSession, bool) {
+	schoolID, _ := c.Get("school_id")
+
+	var session models.CheckInSession
+	if err := database.DB.Joins("JOIN schedules ON schedules.id = check_in_sessions.schedule_id").
+		Joins("JOIN classes ON classes.id = schedules.class_id").
+		Where("check_in_sessions.id = ? AND classes.school_id = ?", c.Param("id"), schoolID).
+		Preload("Schedule.Class").
+		Preload("Schedule.Subject").
+		First(&session).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Check-in session not found"})
+		return nil, false
+	}
+
+	if !canTakeRegister(c, session.Schedule) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return nil, false
+	}
+
+	return &session, true
+}
@@ -7,6 +7,7 @@ import (
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type ClassHandler struct{}
@@ -33,6 +34,7 @@ type UpdateClassRequest struct {
 
 // AddStudentsRequest структура для добавления учеников
 type AddStudentsRequest struct {
+	Mode       string `json:"mode"` // atomic (по умолчанию), partial, validate
 	StudentIDs []uint `json:"student_ids" binding:"required"`
 }
 
@@ -74,7 +76,7 @@ func (h *ClassHandler) CreateClass(c *gin.Context) {
 		StarostaID:        req.StarostaID,
 	}
 
-	if err := database.DB.Create(&class).Error; err != nil {
+	if err := db(c).Create(&class).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create class"})
 		return
 	}
@@ -180,7 +182,7 @@ func (h *ClassHandler) UpdateClass(c *gin.Context) {
 		class.StarostaID = req.StarostaID
 	}
 
-	if err := database.DB.Save(&class).Error; err != nil {
+	if err := db(c).Save(&class).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update class"})
 		return
 	}
@@ -207,7 +209,7 @@ func (h *ClassHandler) DeleteClass(c *gin.Context) {
 		return
 	}
 
-	if err := database.DB.Delete(&class).Error; err != nil {
+	if err := db(c).Delete(&class).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete class"})
 		return
 	}
@@ -231,28 +233,52 @@ func (h *ClassHandler) AddStudents(c *gin.Context) {
 		return
 	}
 
+	mode, ok := parseBulkMode(c, req.Mode, len(req.StudentIDs), maxBulkItems)
+	if !ok {
+		return
+	}
+
 	var class models.Class
-	if err := database.DB.Where("id = ? AND school_id = ?", id, schoolID).
-		Preload("Students").First(&class).Error; err != nil {
+	if err := database.DB.Where("id = ? AND school_id = ?", id, schoolID).First(&class).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Class not found"})
 		return
 	}
 
-	// Получаем учеников
+	// Ученики школы из запроса - одним запросом
 	var students []models.User
-	if err := database.DB.Where("id IN ? AND school_id = ? AND (role = ? OR role = ?)", 
+	if err := database.DB.Where("id IN ? AND school_id = ? AND (role = ? OR role = ?)",
 		req.StudentIDs, schoolID, "student", "starosta").Find(&students).Error; err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Students not found"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load students"})
 		return
 	}
+	valid := make(map[uint]bool, len(students))
+	for _, student := range students {
+		valid[student.ID] = true
+	}
 
-	if len(students) != len(req.StudentIDs) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Some students not found or not valid"})
-		return
+	// Уже зачисленные ученики
+	var enrolledIDs []uint
+	database.DB.Table("class_students").Where("class_id = ?", class.ID).Pluck("user_id", &enrolledIDs)
+	enrolled := make(map[uint]bool, len(enrolledIDs))
+	for _, studentID := range enrolledIDs {
+		enrolled[studentID] = true
 	}
 
-	// Добавляем учеников
-	if err := database.DB.Model(&class).Association("Students").Append(&students); err != nil {
+	report, err := runBulk(c, mode, len(req.StudentIDs), func(tx *gorm.DB, i int) (uint, interface{}, error) {
+		studentID := req.StudentIDs[i]
+		if !valid[studentID] {
+			return 0, nil, itemError("Student not found or not valid")
+		}
+		if enrolled[studentID] {
+			return studentID, "Student is already in this class", nil
+		}
+		if err := tx.Table("class_students").Create(map[string]interface{}{"class_id": class.ID, "user_id": studentID}).Error; err != nil {
+			return 0, nil, err
+		}
+		enrolled[studentID] = true
+		return studentID, nil, nil
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add students"})
 		return
 	}
@@ -260,7 +286,11 @@ func (h *ClassHandler) AddStudents(c *gin.Context) {
 	// Обновляем класс с учениками
 	database.DB.Preload("Students").First(&class, class.ID)
 
-	c.JSON(http.StatusOK, gin.H{"class": class, "message": "Students added successfully"})
+	extra := gin.H{"class": class}
+	if report.Committed && report.Failed == 0 {
+		extra["message"] = "Students added successfully"
+	}
+	respondBulk(c, report, extra)
 }
 
 // RemoveStudent удаляет ученика из класса
@@ -292,7 +322,7 @@ func (h *ClassHandler) RemoveStudent(c *gin.Context) {
 	}
 
 	// Удаляем ученика из класса
-	if err := database.DB.Model(&class).Association("Students").Delete(&student); err != nil {
+	if err := db(c).Model(&class).Association("Students").Delete(&student); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove student"})
 		return
 	}
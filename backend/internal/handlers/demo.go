@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"classkeeper/internal/config"
+	"classkeeper/internal/database"
+	"classkeeper/internal/demo"
+	"classkeeper/internal/models"
+	"classkeeper/internal/seed"
+	"classkeeper/internal/storage"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DemoHandler - песочницы демо-режима: создание, вход одним нажатием и сброс
+type DemoHandler struct {
+	cfg   *config.Config
+	store storage.Backend
+	auth  *AuthHandler
+}
+
+func NewDemoHandler(cfg *config.Config, store storage.Backend, auth *AuthHandler) *DemoHandler {
+	return &DemoHandler{cfg: cfg, store: store, auth: auth}
+}
+
+// DemoLoginRequest - вход в песочницу под ролью
+type DemoLoginRequest struct {
+	Key  string `json:"key" binding:"required"`
+	Role string `json:"role" binding:"required"`
+}
+
+// DemoResetRequest - сброс песочницы к исходным данным
+type DemoResetRequest struct {
+	Key string `json:"key" binding:"required"`
+}
+
+// DemoSandboxResponse - песочница посетителя. Key есть только в ответе на создание.
+type DemoSandboxResponse struct {
+	Key       string            `json:"key,omitempty"`
+	SchoolID  uint              `json:"school_id"`
+	ExpiresAt time.Time         `json:"expires_at"`
+	Logins    map[string]string `json:"logins"` // роль -> логин
+	Password  string            `json:"password"`
+}
+
+// GetDemoInfo возвращает параметры демо-режима
+func (h *DemoHandler) GetDemoInfo(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"roles":       demo.Roles,
+		"ttl_minutes": int(h.cfg.Demo.TTL.Minutes()),
+	})
+}
+
+// CreateSandbox создаёт песочницу для нового посетителя
+func (h *DemoHandler) CreateSandbox(c *gin.Context) {
+	sandbox, key, err := demo.Create(c.Request.Context(), database.DB, &h.cfg.Demo)
+	if errors.Is(err, demo.ErrLimit) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Demo sandbox creation failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create demo sandbox"})
+		return
+	}
+	h.respond(c, http.StatusCreated, sandbox, key)
+}
+
+// GetSandbox возвращает песочницу по ключу из заголовка X-Demo-Key
+func (h *DemoHandler) GetSandbox(c *gin.Context) {
+	sandbox, ok := h.sandbox(c, c.GetHeader("X-Demo-Key"))
+	if !ok {
+		return
+	}
+	h.respond(c, http.StatusOK, sandbox, "")
+}
+
+// Login выдаёт токен первого пользователя песочницы с выбранной ролью
+func (h *DemoHandler) Login(c *gin.Context) {
+	var req DemoLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sandbox, ok := h.sandbox(c, req.Key)
+	if !ok {
+		return
+	}
+
+	user, err := demo.User(database.DB, sandbox, req.Role)
+	if errors.Is(err, demo.ErrUnknownRole) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find demo user"})
+		return
+	}
+
+	token, err := h.auth.generateToken(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	c.JSON(http.StatusOK, AuthResponse{Token: token, User: user})
+}
+
+// ResetSandbox возвращает песочницу к исходным данным и продлевает её
+func (h *DemoHandler) ResetSandbox(c *gin.Context) {
+	var req DemoResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sandbox, ok := h.sandbox(c, req.Key)
+	if !ok {
+		return
+	}
+
+	if err := demo.Reset(c.Request.Context(), database.DB, h.store, &h.cfg.Demo, sandbox); err != nil {
+		log.Printf("Demo sandbox reset failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset demo sandbox"})
+		return
+	}
+	h.respond(c, http.StatusOK, sandbox, "")
+}
+
+// sandbox находит действующую песочницу по ключу или отвечает 404
+func (h *DemoHandler) sandbox(c *gin.Context, key string) (*models.DemoSandbox, bool) {
+	sandbox, err := demo.Find(database.DB, key)
+	if errors.Is(err, demo.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find demo sandbox"})
+		return nil, false
+	}
+	return sandbox, true
+}
+
+func (h *DemoHandler) respond(c *gin.Context, status int, sandbox *models.DemoSandbox, key string) {
+	logins, err := demo.Logins(database.DB, sandbox)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load demo logins"})
+		return
+	}
+	c.JSON(status, DemoSandboxResponse{
+		Key:       key,
+		SchoolID:  sandbox.SchoolID,
+		ExpiresAt: sandbox.ExpiresAt,
+		Logins:    logins,
+		Password:  seed.DefaultPassword,
+	})
+}
@@ -18,7 +18,7 @@ func NewExportHandler() *ExportHandler {
 	return &ExportHandler{}
 }
 
-// ExportClassGrades экспортирует оценки класса в CSV
+// ExportClassGrades экспортирует оценки класса в CSV (списком) или XLSX (журналом)
 func (h *ExportHandler) ExportClassGrades(c *gin.Context) {
 	classID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -28,6 +28,11 @@ func (h *ExportHandler) ExportClassGrades(c *gin.Context) {
 
 	schoolID, _ := c.Get("school_id")
 
+	format, ok := exportFormat(c)
+	if !ok {
+		return
+	}
+
 	// Проверяем класс
 	var class models.Class
 	if err := database.DB.Where("id = ? AND school_id = ?", classID, schoolID).
@@ -36,6 +41,12 @@ func (h *ExportHandler) ExportClassGrades(c *gin.Context) {
 		return
 	}
 
+	// XLSX - журнал в бумажном виде: по листу на предмет
+	if format == ExportXLSX {
+		exportJournalXLSX(c, class)
+		return
+	}
+
 	// Получаем оценки
 	var grades []models.Grade
 	studentIDs := make([]uint, len(class.Students))
@@ -74,7 +85,7 @@ func (h *ExportHandler) ExportClassGrades(c *gin.Context) {
 	}
 }
 
-// ExportClassAttendance экспортирует посещаемость класса в CSV
+// ExportClassAttendance экспортирует посещаемость класса в CSV (списком) или XLSX (по дням)
 func (h *ExportHandler) ExportClassAttendance(c *gin.Context) {
 	classID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -93,6 +104,11 @@ func (h *ExportHandler) ExportClassAttendance(c *gin.Context) {
 		dateTo = time.Now().Format("2006-01-02")
 	}
 
+	format, ok := exportFormat(c)
+	if !ok {
+		return
+	}
+
 	// Проверяем класс
 	var class models.Class
 	if err := database.DB.Where("id = ? AND school_id = ?", classID, schoolID).
@@ -101,12 +117,22 @@ func (h *ExportHandler) ExportClassAttendance(c *gin.Context) {
 		return
 	}
 
+	if format == ExportXLSX {
+		from, errFrom := time.Parse("2006-01-02", dateFrom)
+		to, errTo := time.Parse("2006-01-02", dateTo)
+		if errFrom != nil || errTo != nil || to.Before(from) || to.Sub(from).Hours()/24 > maxExportDays {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid period (use YYYY-MM-DD)"})
+			return
+		}
+		exportAttendanceXLSX(c, class, from, to)
+		return
+	}
+
 	// Получаем посещаемость
 	var attendance []models.Attendance
-	database.DB.Joins("JOIN schedules ON schedules.id = attendances.schedule_id").
-		Where("schedules.class_id = ? AND attendances.date BETWEEN ? AND ?", classID, dateFrom, dateTo).
+	database.DB.Where("class_id = ? AND date BETWEEN ? AND ?", classID, dateFrom, dateTo).
 		Preload("Student").
-		Preload("Schedule.Subject").
+		Preload("Subject").
 		Preload("Marker").
 		Order("date DESC").
 		Find(&attendance)
@@ -213,7 +239,7 @@ func (h *ExportHandler) ExportStudentReport(c *gin.Context) {
 		Count       int64
 	}
 
-	database.DB.Table("grades").
+	database.DB.Model(&models.Grade{}).
 		Select("subjects.name as subject_name, AVG(grades.grade) as average, COUNT(*) as count").
 		Joins("JOIN subjects ON subjects.id = grades.subject_id").
 		Where("grades.student_id = ?", studentID).
@@ -294,6 +320,15 @@ func (h *ExportHandler) ExportSchoolReport(c *gin.Context) {
 	var school models.School
 	database.DB.First(&school, schoolID)
 
+	format, ok := exportFormat(c)
+	if !ok {
+		return
+	}
+	if format == ExportXLSX {
+		exportSchoolXLSX(c, school)
+		return
+	}
+
 	c.Header("Content-Type", "text/csv; charset=utf-8")
 	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=school_report_%s.csv", 
 		time.Now().Format("2006-01-02")))
@@ -336,7 +371,7 @@ func (h *ExportHandler) ExportSchoolReport(c *gin.Context) {
 		var avgGrade struct {
 			Average float64
 		}
-		database.DB.Table("grades").
+		database.DB.Model(&models.Grade{}).
 			Joins("JOIN users ON users.id = grades.student_id").
 			Joins("JOIN class_students ON class_students.user_id = users.id").
 			Where("class_students.class_id = ?", class.ID).
@@ -347,13 +382,11 @@ func (h *ExportHandler) ExportSchoolReport(c *gin.Context) {
 			Total   int64
 			Present int64
 		}
-		database.DB.Table("attendances").
-			Joins("JOIN schedules ON schedules.id = attendances.schedule_id").
-			Where("schedules.class_id = ?", class.ID).
+		database.DB.Model(&models.Attendance{}).
+			Where("class_id = ?", class.ID).
 			Count(&attendance.Total)
-		database.DB.Table("attendances").
-			Joins("JOIN schedules ON schedules.id = attendances.schedule_id").
-			Where("schedules.class_id = ? AND attendances.status = ?", class.ID, "present").
+		database.DB.Model(&models.Attendance{}).
+			Where("class_id = ? AND status = ?", class.ID, "present").
 			Count(&attendance.Present)
 
 		var attendancePercent float64
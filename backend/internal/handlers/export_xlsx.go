@@ -0,0 +1,699 @@
+package handlers
+
+import (
+	"classkeeper/internal/calendar"
+	"classkeeper/internal/database"
+	"classkeeper/internal/models"
+	"classkeeper/internal/xlsx"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Форматы выгрузки
+const (
+	ExportCSV  = "csv"
+	ExportXLSX = "xlsx"
+)
+
+// maxExportDays - предел периода выгрузки журнала
+const maxExportDays = 400
+
+// journalMarks - отметки посещаемости в клетках журнала
+var journalMarks = map[string]string{
+	"absent":  "н",
+	"excused": "у",
+	"late":    "оп",
+}
+
+var monthNames = [...]string{"Январь", "Февраль", "Март", "Апрель", "Май", "Июнь",
+	"Июль", "Август", "Сентябрь", "Октябрь", "Ноябрь", "Декабрь"}
+
+// exportFormat читает параметр format (csv по умолчанию).
+// При ошибке пишет ответ и возвращает false.
+func exportFormat(c *gin.Context) (string, bool) {
+	format := c.DefaultQuery("format", ExportCSV)
+	if format != ExportCSV && format != ExportXLSX {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format (use csv or xlsx)"})
+		return "", false
+	}
+	return format, true
+}
+
+// exportPeriod читает date_from/date_to; по умолчанию - с начала учебного года по сегодня
+func exportPeriod(c *gin.Context) (time.Time, time.Time, error) {
+	today := calendar.Date(time.Now())
+	from, yearEnd := calendar.AcademicYear(today)
+	to := today
+	if to.After(yearEnd) {
+		to = yearEnd
+	}
+
+	if s := c.Query("date_from"); s != "" {
+		d, err := time.Parse(calendar.DateLayout, s)
+		if err != nil {
+			return from, to, fmt.Errorf("Invalid date_from format (use YYYY-MM-DD)")
+		}
+		from = d
+	}
+	if s := c.Query("date_to"); s != "" {
+		d, err := time.Parse(calendar.DateLayout, s)
+		if err != nil {
+			return from, to, fmt.Errorf("Invalid date_to format (use YYYY-MM-DD)")
+		}
+		to = d
+	}
+	if to.Before(from) {
+		return from, to, fmt.Errorf("date_to must not be before date_from")
+	}
+	if to.Sub(from).Hours()/24 > maxExportDays {
+		return from, to, fmt.Errorf("Period is too long (max %d days)", maxExportDays)
+	}
+	return from, to, nil
+}
+
+// sendWorkbook отдаёт книгу как вложение
+func sendWorkbook(c *gin.Context, wb *xlsx.Workbook, filename string) {
+	c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	if err := wb.Write(c.Writer); err != nil {
+		c.Error(err)
+	}
+}
+
+// classStudents возвращает учеников класса по алфавиту
+func classStudents(classID uint) []models.User {
+	var students []models.User
+	database.DB.Joins("JOIN class_students ON class_students.user_id = users.id").
+		Where("class_students.class_id = ?", classID).
+		Order("users.last_name, users.first_name").
+		Find(&students)
+	return students
+}
+
+// studentName возвращает "Фамилия Имя"
+func studentName(u *models.User) string {
+	name := strings.TrimSpace(u.LastName + " " + u.FirstName)
+	if name == "" {
+		return u.Username
+	}
+	return name
+}
+
+// classJournal - данные журнала класса за период
+type classJournal struct {
+	class    models.Class
+	from, to time.Time
+	students []models.User
+	subjects []models.Subject
+	terms    []calendar.Term
+	cal      *calendar.Calendar
+
+	lessonDays map[uint]map[string]bool              // Предмет -> дни недели с уроками
+	grades     map[uint]map[uint]map[string][]int    // Предмет -> ученик -> дата -> оценки
+	marks      map[uint]map[uint]map[string][]string // Предмет (0 - без предмета) -> ученик -> дата -> статусы
+	dates      map[uint]map[string]bool              // Предмет -> даты с оценками или отметками
+}
+
+// loadClassJournal загружает журнал класса; subjectID ограничивает его одним предметом
+func loadClassJournal(class models.Class, from, to time.Time, subjectID *uint) (*classJournal, error) {
+	j := &classJournal{
+		class:      class,
+		from:       from,
+		to:         to,
+		students:   classStudents(class.ID),
+		lessonDays: make(map[uint]map[string]bool),
+		grades:     make(map[uint]map[uint]map[string][]int),
+		marks:      make(map[uint]map[uint]map[string][]string),
+		dates:      make(map[uint]map[string]bool),
+	}
+
+	var err error
+	if j.cal, err = loadClassCalendar(&class, from, to); err != nil {
+		return nil, err
+	}
+	if j.terms, err = calendar.Terms(database.DB, class.SchoolID, from, to); err != nil {
+		return nil, err
+	}
+
+	var schedules []models.Schedule
+	database.DB.Where("class_id = ?", class.ID).Find(&schedules)
+	subjectIDs := make(map[uint]bool)
+	for _, s := range schedules {
+		if j.lessonDays[s.SubjectID] == nil {
+			j.lessonDays[s.SubjectID] = make(map[string]bool)
+		}
+		j.lessonDays[s.SubjectID][s.DayOfWeek] = true
+		subjectIDs[s.SubjectID] = true
+	}
+
+	studentIDs := make([]uint, len(j.students))
+	for i, s := range j.students {
+		studentIDs[i] = s.ID
+	}
+
+	if len(studentIDs) > 0 {
+		var grades []models.Grade
+		database.DB.Where("student_id IN ? AND date BETWEEN ? AND ?", studentIDs, from, to).
+			Order("date, id").Find(&grades)
+		for _, g := range grades {
+			key := g.Date.Format(calendar.DateLayout)
+			if j.grades[g.SubjectID] == nil {
+				j.grades[g.SubjectID] = make(map[uint]map[string][]int)
+			}
+			if j.grades[g.SubjectID][g.StudentID] == nil {
+				j.grades[g.SubjectID][g.StudentID] = make(map[string][]int)
+			}
+			j.grades[g.SubjectID][g.StudentID][key] = append(j.grades[g.SubjectID][g.StudentID][key], g.Grade)
+			j.addDate(g.SubjectID, key)
+			subjectIDs[g.SubjectID] = true
+		}
+	}
+
+	var attendance []models.Attendance
+	database.DB.Where("class_id = ? AND date BETWEEN ? AND ?", class.ID, from, to).
+		Order("date, lesson_number").Find(&attendance)
+	for _, a := range attendance {
+		subject := uint(0)
+		if a.SubjectID != nil {
+			subject = *a.SubjectID
+			subjectIDs[subject] = true
+		}
+		key := a.Date.Format(calendar.DateLayout)
+		if j.marks[subject] == nil {
+			j.marks[subject] = make(map[uint]map[string][]string)
+		}
+		if j.marks[subject][a.StudentID] == nil {
+			j.marks[subject][a.StudentID] = make(map[string][]string)
+		}
+		j.marks[subject][a.StudentID][key] = append(j.marks[subject][a.StudentID][key], a.Status)
+		j.addDate(subject, key)
+	}
+
+	ids := make([]uint, 0, len(subjectIDs))
+	for id := range subjectIDs {
+		if subjectID == nil || id == *subjectID {
+			ids = append(ids, id)
+		}
+	}
+	if subjectID != nil && len(ids) == 0 {
+		ids = append(ids, *subjectID)
+	}
+	if len(ids) > 0 {
+		database.DB.Where("id IN ? AND school_id = ?", ids, class.SchoolID).Order("name").Find(&j.subjects)
+	}
+	return j, nil
+}
+
+func (j *classJournal) addDate(subjectID uint, key string) {
+	if j.dates[subjectID] == nil {
+		j.dates[subjectID] = make(map[string]bool)
+	}
+	j.dates[subjectID][key] = true
+}
+
+// lessonDates возвращает даты уроков предмета по расписанию и даты с оценками или отметками
+func (j *classJournal) lessonDates(subjectID uint) []time.Time {
+	keys := make(map[string]bool)
+	for key := range j.dates[subjectID] {
+		keys[key] = true
+	}
+	if days := j.lessonDays[subjectID]; len(days) > 0 {
+		for d := j.from; !d.After(j.to); d = d.AddDate(0, 0, 1) {
+			if day, ok := j.cal.ScheduleDay(d); ok && days[day] {
+				keys[d.Format(calendar.DateLayout)] = true
+			}
+		}
+	}
+
+	dates := make([]time.Time, 0, len(keys))
+	for key := range keys {
+		d, _ := time.Parse(calendar.DateLayout, key)
+		dates = append(dates, d)
+	}
+	sort.Slice(dates, func(a, b int) bool { return dates[a].Before(dates[b]) })
+	return dates
+}
+
+// writeDateHeader пишет шапку "№ | Ученик | месяцы с датами" и возвращает первый свободный столбец
+func writeDateHeader(sheet *xlsx.Sheet, dates []time.Time) int {
+	sheet.Set(1, 0, "№", xlsx.StyleHeader)
+	sheet.Set(2, 0, nil, xlsx.StyleHeader)
+	sheet.Merge(1, 0, 2, 0)
+	sheet.Set(1, 1, "Ученик", xlsx.StyleHeader)
+	sheet.Set(2, 1, nil, xlsx.StyleHeader)
+	sheet.Merge(1, 1, 2, 1)
+	sheet.SetColWidth(0, 4)
+	sheet.SetColWidth(1, 28)
+
+	col := 2
+	for i := 0; i < len(dates); {
+		month := dates[i].Month()
+		year := dates[i].Year()
+		start := col
+		for ; i < len(dates) && dates[i].Month() == month && dates[i].Year() == year; i++ {
+			sheet.Set(2, col, fmt.Sprintf("%02d", dates[i].Day()), xlsx.StyleHeader)
+			sheet.SetColWidth(col, 5)
+			col++
+		}
+		sheet.Set(1, start, fmt.Sprintf("%s %d", monthNames[month-1], year), xlsx.StyleHeader)
+		for c := start + 1; c < col; c++ {
+			sheet.Set(1, c, nil, xlsx.StyleHeader)
+		}
+		sheet.Merge(1, start, 1, col-1)
+	}
+	sheet.Freeze(3, 2)
+	return col
+}
+
+// writeGroupHeader пишет над столбцами first.. заголовок группы и подписи столбцов
+func writeGroupHeader(sheet *xlsx.Sheet, first int, title string, labels []string, width float64) int {
+	if len(labels) == 1 && labels[0] == "" {
+		sheet.Set(1, first, title, xlsx.StyleHeader)
+		sheet.Set(2, first, nil, xlsx.StyleHeader)
+		sheet.Merge(1, first, 2, first)
+		sheet.SetColWidth(first, width)
+		return first + 1
+	}
+	for i, label := range labels {
+		if i == 0 {
+			sheet.Set(1, first, title, xlsx.StyleHeader)
+		} else {
+			sheet.Set(1, first+i, nil, xlsx.StyleHeader)
+		}
+		sheet.Set(2, first+i, label, xlsx.StyleHeader)
+		sheet.SetColWidth(first+i, width)
+	}
+	sheet.Merge(1, first, 1, first+len(labels)-1)
+	return first + len(labels)
+}
+
+// termLabels возвращает подписи учебных периодов и итогового столбца
+func termLabels(terms []calendar.Term) []string {
+	labels := make([]string, 0, len(terms)+1)
+	for _, t := range terms {
+		labels = append(labels, strconv.Itoa(t.Number))
+	}
+	return append(labels, "Итог")
+}
+
+// average возвращает средний балл или nil, если оценок нет
+func average(sum, count int) interface{} {
+	if count == 0 {
+		return nil
+	}
+	return float64(sum) / float64(count)
+}
+
+// addSubjectSheet добавляет лист журнала по предмету: ученики по строкам, даты уроков
+// по столбцам с группировкой по месяцам, отметки в клетках и средние по периодам в конце
+func (j *classJournal) addSubjectSheet(wb *xlsx.Workbook, subject models.Subject) {
+	sheet := wb.AddSheet(subject.Name)
+	dates := j.lessonDates(subject.ID)
+
+	sheet.Set(0, 0, fmt.Sprintf("Журнал %s - %s (%s - %s)", j.class.Name, subject.Name,
+		j.from.Format("02.01.2006"), j.to.Format("02.01.2006")), xlsx.StyleTitle)
+
+	col := writeDateHeader(sheet, dates)
+	avgCol := col
+	col = writeGroupHeader(sheet, col, "Средний балл", termLabels(j.terms), 7)
+	absentCol := col
+	writeGroupHeader(sheet, col, "Пропуски", []string{""}, 10)
+
+	for i, student := range j.students {
+		row := i + 3
+		sheet.Set(row, 0, i+1, xlsx.StyleCell)
+		sheet.Set(row, 1, studentName(&student), xlsx.StyleText)
+
+		grades := j.grades[subject.ID][student.ID]
+		marks := j.marks[subject.ID][student.ID]
+		termSum := make([]int, len(j.terms))
+		termCount := make([]int, len(j.terms))
+		sum, count, missed := 0, 0, 0
+
+		for k, d := range dates {
+			key := d.Format(calendar.DateLayout)
+			var parts []string
+			alert := false
+			for _, status := range marks[key] {
+				if mark, ok := journalMarks[status]; ok {
+					parts = append(parts, mark)
+				}
+				if status == "absent" || status == "excused" {
+					missed++
+				}
+				alert = alert || status == "absent"
+			}
+			for _, g := range grades[key] {
+				parts = append(parts, strconv.Itoa(g))
+				alert = alert || g <= 2
+				sum += g
+				count++
+				for t, term := range j.terms {
+					if !d.Before(term.From) && !d.After(term.To) {
+						termSum[t] += g
+						termCount[t]++
+					}
+				}
+			}
+
+			style := xlsx.StyleCell
+			if alert {
+				style = xlsx.StyleAlert
+			}
+			switch {
+			case len(parts) == 0:
+				sheet.Set(row, 2+k, nil, style)
+			case len(parts) == 1 && len(grades[key]) == 1:
+				sheet.Set(row, 2+k, grades[key][0], style)
+			default:
+				sheet.Set(row, 2+k, strings.Join(parts, "/"), style)
+			}
+		}
+
+		for t := range j.terms {
+			sheet.Set(row, avgCol+t, average(termSum[t], termCount[t]), xlsx.StyleNumber)
+		}
+		sheet.Set(row, avgCol+len(j.terms), average(sum, count), xlsx.StyleTotal)
+		sheet.Set(row, absentCol, missed, xlsx.StyleCell)
+	}
+}
+
+// exportJournalXLSX выгружает журнал класса: по листу на предмет
+func exportJournalXLSX(c *gin.Context, class models.Class) {
+	from, to, err := exportPeriod(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var subjectID *uint
+	if s := c.Query("subject_id"); s != "" {
+		id, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subject_id"})
+			return
+		}
+		var subject models.Subject
+		if err := database.DB.Where("id = ? AND school_id = ?", id, class.SchoolID).First(&subject).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Subject not found"})
+			return
+		}
+		uid := uint(id)
+		subjectID = &uid
+	}
+
+	journal, err := loadClassJournal(class, from, to, subjectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load journal"})
+		return
+	}
+
+	wb := xlsx.NewWorkbook()
+	for _, subject := range journal.subjects {
+		journal.addSubjectSheet(wb, subject)
+	}
+	if len(journal.subjects) == 0 {
+		sheet := wb.AddSheet("Журнал")
+		sheet.Set(0, 0, fmt.Sprintf("Журнал %s: нет уроков и оценок за период", class.Name), xlsx.StyleTitle)
+	}
+
+	sendWorkbook(c, wb, fmt.Sprintf("journal_class_%s.xlsx", class.Name))
+}
+
+// exportAttendanceXLSX выгружает посещаемость класса: число пропущенных уроков по дням
+// и итоги по каждому ученику
+func exportAttendanceXLSX(c *gin.Context, class models.Class, from, to time.Time) {
+	journal, err := loadClassJournal(class, from, to, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load attendance"})
+		return
+	}
+
+	// Все отметки ученика по датам, независимо от предмета
+	byStudent := make(map[uint]map[string][]string)
+	keys := make(map[string]bool)
+	for _, students := range journal.marks {
+		for studentID, days := range students {
+			if byStudent[studentID] == nil {
+				byStudent[studentID] = make(map[string][]string)
+			}
+			for key, statuses := range days {
+				byStudent[studentID][key] = append(byStudent[studentID][key], statuses...)
+				keys[key] = true
+			}
+		}
+	}
+	for _, d := range journal.cal.WorkingDays(from, to) {
+		keys[d.Format(calendar.DateLayout)] = true
+	}
+	dates := make([]time.Time, 0, len(keys))
+	for key := range keys {
+		d, _ := time.Parse(calendar.DateLayout, key)
+		dates = append(dates, d)
+	}
+	sort.Slice(dates, func(a, b int) bool { return dates[a].Before(dates[b]) })
+
+	wb := xlsx.NewWorkbook()
+	sheet := wb.AddSheet("Посещаемость")
+	sheet.Set(0, 0, fmt.Sprintf("Посещаемость %s (%s - %s): пропущено уроков за день", class.Name,
+		from.Format("02.01.2006"), to.Format("02.01.2006")), xlsx.StyleTitle)
+
+	col := writeDateHeader(sheet, dates)
+	totalCol := col
+	writeGroupHeader(sheet, col, "Итого", []string{"Пропущено", "Уважит.", "Опозданий", "Посещ. %"}, 10)
+
+	for i, student := range journal.students {
+		row := i + 3
+		sheet.Set(row, 0, i+1, xlsx.StyleCell)
+		sheet.Set(row, 1, studentName(&student), xlsx.StyleText)
+
+		total, missed, excused, late := 0, 0, 0, 0
+		for k, d := range dates {
+			dayMissed, dayAbsent, dayLate := 0, 0, 0
+			for _, status := range byStudent[student.ID][d.Format(calendar.DateLayout)] {
+				total++
+				switch status {
+				case "absent":
+					dayMissed++
+					dayAbsent++
+				case "excused":
+					dayMissed++
+					excused++
+				case "late":
+					dayLate++
+				}
+			}
+			missed += dayMissed
+			late += dayLate
+
+			switch {
+			case dayMissed > 0 && dayAbsent > 0:
+				sheet.Set(row, 2+k, dayMissed, xlsx.StyleAlert)
+			case dayMissed > 0:
+				sheet.Set(row, 2+k, dayMissed, xlsx.StyleCell)
+			case dayLate > 0:
+				sheet.Set(row, 2+k, "оп", xlsx.StyleCell)
+			default:
+				sheet.Set(row, 2+k, nil, xlsx.StyleCell)
+			}
+		}
+
+		sheet.Set(row, totalCol, missed, xlsx.StyleCell)
+		sheet.Set(row, totalCol+1, excused, xlsx.StyleCell)
+		sheet.Set(row, totalCol+2, late, xlsx.StyleCell)
+		if total > 0 {
+			sheet.Set(row, totalCol+3, float64(total-missed)/float64(total)*100, xlsx.StyleTotal)
+		} else {
+			sheet.Set(row, totalCol+3, nil, xlsx.StyleTotal)
+		}
+	}
+
+	sendWorkbook(c, wb, fmt.Sprintf("attendance_class_%s.xlsx", class.Name))
+}
+
+// exportSchoolXLSX выгружает отчёт по школе: сводку, классы со средними по периодам
+// и посещаемостью, успеваемость классов по предметам
+func exportSchoolXLSX(c *gin.Context, school models.School) {
+	from, to, err := exportPeriod(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	terms, err := calendar.Terms(database.DB, school.ID, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load calendar"})
+		return
+	}
+
+	var classes []models.Class
+	database.DB.Where("school_id = ?", school.ID).Preload("HomeroomTeacher").Order("name").Find(&classes)
+	var subjects []models.Subject
+	database.DB.Where("school_id = ?", school.ID).Order("name").Find(&subjects)
+
+	var studentsCount, teachersCount int64
+	database.DB.Model(&models.User{}).Where("school_id = ? AND (role = ? OR role = ?)",
+		school.ID, "student", "starosta").Count(&studentsCount)
+	database.DB.Model(&models.User{}).Where("school_id = ? AND role = ?", school.ID, "teacher").Count(&teachersCount)
+
+	wb := xlsx.NewWorkbook()
+
+	summary := wb.AddSheet("Сводка")
+	summary.Set(0, 0, "Отчёт по школе", xlsx.StyleTitle)
+	summary.SetColWidth(0, 24)
+	summary.SetColWidth(1, 40)
+	rows := [][2]interface{}{
+		{"Школа", school.Name},
+		{"Период", fmt.Sprintf("%s - %s", from.Format("02.01.2006"), to.Format("02.01.2006"))},
+		{"Дата отчёта", time.Now().Format("02.01.2006")},
+		{"Учеников", int(studentsCount)},
+		{"Учителей", int(teachersCount)},
+		{"Классов", len(classes)},
+	}
+	for i, r := range rows {
+		summary.Set(i+2, 0, r[0], xlsx.StyleHeader)
+		summary.Set(i+2, 1, r[1], xlsx.StyleText)
+	}
+
+	// Средние и посещаемость по классам
+	type gradeRow struct {
+		ClassID   uint
+		SubjectID uint
+		Date      time.Time
+		Grade     int
+	}
+	var grades []gradeRow
+	database.DB.Model(&models.Grade{}).
+		Select("class_students.class_id, grades.subject_id, grades.date, grades.grade").
+		Joins("JOIN class_students ON class_students.user_id = grades.student_id").
+		Joins("JOIN classes ON classes.id = class_students.class_id").
+		Where("classes.school_id = ? AND grades.date BETWEEN ? AND ?", school.ID, from, to).
+		Scan(&grades)
+
+	type stat struct{ sum, count int }
+	classTerm := make(map[uint][]stat)
+	classTotal := make(map[uint]*stat)
+	classSubject := make(map[uint]map[uint]*stat)
+	for _, g := range grades {
+		if classTerm[g.ClassID] == nil {
+			classTerm[g.ClassID] = make([]stat, len(terms))
+			classTotal[g.ClassID] = &stat{}
+			classSubject[g.ClassID] = make(map[uint]*stat)
+		}
+		if t, ok := calendar.TermOf(terms, g.Date); ok {
+			classTerm[g.ClassID][t.Number-1].sum += g.Grade
+			classTerm[g.ClassID][t.Number-1].count++
+		}
+		classTotal[g.ClassID].sum += g.Grade
+		classTotal[g.ClassID].count++
+		if classSubject[g.ClassID][g.SubjectID] == nil {
+			classSubject[g.ClassID][g.SubjectID] = &stat{}
+		}
+		classSubject[g.ClassID][g.SubjectID].sum += g.Grade
+		classSubject[g.ClassID][g.SubjectID].count++
+	}
+
+	var attendanceRows []struct {
+		ClassID uint
+		Status  string
+		Count   int
+	}
+	database.DB.Model(&models.Attendance{}).
+		Select("attendances.class_id, attendances.status, COUNT(*) as count").
+		Joins("JOIN classes ON classes.id = attendances.class_id").
+		Where("classes.school_id = ? AND attendances.date BETWEEN ? AND ?", school.ID, from, to).
+		Group("attendances.class_id, attendances.status").
+		Scan(&attendanceRows)
+	attendance := make(map[uint]map[string]int)
+	for _, a := range attendanceRows {
+		if attendance[a.ClassID] == nil {
+			attendance[a.ClassID] = make(map[string]int)
+		}
+		attendance[a.ClassID][a.Status] = a.Count
+	}
+
+	classSheet := wb.AddSheet("Классы")
+	classSheet.Set(0, 0, "Классы", xlsx.StyleTitle)
+	header := []string{"Класс", "Учебный год", "Классный руководитель", "Учеников"}
+	for i, title := range header {
+		classSheet.Set(1, i, title, xlsx.StyleHeader)
+		classSheet.Set(2, i, nil, xlsx.StyleHeader)
+		classSheet.Merge(1, i, 2, i)
+	}
+	classSheet.SetColWidth(0, 10)
+	classSheet.SetColWidth(1, 12)
+	classSheet.SetColWidth(2, 28)
+	classSheet.SetColWidth(3, 10)
+	col := writeGroupHeader(classSheet, len(header), "Средний балл", termLabels(terms), 8)
+	writeGroupHeader(classSheet, col, "Посещаемость", []string{"Пропущено", "Посещ. %"}, 11)
+	classSheet.Freeze(3, 1)
+
+	for i, class := range classes {
+		row := i + 3
+		var count int64
+		database.DB.Table("class_students").Where("class_id = ?", class.ID).Count(&count)
+
+		teacher := ""
+		if class.HomeroomTeacher != nil {
+			teacher = strings.TrimSpace(class.HomeroomTeacher.LastName + " " + class.HomeroomTeacher.FirstName)
+		}
+		classSheet.Set(row, 0, class.Name, xlsx.StyleText)
+		classSheet.Set(row, 1, class.Year, xlsx.StyleCell)
+		classSheet.Set(row, 2, teacher, xlsx.StyleText)
+		classSheet.Set(row, 3, int(count), xlsx.StyleCell)
+
+		for t := range terms {
+			var s stat
+			if classTerm[class.ID] != nil {
+				s = classTerm[class.ID][t]
+			}
+			classSheet.Set(row, len(header)+t, average(s.sum, s.count), xlsx.StyleNumber)
+		}
+		var total stat
+		if classTotal[class.ID] != nil {
+			total = *classTotal[class.ID]
+		}
+		classSheet.Set(row, len(header)+len(terms), average(total.sum, total.count), xlsx.StyleTotal)
+
+		marks := attendance[class.ID]
+		all := 0
+		for _, n := range marks {
+			all += n
+		}
+		missed := marks["absent"] + marks["excused"]
+		classSheet.Set(row, col, missed, xlsx.StyleCell)
+		if all > 0 {
+			classSheet.Set(row, col+1, float64(all-missed)/float64(all)*100, xlsx.StyleTotal)
+		} else {
+			classSheet.Set(row, col+1, nil, xlsx.StyleTotal)
+		}
+	}
+
+	// Успеваемость: классы по строкам, предметы по столбцам
+	matrix := wb.AddSheet("Успеваемость")
+	matrix.Set(0, 0, "Средний балл по предметам", xlsx.StyleTitle)
+	matrix.Set(1, 0, "Класс", xlsx.StyleHeader)
+	matrix.SetColWidth(0, 10)
+	for k, subject := range subjects {
+		matrix.Set(1, k+1, subject.Name, xlsx.StyleHeader)
+		matrix.SetColWidth(k+1, 12)
+	}
+	matrix.Freeze(2, 1)
+	for i, class := range classes {
+		matrix.Set(i+2, 0, class.Name, xlsx.StyleText)
+		for k, subject := range subjects {
+			var s stat
+			if ps := classSubject[class.ID][subject.ID]; ps != nil {
+				s = *ps
+			}
+			matrix.Set(i+2, k+1, average(s.sum, s.count), xlsx.StyleNumber)
+		}
+	}
+
+	sendWorkbook(c, wb, fmt.Sprintf("school_report_%s.xlsx", time.Now().Format("2006-01-02")))
+}
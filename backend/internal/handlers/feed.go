@@ -0,0 +1,380 @@
+package handlers
+
+import (
+	"classkeeper/internal/calendar"
+	"classkeeper/internal/config"
+	"classkeeper/internal/database"
+	"classkeeper/internal/ical"
+	"classkeeper/internal/models"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Виды iCalendar-лент
+const (
+	FeedTimetable = "timetable" // Расписание уроков
+	FeedHomework  = "homework"  // Сроки сдачи ДЗ
+	FeedEvents    = "events"    // Праздники, каникулы и школьные события
+	FeedAll       = "all"       // Всё вместе
+)
+
+var feedKinds = []string{FeedTimetable, FeedHomework, FeedEvents, FeedAll}
+
+type FeedHandler struct {
+	cfg *config.Config
+}
+
+func NewFeedHandler(cfg *config.Config) *FeedHandler {
+	return &FeedHandler{cfg: cfg}
+}
+
+// CreateFeedRequest структура для создания ленты
+type CreateFeedRequest struct {
+	Name string `json:"name"`
+}
+
+// CreateFeed выпускает новый токен для iCalendar-лент текущего пользователя.
+// Токен показывается только один раз - в БД хранится его хеш.
+func (h *FeedHandler) CreateFeed(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req CreateFeedRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := generateFeedToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	feed := models.CalendarFeed{
+		UserID:    userID.(uint),
+		Name:      req.Name,
+		TokenHash: hashFeedToken(token),
+	}
+
+	if err := db(c).Create(&feed).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create feed"})
+		return
+	}
+
+	urls := make(map[string]string)
+	for _, kind := range feedKinds {
+		urls[kind] = fmt.Sprintf("%s/api/ical/%s/%s.ics", publicBaseURL(c, h.cfg), token, kind)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"feed":  feed,
+		"token": token,
+		"urls":  urls,
+	})
+}
+
+// ListFeeds возвращает ленты текущего пользователя
+func (h *FeedHandler) ListFeeds(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var feeds []models.CalendarFeed
+	if err := database.DB.Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Find(&feeds).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch feeds"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"feeds": feeds})
+}
+
+// RevokeFeed отзывает токен ленты (владелец или админ школы)
+func (h *FeedHandler) RevokeFeed(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid feed ID"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	schoolID, _ := c.Get("school_id")
+	role, _ := c.Get("role")
+
+	var feed models.CalendarFeed
+	if err := database.DB.Preload("User").First(&feed, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Feed not found"})
+		return
+	}
+
+	if feed.UserID != userID.(uint) && (role != "admin" || feed.User.SchoolID != schoolID.(uint)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	if feed.RevokedAt == nil {
+		now := time.Now()
+		feed.RevokedAt = &now
+		if err := db(c).Model(&feed).Update("revoked_at", now).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke feed"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Feed revoked successfully", "feed": feed})
+}
+
+// ServeFeed отдаёт iCalendar-ленту по токену (без JWT - для календарей в телефоне)
+func (h *FeedHandler) ServeFeed(c *gin.Context) {
+	kind := strings.TrimSuffix(c.Param("feed"), ".ics")
+	valid := false
+	for _, k := range feedKinds {
+		if k == kind {
+			valid = true
+		}
+	}
+	if !valid {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown feed"})
+		return
+	}
+
+	var feed models.CalendarFeed
+	if err := database.DB.Where("token_hash = ? AND revoked_at IS NULL", hashFeedToken(c.Param("token"))).
+		Preload("User").
+		First(&feed).Error; err != nil || feed.User.ID == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Feed not found"})
+		return
+	}
+
+	db(c).Model(&feed).Update("last_used_at", time.Now())
+
+	user := feed.User
+	loc, err := time.LoadLocation(h.cfg.Server.TimeZone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	// Период: две недели назад и N недель вперёд
+	weeks, _ := strconv.Atoi(c.DefaultQuery("weeks", "8"))
+	if weeks <= 0 || weeks > 52 {
+		weeks = 8
+	}
+	today := calendar.Date(time.Now().In(loc))
+	from := today.AddDate(0, 0, -14)
+	to := today.AddDate(0, 0, 7*weeks)
+
+	var school models.School
+	database.DB.First(&school, user.SchoolID)
+
+	cal := ical.Calendar{
+		Name:     strings.TrimSpace(fmt.Sprintf("%s - %s %s", school.Name, user.LastName, user.FirstName)),
+		TimeZone: loc.String(),
+	}
+
+	if kind == FeedTimetable || kind == FeedAll {
+		events, err := timetableEvents(&user, from, to, loc)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build timetable"})
+			return
+		}
+		cal.Events = append(cal.Events, events...)
+	}
+	if kind == FeedHomework || kind == FeedAll {
+		cal.Events = append(cal.Events, homeworkEvents(&user, from, to)...)
+	}
+	if kind == FeedEvents || kind == FeedAll {
+		cal.Events = append(cal.Events, schoolEvents(&user, from, to)...)
+	}
+
+	c.Header("Content-Type", "text/calendar; charset=utf-8")
+	c.Header("Cache-Control", "private, max-age=900")
+	cal.Write(c.Writer)
+}
+
+// timetableEvents строит уроки пользователя по расписанию с учётом школьного календаря
+func timetableEvents(user *models.User, from, to time.Time, loc *time.Location) ([]ical.Event, error) {
+	query := database.DB.Preload("Subject").Preload("Class").Preload("Teacher")
+	if user.Role == "teacher" {
+		query = query.Where("teacher_id = ?", user.ID)
+	} else {
+		classIDs := classIDsForUser(user)
+		if len(classIDs) == 0 {
+			return nil, nil
+		}
+		query = query.Where("class_id IN ?", classIDs)
+	}
+
+	var schedules []models.Schedule
+	if err := query.Order("lesson_number").Find(&schedules).Error; err != nil {
+		return nil, err
+	}
+
+	// Группируем уроки по классу и дню недели
+	byClass := make(map[uint]map[string][]models.Schedule)
+	classes := make(map[uint]models.Class)
+	for _, s := range schedules {
+		if byClass[s.ClassID] == nil {
+			byClass[s.ClassID] = make(map[string][]models.Schedule)
+			classes[s.ClassID] = s.Class
+		}
+		byClass[s.ClassID][s.DayOfWeek] = append(byClass[s.ClassID][s.DayOfWeek], s)
+	}
+
+	var events []ical.Event
+	for classID, week := range byClass {
+		class := classes[classID]
+		cal, err := calendar.Load(database.DB, class.SchoolID, &class.ID, from, to)
+		if err != nil {
+			return nil, err
+		}
+
+		for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+			scheduleDay, ok := cal.ScheduleDay(d)
+			if !ok {
+				continue
+			}
+			for _, s := range week[scheduleDay] {
+				events = append(events, lessonEvent(s, d, loc))
+			}
+		}
+	}
+
+	return events, nil
+}
+
+// lessonEvent преобразует урок расписания на конкретную дату в событие.
+// UID зависит только от урока и даты, поэтому клиенты обновляют, а не дублируют события.
+func lessonEvent(s models.Schedule, d time.Time, loc *time.Location) ical.Event {
+	summary := s.Subject.Name
+	if s.Class.Name != "" {
+		summary = fmt.Sprintf("%s (%s)", s.Subject.Name, s.Class.Name)
+	}
+
+	description := fmt.Sprintf("Урок %d", s.LessonNumber)
+	if s.Teacher != nil {
+		description += fmt.Sprintf("\nУчитель: %s %s", s.Teacher.LastName, s.Teacher.FirstName)
+	}
+
+	event := ical.Event{
+		UID:         fmt.Sprintf("lesson-%d-%s@classkeeper", s.ID, d.Format("20060102")),
+		Summary:     summary,
+		Description: description,
+		Categories:  []string{"lesson"},
+	}
+	if s.RoomNumber != "" {
+		event.Location = "Кабинет " + s.RoomNumber
+	}
+
+	start, errStart := time.ParseInLocation("2006-01-02 15:04", d.Format("2006-01-02")+" "+s.StartTime, loc)
+	end, errEnd := time.ParseInLocation("2006-01-02 15:04", d.Format("2006-01-02")+" "+s.EndTime, loc)
+	if errStart != nil || errEnd != nil {
+		event.Start = d
+		event.AllDay = true
+		return event
+	}
+
+	event.Start = start
+	event.End = end
+	return event
+}
+
+// homeworkEvents возвращает сроки сдачи ДЗ пользователя как события на целый день
+func homeworkEvents(user *models.User, from, to time.Time) []ical.Event {
+	query := database.DB.Where("due_date BETWEEN ? AND ?", from, to).
+		Preload("Subject").
+		Preload("Class")
+
+	if user.Role == "teacher" {
+		query = query.Where("teacher_id = ?", user.ID)
+	} else {
+		classIDs := classIDsForUser(user)
+		if len(classIDs) == 0 {
+			return nil
+		}
+		query = query.Where("class_id IN ?", classIDs)
+	}
+
+	var homework []models.Homework
+	query.Order("due_date").Find(&homework)
+
+	var events []ical.Event
+	for _, hw := range homework {
+		events = append(events, ical.Event{
+			UID:         fmt.Sprintf("homework-%d@classkeeper", hw.ID),
+			Summary:     fmt.Sprintf("ДЗ: %s (%s)", hw.Subject.Name, hw.Class.Name),
+			Description: hw.Description,
+			Categories:  []string{"homework"},
+			Start:       hw.DueDate,
+			AllDay:      true,
+		})
+	}
+	return events
+}
+
+// schoolEvents возвращает записи школьного календаря для пользователя
+func schoolEvents(user *models.User, from, to time.Time) []ical.Event {
+	query := database.DB.Where("school_id = ? AND start_date <= ? AND end_date >= ?", user.SchoolID, to, from)
+
+	classIDs := classIDsForUser(user)
+	if len(classIDs) > 0 {
+		query = query.Where("class_id IS NULL OR class_id IN ?", classIDs)
+	} else {
+		query = query.Where("class_id IS NULL")
+	}
+
+	var records []models.CalendarEvent
+	query.Order("start_date").Find(&records)
+
+	var events []ical.Event
+	for _, e := range records {
+		events = append(events, calendarEventToICal(e))
+	}
+	return events
+}
+
+// classIDsForUser возвращает классы ученика, классы детей родителя
+// или классы, где учитель - классный руководитель
+func classIDsForUser(user *models.User) []uint {
+	var classIDs []uint
+
+	switch user.Role {
+	case "student", "starosta":
+		database.DB.Table("class_students").
+			Where("user_id = ?", user.ID).
+			Pluck("class_id", &classIDs)
+	case "parent":
+		database.DB.Table("class_students").
+			Joins("JOIN parent_students ON parent_students.student_id = class_students.user_id AND parent_students.deleted_at IS NULL").
+			Where("parent_students.parent_id = ?", user.ID).
+			Distinct().
+			Pluck("class_students.class_id", &classIDs)
+	case "teacher":
+		database.DB.Model(&models.Class{}).
+			Where("homeroom_teacher_id = ?", user.ID).
+			Pluck("id", &classIDs)
+	}
+
+	return classIDs
+}
+
+func generateFeedToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashFeedToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
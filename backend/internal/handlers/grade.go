@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type GradeHandler struct{}
@@ -87,7 +88,7 @@ func (h *GradeHandler) CreateGrade(c *gin.Context) {
 		Comment:   req.Comment,
 	}
 
-	if err := database.DB.Create(&grade).Error; err != nil {
+	if err := db(c).Create(&grade).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create grade"})
 		return
 	}
@@ -98,6 +99,106 @@ func (h *GradeHandler) CreateGrade(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{"grade": grade})
 }
 
+// BulkGradesRequest структура для массового выставления оценок
+type BulkGradesRequest struct {
+	Mode   string               `json:"mode"` // atomic (по умолчанию), partial, validate
+	Grades []CreateGradeRequest `json:"grades" binding:"required"`
+}
+
+// BulkCreateGrades выставляет несколько оценок в одной транзакции с отчётом по каждой
+func (h *GradeHandler) BulkCreateGrades(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	schoolID, _ := c.Get("school_id")
+	role, _ := c.Get("role")
+
+	var req BulkGradesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	mode, ok := parseBulkMode(c, req.Mode, len(req.Grades), maxBulkItems)
+	if !ok {
+		return
+	}
+
+	// Проверки учеников и предметов повторяются - кэшируем их на время запроса
+	students := make(map[uint]bool)
+	subjects := make(map[uint]string)
+
+	grades := make([]models.Grade, 0, len(req.Grades))
+	report, err := runBulk(c, mode, len(req.Grades), func(tx *gorm.DB, i int) (uint, interface{}, error) {
+		item := req.Grades[i]
+		if err := validateBulkItem(item); err != nil {
+			return 0, nil, err
+		}
+
+		date, err := time.Parse("2006-01-02", item.Date)
+		if err != nil {
+			return 0, nil, itemError("Invalid date format (use YYYY-MM-DD)")
+		}
+
+		valid, ok := students[item.StudentID]
+		if !ok {
+			var count int64
+			tx.Model(&models.User{}).
+				Where("id = ? AND school_id = ? AND (role = ? OR role = ?)", item.StudentID, schoolID, "student", "starosta").
+				Count(&count)
+			valid = count > 0
+			students[item.StudentID] = valid
+		}
+		if !valid {
+			return 0, nil, itemError("Student not found")
+		}
+
+		problem, ok := subjects[item.SubjectID]
+		if !ok {
+			var subject models.Subject
+			if err := tx.Where("id = ? AND school_id = ?", item.SubjectID, schoolID).First(&subject).Error; err != nil {
+				problem = "Subject not found"
+			} else if role == "teacher" {
+				// Учитель ставит оценки только по своим предметам
+				var count int64
+				tx.Table("teachers_subjects").
+					Where("user_id = ? AND subject_id = ?", userID, item.SubjectID).
+					Count(&count)
+				if count == 0 {
+					problem = "You don't teach this subject"
+				}
+			}
+			subjects[item.SubjectID] = problem
+		}
+		if problem != "" {
+			return 0, nil, itemError("%s", problem)
+		}
+
+		grade := models.Grade{
+			StudentID: item.StudentID,
+			SubjectID: item.SubjectID,
+			TeacherID: userID.(uint),
+			Grade:     item.Grade,
+			GradeType: item.GradeType,
+			Date:      date,
+			Comment:   item.Comment,
+		}
+		if err := tx.Create(&grade).Error; err != nil {
+			return 0, nil, err
+		}
+		grades = append(grades, grade)
+		return grade.ID, nil, nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create grades"})
+		return
+	}
+
+	extra := gin.H{}
+	if report.Committed {
+		extra["grades"] = grades
+	}
+	respondBulk(c, report, extra)
+}
+
 // ListGrades возвращает список оценок с фильтрами
 func (h *GradeHandler) ListGrades(c *gin.Context) {
 	studentID := c.Query("student_id")
@@ -197,7 +298,7 @@ func (h *GradeHandler) UpdateGrade(c *gin.Context) {
 	grade.Date = date
 	grade.Comment = req.Comment
 
-	if err := database.DB.Save(&grade).Error; err != nil {
+	if err := db(c).Save(&grade).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update grade"})
 		return
 	}
@@ -231,7 +332,7 @@ func (h *GradeHandler) DeleteGrade(c *gin.Context) {
 		return
 	}
 
-	if err := database.DB.Delete(&grade).Error; err != nil {
+	if err := db(c).Delete(&grade).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete grade"})
 		return
 	}
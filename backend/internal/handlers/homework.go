@@ -1,13 +1,16 @@
 package handlers
 
 import (
+	"classkeeper/internal/calendar"
 	"classkeeper/internal/database"
 	"classkeeper/internal/models"
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type HomeworkHandler struct{}
@@ -18,11 +21,14 @@ func NewHomeworkHandler() *HomeworkHandler {
 
 // CreateHomeworkRequest структура для создания домашнего задания
 type CreateHomeworkRequest struct {
-	ClassID      uint   `json:"class_id" binding:"required"`
-	SubjectID    uint   `json:"subject_id" binding:"required"`
-	Description  string `json:"description" binding:"required"`
-	AssignedDate string `json:"assigned_date" binding:"required"` // YYYY-MM-DD
-	DueDate      string `json:"due_date" binding:"required"`      // YYYY-MM-DD
+	ClassID          uint   `json:"class_id" binding:"required"`
+	SubjectID        uint   `json:"subject_id" binding:"required"`
+	Description      string `json:"description" binding:"required"`
+	AssignedDate     string `json:"assigned_date" binding:"required"`                    // YYYY-MM-DD
+	DueDate          string `json:"due_date" binding:"required"`                         // YYYY-MM-DD
+	AttachmentIDs    []uint `json:"attachment_ids"`                                      // Файлы, загруженные через /api/attachments
+	EstimatedMinutes int    `json:"estimated_minutes" binding:"omitempty,min=1,max=600"` // Оценка времени на выполнение, минут
+	Force            bool   `json:"force"`                                               // Админ: создать несмотря на лимит нагрузки
 }
 
 // CreateHomework создает новое домашнее задание
@@ -52,18 +58,9 @@ func (h *HomeworkHandler) CreateHomework(c *gin.Context) {
 	}
 
 	// Проверяем права (только учителя этого предмета или классный руководитель или админ)
-	if role == "teacher" {
-		var teacher models.User
-		database.DB.First(&teacher, userID)
-
-		// Проверяем что учитель преподаёт этот предмет
-		if teacher.TeacherSubject != subject.Name {
-			// Проверяем может он классный руководитель этого класса
-			if class.HomeroomTeacherID == nil || *class.HomeroomTeacherID != userID.(uint) {
-				c.JSON(http.StatusForbidden, gin.H{"error": "You can only create homework for your subject or your class"})
-				return
-			}
-		}
+	if !canAssignHomework(userID.(uint), role, &class, &subject) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only create homework for your subject or your class"})
+		return
 	}
 
 	// Парсим даты
@@ -79,24 +76,200 @@ func (h *HomeworkHandler) CreateHomework(c *gin.Context) {
 		return
 	}
 
+	// Срок сдачи должен приходиться на учебный день
+	if !checkDueDate(c, &class, dueDate) {
+		return
+	}
+
+	if req.EstimatedMinutes == 0 {
+		req.EstimatedMinutes = DefaultEstimatedMinutes
+	}
+
+	// Нагрузка класса на день сдачи
+	warning, ok := checkHomeworkLoad(c, &class, dueDate, req.EstimatedMinutes, 0, req.Force)
+	if !ok {
+		return
+	}
+
 	homework := models.Homework{
-		ClassID:      req.ClassID,
-		SubjectID:    req.SubjectID,
-		TeacherID:    userID.(uint),
-		Description:  req.Description,
-		AssignedDate: assignedDate,
-		DueDate:      dueDate,
+		ClassID:          req.ClassID,
+		SubjectID:        req.SubjectID,
+		TeacherID:        userID.(uint),
+		Description:      req.Description,
+		AssignedDate:     assignedDate,
+		DueDate:          dueDate,
+		EstimatedMinutes: req.EstimatedMinutes,
 	}
 
-	if err := database.DB.Create(&homework).Error; err != nil {
+	err = db(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&homework).Error; err != nil {
+			return err
+		}
+		return attachFiles(tx, req.AttachmentIDs, AttachmentHomework, homework.ID, homework.TeacherID)
+	})
+	if errors.Is(err, errInvalidAttachments) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment IDs"})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create homework"})
 		return
 	}
 
 	// Загружаем связи
-	database.DB.Preload("Class").Preload("Subject").Preload("Teacher").First(&homework, homework.ID)
+	database.DB.Preload("Class").Preload("Subject").Preload("Teacher").Preload("Attachments").First(&homework, homework.ID)
 
-	c.JSON(http.StatusCreated, gin.H{"homework": homework})
+	response := gin.H{"homework": homework}
+	if warning != nil {
+		response["load_warning"] = warning
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// BulkHomeworkRequest структура для массового создания домашних заданий
+type BulkHomeworkRequest struct {
+	Mode     string                  `json:"mode"` // atomic (по умолчанию), partial, validate
+	Homework []CreateHomeworkRequest `json:"homework" binding:"required"`
+}
+
+// BulkCreateHomework создаёт несколько домашних заданий в одной транзакции с отчётом по каждому.
+// Лимит нагрузки учитывает и задания из этого же запроса.
+func (h *HomeworkHandler) BulkCreateHomework(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	schoolID, _ := c.Get("school_id")
+	role, _ := c.Get("role")
+
+	var req BulkHomeworkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	mode, ok := parseBulkMode(c, req.Mode, len(req.Homework), maxBulkItems)
+	if !ok {
+		return
+	}
+
+	classes := make(map[uint]*models.Class)
+	subjects := make(map[uint]*models.Subject)
+	// Нагрузка, добавленная заданиями запроса: класс -> дата сдачи
+	added := make(map[uint]map[string]HomeworkLoad)
+
+	created := make([]models.Homework, 0, len(req.Homework))
+	report, err := runBulk(c, mode, len(req.Homework), func(tx *gorm.DB, i int) (uint, interface{}, error) {
+		item := req.Homework[i]
+		if err := validateBulkItem(item); err != nil {
+			return 0, nil, err
+		}
+
+		class, ok := classes[item.ClassID]
+		if !ok {
+			var found models.Class
+			if err := tx.Where("id = ? AND school_id = ?", item.ClassID, schoolID).First(&found).Error; err == nil {
+				class = &found
+			}
+			classes[item.ClassID] = class
+		}
+		if class == nil {
+			return 0, nil, itemError("Class not found")
+		}
+
+		subject, ok := subjects[item.SubjectID]
+		if !ok {
+			var found models.Subject
+			if err := tx.Where("id = ? AND school_id = ?", item.SubjectID, schoolID).First(&found).Error; err == nil {
+				subject = &found
+			}
+			subjects[item.SubjectID] = subject
+		}
+		if subject == nil {
+			return 0, nil, itemError("Subject not found")
+		}
+
+		if !canAssignHomework(userID.(uint), role, class, subject) {
+			return 0, nil, itemError("You can only create homework for your subject or your class")
+		}
+
+		assignedDate, err := time.Parse("2006-01-02", item.AssignedDate)
+		if err != nil {
+			return 0, nil, itemError("Invalid assigned_date format (use YYYY-MM-DD)")
+		}
+		dueDate, err := time.Parse("2006-01-02", item.DueDate)
+		if err != nil {
+			return 0, nil, itemError("Invalid due_date format (use YYYY-MM-DD)")
+		}
+
+		// Срок сдачи должен приходиться на учебный день
+		cal, err := loadClassCalendar(class, dueDate, dueDate)
+		if err != nil {
+			return 0, nil, err
+		}
+		if !cal.IsWorkingDay(dueDate) {
+			return 0, nil, itemError("Due date falls on a non-working day (next working day %s)",
+				cal.NextWorkingDay(dueDate).Format(calendar.DateLayout))
+		}
+
+		if item.EstimatedMinutes == 0 {
+			item.EstimatedMinutes = DefaultEstimatedMinutes
+		}
+
+		// Нагрузка класса на день сдачи вместе с уже принятыми заданиями запроса
+		key := dueDate.Format(calendar.DateLayout)
+		batch := added[class.ID][key]
+		batch.Items++
+		batch.Minutes += item.EstimatedMinutes
+		load, limit, err := projectedLoad(class, dueDate, batch, 0)
+		if err != nil {
+			return 0, nil, err
+		}
+		var warning interface{}
+		if load.Level == LoadLevelOver {
+			if limit.Mode == LoadModeBlock && !(item.Force && role == "admin") {
+				return 0, nil, itemError("Homework load for %s exceeds the limit", key)
+			}
+			warning = gin.H{
+				"message": "Homework load for the due date exceeds the limit",
+				"load":    load,
+				"limit":   limit,
+			}
+		}
+
+		homework := models.Homework{
+			ClassID:          item.ClassID,
+			SubjectID:        item.SubjectID,
+			TeacherID:        userID.(uint),
+			Description:      item.Description,
+			AssignedDate:     assignedDate,
+			DueDate:          dueDate,
+			EstimatedMinutes: item.EstimatedMinutes,
+		}
+		if err := tx.Create(&homework).Error; err != nil {
+			return 0, nil, err
+		}
+		if err := attachFiles(tx, item.AttachmentIDs, AttachmentHomework, homework.ID, homework.TeacherID); err != nil {
+			if errors.Is(err, errInvalidAttachments) {
+				return 0, nil, itemError("Invalid attachment IDs")
+			}
+			return 0, nil, err
+		}
+
+		if added[class.ID] == nil {
+			added[class.ID] = make(map[string]HomeworkLoad)
+		}
+		added[class.ID][key] = batch
+		created = append(created, homework)
+		return homework.ID, warning, nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create homework"})
+		return
+	}
+
+	extra := gin.H{}
+	if report.Committed {
+		extra["homework"] = created
+	}
+	respondBulk(c, report, extra)
 }
 
 // GetAllHomework получает все домашние задания для школы
@@ -207,7 +380,7 @@ func (h *HomeworkHandler) DeleteHomework(c *gin.Context) {
 		return
 	}
 
-	if err := database.DB.Delete(&homework).Error; err != nil {
+	if err := db(c).Delete(&homework).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete homework"})
 		return
 	}
@@ -232,6 +405,7 @@ func (h *HomeworkHandler) GetHomework(c *gin.Context) {
 		Preload("Class").
 		Preload("Subject").
 		Preload("Teacher").
+		Preload("Attachments").
 		First(&homework).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Homework not found"})
 		return
@@ -281,21 +455,52 @@ func (h *HomeworkHandler) UpdateHomework(c *gin.Context) {
 		return
 	}
 
+	// Проверяем новый класс и срок сдачи по его календарю
+	var class models.Class
+	if err := database.DB.Where("id = ? AND school_id = ?", req.ClassID, schoolID).First(&class).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Class not found"})
+		return
+	}
+	if !dueDate.Equal(homework.DueDate) || class.ID != homework.ClassID {
+		if !checkDueDate(c, &class, dueDate) {
+			return
+		}
+	}
+
+	if req.EstimatedMinutes == 0 {
+		req.EstimatedMinutes = homework.EstimatedMinutes
+	}
+
+	// Нагрузку перепроверяем, только если она могла вырасти
+	var warning gin.H
+	if !dueDate.Equal(homework.DueDate) || class.ID != homework.ClassID || req.EstimatedMinutes > homework.EstimatedMinutes {
+		var ok bool
+		warning, ok = checkHomeworkLoad(c, &class, dueDate, req.EstimatedMinutes, homework.ID, req.Force)
+		if !ok {
+			return
+		}
+	}
+
 	// Обновляем
 	homework.ClassID = req.ClassID
 	homework.SubjectID = req.SubjectID
 	homework.Description = req.Description
 	homework.AssignedDate = assignedDate
 	homework.DueDate = dueDate
+	homework.EstimatedMinutes = req.EstimatedMinutes
 
-	if err := database.DB.Save(&homework).Error; err != nil {
+	if err := db(c).Save(&homework).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update homework"})
 		return
 	}
 
 	database.DB.Preload("Class").Preload("Subject").Preload("Teacher").First(&homework, homework.ID)
 
-	c.JSON(http.StatusOK, gin.H{"homework": homework})
+	response := gin.H{"homework": homework}
+	if warning != nil {
+		response["load_warning"] = warning
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 // GetUpcomingHomework получает предстоящие ДЗ для класса
@@ -338,18 +543,83 @@ func (h *HomeworkHandler) GetOverdueHomework(c *gin.Context) {
 		return
 	}
 
-	now := time.Now()
-	var homework []models.Homework
+	today := calendar.Date(time.Now())
+	var candidates []models.Homework
 	if err := database.DB.
-		Where("class_id = ? AND due_date < ?", classID, now).
+		Where("class_id = ? AND due_date < ?", classID, today).
 		Preload("Class").
 		Preload("Subject").
 		Preload("Teacher").
 		Order("due_date DESC").
-		Find(&homework).Error; err != nil {
+		Find(&candidates).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch homework"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"homework": homework})
+	homework := []models.Homework{}
+	daysOverdue := make(map[uint]int)
+	if len(candidates) > 0 {
+		oldest := candidates[len(candidates)-1].DueDate
+		cal, err := loadClassCalendar(&class, oldest, today)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load calendar"})
+			return
+		}
+
+		// Если срок выпал на неучебный день, ДЗ сдаётся в ближайший учебный день,
+		// а просрочка считается только в учебных днях
+		for _, hw := range candidates {
+			effectiveDue := cal.NextWorkingDay(hw.DueDate)
+			if !effectiveDue.Before(today) {
+				continue
+			}
+			homework = append(homework, hw)
+			daysOverdue[hw.ID] = cal.CountWorkingDays(effectiveDue, today)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"homework":     homework,
+		"days_overdue": daysOverdue,
+	})
+}
+
+// canAssignHomework проверяет, может ли пользователь задавать ДЗ классу по предмету:
+// админ, учитель этого предмета или классный руководитель класса
+func canAssignHomework(userID uint, role interface{}, class *models.Class, subject *models.Subject) bool {
+	if role == "admin" {
+		return true
+	}
+	if role != "teacher" {
+		return false
+	}
+
+	var teacher models.User
+	database.DB.First(&teacher, userID)
+
+	// Учитель преподаёт этот предмет
+	if teacher.TeacherSubject == subject.Name {
+		return true
+	}
+	// Или классный руководитель этого класса
+	return class.HomeroomTeacherID != nil && *class.HomeroomTeacherID == userID
+}
+
+// checkDueDate проверяет, что срок сдачи - учебный день класса.
+// При ошибке пишет ответ и возвращает false.
+func checkDueDate(c *gin.Context, class *models.Class, dueDate time.Time) bool {
+	cal, err := loadClassCalendar(class, dueDate, dueDate)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load calendar"})
+		return false
+	}
+
+	if !cal.IsWorkingDay(dueDate) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":            "Due date falls on a non-working day",
+			"next_working_day": cal.NextWorkingDay(dueDate).Format(calendar.DateLayout),
+		})
+		return false
+	}
+	return true
 }
@@ -0,0 +1,362 @@
+package handlers
+
+import (
+	"classkeeper/internal/calendar"
+	"classkeeper/internal/database"
+	"classkeeper/internal/models"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultEstimatedMinutes - оценка времени на ДЗ, если учитель её не указал
+const DefaultEstimatedMinutes = 30
+
+// Режимы контроля нагрузки
+const (
+	LoadModeWarn  = "warn"  // Создать ДЗ и вернуть предупреждение
+	LoadModeBlock = "block" // Не создавать ДЗ сверх лимита
+)
+
+// Уровни нагрузки для тепловой карты
+const (
+	LoadLevelNone = "none" // Заданий нет
+	LoadLevelOK   = "ok"   // До 75% лимита
+	LoadLevelHigh = "high" // От 75% до 100% лимита
+	LoadLevelOver = "over" // Лимит превышен
+)
+
+// defaultLoadLimits - лимиты по умолчанию, если школа не настроила свои.
+// Минуты соответствуют нормам СанПиН на суммарное время выполнения ДЗ.
+var defaultLoadLimits = map[int]models.HomeworkLoadLimit{
+	1:  {GradeLevel: 1, MaxItems: 1, MaxMinutes: 60},
+	2:  {GradeLevel: 2, MaxItems: 3, MaxMinutes: 90},
+	3:  {GradeLevel: 3, MaxItems: 3, MaxMinutes: 90},
+	4:  {GradeLevel: 4, MaxItems: 3, MaxMinutes: 120},
+	5:  {GradeLevel: 5, MaxItems: 4, MaxMinutes: 120},
+	6:  {GradeLevel: 6, MaxItems: 4, MaxMinutes: 150},
+	7:  {GradeLevel: 7, MaxItems: 4, MaxMinutes: 150},
+	8:  {GradeLevel: 8, MaxItems: 4, MaxMinutes: 150},
+	9:  {GradeLevel: 9, MaxItems: 5, MaxMinutes: 210},
+	10: {GradeLevel: 10, MaxItems: 5, MaxMinutes: 210},
+	11: {GradeLevel: 11, MaxItems: 5, MaxMinutes: 210},
+}
+
+// HomeworkLoad - нагрузка класса домашними заданиями на один день
+type HomeworkLoad struct {
+	Date       string  `json:"date"`
+	DayOfWeek  string  `json:"day_of_week"`
+	WorkingDay bool    `json:"working_day"`
+	Items      int     `json:"items"`
+	Minutes    int     `json:"minutes"`
+	Percent    float64 `json:"percent"` // Доля от лимита (по худшему из двух показателей)
+	Level      string  `json:"level"`
+}
+
+// HomeworkLoadLimitRequest структура для настройки лимита параллели
+type HomeworkLoadLimitRequest struct {
+	GradeLevel int    `json:"grade_level" binding:"min=0,max=11"`
+	MaxItems   int    `json:"max_items" binding:"required,min=1"`
+	MaxMinutes int    `json:"max_minutes" binding:"required,min=1"`
+	Mode       string `json:"mode"` // warn (по умолчанию), block
+}
+
+// GetClassLoad возвращает тепловую карту нагрузки ДЗ класса по дням недели.
+// Параметры: week - любая дата недели (по умолчанию текущая), weeks - число недель (1-8).
+func (h *HomeworkHandler) GetClassLoad(c *gin.Context) {
+	classID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid class ID"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	schoolID, _ := c.Get("school_id")
+	role, _ := c.Get("role")
+
+	var class models.Class
+	if err := database.DB.Where("id = ? AND school_id = ?", classID, schoolID).First(&class).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Class not found"})
+		return
+	}
+
+	// Только админы и классный руководитель
+	if role != "admin" && (class.HomeroomTeacherID == nil || *class.HomeroomTeacherID != userID.(uint)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins and the homeroom teacher can view class load"})
+		return
+	}
+
+	week := calendar.Date(time.Now())
+	if value := c.Query("week"); value != "" {
+		week, err = time.Parse(calendar.DateLayout, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid week format (use YYYY-MM-DD)"})
+			return
+		}
+	}
+
+	weeks := 1
+	if value := c.Query("weeks"); value != "" {
+		weeks, err = strconv.Atoi(value)
+		if err != nil || weeks < 1 || weeks > 8 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "weeks must be between 1 and 8"})
+			return
+		}
+	}
+
+	// Начинаем с понедельника
+	offset := (int(week.Weekday()) + 6) % 7
+	from := week.AddDate(0, 0, -offset)
+	to := from.AddDate(0, 0, 7*weeks-1)
+
+	cal, err := loadClassCalendar(&class, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load calendar"})
+		return
+	}
+
+	loads, err := classLoad(class.ID, from, to, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate load"})
+		return
+	}
+
+	limit := loadLimitFor(class.SchoolID, gradeLevel(class.Name))
+
+	days := make([]HomeworkLoad, 0, 7*weeks)
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		load := loads[d.Format(calendar.DateLayout)]
+		load.Date = d.Format(calendar.DateLayout)
+		load.DayOfWeek = calendar.DayName(d)
+		load.WorkingDay = cal.IsWorkingDay(d)
+		rateLoad(&load, limit)
+		days = append(days, load)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"class": class,
+		"limit": limit,
+		"from":  from.Format(calendar.DateLayout),
+		"to":    to.Format(calendar.DateLayout),
+		"days":  days,
+	})
+}
+
+// GetLoadLimits возвращает лимиты нагрузки школы по параллелям с учётом значений по умолчанию
+func (h *HomeworkHandler) GetLoadLimits(c *gin.Context) {
+	schoolID, _ := c.Get("school_id")
+
+	var custom []models.HomeworkLoadLimit
+	if err := database.DB.Where("school_id = ?", schoolID).
+		Order("grade_level").
+		Find(&custom).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch limits"})
+		return
+	}
+
+	effective := make([]models.HomeworkLoadLimit, 0, len(defaultLoadLimits))
+	for grade := 1; grade <= 11; grade++ {
+		effective = append(effective, loadLimitFor(schoolID.(uint), grade))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"limits":    custom,
+		"effective": effective,
+	})
+}
+
+// SetLoadLimit создаёт или обновляет лимит нагрузки для параллели
+func (h *HomeworkHandler) SetLoadLimit(c *gin.Context) {
+	schoolID, _ := c.Get("school_id")
+
+	var req HomeworkLoadLimitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Mode == "" {
+		req.Mode = LoadModeWarn
+	}
+	if req.Mode != LoadModeWarn && req.Mode != LoadModeBlock {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Mode must be warn or block"})
+		return
+	}
+
+	limit := models.HomeworkLoadLimit{
+		SchoolID:   schoolID.(uint),
+		GradeLevel: req.GradeLevel,
+		MaxItems:   req.MaxItems,
+		MaxMinutes: req.MaxMinutes,
+		Mode:       req.Mode,
+	}
+
+	if err := db(c).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "school_id"}, {Name: "grade_level"}},
+		DoUpdates: clause.AssignmentColumns([]string{"max_items", "max_minutes", "mode", "updated_at"}),
+	}).Create(&limit).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save limit"})
+		return
+	}
+
+	database.DB.Where("school_id = ? AND grade_level = ?", schoolID, req.GradeLevel).First(&limit)
+
+	c.JSON(http.StatusOK, gin.H{"limit": limit})
+}
+
+// DeleteLoadLimit удаляет настройку параллели (возвращаются значения по умолчанию)
+func (h *HomeworkHandler) DeleteLoadLimit(c *gin.Context) {
+	grade, err := strconv.Atoi(c.Param("grade"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid grade level"})
+		return
+	}
+
+	schoolID, _ := c.Get("school_id")
+
+	result := db(c).Where("school_id = ? AND grade_level = ?", schoolID, grade).
+		Delete(&models.HomeworkLoadLimit{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete limit"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Limit not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Limit deleted successfully"})
+}
+
+// checkHomeworkLoad считает нагрузку класса на день сдачи с учётом нового задания.
+// В режиме block при превышении пишет ответ 409 и возвращает ok=false (админ может
+// обойти запрет флагом force). В режиме warn возвращает предупреждение для ответа.
+func checkHomeworkLoad(c *gin.Context, class *models.Class, dueDate time.Time, minutes int, excludeID uint, force bool) (gin.H, bool) {
+	role, _ := c.Get("role")
+
+	load, limit, err := projectedLoad(class, dueDate, HomeworkLoad{Items: 1, Minutes: minutes}, excludeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate load"})
+		return nil, false
+	}
+	if load.Level != LoadLevelOver {
+		return nil, true
+	}
+
+	if limit.Mode == LoadModeBlock && !(force && role == "admin") {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Homework load for the due date exceeds the limit",
+			"load":  load,
+			"limit": limit,
+		})
+		return nil, false
+	}
+	return gin.H{
+		"message": "Homework load for the due date exceeds the limit",
+		"load":    load,
+		"limit":   limit,
+	}, true
+}
+
+// projectedLoad считает нагрузку класса на день сдачи вместе с добавляемыми заданиями
+func projectedLoad(class *models.Class, dueDate time.Time, added HomeworkLoad, excludeID uint) (HomeworkLoad, models.HomeworkLoadLimit, error) {
+	loads, err := classLoad(class.ID, dueDate, dueDate, excludeID)
+	if err != nil {
+		return HomeworkLoad{}, models.HomeworkLoadLimit{}, err
+	}
+
+	load := loads[dueDate.Format(calendar.DateLayout)]
+	load.Date = dueDate.Format(calendar.DateLayout)
+	load.DayOfWeek = calendar.DayName(dueDate)
+	load.WorkingDay = true
+	load.Items += added.Items
+	load.Minutes += added.Minutes
+
+	limit := loadLimitFor(class.SchoolID, gradeLevel(class.Name))
+	rateLoad(&load, limit)
+	return load, limit, nil
+}
+
+// classLoad считает число заданий и минуты по дням сдачи в периоде [from, to]
+func classLoad(classID uint, from, to time.Time, excludeID uint) (map[string]HomeworkLoad, error) {
+	query := database.DB.Model(&models.Homework{}).
+		Where("class_id = ? AND due_date BETWEEN ? AND ?", classID, from, to)
+	if excludeID != 0 {
+		query = query.Where("id <> ?", excludeID)
+	}
+
+	var homework []models.Homework
+	if err := query.Find(&homework).Error; err != nil {
+		return nil, err
+	}
+
+	loads := make(map[string]HomeworkLoad)
+	for _, hw := range homework {
+		key := hw.DueDate.Format(calendar.DateLayout)
+		load := loads[key]
+		load.Items++
+		load.Minutes += hw.EstimatedMinutes
+		loads[key] = load
+	}
+	return loads, nil
+}
+
+// rateLoad вычисляет процент от лимита и уровень нагрузки
+func rateLoad(load *HomeworkLoad, limit models.HomeworkLoadLimit) {
+	if load.Items == 0 {
+		load.Level = LoadLevelNone
+		return
+	}
+
+	ratio := float64(load.Items) / float64(limit.MaxItems)
+	if byMinutes := float64(load.Minutes) / float64(limit.MaxMinutes); byMinutes > ratio {
+		ratio = byMinutes
+	}
+	load.Percent = float64(int(ratio*1000+0.5)) / 10
+
+	switch {
+	case ratio > 1:
+		load.Level = LoadLevelOver
+	case ratio >= 0.75:
+		load.Level = LoadLevelHigh
+	default:
+		load.Level = LoadLevelOK
+	}
+}
+
+// loadLimitFor возвращает лимит для параллели: настройка параллели, затем общая
+// настройка школы (grade_level = 0), затем значения по умолчанию
+func loadLimitFor(schoolID uint, grade int) models.HomeworkLoadLimit {
+	var limits []models.HomeworkLoadLimit
+	database.DB.Where("school_id = ? AND grade_level IN ?", schoolID, []int{grade, 0}).
+		Order("grade_level DESC").
+		Find(&limits)
+	if len(limits) > 0 {
+		return limits[0]
+	}
+
+	limit, ok := defaultLoadLimits[grade]
+	if !ok {
+		limit = defaultLoadLimits[9]
+		limit.GradeLevel = grade
+	}
+	limit.SchoolID = schoolID
+	limit.Mode = LoadModeWarn
+	return limit
+}
+
+// gradeLevel извлекает номер параллели из названия класса ("9А" -> 9, "11-Б" -> 11)
+func gradeLevel(className string) int {
+	grade := 0
+	for _, r := range className {
+		if !unicode.IsDigit(r) {
+			break
+		}
+		grade = grade*10 + int(r-'0')
+	}
+	return grade
+}
@@ -0,0 +1,654 @@
+package handlers
+
+import (
+	"classkeeper/internal/calendar"
+	"classkeeper/internal/database"
+	"classkeeper/internal/models"
+	"classkeeper/internal/recurring"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type HomeworkTemplateHandler struct{}
+
+func NewHomeworkTemplateHandler() *HomeworkTemplateHandler {
+	return &HomeworkTemplateHandler{}
+}
+
+// HomeworkTemplateRequest структура для создания/обновления шаблона ДЗ
+type HomeworkTemplateRequest struct {
+	SubjectID        uint   `json:"subject_id" binding:"required"`
+	Title            string `json:"title" binding:"required"`
+	Description      string `json:"description" binding:"required"`
+	EstimatedMinutes int    `json:"estimated_minutes" binding:"omitempty,min=1,max=600"`
+	Year             string `json:"year"` // Учебный год "2025-2026"
+}
+
+// AssignTemplateRequest структура для выдачи ДЗ по шаблону
+type AssignTemplateRequest struct {
+	ClassID      uint   `json:"class_id" binding:"required"`
+	AssignedDate string `json:"assigned_date" binding:"required"` // YYYY-MM-DD
+	DueDate      string `json:"due_date"`                         // YYYY-MM-DD, по умолчанию - следующий урок предмета
+	Force        bool   `json:"force"`
+}
+
+// CopyTemplatesRequest структура для переноса шаблонов на новый учебный год
+type CopyTemplatesRequest struct {
+	FromYear    string `json:"from_year" binding:"required"`
+	ToYear      string `json:"to_year" binding:"required"`
+	TemplateIDs []uint `json:"template_ids"` // Если пусто - все шаблоны года (свои для учителя)
+}
+
+// RecurrenceRequest структура для создания правила повторения
+type RecurrenceRequest struct {
+	TemplateID   uint   `json:"template_id" binding:"required"`
+	ClassID      uint   `json:"class_id" binding:"required"`
+	DayOfWeek    string `json:"day_of_week"`                   // Понедельник... Пусто - каждый урок предмета
+	SkipHolidays *bool  `json:"skip_holidays"`                 // По умолчанию true
+	StartDate    string `json:"start_date" binding:"required"` // YYYY-MM-DD
+	EndDate      string `json:"end_date"`                      // YYYY-MM-DD
+}
+
+// UpdateRecurrenceRequest структура для изменения правила повторения
+type UpdateRecurrenceRequest struct {
+	DayOfWeek    *string `json:"day_of_week"`
+	SkipHolidays *bool   `json:"skip_holidays"`
+	EndDate      *string `json:"end_date"` // "" - без даты окончания
+	Active       *bool   `json:"active"`
+}
+
+// CreateTemplate создаёт шаблон ДЗ
+func (h *HomeworkTemplateHandler) CreateTemplate(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	schoolID, _ := c.Get("school_id")
+
+	var req HomeworkTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var subject models.Subject
+	if err := database.DB.Where("id = ? AND school_id = ?", req.SubjectID, schoolID).First(&subject).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Subject not found"})
+		return
+	}
+
+	if req.EstimatedMinutes == 0 {
+		req.EstimatedMinutes = DefaultEstimatedMinutes
+	}
+
+	template := models.HomeworkTemplate{
+		SchoolID:         schoolID.(uint),
+		SubjectID:        req.SubjectID,
+		TeacherID:        userID.(uint),
+		Title:            req.Title,
+		Description:      req.Description,
+		EstimatedMinutes: req.EstimatedMinutes,
+		Year:             req.Year,
+	}
+
+	if err := db(c).Create(&template).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create template"})
+		return
+	}
+
+	database.DB.Preload("Subject").Preload("Teacher").First(&template, template.ID)
+
+	c.JSON(http.StatusCreated, gin.H{"template": template})
+}
+
+// ListTemplates возвращает шаблоны школы (фильтры: subject_id, year, mine=true)
+func (h *HomeworkTemplateHandler) ListTemplates(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	schoolID, _ := c.Get("school_id")
+
+	query := database.DB.Where("school_id = ?", schoolID).
+		Preload("Subject").
+		Preload("Teacher")
+
+	if subjectID := c.Query("subject_id"); subjectID != "" {
+		query = query.Where("subject_id = ?", subjectID)
+	}
+	if year := c.Query("year"); year != "" {
+		query = query.Where("year = ?", year)
+	}
+	if c.Query("mine") == "true" {
+		query = query.Where("teacher_id = ?", userID)
+	}
+
+	var templates []models.HomeworkTemplate
+	if err := query.Order("subject_id, title").Find(&templates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch templates"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"templates": templates})
+}
+
+// GetTemplate возвращает шаблон ДЗ
+func (h *HomeworkTemplateHandler) GetTemplate(c *gin.Context) {
+	template, ok := findSchoolTemplate(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"template": template})
+}
+
+// UpdateTemplate обновляет шаблон (автор или админ)
+func (h *HomeworkTemplateHandler) UpdateTemplate(c *gin.Context) {
+	template, ok := findSchoolTemplate(c)
+	if !ok {
+		return
+	}
+	if !canEditTemplate(c, template) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only update your own templates"})
+		return
+	}
+
+	schoolID, _ := c.Get("school_id")
+
+	var req HomeworkTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var subject models.Subject
+	if err := database.DB.Where("id = ? AND school_id = ?", req.SubjectID, schoolID).First(&subject).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Subject not found"})
+		return
+	}
+
+	template.SubjectID = req.SubjectID
+	template.Title = req.Title
+	template.Description = req.Description
+	template.Year = req.Year
+	if req.EstimatedMinutes != 0 {
+		template.EstimatedMinutes = req.EstimatedMinutes
+	}
+
+	if err := db(c).Omit("Subject", "Teacher").Save(template).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update template"})
+		return
+	}
+
+	database.DB.Preload("Subject").Preload("Teacher").First(template, template.ID)
+
+	c.JSON(http.StatusOK, gin.H{"template": template})
+}
+
+// DeleteTemplate удаляет шаблон вместе с его правилами повторения.
+// Уже выданные по шаблону ДЗ остаются.
+func (h *HomeworkTemplateHandler) DeleteTemplate(c *gin.Context) {
+	template, ok := findSchoolTemplate(c)
+	if !ok {
+		return
+	}
+	if !canEditTemplate(c, template) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only delete your own templates"})
+		return
+	}
+
+	err := db(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("template_id = ?", template.ID).Delete(&models.HomeworkRecurrence{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(template).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete template"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Template deleted successfully"})
+}
+
+// AssignTemplate выдаёт ДЗ по шаблону классу. Шаблон может использовать любой
+// учитель школы, который вправе задавать ДЗ этому классу по предмету шаблона.
+func (h *HomeworkTemplateHandler) AssignTemplate(c *gin.Context) {
+	template, ok := findSchoolTemplate(c)
+	if !ok {
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	schoolID, _ := c.Get("school_id")
+	role, _ := c.Get("role")
+
+	var req AssignTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var class models.Class
+	if err := database.DB.Where("id = ? AND school_id = ?", req.ClassID, schoolID).First(&class).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Class not found"})
+		return
+	}
+
+	if !canAssignHomework(userID.(uint), role, &class, &template.Subject) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only create homework for your subject or your class"})
+		return
+	}
+
+	assignedDate, err := time.Parse(calendar.DateLayout, req.AssignedDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assigned_date format (use YYYY-MM-DD)"})
+		return
+	}
+
+	var dueDate time.Time
+	if req.DueDate != "" {
+		dueDate, err = time.Parse(calendar.DateLayout, req.DueDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid due_date format (use YYYY-MM-DD)"})
+			return
+		}
+	} else {
+		// По умолчанию - к следующему уроку предмета
+		cal, err := loadClassCalendar(&class, assignedDate, assignedDate)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load calendar"})
+			return
+		}
+		dueDate = recurring.NextLesson(cal, subjectLessonDays(class.ID, template.SubjectID), assignedDate)
+	}
+
+	if !checkDueDate(c, &class, dueDate) {
+		return
+	}
+
+	warning, ok := checkHomeworkLoad(c, &class, dueDate, template.EstimatedMinutes, 0, req.Force)
+	if !ok {
+		return
+	}
+
+	homework := models.Homework{
+		ClassID:          class.ID,
+		SubjectID:        template.SubjectID,
+		TeacherID:        userID.(uint),
+		Description:      template.Description,
+		AssignedDate:     assignedDate,
+		DueDate:          dueDate,
+		EstimatedMinutes: template.EstimatedMinutes,
+		TemplateID:       &template.ID,
+	}
+
+	if err := db(c).Create(&homework).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create homework"})
+		return
+	}
+
+	database.DB.Preload("Class").Preload("Subject").Preload("Teacher").First(&homework, homework.ID)
+
+	response := gin.H{"homework": homework}
+	if warning != nil {
+		response["load_warning"] = warning
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// CopyTemplates копирует шаблоны учебного года в следующий год.
+// Учитель копирует свои шаблоны, админ - любые шаблоны школы.
+func (h *HomeworkTemplateHandler) CopyTemplates(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	schoolID, _ := c.Get("school_id")
+	role, _ := c.Get("role")
+
+	var req CopyTemplatesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.FromYear == req.ToYear {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from_year and to_year must differ"})
+		return
+	}
+
+	query := database.DB.Where("school_id = ? AND year = ?", schoolID, req.FromYear)
+	if len(req.TemplateIDs) > 0 {
+		query = query.Where("id IN ?", req.TemplateIDs)
+	}
+	if role != "admin" {
+		query = query.Where("teacher_id = ?", userID)
+	}
+
+	var templates []models.HomeworkTemplate
+	if err := query.Find(&templates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch templates"})
+		return
+	}
+
+	copies := make([]models.HomeworkTemplate, 0, len(templates))
+	err := db(c).Transaction(func(tx *gorm.DB) error {
+		for _, t := range templates {
+			// Не создаём дубликат, если шаблон уже перенесён
+			var count int64
+			tx.Model(&models.HomeworkTemplate{}).
+				Where("school_id = ? AND year = ? AND subject_id = ? AND title = ?", t.SchoolID, req.ToYear, t.SubjectID, t.Title).
+				Count(&count)
+			if count > 0 {
+				continue
+			}
+
+			copied := models.HomeworkTemplate{
+				SchoolID:         t.SchoolID,
+				SubjectID:        t.SubjectID,
+				TeacherID:        t.TeacherID,
+				Title:            t.Title,
+				Description:      t.Description,
+				EstimatedMinutes: t.EstimatedMinutes,
+				Year:             req.ToYear,
+			}
+			if err := tx.Create(&copied).Error; err != nil {
+				return err
+			}
+			copies = append(copies, copied)
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to copy templates"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"copied":    len(copies),
+		"skipped":   len(templates) - len(copies),
+		"templates": copies,
+	})
+}
+
+// CreateRecurrence создаёт правило автоматической выдачи ДЗ по шаблону
+func (h *HomeworkTemplateHandler) CreateRecurrence(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	schoolID, _ := c.Get("school_id")
+	role, _ := c.Get("role")
+
+	var req RecurrenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var template models.HomeworkTemplate
+	if err := database.DB.Where("id = ? AND school_id = ?", req.TemplateID, schoolID).
+		Preload("Subject").
+		First(&template).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Template not found"})
+		return
+	}
+
+	var class models.Class
+	if err := database.DB.Where("id = ? AND school_id = ?", req.ClassID, schoolID).First(&class).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Class not found"})
+		return
+	}
+
+	if !canAssignHomework(userID.(uint), role, &class, &template.Subject) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only create homework for your subject or your class"})
+		return
+	}
+
+	if req.DayOfWeek != "" {
+		if _, ok := calendar.ParseDayName(req.DayOfWeek); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid day_of_week"})
+			return
+		}
+	}
+
+	// Правило имеет смысл, только если в расписании есть уроки предмета
+	lessonDays := subjectLessonDays(class.ID, template.SubjectID)
+	if len(lessonDays) == 0 || (req.DayOfWeek != "" && !lessonDays[req.DayOfWeek]) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The class has no lessons of this subject on the given day"})
+		return
+	}
+
+	startDate, err := time.Parse(calendar.DateLayout, req.StartDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start_date format (use YYYY-MM-DD)"})
+		return
+	}
+
+	rule := models.HomeworkRecurrence{
+		TemplateID:   template.ID,
+		ClassID:      class.ID,
+		TeacherID:    userID.(uint),
+		DayOfWeek:    req.DayOfWeek,
+		SkipHolidays: req.SkipHolidays == nil || *req.SkipHolidays,
+		StartDate:    startDate,
+		Active:       true,
+	}
+
+	if req.EndDate != "" {
+		endDate, err := time.Parse(calendar.DateLayout, req.EndDate)
+		if err != nil || endDate.Before(startDate) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_date"})
+			return
+		}
+		rule.EndDate = &endDate
+	}
+
+	if err := db(c).Create(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create recurrence"})
+		return
+	}
+
+	// Сразу выдаём задания за уже прошедшие уроки периода
+	created, err := recurring.Generate(db(c), &rule, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Recurrence created, but homework generation failed"})
+		return
+	}
+
+	database.DB.Preload("Template").Preload("Class").First(&rule, rule.ID)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"recurrence": rule,
+		"created":    len(created),
+	})
+}
+
+// ListRecurrences возвращает правила повторения школы (фильтры: class_id, template_id)
+func (h *HomeworkTemplateHandler) ListRecurrences(c *gin.Context) {
+	schoolID, _ := c.Get("school_id")
+
+	query := database.DB.
+		Joins("JOIN classes ON classes.id = homework_recurrences.class_id").
+		Where("classes.school_id = ?", schoolID).
+		Preload("Template").
+		Preload("Class")
+
+	if classID := c.Query("class_id"); classID != "" {
+		query = query.Where("homework_recurrences.class_id = ?", classID)
+	}
+	if templateID := c.Query("template_id"); templateID != "" {
+		query = query.Where("homework_recurrences.template_id = ?", templateID)
+	}
+
+	var rules []models.HomeworkRecurrence
+	if err := query.Order("homework_recurrences.id").Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recurrences"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recurrences": rules})
+}
+
+// UpdateRecurrence изменяет правило (приостановка, день недели, дата окончания)
+func (h *HomeworkTemplateHandler) UpdateRecurrence(c *gin.Context) {
+	rule, ok := findSchoolRecurrence(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateRecurrenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.DayOfWeek != nil {
+		if *req.DayOfWeek != "" {
+			if _, ok := calendar.ParseDayName(*req.DayOfWeek); !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid day_of_week"})
+				return
+			}
+		}
+		rule.DayOfWeek = *req.DayOfWeek
+	}
+	if req.SkipHolidays != nil {
+		rule.SkipHolidays = *req.SkipHolidays
+	}
+	if req.Active != nil {
+		rule.Active = *req.Active
+	}
+	if req.EndDate != nil {
+		if *req.EndDate == "" {
+			rule.EndDate = nil
+		} else {
+			endDate, err := time.Parse(calendar.DateLayout, *req.EndDate)
+			if err != nil || endDate.Before(rule.StartDate) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_date"})
+				return
+			}
+			rule.EndDate = &endDate
+		}
+	}
+
+	if err := db(c).Omit("Template", "Class").Save(rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update recurrence"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recurrence": rule})
+}
+
+// DeleteRecurrence удаляет правило. Уже выданные ДЗ остаются.
+func (h *HomeworkTemplateHandler) DeleteRecurrence(c *gin.Context) {
+	rule, ok := findSchoolRecurrence(c)
+	if !ok {
+		return
+	}
+
+	if err := db(c).Delete(rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete recurrence"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Recurrence deleted successfully"})
+}
+
+// GenerateRecurrence выдаёт ДЗ по правилу заранее - до даты until (по умолчанию сегодня)
+func (h *HomeworkTemplateHandler) GenerateRecurrence(c *gin.Context) {
+	rule, ok := findSchoolRecurrence(c)
+	if !ok {
+		return
+	}
+
+	if !rule.Active {
+		c.JSON(http.StatusConflict, gin.H{"error": "Recurrence is paused"})
+		return
+	}
+
+	until := time.Now()
+	if value := c.Query("until"); value != "" {
+		parsed, err := time.Parse(calendar.DateLayout, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid until format (use YYYY-MM-DD)"})
+			return
+		}
+		until = parsed
+	}
+
+	created, err := recurring.Generate(db(c), rule, until)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate homework"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"created":  len(created),
+		"homework": created,
+	})
+}
+
+// findSchoolTemplate находит шаблон в школе пользователя. При ошибке пишет ответ.
+func findSchoolTemplate(c *gin.Context) (*models.HomeworkTemplate, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template ID"})
+		return nil, false
+	}
+
+	schoolID, _ := c.Get("school_id")
+
+	var template models.HomeworkTemplate
+	if err := database.DB.Where("id = ? AND school_id = ?", id, schoolID).
+		Preload("Subject").
+		Preload("Teacher").
+		First(&template).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return nil, false
+	}
+	return &template, true
+}
+
+// findSchoolRecurrence находит правило и проверяет право на его изменение
+// (создатель правила или админ). При ошибке пишет ответ.
+func findSchoolRecurrence(c *gin.Context) (*models.HomeworkRecurrence, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recurrence ID"})
+		return nil, false
+	}
+
+	userID, _ := c.Get("user_id")
+	schoolID, _ := c.Get("school_id")
+	role, _ := c.Get("role")
+
+	var rule models.HomeworkRecurrence
+	if err := database.DB.
+		Joins("JOIN classes ON classes.id = homework_recurrences.class_id").
+		Where("homework_recurrences.id = ? AND classes.school_id = ?", id, schoolID).
+		First(&rule).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Recurrence not found"})
+		return nil, false
+	}
+
+	if role != "admin" && rule.TeacherID != userID.(uint) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only manage your own recurrences"})
+		return nil, false
+	}
+	return &rule, true
+}
+
+// canEditTemplate - шаблон может менять автор или админ
+func canEditTemplate(c *gin.Context, template *models.HomeworkTemplate) bool {
+	userID, _ := c.Get("user_id")
+	role, _ := c.Get("role")
+	return role == "admin" || template.TeacherID == userID.(uint)
+}
+
+// subjectLessonDays возвращает дни недели, в которые у класса есть уроки предмета
+func subjectLessonDays(classID, subjectID uint) map[string]bool {
+	var days []string
+	database.DB.Model(&models.Schedule{}).
+		Where("class_id = ? AND subject_id = ?", classID, subjectID).
+		Distinct().
+		Pluck("day_of_week", &days)
+
+	lessonDays := make(map[string]bool)
+	for _, day := range days {
+		lessonDays[day] = true
+	}
+	return lessonDays
+}
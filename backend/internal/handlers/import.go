@@ -0,0 +1,848 @@
+package handlers
+
+import (
+	"bytes"
+	"classkeeper/internal/models"
+	"classkeeper/internal/xlsx"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/mail"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/encoding/charmap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Сущности импорта
+const (
+	ImportStudents    = "students"
+	ImportTeachers    = "teachers"
+	ImportParents     = "parents"
+	ImportClasses     = "classes"
+	ImportParentLinks = "parent_links"
+)
+
+// Действия над строкой импорта
+const (
+	ImportCreated   = "created"
+	ImportUpdated   = "updated"
+	ImportLinked    = "linked"    // Найдена существующая запись без external_id и связана с ним
+	ImportUnchanged = "unchanged" // Повторный импорт без изменений
+)
+
+const (
+	maxImportFileSize = 10 << 20
+	maxImportRows     = 5000
+
+	// importEmailDomain - домен адресов-заглушек для пользователей без email
+	importEmailDomain = "no-email.classkeeper.local"
+
+	// initialPasswordLength - длина сгенерированного начального пароля
+	initialPasswordLength = 10
+	// passwordAlphabet - без похожих символов (0/O, 1/l/I)
+	passwordAlphabet = "abcdefghjkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+// importField описывает столбец импорта: имя поля и заголовки, которые ему соответствуют
+type importField struct {
+	Name     string   `json:"name"`
+	Required bool     `json:"required"`
+	Aliases  []string `json:"aliases"`
+}
+
+var (
+	fieldExternalID = importField{Name: "external_id", Required: true, Aliases: []string{"id", "внешний id", "код", "номер"}}
+	fieldLastName   = importField{Name: "last_name", Required: true, Aliases: []string{"фамилия"}}
+	fieldFirstName  = importField{Name: "first_name", Required: true, Aliases: []string{"имя"}}
+	fieldMiddleName = importField{Name: "middle_name", Aliases: []string{"отчество"}}
+	fieldEmail      = importField{Name: "email", Aliases: []string{"e-mail", "почта", "эл. почта", "электронная почта"}}
+	fieldUsername   = importField{Name: "username", Aliases: []string{"логин"}}
+	fieldPassword   = importField{Name: "password", Aliases: []string{"пароль"}}
+)
+
+// importEntities - поля каждой сущности импорта
+var importEntities = map[string][]importField{
+	ImportStudents: {
+		fieldExternalID, fieldLastName, fieldFirstName, fieldMiddleName, fieldEmail, fieldUsername, fieldPassword,
+		{Name: "class", Aliases: []string{"класс"}},
+		{Name: "year", Aliases: []string{"учебный год", "год"}},
+	},
+	ImportTeachers: {
+		fieldExternalID, fieldLastName, fieldFirstName, fieldMiddleName, fieldEmail, fieldUsername, fieldPassword,
+		{Name: "subject", Aliases: []string{"teacher_subject", "предмет"}},
+	},
+	ImportParents: {
+		fieldExternalID, fieldLastName, fieldFirstName, fieldMiddleName, fieldEmail, fieldUsername, fieldPassword,
+		{Name: "children", Aliases: []string{"дети", "ученики"}}, // external_id учеников через ";"
+	},
+	ImportClasses: {
+		fieldExternalID,
+		{Name: "name", Required: true, Aliases: []string{"название", "класс"}},
+		{Name: "year", Required: true, Aliases: []string{"учебный год", "год"}},
+		{Name: "homeroom_teacher", Aliases: []string{"классный руководитель"}}, // external_id или логин учителя
+	},
+	ImportParentLinks: {
+		{Name: "parent", Required: true, Aliases: []string{"parent_external_id", "родитель"}},
+		{Name: "student", Required: true, Aliases: []string{"student_external_id", "ученик"}},
+	},
+}
+
+// ImportRow результат импорта строки файла
+type ImportRow struct {
+	Row        int      `json:"row"` // Номер строки в файле (заголовок - строка 1)
+	ExternalID string   `json:"external_id,omitempty"`
+	Action     string   `json:"action,omitempty"`
+	Username   string   `json:"username,omitempty"`
+	Password   string   `json:"password,omitempty"` // Начальный пароль, только для созданных пользователей
+	Changes    []string `json:"changes,omitempty"`
+	Warnings   []string `json:"warnings,omitempty"`
+}
+
+// importRecord - строка файла: значения по именам полей
+type importRecord struct {
+	line   int
+	values map[string]string
+}
+
+func (r importRecord) get(field string) string {
+	return strings.TrimSpace(r.values[field])
+}
+
+type ImportHandler struct{}
+
+func NewImportHandler() *ImportHandler {
+	return &ImportHandler{}
+}
+
+// GetImportFields возвращает поля и распознаваемые заголовки для каждой сущности
+func (h *ImportHandler) GetImportFields(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"entities": importEntities})
+}
+
+// Import импортирует пользователей, классы или связи родителей из CSV или XLSX.
+// По умолчанию работает в режиме validate: возвращает отчёт, ничего не сохраняя.
+// Повторный импорт того же файла ничего не меняет: записи ищутся по external_id.
+func (h *ImportHandler) Import(c *gin.Context) {
+	schoolID, _ := c.Get("school_id")
+
+	entity := c.Param("entity")
+	fields, ok := importEntities[entity]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown import entity"})
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File is required"})
+		return
+	}
+	if file.Size > maxImportFileSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File is too large"})
+		return
+	}
+
+	// Соответствие полей заголовкам файла: {"last_name": "Фамилия ученика"}
+	var mapping map[string]string
+	if raw := c.PostForm("mapping"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mapping JSON"})
+			return
+		}
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxImportFileSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+
+	table, err := readImportTable(file.Filename, data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(table) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File is empty"})
+		return
+	}
+
+	columns, ignored, err := mapImportColumns(table[0], fields, mapping)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "headers": table[0]})
+		return
+	}
+
+	var records []importRecord
+	for i, row := range table[1:] {
+		rec := importRecord{line: i + 2, values: make(map[string]string, len(columns))}
+		empty := true
+		for name, col := range columns {
+			if col < len(row) {
+				rec.values[name] = row[col]
+				if strings.TrimSpace(row[col]) != "" {
+					empty = false
+				}
+			}
+		}
+		if !empty {
+			records = append(records, rec)
+		}
+	}
+
+	mode := c.PostForm("mode")
+	if mode == "" {
+		mode = BulkModeValidate
+	}
+	mode, ok = parseBulkMode(c, mode, len(records), maxImportRows)
+	if !ok {
+		return
+	}
+
+	im := &importer{
+		schoolID: schoolID.(uint),
+		entity:   entity,
+		fields:   fields,
+		seen:     make(map[string]int),
+	}
+	rows := make([]ImportRow, len(records))
+	report, err := runBulk(c, mode, len(records), func(tx *gorm.DB, i int) (uint, interface{}, error) {
+		row := ImportRow{Row: records[i].line}
+		id, err := im.apply(tx, records[i], &row)
+		if err != nil {
+			row.Action = ""
+			row.Username = ""
+			row.Password = ""
+		}
+		rows[i] = row
+		return id, nil, err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import"})
+		return
+	}
+
+	// Пароли откатившегося импорта недействительны
+	if !report.Committed {
+		for i := range rows {
+			rows[i].Password = ""
+		}
+	}
+
+	respondBulk(c, report, gin.H{
+		"entity":          entity,
+		"rows":            rows,
+		"ignored_columns": ignored,
+	})
+}
+
+// readImportTable читает CSV или XLSX по расширению файла
+func readImportTable(filename string, data []byte) ([][]string, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".xlsx":
+		table, err := xlsx.ReadFirstSheet(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid XLSX file: %v", err)
+		}
+		return table, nil
+	case ".csv", ".txt":
+		return readImportCSV(data)
+	default:
+		return nil, errors.New("unsupported file type (use .csv or .xlsx)")
+	}
+}
+
+// readImportCSV читает CSV в UTF-8 или Windows-1251 (так сохраняет русский Excel)
+// с разделителем ",", ";" или табуляцией
+func readImportCSV(data []byte) ([][]string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(data) {
+		decoded, err := charmap.Windows1251.NewDecoder().Bytes(data)
+		if err != nil {
+			return nil, errors.New("unsupported CSV encoding (use UTF-8 or Windows-1251)")
+		}
+		data = decoded
+	}
+
+	// Разделитель определяем по строке заголовков
+	header := data
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		header = data[:i]
+	}
+	delimiter := ','
+	best := bytes.Count(header, []byte(","))
+	for _, d := range []rune{';', '\t'} {
+		if n := bytes.Count(header, []byte(string(d))); n > best {
+			delimiter, best = d, n
+		}
+	}
+
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comma = delimiter
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	table, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV file: %v", err)
+	}
+	return table, nil
+}
+
+// mapImportColumns сопоставляет поля столбцам файла: сначала по явному mapping,
+// затем по имени поля и известным заголовкам. Возвращает номера столбцов и
+// заголовки, которые не попали ни в одно поле.
+func mapImportColumns(headers []string, fields []importField, mapping map[string]string) (map[string]int, []string, error) {
+	known := make(map[string]importField, len(fields))
+	for _, field := range fields {
+		known[field.Name] = field
+	}
+	for name := range mapping {
+		if _, ok := known[name]; !ok {
+			return nil, nil, fmt.Errorf("unknown field in mapping: %s", name)
+		}
+	}
+
+	byHeader := make(map[string]int, len(headers))
+	for i, header := range headers {
+		key := normalizeHeader(header)
+		if _, dup := byHeader[key]; !dup && key != "" {
+			byHeader[key] = i
+		}
+	}
+
+	columns := make(map[string]int)
+	used := make(map[int]bool)
+	var missing []string
+	for _, field := range fields {
+		candidates := append([]string{field.Name}, field.Aliases...)
+		if header, ok := mapping[field.Name]; ok {
+			candidates = []string{header}
+		}
+
+		found := false
+		for _, candidate := range candidates {
+			if col, ok := byHeader[normalizeHeader(candidate)]; ok && !used[col] {
+				columns[field.Name] = col
+				used[col] = true
+				found = true
+				break
+			}
+		}
+		if !found && field.Required {
+			missing = append(missing, field.Name)
+		} else if header, ok := mapping[field.Name]; ok && !found {
+			return nil, nil, fmt.Errorf("column %q mapped to %s not found", header, field.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, nil, fmt.Errorf("missing required columns: %s", strings.Join(missing, ", "))
+	}
+
+	ignored := []string{}
+	for i, header := range headers {
+		if !used[i] && strings.TrimSpace(header) != "" {
+			ignored = append(ignored, header)
+		}
+	}
+	return columns, ignored, nil
+}
+
+// normalizeHeader приводит заголовок к виду для сравнения
+func normalizeHeader(header string) string {
+	header = strings.ToLower(strings.Join(strings.Fields(header), " "))
+	return strings.ReplaceAll(header, "ё", "е")
+}
+
+// importer применяет строки файла к базе одной школы
+type importer struct {
+	schoolID uint
+	entity   string
+	fields   []importField
+	seen     map[string]int // Ключ строки -> номер строки, где он встретился впервые
+}
+
+// apply импортирует одну строку и заполняет её отчёт
+func (im *importer) apply(tx *gorm.DB, rec importRecord, row *ImportRow) (uint, error) {
+	for _, field := range im.fields {
+		if field.Required && rec.get(field.Name) == "" {
+			return 0, itemError("%s is required", field.Name)
+		}
+	}
+
+	// Один ключ - одна строка файла
+	key := rec.get("external_id")
+	if im.entity == ImportParentLinks {
+		key = rec.get("parent") + "/" + rec.get("student")
+	}
+	row.ExternalID = rec.get("external_id")
+	if first, dup := im.seen[key]; dup {
+		return 0, itemError("Duplicate of row %d", first)
+	}
+	im.seen[key] = rec.line
+
+	switch im.entity {
+	case ImportStudents:
+		return im.importUser(tx, rec, row, "student")
+	case ImportTeachers:
+		return im.importUser(tx, rec, row, "teacher")
+	case ImportParents:
+		return im.importUser(tx, rec, row, "parent")
+	case ImportClasses:
+		return im.importClass(tx, rec, row)
+	default:
+		return im.importParentLink(tx, rec, row)
+	}
+}
+
+// importUser создаёт или обновляет пользователя по external_id
+func (im *importer) importUser(tx *gorm.DB, rec importRecord, row *ImportRow, role string) (uint, error) {
+	externalID := rec.get("external_id")
+	email := strings.ToLower(rec.get("email"))
+	if email != "" && !validEmail(email) {
+		return 0, itemError("Invalid email: %s", email)
+	}
+
+	var user models.User
+	err := tx.Unscoped().Where("school_id = ? AND external_id = ?", im.schoolID, externalID).First(&user).Error
+	switch {
+	case err == nil:
+		if user.DeletedAt.Valid {
+			return 0, itemError("User with this external_id was deleted")
+		}
+		if !sameImportRole(user.Role, role) {
+			return 0, itemError("external_id belongs to a %s", user.Role)
+		}
+		row.Action = ImportUnchanged
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		// Пользователь, созданный до импорта, связывается по email
+		if email != "" {
+			var existing models.User
+			if err := tx.Unscoped().Where("email = ?", email).First(&existing).Error; err == nil {
+				if existing.SchoolID != im.schoolID || existing.ExternalID != nil ||
+					existing.DeletedAt.Valid || !sameImportRole(existing.Role, role) {
+					return 0, itemError("Email is already used by another user")
+				}
+				user = existing
+				user.ExternalID = &externalID
+				row.Action = ImportLinked
+				row.Changes = append(row.Changes, "external_id")
+			}
+		}
+	default:
+		return 0, err
+	}
+
+	if user.ID == 0 {
+		if err := im.newUser(tx, rec, row, role, email, &user); err != nil {
+			return 0, err
+		}
+	} else {
+		if rec.get("username") != "" && rec.get("username") != user.Username {
+			row.Warnings = append(row.Warnings, "username of an existing user is not changed")
+		}
+		changeField(row, "last_name", &user.LastName, rec.get("last_name"))
+		changeField(row, "first_name", &user.FirstName, rec.get("first_name"))
+		changeField(row, "middle_name", &user.MiddleName, rec.get("middle_name"))
+		if role == "teacher" {
+			changeField(row, "subject", &user.TeacherSubject, rec.get("subject"))
+		}
+		if email != "" && email != user.Email {
+			var count int64
+			tx.Unscoped().Model(&models.User{}).Where("email = ? AND id <> ?", email, user.ID).Count(&count)
+			if count > 0 {
+				return 0, itemError("Email is already used by another user")
+			}
+			changeField(row, "email", &user.Email, email)
+		}
+		if len(row.Changes) > 0 {
+			if err := tx.Save(&user).Error; err != nil {
+				return 0, err
+			}
+			if row.Action == ImportUnchanged {
+				row.Action = ImportUpdated
+			}
+		}
+		row.Username = user.Username
+	}
+
+	switch role {
+	case "student":
+		if err := im.enroll(tx, rec, row, &user); err != nil {
+			return 0, err
+		}
+	case "parent":
+		if err := im.linkChildren(tx, rec, row, &user); err != nil {
+			return 0, err
+		}
+	}
+	return user.ID, nil
+}
+
+// newUser создаёт пользователя, генерируя логин и начальный пароль, если их нет в файле
+func (im *importer) newUser(tx *gorm.DB, rec importRecord, row *ImportRow, role, email string, user *models.User) error {
+	externalID := rec.get("external_id")
+
+	username := rec.get("username")
+	if username != "" {
+		if len(username) < 3 || len(username) > 50 {
+			return itemError("username must be 3 to 50 characters")
+		}
+		var count int64
+		tx.Unscoped().Model(&models.User{}).Where("username = ?", username).Count(&count)
+		if count > 0 {
+			return itemError("Username is already taken: %s", username)
+		}
+	} else {
+		generated, err := generateUsername(tx, rec.get("last_name"), rec.get("first_name"), rec.get("middle_name"))
+		if err != nil {
+			return err
+		}
+		username = generated
+	}
+
+	password := rec.get("password")
+	if password != "" && len(password) < 6 {
+		return itemError("password must be at least 6 characters")
+	}
+	if password == "" {
+		generated, err := generatePassword()
+		if err != nil {
+			return err
+		}
+		password = generated
+		row.Password = generated
+	}
+
+	if email == "" {
+		email = username + "@" + importEmailDomain
+		row.Warnings = append(row.Warnings, "no email, placeholder address used")
+	} else {
+		var count int64
+		tx.Unscoped().Model(&models.User{}).Where("email = ?", email).Count(&count)
+		if count > 0 {
+			return itemError("Email is already used by another user")
+		}
+	}
+
+	*user = models.User{
+		SchoolID:     im.schoolID,
+		ExternalID:   &externalID,
+		Username:     username,
+		Email:        email,
+		PasswordHash: password, // Пароль хранится так же, как при регистрации
+		Role:         role,
+		FirstName:    rec.get("first_name"),
+		LastName:     rec.get("last_name"),
+		MiddleName:   rec.get("middle_name"),
+	}
+	if role == "teacher" {
+		user.TeacherSubject = rec.get("subject")
+	}
+	if err := tx.Create(user).Error; err != nil {
+		return err
+	}
+
+	row.Action = ImportCreated
+	row.Username = username
+	return nil
+}
+
+// enroll зачисляет ученика в класс из столбца class
+func (im *importer) enroll(tx *gorm.DB, rec importRecord, row *ImportRow, student *models.User) error {
+	name := rec.get("class")
+	if name == "" {
+		return nil
+	}
+
+	class, err := im.findClass(tx, name, rec.get("year"))
+	if err != nil {
+		return err
+	}
+
+	var count int64
+	tx.Table("class_students").Where("class_id = ? AND user_id = ?", class.ID, student.ID).Count(&count)
+	if count > 0 {
+		return nil
+	}
+	if err := tx.Table("class_students").Create(map[string]interface{}{"class_id": class.ID, "user_id": student.ID}).Error; err != nil {
+		return err
+	}
+	row.Changes = append(row.Changes, "class "+class.Name)
+	if row.Action == ImportUnchanged {
+		row.Action = ImportUpdated
+	}
+	return nil
+}
+
+// findClass ищет класс школы по названию и, если указан, учебному году
+func (im *importer) findClass(tx *gorm.DB, name, year string) (*models.Class, error) {
+	query := tx.Where("school_id = ? AND LOWER(name) = LOWER(?)", im.schoolID, name)
+	if year != "" {
+		query = query.Where("year = ?", year)
+	}
+
+	var classes []models.Class
+	if err := query.Limit(2).Find(&classes).Error; err != nil {
+		return nil, err
+	}
+	switch len(classes) {
+	case 0:
+		if year != "" {
+			return nil, itemError("Unknown class: %s (%s)", name, year)
+		}
+		return nil, itemError("Unknown class: %s", name)
+	case 1:
+		return &classes[0], nil
+	default:
+		return nil, itemError("Class %s exists in several years, add a year column", name)
+	}
+}
+
+// linkChildren связывает родителя с учениками из столбца children
+func (im *importer) linkChildren(tx *gorm.DB, rec importRecord, row *ImportRow, parent *models.User) error {
+	children := strings.FieldsFunc(rec.get("children"), func(r rune) bool {
+		return r == ';' || r == ',' || r == ' '
+	})
+	for _, childID := range children {
+		student, err := im.findStudent(tx, childID)
+		if err != nil {
+			return err
+		}
+		created, err := linkParent(tx, parent.ID, student.ID)
+		if err != nil {
+			return err
+		}
+		if created {
+			row.Changes = append(row.Changes, "child "+childID)
+			if row.Action == ImportUnchanged {
+				row.Action = ImportUpdated
+			}
+		}
+	}
+	return nil
+}
+
+// importClass создаёт или обновляет класс по external_id
+func (im *importer) importClass(tx *gorm.DB, rec importRecord, row *ImportRow) (uint, error) {
+	externalID := rec.get("external_id")
+	name := rec.get("name")
+	year := rec.get("year")
+
+	var homeroomID *uint
+	if ref := rec.get("homeroom_teacher"); ref != "" {
+		var teacher models.User
+		if err := tx.Where("school_id = ? AND role = ? AND (external_id = ? OR username = ?)",
+			im.schoolID, "teacher", ref, ref).First(&teacher).Error; err != nil {
+			return 0, itemError("Unknown homeroom teacher: %s", ref)
+		}
+		homeroomID = &teacher.ID
+	}
+
+	var class models.Class
+	err := tx.Unscoped().Where("school_id = ? AND external_id = ?", im.schoolID, externalID).First(&class).Error
+	switch {
+	case err == nil:
+		if class.DeletedAt.Valid {
+			return 0, itemError("Class with this external_id was deleted")
+		}
+		row.Action = ImportUnchanged
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		// Класс, созданный до импорта, связывается по названию и году
+		if err := tx.Where("school_id = ? AND name = ? AND year = ? AND external_id IS NULL",
+			im.schoolID, name, year).First(&class).Error; err == nil {
+			class.ExternalID = &externalID
+			row.Action = ImportLinked
+			row.Changes = append(row.Changes, "external_id")
+		}
+	default:
+		return 0, err
+	}
+
+	if class.ID == 0 {
+		class = models.Class{
+			SchoolID:          im.schoolID,
+			ExternalID:        &externalID,
+			Name:              name,
+			Year:              year,
+			HomeroomTeacherID: homeroomID,
+		}
+		if err := tx.Create(&class).Error; err != nil {
+			return 0, err
+		}
+		row.Action = ImportCreated
+		return class.ID, nil
+	}
+
+	changeField(row, "name", &class.Name, name)
+	changeField(row, "year", &class.Year, year)
+	if homeroomID != nil && (class.HomeroomTeacherID == nil || *class.HomeroomTeacherID != *homeroomID) {
+		class.HomeroomTeacherID = homeroomID
+		row.Changes = append(row.Changes, "homeroom_teacher")
+	}
+	if len(row.Changes) > 0 {
+		if err := tx.Omit(clause.Associations).Save(&class).Error; err != nil {
+			return 0, err
+		}
+		if row.Action == ImportUnchanged {
+			row.Action = ImportUpdated
+		}
+	}
+	return class.ID, nil
+}
+
+// importParentLink связывает родителя и ученика по их external_id
+func (im *importer) importParentLink(tx *gorm.DB, rec importRecord, row *ImportRow) (uint, error) {
+	var parent models.User
+	if err := tx.Where("school_id = ? AND role = ? AND external_id = ?",
+		im.schoolID, "parent", rec.get("parent")).First(&parent).Error; err != nil {
+		return 0, itemError("Unknown parent: %s", rec.get("parent"))
+	}
+	student, err := im.findStudent(tx, rec.get("student"))
+	if err != nil {
+		return 0, err
+	}
+
+	created, err := linkParent(tx, parent.ID, student.ID)
+	if err != nil {
+		return 0, err
+	}
+	row.Action = ImportUnchanged
+	if created {
+		row.Action = ImportCreated
+	}
+	return parent.ID, nil
+}
+
+// findStudent ищет ученика школы по external_id
+func (im *importer) findStudent(tx *gorm.DB, externalID string) (*models.User, error) {
+	var student models.User
+	if err := tx.Where("school_id = ? AND role IN ? AND external_id = ?",
+		im.schoolID, []string{"student", "starosta"}, externalID).First(&student).Error; err != nil {
+		return nil, itemError("Unknown student: %s", externalID)
+	}
+	return &student, nil
+}
+
+// linkParent создаёт связь родитель-ученик, если её ещё нет
+func linkParent(tx *gorm.DB, parentID, studentID uint) (bool, error) {
+	var count int64
+	tx.Model(&models.ParentStudent{}).Where("parent_id = ? AND student_id = ?", parentID, studentID).Count(&count)
+	if count > 0 {
+		return false, nil
+	}
+	link := models.ParentStudent{ParentID: parentID, StudentID: studentID}
+	if err := tx.Omit(clause.Associations).Create(&link).Error; err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// changeField обновляет поле, если в файле указано новое значение
+func changeField(row *ImportRow, name string, field *string, value string) {
+	if value == "" || value == *field {
+		return
+	}
+	*field = value
+	row.Changes = append(row.Changes, name)
+}
+
+// sameImportRole: староста импортируется как ученик
+func sameImportRole(existing, role string) bool {
+	return existing == role || (existing == "starosta" && role == "student")
+}
+
+// validEmail проверяет, что строка - голый адрес без имени
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
+
+// generateUsername строит логин из транслитерации ФИО (ivanov.ps) и добавляет
+// номер, если логин занят
+func generateUsername(tx *gorm.DB, lastName, firstName, middleName string) (string, error) {
+	base := transliterate(lastName)
+	initials := ""
+	for _, part := range []string{firstName, middleName} {
+		if t := transliterate(part); t != "" {
+			initials += t[:1]
+		}
+	}
+	if initials != "" {
+		base += "." + initials
+	}
+	base = strings.Trim(base, ".")
+	if len(base) > 40 {
+		base = base[:40]
+	}
+	for len(base) < 3 {
+		base += "0"
+	}
+
+	for n := 1; n < 1000; n++ {
+		candidate := base
+		if n > 1 {
+			candidate = fmt.Sprintf("%s%d", base, n)
+		}
+		var count int64
+		if err := tx.Unscoped().Model(&models.User{}).Where("username = ?", candidate).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+	}
+	return "", itemError("Failed to generate a unique username")
+}
+
+// translitTable - транслитерация кириллицы (как в загранпаспортах)
+var translitTable = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "i", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "ie", 'ы': "y", 'ь': "", 'э': "e", 'ю': "iu",
+	'я': "ia",
+}
+
+// transliterate переводит строку в латиницу, оставляя только a-z и цифры
+func transliterate(s string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			sb.WriteRune(r)
+		default:
+			sb.WriteString(translitTable[r])
+		}
+	}
+	return sb.String()
+}
+
+// generatePassword создаёт случайный начальный пароль
+func generatePassword() (string, error) {
+	b := make([]byte, initialPasswordLength)
+	max := big.NewInt(int64(len(passwordAlphabet)))
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = passwordAlphabet[n.Int64()]
+	}
+	return string(b), nil
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"classkeeper/internal/integrity"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Режимы исправления проблем целостности
+const (
+	RepairModeDryRun = "dry_run" // Только показать, что будет исправлено
+	RepairModeApply  = "apply"
+)
+
+// IntegrityHandler - проверка целостности данных школы и исправление найденных проблем
+type IntegrityHandler struct{}
+
+func NewIntegrityHandler() *IntegrityHandler {
+	return &IntegrityHandler{}
+}
+
+// CheckIntegrity проверяет данные школы. checks - виды проблем через запятую
+// (по умолчанию все).
+func (h *IntegrityHandler) CheckIntegrity(c *gin.Context) {
+	schoolID, _ := c.Get("school_id")
+
+	report, err := integrity.Check(db(c), schoolID.(uint), integrityChecks(c)...)
+	if errors.Is(err, integrity.ErrUnknownCheck) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Integrity check of school %v failed: %v", schoolID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check data integrity"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"report": report, "available_checks": integrity.Checks})
+}
+
+// RepairIntegrity исправляет проблемы школы так, как предлагает проверка. По умолчанию
+// (mode=dry_run) только показывает исправления и проблемы, которые останутся после них;
+// mode=apply применяет исправления.
+func (h *IntegrityHandler) RepairIntegrity(c *gin.Context) {
+	mode := c.DefaultQuery("mode", RepairModeDryRun)
+	if mode != RepairModeDryRun && mode != RepairModeApply {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mode (use dry_run or apply)"})
+		return
+	}
+	schoolID, _ := c.Get("school_id")
+
+	result, err := integrity.Repair(db(c), schoolID.(uint), integrity.RepairOptions{
+		DryRun: mode == RepairModeDryRun,
+		Checks: integrityChecks(c),
+	})
+	if errors.Is(err, integrity.ErrUnknownCheck) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Integrity repair of school %v failed: %v", schoolID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to repair data"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"result": result})
+}
+
+func integrityChecks(c *gin.Context) []string {
+	var checks []string
+	for _, check := range strings.Split(c.Query("checks"), ",") {
+		if check = strings.TrimSpace(check); check != "" {
+			checks = append(checks, check)
+		}
+	}
+	return checks
+}
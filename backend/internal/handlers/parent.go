@@ -55,7 +55,7 @@ func (h *ParentHandler) LinkParentToStudent(c *gin.Context) {
 
 	// Проверяем, не связаны ли они уже
 	var count int64
-	database.DB.Table("parent_students").
+	database.DB.Model(&models.ParentStudent{}).
 		Where("parent_id = ? AND student_id = ?", req.ParentID, req.StudentID).
 		Count(&count)
 	
@@ -65,8 +65,8 @@ func (h *ParentHandler) LinkParentToStudent(c *gin.Context) {
 	}
 
 	// Создаём связь
-	if err := database.DB.Exec("INSERT INTO parent_students (parent_id, student_id) VALUES (?, ?)", 
-		req.ParentID, req.StudentID).Error; err != nil {
+	link := models.ParentStudent{ParentID: req.ParentID, StudentID: req.StudentID}
+	if err := db(c).Create(&link).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create link"})
 		return
 	}
@@ -96,8 +96,8 @@ func (h *ParentHandler) UnlinkParentFromStudent(c *gin.Context) {
 	}
 
 	// Удаляем связь
-	if err := database.DB.Exec("DELETE FROM parent_students WHERE parent_id = ? AND student_id = ?", 
-		parentID, studentID).Error; err != nil {
+	if err := db(c).Where("parent_id = ? AND student_id = ?", parentID, studentID).
+		Delete(&models.ParentStudent{}).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlink"})
 		return
 	}
@@ -123,7 +123,7 @@ func (h *ParentHandler) GetParentChildren(c *gin.Context) {
 	// Получаем детей
 	var children []models.User
 	database.DB.Table("users").
-		Joins("JOIN parent_students ON parent_students.student_id = users.id").
+		Joins("JOIN parent_students ON parent_students.student_id = users.id AND parent_students.deleted_at IS NULL").
 		Where("parent_students.parent_id = ?", parentID).
 		Preload("School").
 		Find(&children)
@@ -142,7 +142,7 @@ func (h *ParentHandler) GetStudentParents(c *gin.Context) {
 	// Получаем родителей
 	var parents []models.User
 	database.DB.Table("users").
-		Joins("JOIN parent_students ON parent_students.parent_id = users.id").
+		Joins("JOIN parent_students ON parent_students.parent_id = users.id AND parent_students.deleted_at IS NULL").
 		Where("parent_students.student_id = ?", studentID).
 		Find(&parents)
 
@@ -164,7 +164,7 @@ func (h *ParentHandler) GetChildGrades(c *gin.Context) {
 	if role == "parent" {
 		// Проверяем что это действительно ребёнок родителя
 		var count int64
-		database.DB.Table("parent_students").
+		database.DB.Model(&models.ParentStudent{}).
 			Where("parent_id = ? AND student_id = ?", userID, childID).
 			Count(&count)
 		
@@ -212,7 +212,7 @@ func (h *ParentHandler) GetChildAttendance(c *gin.Context) {
 	// Проверяем право доступа
 	if role == "parent" {
 		var count int64
-		database.DB.Table("parent_students").
+		database.DB.Model(&models.ParentStudent{}).
 			Where("parent_id = ? AND student_id = ?", userID, childID).
 			Count(&count)
 		
@@ -226,7 +226,8 @@ func (h *ParentHandler) GetChildAttendance(c *gin.Context) {
 	dateTo := c.Query("date_to")
 
 	query := database.DB.Where("student_id = ?", childID).
-		Preload("Schedule.Subject")
+		Preload("Schedule").
+		Preload("Subject")
 
 	if dateFrom != "" {
 		query = query.Where("date >= ?", dateFrom)
@@ -289,7 +290,7 @@ func (h *ParentHandler) GetChildHomework(c *gin.Context) {
 	// Проверяем право доступа
 	if role == "parent" {
 		var count int64
-		database.DB.Table("parent_students").
+		database.DB.Model(&models.ParentStudent{}).
 			Where("parent_id = ? AND student_id = ?", userID, childID).
 			Count(&count)
 		
@@ -312,9 +313,8 @@ func (h *ParentHandler) GetChildHomework(c *gin.Context) {
 
 	// Получаем ДЗ классов
 	var homework []models.Homework
-	database.DB.Joins("JOIN schedules ON schedules.id = homeworks.schedule_id").
-		Where("schedules.class_id IN ?", classIDs).
-		Preload("Schedule.Subject").
+	database.DB.Where("class_id IN ?", classIDs).
+		Preload("Subject").
 		Preload("Teacher").
 		Order("homeworks.due_date ASC").
 		Limit(50).
@@ -57,7 +57,7 @@ func (h *ParentStudentHandler) CreateLink(c *gin.Context) {
 		StudentID: req.StudentID,
 	}
 
-	if err := database.DB.Create(&link).Error; err != nil {
+	if err := db(c).Create(&link).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create link"})
 		return
 	}
@@ -103,7 +103,7 @@ func (h *ParentStudentHandler) DeleteLink(c *gin.Context) {
 		return
 	}
 
-	if err := database.DB.Delete(&link).Error; err != nil {
+	if err := db(c).Delete(&link).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete link"})
 		return
 	}
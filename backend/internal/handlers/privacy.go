@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"classkeeper/internal/audit"
+	"classkeeper/internal/config"
+	"classkeeper/internal/database"
+	"classkeeper/internal/models"
+	"classkeeper/internal/privacy"
+	"classkeeper/internal/storage"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PrivacyHandler - запросы субъектов персональных данных: выгрузка и обезличивание
+type PrivacyHandler struct {
+	cfg   *config.Config
+	store storage.Backend
+}
+
+func NewPrivacyHandler(cfg *config.Config, store storage.Backend) *PrivacyHandler {
+	return &PrivacyHandler{cfg: cfg, store: store}
+}
+
+// AnonymizeRequest - подтверждение обезличивания логином пользователя
+type AnonymizeRequest struct {
+	Confirm string `json:"confirm" binding:"required"`
+	Reason  string `json:"reason"`
+}
+
+// subject возвращает пользователя школы (включая удалённых) из параметра :id
+func (h *PrivacyHandler) subject(c *gin.Context) (*models.User, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return nil, false
+	}
+	schoolID, _ := c.Get("school_id")
+
+	var user models.User
+	if err := database.DB.Unscoped().Where("id = ? AND school_id = ?", id, schoolID).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	return &user, true
+}
+
+// ExportUserData выгружает ZIP-архив со всеми данными ученика или родителя.
+// Доступно админу школы, самому пользователю и родителю ученика.
+func (h *PrivacyHandler) ExportUserData(c *gin.Context) {
+	user, ok := h.subject(c)
+	if !ok {
+		return
+	}
+	userID, _ := c.Get("user_id")
+	role, _ := c.Get("role")
+	if role != "admin" && userID.(uint) != user.ID {
+		if role != "parent" || !canViewStudent(c, user.ID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+			return
+		}
+	}
+
+	tmp, err := os.CreateTemp("", "classkeeper-personal-*.zip")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export personal data"})
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	manifest, err := privacy.Export(c.Request.Context(), database.DB, h.store, user.ID, tmp)
+	if err != nil {
+		log.Printf("Personal data export of user %d failed: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export personal data"})
+		return
+	}
+	if err := audit.Record(db(c), user.SchoolID, audit.ActionExport, "users", user.ID, nil); err != nil {
+		log.Printf("Failed to record personal data export of user %d: %v", user.ID, err)
+	}
+
+	c.FileAttachment(tmp.Name(), fmt.Sprintf("personal-data-%d-%s.zip", user.ID, manifest.CreatedAt.Format("20060102")))
+}
+
+// AnonymizeUser стирает персональные данные ученика или родителя. Оценки и
+// посещаемость остаются в статистике класса. Действие необратимо, поэтому в теле
+// запроса нужно повторить логин пользователя.
+func (h *PrivacyHandler) AnonymizeUser(c *gin.Context) {
+	user, ok := h.subject(c)
+	if !ok {
+		return
+	}
+	var req AnonymizeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Confirm != user.Username {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Confirmation does not match username"})
+		return
+	}
+
+	err := privacy.Anonymize(c.Request.Context(), database.DB, h.store, user.ID, req.Reason)
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, gin.H{"message": "User anonymized successfully"})
+	case errors.Is(err, privacy.ErrNotSubject):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only students and parents can be anonymized"})
+	case errors.Is(err, privacy.ErrAnonymized):
+		c.JSON(http.StatusConflict, gin.H{"error": "User is already anonymized"})
+	default:
+		log.Printf("Anonymization of user %d failed: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to anonymize user"})
+	}
+}
+
+// retentionYears - срок хранения из запроса (years) или из настроек
+func (h *PrivacyHandler) retentionYears(c *gin.Context) (int, bool) {
+	years := h.cfg.Privacy.GraduateRetentionYears
+	if value := c.Query("years"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid years"})
+			return 0, false
+		}
+		years = n
+	}
+	if years <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Retention period is not configured"})
+		return 0, false
+	}
+	return years, true
+}
+
+// GetRetention возвращает выпускников и выбывших учеников школы (и их родителей),
+// данные которых подлежат обезличиванию. Параметр years заменяет срок из настроек.
+func (h *PrivacyHandler) GetRetention(c *gin.Context) {
+	years, ok := h.retentionYears(c)
+	if !ok {
+		return
+	}
+	schoolID, _ := c.Get("school_id")
+
+	candidates, err := privacy.Candidates(database.DB, schoolID.(uint), years, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get retention candidates"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"years":      years,
+		"configured": h.cfg.Privacy.GraduateRetentionYears,
+		"candidates": candidates,
+	})
+}
+
+// RunRetention обезличивает данные, срок хранения которых истёк, не дожидаясь
+// ежедневного запуска
+func (h *PrivacyHandler) RunRetention(c *gin.Context) {
+	years, ok := h.retentionYears(c)
+	if !ok {
+		return
+	}
+	schoolID, _ := c.Get("school_id")
+
+	n, err := privacy.ApplyRetention(c.Request.Context(), database.DB, h.store, schoolID.(uint), years)
+	if err != nil {
+		log.Printf("Data retention of school %v failed: %v", schoolID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply retention", "anonymized": n})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"anonymized": n})
+}
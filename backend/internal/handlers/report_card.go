@@ -0,0 +1,712 @@
+package handlers
+
+import (
+	"archive/zip"
+	"classkeeper/internal/calendar"
+	"classkeeper/internal/config"
+	"classkeeper/internal/database"
+	"classkeeper/internal/models"
+	"classkeeper/internal/pdf"
+	"classkeeper/internal/storage"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"mime"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxLogoSize - логотип больше этого размера в табель не встраивается
+const maxLogoSize = 5 << 20
+
+// missedStatuses - статусы посещаемости, считающиеся пропуском урока
+var missedStatuses = map[string]bool{"absent": true, "sick": true, "excused": true}
+
+// ReportCardHandler формирует табели успеваемости в PDF
+type ReportCardHandler struct {
+	cfg   *config.Config
+	store storage.Backend
+
+	regular *pdf.Font
+	bold    *pdf.Font
+}
+
+func NewReportCardHandler(cfg *config.Config, store storage.Backend) *ReportCardHandler {
+	h := &ReportCardHandler{cfg: cfg, store: store, regular: pdf.Helvetica, bold: pdf.HelveticaBold}
+
+	// Встроенный шрифт гарантирует одинаковый вид табеля в любой программе просмотра
+	if path := cfg.Reports.FontPath; path != "" {
+		if font, err := loadReportFont(path); err != nil {
+			log.Printf("Warning: failed to load report font %s: %v, using Helvetica", path, err)
+		} else {
+			h.regular, h.bold = font, font
+		}
+	}
+	if path := cfg.Reports.BoldFontPath; path != "" && h.regular != pdf.Helvetica {
+		if font, err := loadReportFont(path); err != nil {
+			log.Printf("Warning: failed to load bold report font %s: %v", path, err)
+		} else {
+			h.bold = font
+		}
+	}
+	return h
+}
+
+func loadReportFont(path string) (*pdf.Font, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	font, err := pdf.ParseTrueType(data)
+	if err != nil {
+		return nil, err
+	}
+	if !font.HasGlyph('Я') {
+		return nil, errors.New("font has no Cyrillic glyphs")
+	}
+	return font, nil
+}
+
+// ReportCardCommentRequest - комментарий учителя в табель
+type ReportCardCommentRequest struct {
+	StudentID uint   `json:"student_id" binding:"required"`
+	SubjectID uint   `json:"subject_id"`                 // 0 - общий комментарий классного руководителя
+	Year      int    `json:"year"`                       // Год начала учебного года, по умолчанию текущий
+	Term      int    `json:"term" binding:"min=0"`       // Номер учебного периода, 0 - за год
+	Comment   string `json:"comment" binding:"max=2000"` // Пустой комментарий удаляет запись
+}
+
+// reportCard - данные табеля одного ученика
+type reportCard struct {
+	School     models.School
+	Student    models.User
+	Class      *models.Class
+	Homeroom   string
+	Year       int
+	Terms      []calendar.Term // Периоды, выводимые в табеле
+	TermCount  int             // Всего периодов в учебном году
+	Term       int             // 0 - годовой табель
+	From, To   time.Time       // Период, за который считаются средний балл и пропуски
+	Subjects   []reportSubject
+	Attendance reportAttendance
+	Comment    string // Общий комментарий классного руководителя
+	CommentBy  string
+	Issued     time.Time
+}
+
+// reportSubject - строка табеля по предмету
+type reportSubject struct {
+	ID        uint
+	Name      string
+	Marks     []string // Отметки за периоды
+	Annual    string
+	Average   float64
+	Count     int
+	Missed    int
+	Comment   string
+	CommentBy string // Автор комментария
+}
+
+// reportAttendance - сводка посещаемости за период табеля
+type reportAttendance struct {
+	Total   int
+	Present int
+	Missed  int
+	Excused int // Пропуски по уважительной причине (в том числе болезнь)
+	Late    int
+}
+
+// Percent возвращает долю уроков без пропусков
+func (a reportAttendance) Percent() float64 {
+	if a.Total == 0 {
+		return 0
+	}
+	return float64(a.Total-a.Missed) / float64(a.Total) * 100
+}
+
+// reportPeriod - учебный год и период табеля из параметров year и term
+type reportPeriod struct {
+	Year  int
+	Term  int
+	Terms []calendar.Term
+}
+
+// parseReportPeriod читает year (по умолчанию текущий учебный год) и term (0 - годовой).
+// При ошибке пишет ответ.
+func parseReportPeriod(c *gin.Context, schoolID uint) (*reportPeriod, bool) {
+	start, _ := calendar.AcademicYear(time.Now())
+	period := &reportPeriod{Year: start.Year()}
+
+	if s := c.Query("year"); s != "" {
+		year, err := strconv.Atoi(s)
+		if err != nil || year < 2000 || year > 2100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid year (use the year the academic year starts, e.g. 2025)"})
+			return nil, false
+		}
+		period.Year = year
+	}
+	if s := c.Query("term"); s != "" {
+		term, err := strconv.Atoi(s)
+		if err != nil || term < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid term"})
+			return nil, false
+		}
+		period.Term = term
+	}
+
+	var err error
+	if period.Terms, err = academicTerms(schoolID, period.Year); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load school calendar"})
+		return nil, false
+	}
+	if period.Term > len(period.Terms) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Term not found (the academic year has %d terms)", len(period.Terms))})
+		return nil, false
+	}
+	return period, true
+}
+
+// academicTerms возвращает учебные периоды года, начинающегося в year
+func academicTerms(schoolID uint, year int) ([]calendar.Term, error) {
+	from, to := calendar.AcademicYear(time.Date(year, time.September, 1, 0, 0, 0, 0, time.UTC))
+	return calendar.Terms(database.DB, schoolID, from, to)
+}
+
+// StudentReportCard возвращает табель ученика в PDF (?year=2025&term=1, без term - годовой)
+func (h *ReportCardHandler) StudentReportCard(c *gin.Context) {
+	studentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid student ID"})
+		return
+	}
+
+	schoolID, _ := c.Get("school_id")
+
+	var student models.User
+	if err := database.DB.Where("id = ? AND school_id = ? AND role IN ?", studentID, schoolID, []string{"student", "starosta"}).
+		First(&student).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+		return
+	}
+	if !canViewStudent(c, student.ID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	period, ok := parseReportPeriod(c, student.SchoolID)
+	if !ok {
+		return
+	}
+
+	var school models.School
+	database.DB.First(&school, student.SchoolID)
+
+	card, err := loadReportCard(school, student, studentClass(student.ID, period.Year), period)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load report card data"})
+		return
+	}
+
+	doc := h.newDocument(card)
+	h.renderReportCard(doc, card, h.schoolLogo(c, school))
+
+	c.Header("Content-Type", "application/pdf")
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": reportCardFileName(card) + ".pdf",
+	}))
+	if err := doc.Write(c.Writer); err != nil {
+		c.Error(err)
+	}
+}
+
+// ClassReportCards возвращает ZIP-архив с табелями всех учеников класса
+func (h *ReportCardHandler) ClassReportCards(c *gin.Context) {
+	classID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid class ID"})
+		return
+	}
+
+	schoolID, _ := c.Get("school_id")
+
+	var class models.Class
+	if err := database.DB.Where("id = ? AND school_id = ?", classID, schoolID).
+		Preload("HomeroomTeacher").First(&class).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Class not found"})
+		return
+	}
+
+	period, ok := parseReportPeriod(c, class.SchoolID)
+	if !ok {
+		return
+	}
+
+	students := classStudents(class.ID)
+	if len(students) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Class has no students"})
+		return
+	}
+
+	var school models.School
+	database.DB.First(&school, class.SchoolID)
+
+	// Данные собираем заранее, чтобы ошибка не оборвала уже начатый архив
+	cards := make([]*reportCard, len(students))
+	for i, student := range students {
+		if cards[i], err = loadReportCard(school, student, &class, period); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load report card data"})
+			return
+		}
+	}
+	logo := h.schoolLogo(c, school)
+
+	name := fmt.Sprintf("report_cards_%s_%d", class.Name, period.Year)
+	if period.Term > 0 {
+		name += fmt.Sprintf("_term%d", period.Term)
+	}
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + ".zip"}))
+
+	zw := zip.NewWriter(c.Writer)
+	for i, card := range cards {
+		w, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     fmt.Sprintf("%02d_%s.pdf", i+1, reportCardFileName(card)),
+			Method:   zip.Deflate,
+			Modified: card.Issued,
+		})
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		doc := h.newDocument(card)
+		h.renderReportCard(doc, card, logo)
+		if err := doc.Write(w); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		c.Error(err)
+	}
+}
+
+// GetComments возвращает комментарии в табели (?student_id= или ?class_id=, year, term)
+func (h *ReportCardHandler) GetComments(c *gin.Context) {
+	schoolID, _ := c.Get("school_id")
+
+	start, _ := calendar.AcademicYear(time.Now())
+	year := start.Year()
+	if s := c.Query("year"); s != "" {
+		var err error
+		if year, err = strconv.Atoi(s); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid year"})
+			return
+		}
+	}
+
+	query := database.DB.Model(&models.ReportCardComment{}).
+		Joins("JOIN users ON users.id = report_card_comments.student_id").
+		Where("users.school_id = ? AND report_card_comments.year = ?", schoolID, year)
+
+	switch {
+	case c.Query("student_id") != "":
+		query = query.Where("report_card_comments.student_id = ?", c.Query("student_id"))
+	case c.Query("class_id") != "":
+		query = query.Where("report_card_comments.student_id IN (?)",
+			database.DB.Table("class_students").Select("user_id").Where("class_id = ?", c.Query("class_id")))
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "student_id or class_id is required"})
+		return
+	}
+	if term := c.Query("term"); term != "" {
+		query = query.Where("report_card_comments.term = ?", term)
+	}
+
+	var comments []models.ReportCardComment
+	if err := query.Preload("Teacher").
+		Order("report_card_comments.student_id, report_card_comments.term, report_card_comments.subject_id").
+		Find(&comments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch comments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"comments": comments, "year": year})
+}
+
+// SaveComment создаёт или заменяет комментарий в табель. Комментарий по предмету
+// пишет учитель этого предмета, общий - классный руководитель ученика.
+func (h *ReportCardHandler) SaveComment(c *gin.Context) {
+	var req ReportCardCommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	schoolID, _ := c.Get("school_id")
+	role, _ := c.Get("role")
+
+	var student models.User
+	if err := database.DB.Where("id = ? AND school_id = ? AND role IN ?", req.StudentID, schoolID, []string{"student", "starosta"}).
+		First(&student).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+		return
+	}
+
+	if req.SubjectID != 0 {
+		var subject models.Subject
+		if err := database.DB.Where("id = ? AND school_id = ?", req.SubjectID, schoolID).First(&subject).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Subject not found"})
+			return
+		}
+		if role == "teacher" {
+			var count int64
+			database.DB.Table("teachers_subjects").
+				Where("user_id = ? AND subject_id = ?", userID, req.SubjectID).
+				Count(&count)
+			if count == 0 {
+				c.JSON(http.StatusForbidden, gin.H{"error": "You don't teach this subject"})
+				return
+			}
+		}
+	} else if role == "teacher" {
+		var count int64
+		database.DB.Model(&models.Class{}).
+			Joins("JOIN class_students ON class_students.class_id = classes.id").
+			Where("class_students.user_id = ? AND classes.homeroom_teacher_id = ?", student.ID, userID).
+			Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only the homeroom teacher can write the general comment"})
+			return
+		}
+	}
+
+	if req.Year == 0 {
+		start, _ := calendar.AcademicYear(time.Now())
+		req.Year = start.Year()
+	}
+	if req.Year < 2000 || req.Year > 2100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid year"})
+		return
+	}
+	terms, err := academicTerms(student.SchoolID, req.Year)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load school calendar"})
+		return
+	}
+	if req.Term > len(terms) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Term not found (the academic year has %d terms)", len(terms))})
+		return
+	}
+
+	var comment models.ReportCardComment
+	err = database.DB.Where("student_id = ? AND subject_id = ? AND year = ? AND term = ?",
+		req.StudentID, req.SubjectID, req.Year, req.Term).First(&comment).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save comment"})
+		return
+	}
+	exists := err == nil
+
+	text := strings.TrimSpace(req.Comment)
+	if text == "" {
+		if exists {
+			db(c).Delete(&comment)
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Comment deleted"})
+		return
+	}
+
+	comment.StudentID = req.StudentID
+	comment.SubjectID = req.SubjectID
+	comment.Year = req.Year
+	comment.Term = req.Term
+	comment.TeacherID = userID.(uint)
+	comment.Comment = text
+	if err := db(c).Save(&comment).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save comment"})
+		return
+	}
+
+	status := http.StatusOK
+	if !exists {
+		status = http.StatusCreated
+	}
+	database.DB.Preload("Teacher").First(&comment, comment.ID)
+	c.JSON(status, gin.H{"comment": comment})
+}
+
+// canViewStudent - данные ученика видят админ и учителя школы, сам ученик и его родители
+func canViewStudent(c *gin.Context, studentID uint) bool {
+	userID, _ := c.Get("user_id")
+	role, _ := c.Get("role")
+
+	switch role {
+	case "admin", "teacher":
+		return true
+	case "parent":
+		var count int64
+		database.DB.Model(&models.ParentStudent{}).
+			Where("parent_id = ? AND student_id = ?", userID, studentID).
+			Count(&count)
+		return count > 0
+	}
+	return userID.(uint) == studentID
+}
+
+// studentClass возвращает класс ученика в учебном году (или последний его класс)
+func studentClass(studentID uint, year int) *models.Class {
+	var classes []models.Class
+	database.DB.Joins("JOIN class_students ON class_students.class_id = classes.id").
+		Where("class_students.user_id = ?", studentID).
+		Preload("HomeroomTeacher").
+		Order("classes.id DESC").
+		Find(&classes)
+	if len(classes) == 0 {
+		return nil
+	}
+
+	label := fmt.Sprintf("%d-%d", year, year+1)
+	for i := range classes {
+		if strings.ReplaceAll(classes[i].Year, "/", "-") == label {
+			return &classes[i]
+		}
+	}
+	return &classes[0]
+}
+
+// loadReportCard собирает оценки, пропуски и комментарии ученика за период табеля
+func loadReportCard(school models.School, student models.User, class *models.Class, period *reportPeriod) (*reportCard, error) {
+	yearFrom, yearTo := calendar.AcademicYear(time.Date(period.Year, time.September, 1, 0, 0, 0, 0, time.UTC))
+	card := &reportCard{
+		School:    school,
+		Student:   student,
+		Class:     class,
+		Year:      period.Year,
+		Terms:     period.Terms,
+		TermCount: len(period.Terms),
+		Term:      period.Term,
+		From:      yearFrom,
+		To:        yearTo,
+		Issued:    time.Now(),
+	}
+	if period.Term > 0 {
+		card.Terms = period.Terms[:period.Term]
+		card.From, card.To = period.Terms[period.Term-1].From, period.Terms[period.Term-1].To
+	}
+	if class != nil && class.HomeroomTeacher != nil {
+		card.Homeroom = fullName(class.HomeroomTeacher)
+	}
+
+	subjects := make(map[uint]*reportSubject)
+	subject := func(id uint) *reportSubject {
+		if subjects[id] == nil {
+			subjects[id] = &reportSubject{ID: id}
+		}
+		return subjects[id]
+	}
+
+	// Предметы из расписания класса
+	if class != nil {
+		var schedules []models.Schedule
+		if err := database.DB.Where("class_id = ?", class.ID).Find(&schedules).Error; err != nil {
+			return nil, err
+		}
+		for _, s := range schedules {
+			subject(s.SubjectID)
+		}
+	}
+
+	// Оценки с начала года: нужны отметки за все предыдущие периоды
+	var grades []models.Grade
+	if err := database.DB.Where("student_id = ? AND date BETWEEN ? AND ?", student.ID, yearFrom, card.To).
+		Order("date, id").Find(&grades).Error; err != nil {
+		return nil, err
+	}
+	byTerm := make(map[uint][][]models.Grade)
+	for _, g := range grades {
+		rs := subject(g.SubjectID)
+		if byTerm[g.SubjectID] == nil {
+			byTerm[g.SubjectID] = make([][]models.Grade, len(card.Terms))
+		}
+		if t, ok := calendar.TermOf(card.Terms, g.Date); ok {
+			byTerm[g.SubjectID][t.Number-1] = append(byTerm[g.SubjectID][t.Number-1], g)
+		}
+		if !g.Date.Before(card.From) {
+			rs.Average += float64(g.Grade)
+			rs.Count++
+		}
+	}
+
+	var attendance []models.Attendance
+	if err := database.DB.Where("student_id = ? AND date BETWEEN ? AND ?", student.ID, card.From, card.To).
+		Find(&attendance).Error; err != nil {
+		return nil, err
+	}
+	for _, a := range attendance {
+		card.Attendance.Total++
+		switch {
+		case missedStatuses[a.Status]:
+			card.Attendance.Missed++
+			if a.Status != "absent" {
+				card.Attendance.Excused++
+			}
+			if a.SubjectID != nil {
+				subject(*a.SubjectID).Missed++
+			}
+		case a.Status == "late":
+			card.Attendance.Late++
+			card.Attendance.Present++
+		default:
+			card.Attendance.Present++
+		}
+	}
+
+	var comments []models.ReportCardComment
+	if err := database.DB.Where("student_id = ? AND year = ? AND term = ?", student.ID, period.Year, period.Term).
+		Preload("Teacher").Find(&comments).Error; err != nil {
+		return nil, err
+	}
+	for _, cm := range comments {
+		if cm.SubjectID == 0 {
+			card.Comment, card.CommentBy = cm.Comment, fullName(&cm.Teacher)
+		} else {
+			rs := subject(cm.SubjectID)
+			rs.Comment, rs.CommentBy = cm.Comment, fullName(&cm.Teacher)
+		}
+	}
+
+	ids := make([]uint, 0, len(subjects))
+	for id := range subjects {
+		ids = append(ids, id)
+	}
+	if len(ids) > 0 {
+		var rows []models.Subject
+		if err := database.DB.Where("id IN ? AND school_id = ?", ids, school.ID).Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			subjects[row.ID].Name = row.Name
+		}
+	}
+
+	for _, rs := range subjects {
+		// Предметы чужой или удалённой школы не выводим
+		if rs.Name == "" {
+			continue
+		}
+		if rs.Count > 0 {
+			rs.Average /= float64(rs.Count)
+		}
+		rs.Marks = make([]string, len(card.Terms))
+		var sum, count int
+		for i := range card.Terms {
+			var termGrades []models.Grade
+			if byTerm[rs.ID] != nil {
+				termGrades = byTerm[rs.ID][i]
+			}
+			if mark, ok := termMark(termGrades); ok {
+				rs.Marks[i] = strconv.Itoa(mark)
+				sum += mark
+				count++
+			}
+		}
+		if card.annual() && count > 0 {
+			rs.Annual = strconv.Itoa(int(math.Round(float64(sum) / float64(count))))
+		}
+		card.Subjects = append(card.Subjects, *rs)
+	}
+	sort.Slice(card.Subjects, func(a, b int) bool { return card.Subjects[a].Name < card.Subjects[b].Name })
+	return card, nil
+}
+
+// annual - выводится ли годовая отметка (годовой табель или табель за последний период)
+func (card *reportCard) annual() bool {
+	return card.Term == 0 || card.Term == card.TermCount
+}
+
+// termMark возвращает отметку за период: итоговую оценку (grade_type final),
+// если учитель её выставил, иначе округлённый средний балл
+func termMark(grades []models.Grade) (int, bool) {
+	if len(grades) == 0 {
+		return 0, false
+	}
+	sum := 0
+	for i := len(grades) - 1; i >= 0; i-- {
+		if grades[i].GradeType == "final" {
+			return grades[i].Grade, true
+		}
+		sum += grades[i].Grade
+	}
+	return int(math.Round(float64(sum) / float64(len(grades)))), true
+}
+
+// fullName возвращает "Фамилия Имя Отчество"
+func fullName(u *models.User) string {
+	name := strings.Join(strings.Fields(u.LastName+" "+u.FirstName+" "+u.MiddleName), " ")
+	if name == "" {
+		return u.Username
+	}
+	return name
+}
+
+// reportCardFileName возвращает имя файла табеля без расширения
+func reportCardFileName(card *reportCard) string {
+	name := strings.Join(strings.Fields(card.Student.LastName+" "+card.Student.FirstName), "_")
+	if name == "" {
+		name = card.Student.Username
+	}
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if card.Term > 0 {
+		return fmt.Sprintf("%s_%d_term%d", name, card.Year, card.Term)
+	}
+	return fmt.Sprintf("%s_%d", name, card.Year)
+}
+
+// schoolLogo загружает логотип школы из хранилища вложений.
+// Внешние ссылки не скачиваются; без логотипа табель формируется без него.
+func (h *ReportCardHandler) schoolLogo(c *gin.Context, school models.School) *pdf.Image {
+	if school.LogoURL == "" {
+		return nil
+	}
+
+	var attachment models.Attachment
+	if err := database.DB.Where("school_id = ? AND owner_type = ? AND owner_id = ?",
+		school.ID, AttachmentSchoolLogo, school.ID).First(&attachment).Error; err != nil {
+		return nil
+	}
+	if attachment.Backend != h.store.Name() || attachment.Size > maxLogoSize {
+		return nil
+	}
+
+	reader, err := h.store.Get(c.Request.Context(), attachment.StorageKey)
+	if err != nil {
+		return nil
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(io.LimitReader(reader, maxLogoSize))
+	if err != nil {
+		return nil
+	}
+	logo, err := pdf.ParseImage(data)
+	if err != nil {
+		log.Printf("School %d logo is not embeddable in report cards: %v", school.ID, err)
+		return nil
+	}
+	return logo
+}
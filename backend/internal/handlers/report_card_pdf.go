@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"classkeeper/internal/pdf"
+	"fmt"
+	"strings"
+)
+
+// Поля страницы табеля
+const (
+	reportMargin = 40.0
+	reportBottom = pdf.PageHeight - 50
+	reportWidth  = pdf.PageWidth - 2*reportMargin
+)
+
+// termNames - название учебного периода по их числу в году
+var termNames = map[int]string{2: "полугодие", 3: "триместр", 4: "четверть"}
+
+func termName(count int) string {
+	if name, ok := termNames[count]; ok {
+		return name
+	}
+	return "период"
+}
+
+// newDocument создаёт документ для табеля с метаданными
+func (h *ReportCardHandler) newDocument(card *reportCard) *pdf.Document {
+	doc := pdf.New()
+	doc.SetInfo("Табель успеваемости: "+fullName(&card.Student), card.School.Name)
+	return doc
+}
+
+// reportPage - вывод табеля с переносом на новые страницы
+type reportPage struct {
+	doc     *pdf.Document
+	regular *pdf.Font
+	bold    *pdf.Font
+	y       float64
+}
+
+// ensure начинает новую страницу, если до нижнего поля осталось меньше height
+func (p *reportPage) ensure(height float64) bool {
+	if p.y+height <= reportBottom {
+		return false
+	}
+	p.doc.AddPage()
+	p.y = reportMargin
+	return true
+}
+
+// paragraph выводит текст с переносом строк
+func (p *reportPage) paragraph(font *pdf.Font, size float64, x float64, text string) {
+	p.doc.SetFont(font, size)
+	for _, line := range p.doc.SplitText(text, reportMargin+reportWidth-x) {
+		p.ensure(size * 1.4)
+		p.y += size * 1.4
+		p.doc.Text(x, p.y, line)
+	}
+}
+
+// heading выводит заголовок раздела
+func (p *reportPage) heading(text string) {
+	p.ensure(40)
+	p.y += 24
+	p.doc.SetFont(p.bold, 12)
+	p.doc.Text(reportMargin, p.y, text)
+	p.y += 4
+}
+
+// centered выводит строку по центру страницы
+func (p *reportPage) centered(font *pdf.Font, size float64, text string) {
+	p.doc.SetFont(font, size)
+	p.y += size * 1.5
+	p.doc.Text((pdf.PageWidth-p.doc.TextWidth(text))/2, p.y, text)
+}
+
+// renderReportCard выводит табель ученика: шапку школы, оценки по предметам,
+// посещаемость, комментарии учителей и место для подписей
+func (h *ReportCardHandler) renderReportCard(doc *pdf.Document, card *reportCard, logo *pdf.Image) {
+	doc.AddPage()
+	p := &reportPage{doc: doc, regular: h.regular, bold: h.bold, y: reportMargin}
+
+	// Шапка: логотип, название и контакты школы
+	textX := reportMargin
+	if logo != nil && logo.Width > 0 && logo.Height > 0 {
+		w, hgt := 56.0, 56.0
+		if logo.Width > logo.Height {
+			hgt = w * float64(logo.Height) / float64(logo.Width)
+		} else {
+			w = hgt * float64(logo.Width) / float64(logo.Height)
+		}
+		doc.Image(logo, reportMargin, reportMargin, w, hgt)
+		textX += 68
+	}
+	doc.SetFont(h.bold, 14)
+	lines := doc.SplitText(card.School.Name, reportMargin+reportWidth-textX)
+	y := reportMargin + 14
+	for _, line := range lines {
+		doc.Text(textX, y, line)
+		y += 17
+	}
+	doc.SetFont(h.regular, 9)
+	var contacts []string
+	for _, s := range []string{card.School.Phone, card.School.Email} {
+		if s != "" {
+			contacts = append(contacts, s)
+		}
+	}
+	for _, s := range []string{card.School.Address, strings.Join(contacts, ", ")} {
+		if s != "" {
+			doc.Text(textX, y, s)
+			y += 12
+		}
+	}
+	if y < reportMargin+64 {
+		y = reportMargin + 64
+	}
+	doc.SetLineWidth(1)
+	doc.Line(reportMargin, y, reportMargin+reportWidth, y)
+	p.y = y + 12
+
+	// Заголовок табеля
+	p.centered(h.bold, 16, "ТАБЕЛЬ УСПЕВАЕМОСТИ")
+	subtitle := fmt.Sprintf("%d/%d учебный год", card.Year, card.Year+1)
+	if card.Term > 0 {
+		t := card.Terms[card.Term-1]
+		subtitle += fmt.Sprintf(" · %d %s (%s – %s)", card.Term, termName(card.TermCount),
+			t.From.Format("02.01.2006"), t.To.Format("02.01.2006"))
+	} else {
+		subtitle += " · итоговый"
+	}
+	p.centered(h.regular, 11, subtitle)
+	p.y += 10
+
+	// Ученик
+	info := [][2]string{{"Ученик", fullName(&card.Student)}}
+	if card.Class != nil {
+		info = append(info, [2]string{"Класс", card.Class.Name})
+	}
+	if card.Homeroom != "" {
+		info = append(info, [2]string{"Классный руководитель", card.Homeroom})
+	}
+	for _, row := range info {
+		p.y += 15
+		doc.SetFont(h.bold, 10)
+		label := row[0] + ": "
+		doc.Text(reportMargin, p.y, label)
+		x := reportMargin + doc.TextWidth(label)
+		doc.SetFont(h.regular, 10)
+		doc.Text(x, p.y, row[1])
+	}
+
+	h.renderGradesTable(p, card)
+	h.renderAttendance(p, card)
+	h.renderComments(p, card)
+	h.renderSignatures(p, card)
+}
+
+// gradeColumn - столбец таблицы оценок
+type gradeColumn struct {
+	title string
+	width float64
+	value func(s *reportSubject) string
+}
+
+func (h *ReportCardHandler) renderGradesTable(p *reportPage, card *reportCard) {
+	doc := p.doc
+	p.heading("Успеваемость")
+
+	var columns []gradeColumn
+	for i := range card.Terms {
+		i := i
+		columns = append(columns, gradeColumn{fmt.Sprintf("%d", i+1), 30, func(s *reportSubject) string { return s.Marks[i] }})
+	}
+	if card.annual() {
+		columns = append(columns, gradeColumn{"Год", 34, func(s *reportSubject) string { return s.Annual }})
+	}
+	columns = append(columns,
+		gradeColumn{"Ср. балл", 50, func(s *reportSubject) string {
+			if s.Count == 0 {
+				return ""
+			}
+			return fmt.Sprintf("%.2f", s.Average)
+		}},
+		gradeColumn{"Оценок", 44, func(s *reportSubject) string { return fmt.Sprintf("%d", s.Count) }},
+		gradeColumn{"Пропуски", 52, func(s *reportSubject) string { return fmt.Sprintf("%d", s.Missed) }},
+	)
+	nameWidth := reportWidth
+	for _, col := range columns {
+		nameWidth -= col.width
+	}
+
+	header := func() {
+		const height = 20.0
+		doc.SetLineWidth(0.5)
+		doc.SetFillColor(0.9, 0.9, 0.9)
+		doc.Rect(reportMargin, p.y, reportWidth, height, pdf.FillStroke)
+		doc.SetFillColor(0, 0, 0)
+		doc.SetFont(h.bold, 9)
+		doc.Text(reportMargin+4, p.y+13, "Предмет")
+		x := reportMargin + nameWidth
+		for _, col := range columns {
+			doc.Line(x, p.y, x, p.y+height)
+			doc.Text(x+(col.width-doc.TextWidth(col.title))/2, p.y+13, col.title)
+			x += col.width
+		}
+		p.y += height
+	}
+
+	p.y += 6
+	p.ensure(60)
+	header()
+
+	if len(card.Subjects) == 0 {
+		doc.SetFont(h.regular, 10)
+		p.y += 16
+		doc.Text(reportMargin+4, p.y, "Нет оценок за период")
+		return
+	}
+
+	for i := range card.Subjects {
+		s := &card.Subjects[i]
+		doc.SetFont(h.regular, 10)
+		nameLines := doc.SplitText(s.Name, nameWidth-8)
+		height := 8 + 12*float64(len(nameLines))
+		if height < 18 {
+			height = 18
+		}
+		if p.ensure(height) {
+			header()
+		}
+
+		doc.SetLineWidth(0.5)
+		doc.Rect(reportMargin, p.y, reportWidth, height, pdf.Stroke)
+		doc.SetFont(h.regular, 10)
+		for j, line := range nameLines {
+			doc.Text(reportMargin+4, p.y+13+12*float64(j), line)
+		}
+		x := reportMargin + nameWidth
+		for _, col := range columns {
+			doc.Line(x, p.y, x, p.y+height)
+			value := col.value(s)
+			if value == "" {
+				value = "—"
+			}
+			// Неудовлетворительные отметки выделяем красным
+			if value == "2" {
+				doc.SetFillColor(0.8, 0, 0)
+			}
+			doc.Text(x+(col.width-doc.TextWidth(value))/2, p.y+13, value)
+			doc.SetFillColor(0, 0, 0)
+			x += col.width
+		}
+		p.y += height
+	}
+
+	doc.SetFont(h.regular, 8)
+	p.ensure(14)
+	p.y += 12
+	note := fmt.Sprintf("Отметка за %s - итоговая оценка учителя или округлённый средний балл.", termName(card.TermCount))
+	if card.annual() {
+		note += " Годовая - среднее отметок за периоды."
+	}
+	doc.Text(reportMargin, p.y, note)
+}
+
+func (h *ReportCardHandler) renderAttendance(p *reportPage, card *reportCard) {
+	a := card.Attendance
+	p.heading("Посещаемость")
+	if a.Total == 0 {
+		p.paragraph(h.regular, 10, reportMargin, "Отметок посещаемости за период нет.")
+		return
+	}
+	p.paragraph(h.regular, 10, reportMargin, fmt.Sprintf("Отмечено уроков: %d, присутствовал(а) на %d (%.1f%%).",
+		a.Total, a.Total-a.Missed, a.Percent()))
+	p.paragraph(h.regular, 10, reportMargin, fmt.Sprintf("Пропущено уроков: %d, из них по уважительной причине: %d. Опозданий: %d.",
+		a.Missed, a.Excused, a.Late))
+}
+
+func (h *ReportCardHandler) renderComments(p *reportPage, card *reportCard) {
+	hasComments := card.Comment != ""
+	for _, s := range card.Subjects {
+		hasComments = hasComments || s.Comment != ""
+	}
+	if !hasComments {
+		return
+	}
+
+	p.heading("Комментарии учителей")
+	for _, s := range card.Subjects {
+		if s.Comment == "" {
+			continue
+		}
+		title := s.Name
+		if s.CommentBy != "" {
+			title += " (" + s.CommentBy + ")"
+		}
+		p.y += 4
+		p.paragraph(h.bold, 10, reportMargin, title)
+		p.paragraph(h.regular, 10, reportMargin+10, s.Comment)
+	}
+	if card.Comment != "" {
+		title := "Классный руководитель"
+		if card.CommentBy != "" {
+			title += " (" + card.CommentBy + ")"
+		}
+		p.y += 4
+		p.paragraph(h.bold, 10, reportMargin, title)
+		p.paragraph(h.regular, 10, reportMargin+10, card.Comment)
+	}
+}
+
+func (h *ReportCardHandler) renderSignatures(p *reportPage, card *reportCard) {
+	doc := p.doc
+	p.ensure(90)
+	p.y += 36
+
+	doc.SetFont(h.regular, 10)
+	doc.SetLineWidth(0.5)
+	rows := [][2]string{{"Классный руководитель", card.Homeroom}, {"Директор", ""}, {"Подпись родителя", ""}}
+	for _, row := range rows {
+		doc.Text(reportMargin, p.y, row[0])
+		doc.Line(reportMargin+150, p.y+2, reportMargin+300, p.y+2)
+		doc.Text(reportMargin+310, p.y, row[1])
+		p.y += 22
+	}
+	doc.Text(reportMargin, p.y, "Дата выдачи: "+card.Issued.Format("02.01.2006"))
+}
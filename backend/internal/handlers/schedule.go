@@ -1,10 +1,12 @@
 package handlers
 
 import (
+	"classkeeper/internal/calendar"
 	"classkeeper/internal/database"
 	"classkeeper/internal/models"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -61,7 +63,7 @@ func (h *ScheduleHandler) CreateSchedule(c *gin.Context) {
 		RoomNumber:   req.RoomNumber,
 	}
 
-	if err := database.DB.Create(&schedule).Error; err != nil {
+	if err := db(c).Create(&schedule).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create schedule"})
 		return
 	}
@@ -144,7 +146,7 @@ func (h *ScheduleHandler) DeleteSchedule(c *gin.Context) {
 		return
 	}
 
-	if err := database.DB.Delete(&schedule).Error; err != nil {
+	if err := db(c).Delete(&schedule).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete schedule"})
 		return
 	}
@@ -224,7 +226,7 @@ func (h *ScheduleHandler) UpdateSchedule(c *gin.Context) {
 	schedule.EndTime = req.EndTime
 	schedule.RoomNumber = req.RoomNumber
 
-	if err := database.DB.Save(&schedule).Error; err != nil {
+	if err := db(c).Save(&schedule).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update schedule"})
 		return
 	}
@@ -233,3 +235,57 @@ func (h *ScheduleHandler) UpdateSchedule(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"schedule": schedule})
 }
+
+// GetClassScheduleForDate получает уроки класса на конкретную дату с учётом
+// школьного календаря (праздники, каникулы, переносы рабочих дней)
+func (h *ScheduleHandler) GetClassScheduleForDate(c *gin.Context) {
+	classID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid class ID"})
+		return
+	}
+
+	schoolID, _ := c.Get("school_id")
+
+	date := calendar.Date(time.Now())
+	if s := c.Query("date"); s != "" {
+		date, err = time.Parse(calendar.DateLayout, s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format (use YYYY-MM-DD)"})
+			return
+		}
+	}
+
+	var class models.Class
+	if err := database.DB.Where("id = ? AND school_id = ?", classID, schoolID).First(&class).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Class not found"})
+		return
+	}
+
+	cal, err := calendar.Load(database.DB, class.SchoolID, &class.ID, date, date)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load calendar"})
+		return
+	}
+
+	scheduleDay, working := cal.ScheduleDay(date)
+	schedules := []models.Schedule{}
+	if working {
+		if err := database.DB.Where("class_id = ? AND day_of_week = ?", classID, scheduleDay).
+			Preload("Subject").
+			Preload("Teacher").
+			Order("lesson_number").
+			Find(&schedules).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch schedule"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"class":        class,
+		"date":         date.Format(calendar.DateLayout),
+		"working":      working,
+		"schedule_day": scheduleDay,
+		"lessons":      schedules,
+	})
+}
@@ -40,7 +40,7 @@ func (h *SchoolHandler) CreateSchool(c *gin.Context) {
 		LogoURL: req.LogoURL,
 	}
 
-	if err := database.DB.Create(&school).Error; err != nil {
+	if err := db(c).Create(&school).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create school"})
 		return
 	}
@@ -99,7 +99,7 @@ func (h *SchoolHandler) UpdateSchool(c *gin.Context) {
 	school.Email = req.Email
 	school.LogoURL = req.LogoURL
 
-	if err := database.DB.Save(&school).Error; err != nil {
+	if err := db(c).Save(&school).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update school"})
 		return
 	}
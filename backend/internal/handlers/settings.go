@@ -74,7 +74,7 @@ func (h *SettingsHandler) UpdateSchoolSettings(c *gin.Context) {
 		school.LogoURL = req.LogoURL
 	}
 
-	if err := database.DB.Save(&school).Error; err != nil {
+	if err := db(c).Save(&school).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update school"})
 		return
 	}
@@ -107,7 +107,7 @@ func (h *SettingsHandler) GetSystemInfo(c *gin.Context) {
 		Where("classes.school_id = ?", schoolID).
 		Count(&stats.TotalSchedules)
 	
-	database.DB.Table("grades").
+	database.DB.Model(&models.Grade{}).
 		Joins("JOIN users ON users.id = grades.student_id").
 		Where("users.school_id = ?", schoolID).
 		Count(&stats.TotalGrades)
@@ -118,8 +118,7 @@ func (h *SettingsHandler) GetSystemInfo(c *gin.Context) {
 		Count(&stats.TotalAttendance)
 	
 	database.DB.Table("homeworks").
-		Joins("JOIN schedules ON schedules.id = homeworks.schedule_id").
-		Joins("JOIN classes ON classes.id = schedules.class_id").
+		Joins("JOIN classes ON classes.id = homeworks.class_id").
 		Where("classes.school_id = ?", schoolID).
 		Count(&stats.TotalHomework)
 	
@@ -130,134 +129,3 @@ func (h *SettingsHandler) GetSystemInfo(c *gin.Context) {
 		"stats":   stats,
 	})
 }
-
-// BackupDatabase создаёт резервную копию данных школы (JSON)
-func (h *SettingsHandler) BackupDatabase(c *gin.Context) {
-	role, _ := c.Get("role")
-	
-	if role != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can create backups"})
-		return
-	}
-
-	schoolID, _ := c.Get("school_id")
-
-	// Получаем все данные школы
-	var school models.School
-	database.DB.Preload("Users").First(&school, schoolID)
-
-	var classes []models.Class
-	database.DB.Where("school_id = ?", schoolID).
-		Preload("Students").
-		Preload("HomeroomTeacher").
-		Preload("Starosta").
-		Find(&classes)
-
-	var subjects []models.Subject
-	database.DB.Where("school_id = ?", schoolID).
-		Preload("Teachers").
-		Find(&subjects)
-
-	var announcements []models.Announcement
-	database.DB.Where("school_id = ?", schoolID).Find(&announcements)
-
-	// Формируем backup
-	backup := gin.H{
-		"school":        school,
-		"classes":       classes,
-		"subjects":      subjects,
-		"announcements": announcements,
-		"backup_date":   database.DB.NowFunc(),
-	}
-
-	c.JSON(http.StatusOK, gin.H{"backup": backup})
-}
-
-// GetAuditLog получает лог действий (упрощённая версия)
-func (h *SettingsHandler) GetAuditLog(c *gin.Context) {
-	role, _ := c.Get("role")
-	
-	if role != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can view audit log"})
-		return
-	}
-
-	schoolID, _ := c.Get("school_id")
-	limit := c.DefaultQuery("limit", "100")
-
-	// Получаем последние действия
-	type AuditEntry struct {
-		Type      string
-		Count     int64
-		LastDate  string
-	}
-
-	var entries []AuditEntry
-
-	// Оценки
-	var gradesCount int64
-	var lastGradeDate string
-	database.DB.Table("grades").
-		Joins("JOIN users ON users.id = grades.student_id").
-		Where("users.school_id = ?", schoolID).
-		Count(&gradesCount)
-	database.DB.Table("grades").
-		Joins("JOIN users ON users.id = grades.student_id").
-		Where("users.school_id = ?", schoolID).
-		Order("grades.created_at DESC").
-		Limit(1).
-		Pluck("grades.created_at", &lastGradeDate)
-	
-	entries = append(entries, AuditEntry{
-		Type:     "grades",
-		Count:    gradesCount,
-		LastDate: lastGradeDate,
-	})
-
-	// Посещаемость
-	var attendanceCount int64
-	var lastAttendanceDate string
-	database.DB.Table("attendances").
-		Joins("JOIN users ON users.id = attendances.student_id").
-		Where("users.school_id = ?", schoolID).
-		Count(&attendanceCount)
-	database.DB.Table("attendances").
-		Joins("JOIN users ON users.id = attendances.student_id").
-		Where("users.school_id = ?", schoolID).
-		Order("attendances.created_at DESC").
-		Limit(1).
-		Pluck("attendances.created_at", &lastAttendanceDate)
-	
-	entries = append(entries, AuditEntry{
-		Type:     "attendance",
-		Count:    attendanceCount,
-		LastDate: lastAttendanceDate,
-	})
-
-	// ДЗ
-	var homeworkCount int64
-	var lastHomeworkDate string
-	database.DB.Table("homeworks").
-		Joins("JOIN schedules ON schedules.id = homeworks.schedule_id").
-		Joins("JOIN classes ON classes.id = schedules.class_id").
-		Where("classes.school_id = ?", schoolID).
-		Count(&homeworkCount)
-	database.DB.Table("homeworks").
-		Joins("JOIN schedules ON schedules.id = homeworks.schedule_id").
-		Joins("JOIN classes ON classes.id = schedules.class_id").
-		Where("classes.school_id = ?", schoolID).
-		Order("homeworks.created_at DESC").
-		Limit(1).
-		Pluck("homeworks.created_at", &lastHomeworkDate)
-	
-	entries = append(entries, AuditEntry{
-		Type:     "homework",
-		Count:    homeworkCount,
-		LastDate: lastHomeworkDate,
-	})
-
-	c.JSON(http.StatusOK, gin.H{
-		"entries": entries,
-		"limit":   limit,
-	})
-}
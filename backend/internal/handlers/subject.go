@@ -42,7 +42,7 @@ func (h *SubjectHandler) CreateSubject(c *gin.Context) {
 		Description: req.Description,
 	}
 
-	if err := database.DB.Create(&subject).Error; err != nil {
+	if err := db(c).Create(&subject).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create subject"})
 		return
 	}
@@ -112,7 +112,7 @@ func (h *SubjectHandler) UpdateSubject(c *gin.Context) {
 	subject.Name = req.Name
 	subject.Description = req.Description
 
-	if err := database.DB.Save(&subject).Error; err != nil {
+	if err := db(c).Save(&subject).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update subject"})
 		return
 	}
@@ -136,7 +136,7 @@ func (h *SubjectHandler) DeleteSubject(c *gin.Context) {
 		return
 	}
 
-	if err := database.DB.Delete(&subject).Error; err != nil {
+	if err := db(c).Delete(&subject).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete subject"})
 		return
 	}
@@ -181,7 +181,7 @@ func (h *SubjectHandler) AssignTeachers(c *gin.Context) {
 	}
 
 	// Добавляем учителей
-	if err := database.DB.Model(&subject).Association("Teachers").Append(&teachers); err != nil {
+	if err := db(c).Model(&subject).Association("Teachers").Append(&teachers); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign teachers"})
 		return
 	}
@@ -221,7 +221,7 @@ func (h *SubjectHandler) RemoveTeacher(c *gin.Context) {
 	}
 
 	// Удаляем учителя с предмета
-	if err := database.DB.Model(&subject).Association("Teachers").Delete(&teacher); err != nil {
+	if err := db(c).Model(&subject).Association("Teachers").Delete(&teacher); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove teacher"})
 		return
 	}
@@ -0,0 +1,442 @@
+package handlers
+
+import (
+	"classkeeper/internal/calendar"
+	"classkeeper/internal/database"
+	"classkeeper/internal/models"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Статусы сдачи домашнего задания
+const (
+	SubmissionNotStarted = "not_started"
+	SubmissionSubmitted  = "submitted"
+	SubmissionLate       = "late"
+	SubmissionReturned   = "returned"
+)
+
+type SubmissionHandler struct{}
+
+func NewSubmissionHandler() *SubmissionHandler {
+	return &SubmissionHandler{}
+}
+
+// SubmitHomeworkRequest структура для сдачи ДЗ учеником
+type SubmitHomeworkRequest struct {
+	Answer        string `json:"answer"`
+	AttachmentIDs []uint `json:"attachment_ids"` // Файлы, загруженные через /api/attachments
+}
+
+// ReviewSubmissionRequest структура для проверки работы учителем
+type ReviewSubmissionRequest struct {
+	Action    string `json:"action" binding:"required"` // accept, return
+	Comment   string `json:"comment"`
+	Grade     *int   `json:"grade,omitempty" binding:"omitempty,min=1,max=5"` // Если указана - создаётся оценка
+	GradeType string `json:"grade_type"`                                      // По умолчанию homework
+}
+
+// SubmitHomework сдаёт (или пересдаёт) домашнее задание текущим учеником
+func (h *SubmissionHandler) SubmitHomework(c *gin.Context) {
+	homeworkID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid homework ID"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	schoolID, _ := c.Get("school_id")
+
+	var req SubmitHomeworkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Answer == "" && len(req.AttachmentIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Answer or attachments are required"})
+		return
+	}
+
+	homework, ok := findSchoolHomework(c, homeworkID, schoolID)
+	if !ok {
+		return
+	}
+
+	// Ученик должен учиться в классе, которому задано ДЗ
+	var count int64
+	database.DB.Table("class_students").
+		Where("class_id = ? AND user_id = ?", homework.ClassID, userID).
+		Count(&count)
+	if count == 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This homework is not assigned to your class"})
+		return
+	}
+
+	var submission models.HomeworkSubmission
+	database.DB.Where("homework_id = ? AND student_id = ?", homework.ID, userID).First(&submission)
+
+	// Проверенную работу (с оценкой) нельзя пересдать, пока учитель её не вернёт
+	if submission.GradeID != nil && submission.Status != SubmissionReturned {
+		c.JSON(http.StatusConflict, gin.H{"error": "Submission has already been graded"})
+		return
+	}
+
+	now := time.Now()
+	submission.HomeworkID = homework.ID
+	submission.StudentID = userID.(uint)
+	submission.Answer = req.Answer
+	submission.SubmittedAt = &now
+	submission.Status = submissionStatus(homework, now)
+
+	err = db(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&submission).Error; err != nil {
+			return err
+		}
+		// При пересдаче набор файлов заменяется: не вошедшие в неё отвязываются
+		detach := tx.Model(&models.Attachment{}).
+			Where("owner_type = ? AND owner_id = ?", AttachmentSubmission, submission.ID)
+		if len(req.AttachmentIDs) > 0 {
+			detach = detach.Where("id NOT IN ?", req.AttachmentIDs)
+		}
+		if err := detach.Updates(map[string]interface{}{"owner_type": "", "owner_id": 0}).Error; err != nil {
+			return err
+		}
+		return attachFiles(tx, req.AttachmentIDs, AttachmentSubmission, submission.ID, submission.StudentID)
+	})
+	if errors.Is(err, errInvalidAttachments) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment IDs"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit homework"})
+		return
+	}
+
+	// Загружаем связи
+	database.DB.Preload("Homework").Preload("Student").Preload("Grade").Preload("Attachments").First(&submission, submission.ID)
+
+	c.JSON(http.StatusOK, gin.H{"submission": submission})
+}
+
+// GetMySubmission возвращает сдачу ДЗ текущего ученика
+func (h *SubmissionHandler) GetMySubmission(c *gin.Context) {
+	homeworkID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid homework ID"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	schoolID, _ := c.Get("school_id")
+
+	homework, ok := findSchoolHomework(c, homeworkID, schoolID)
+	if !ok {
+		return
+	}
+
+	var submission models.HomeworkSubmission
+	if err := database.DB.Where("homework_id = ? AND student_id = ?", homework.ID, userID).
+		Preload("Grade").
+		Preload("Attachments").
+		First(&submission).Error; err != nil {
+		submission = models.HomeworkSubmission{
+			HomeworkID: homework.ID,
+			StudentID:  userID.(uint),
+			Status:     SubmissionNotStarted,
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"submission": submission})
+}
+
+// ListSubmissions возвращает сдачи ДЗ по всем ученикам класса
+// (ученики без сдачи получают статус not_started)
+func (h *SubmissionHandler) ListSubmissions(c *gin.Context) {
+	homeworkID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid homework ID"})
+		return
+	}
+
+	schoolID, _ := c.Get("school_id")
+
+	homework, ok := findSchoolHomework(c, homeworkID, schoolID)
+	if !ok {
+		return
+	}
+	if !canReviewHomework(c, homework) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	submissions, err := classSubmissions(homework)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch submissions"})
+		return
+	}
+
+	if status := c.Query("status"); status != "" {
+		filtered := []models.HomeworkSubmission{}
+		for _, s := range submissions {
+			if s.Status == status {
+				filtered = append(filtered, s)
+			}
+		}
+		submissions = filtered
+	}
+
+	c.JSON(http.StatusOK, gin.H{"submissions": submissions})
+}
+
+// ReviewSubmission проверяет работу: принимает (опционально с оценкой) или возвращает на доработку
+func (h *SubmissionHandler) ReviewSubmission(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid submission ID"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	schoolID, _ := c.Get("school_id")
+
+	var req ReviewSubmissionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Action != "accept" && req.Action != "return" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid action (use accept or return)"})
+		return
+	}
+	if req.Action == "return" && req.Grade != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Returned submission cannot be graded"})
+		return
+	}
+
+	var submission models.HomeworkSubmission
+	if err := database.DB.First(&submission, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Submission not found"})
+		return
+	}
+
+	homework, ok := findSchoolHomework(c, int(submission.HomeworkID), schoolID)
+	if !ok {
+		return
+	}
+	if !canReviewHomework(c, homework) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	if submission.SubmittedAt == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Submission has not been submitted yet"})
+		return
+	}
+
+	now := time.Now()
+	reviewerID := userID.(uint)
+
+	errMessage := "Failed to review submission"
+	err = db(c).Transaction(func(tx *gorm.DB) error {
+		if req.Grade != nil {
+			gradeType := req.GradeType
+			if gradeType == "" {
+				gradeType = "homework"
+			}
+
+			// Повторная проверка обновляет уже выставленную оценку
+			var grade models.Grade
+			if submission.GradeID != nil {
+				tx.First(&grade, *submission.GradeID)
+			}
+			grade.StudentID = submission.StudentID
+			grade.SubjectID = homework.SubjectID
+			grade.TeacherID = reviewerID
+			grade.Grade = *req.Grade
+			grade.GradeType = gradeType
+			grade.Date = calendar.Date(now)
+			grade.Comment = req.Comment
+
+			if err := tx.Save(&grade).Error; err != nil {
+				errMessage = "Failed to create grade"
+				return err
+			}
+			submission.GradeID = &grade.ID
+		}
+
+		if req.Action == "return" {
+			submission.Status = SubmissionReturned
+		} else {
+			// Принятая после возврата работа снова считается сданной в срок или с опозданием
+			submission.Status = submissionStatus(homework, *submission.SubmittedAt)
+		}
+		submission.TeacherComment = req.Comment
+		submission.ReviewedBy = &reviewerID
+		submission.ReviewedAt = &now
+
+		return tx.Save(&submission).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": errMessage})
+		return
+	}
+
+	database.DB.Preload("Student").Preload("Reviewer").Preload("Grade").First(&submission, submission.ID)
+
+	c.JSON(http.StatusOK, gin.H{"submission": submission})
+}
+
+// GetHomeworkStats возвращает статистику выполнения ДЗ. Доступно тем же, кто
+// проверяет работы.
+func (h *SubmissionHandler) GetHomeworkStats(c *gin.Context) {
+	homeworkID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid homework ID"})
+		return
+	}
+
+	schoolID, _ := c.Get("school_id")
+
+	homework, ok := findSchoolHomework(c, homeworkID, schoolID)
+	if !ok {
+		return
+	}
+	if !canReviewHomework(c, homework) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	submissions, err := classSubmissions(homework)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch submissions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"homework_id": homework.ID,
+		"stats":       submissionStats(submissions),
+	})
+}
+
+// SubmissionStats статистика выполнения одного ДЗ
+type SubmissionStats struct {
+	TotalStudents  int     `json:"total_students"`
+	NotStarted     int     `json:"not_started"`
+	Submitted      int     `json:"submitted"`
+	Late           int     `json:"late"`
+	Returned       int     `json:"returned"`
+	Graded         int     `json:"graded"`
+	CompletionRate float64 `json:"completion_rate"` // % сдавших (вовремя или с опозданием)
+	OnTimeRate     float64 `json:"on_time_rate"`    // % сдавших вовремя
+}
+
+func submissionStats(submissions []models.HomeworkSubmission) SubmissionStats {
+	stats := SubmissionStats{TotalStudents: len(submissions)}
+	for _, s := range submissions {
+		switch s.Status {
+		case SubmissionNotStarted:
+			stats.NotStarted++
+		case SubmissionSubmitted:
+			stats.Submitted++
+		case SubmissionLate:
+			stats.Late++
+		case SubmissionReturned:
+			stats.Returned++
+		}
+		if s.GradeID != nil {
+			stats.Graded++
+		}
+	}
+
+	if stats.TotalStudents > 0 {
+		stats.CompletionRate = float64(stats.Submitted+stats.Late) / float64(stats.TotalStudents) * 100
+		stats.OnTimeRate = float64(stats.Submitted) / float64(stats.TotalStudents) * 100
+	}
+	return stats
+}
+
+// classSubmissions возвращает сдачи ДЗ по всем ученикам класса, подставляя
+// not_started для тех, кто ещё ничего не сдал
+func classSubmissions(homework *models.Homework) ([]models.HomeworkSubmission, error) {
+	var class models.Class
+	if err := database.DB.Preload("Students").First(&class, homework.ClassID).Error; err != nil {
+		return nil, err
+	}
+
+	var existing []models.HomeworkSubmission
+	if err := database.DB.Where("homework_id = ?", homework.ID).
+		Preload("Grade").
+		Preload("Attachments").
+		Find(&existing).Error; err != nil {
+		return nil, err
+	}
+
+	byStudent := make(map[uint]models.HomeworkSubmission)
+	for _, s := range existing {
+		byStudent[s.StudentID] = s
+	}
+
+	submissions := []models.HomeworkSubmission{}
+	for _, student := range class.Students {
+		s, ok := byStudent[student.ID]
+		if !ok {
+			s = models.HomeworkSubmission{
+				HomeworkID: homework.ID,
+				StudentID:  student.ID,
+				Status:     SubmissionNotStarted,
+			}
+		}
+		s.Student = student
+		submissions = append(submissions, s)
+	}
+	return submissions, nil
+}
+
+// submissionStatus определяет статус работы, сданной в submittedAt. Опоздание считаем
+// относительно ближайшего учебного дня к сроку сдачи.
+func submissionStatus(homework *models.Homework, submittedAt time.Time) string {
+	var class models.Class
+	database.DB.First(&class, homework.ClassID)
+	if cal, err := loadClassCalendar(&class, homework.DueDate, submittedAt); err == nil {
+		if calendar.Date(submittedAt).After(cal.NextWorkingDay(homework.DueDate)) {
+			return SubmissionLate
+		}
+	}
+	return SubmissionSubmitted
+}
+
+// findSchoolHomework находит ДЗ в школе пользователя. При ошибке пишет ответ.
+func findSchoolHomework(c *gin.Context, homeworkID int, schoolID interface{}) (*models.Homework, bool) {
+	var homework models.Homework
+	if err := database.DB.
+		Joins("JOIN classes ON classes.id = homeworks.class_id").
+		Where("homeworks.id = ? AND classes.school_id = ?", homeworkID, schoolID).
+		First(&homework).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Homework not found"})
+		return nil, false
+	}
+	return &homework, true
+}
+
+// canReviewHomework проверяет, что пользователь - админ, автор ДЗ или классный руководитель
+func canReviewHomework(c *gin.Context, homework *models.Homework) bool {
+	userID, _ := c.Get("user_id")
+	role, _ := c.Get("role")
+
+	if role == "admin" || homework.TeacherID == userID.(uint) {
+		return true
+	}
+	if role != "teacher" {
+		return false
+	}
+
+	var class models.Class
+	database.DB.First(&class, homework.ClassID)
+	return class.HomeroomTeacherID != nil && *class.HomeroomTeacherID == userID.(uint)
+}
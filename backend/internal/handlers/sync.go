@@ -0,0 +1,598 @@
+package handlers
+
+import (
+	"classkeeper/internal/database"
+	"classkeeper/internal/models"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Стратегии разрешения конфликтов при синхронизации
+const (
+	ConflictReject     = "reject"      // Вернуть клиенту серверную версию (по умолчанию)
+	ConflictClientWins = "client_wins" // Перезаписать серверную версию клиентской
+	ConflictLatestWins = "latest_wins" // Побеждает более позднее изменение по client_updated_at
+)
+
+// Результаты синхронизации записи
+const (
+	SyncCreated   = "created"
+	SyncUpdated   = "updated"
+	SyncDeleted   = "deleted"
+	SyncUnchanged = "unchanged"
+	SyncConflict  = "conflict"
+	SyncError     = "error"
+)
+
+const (
+	maxSyncRecords   = 500
+	defaultSyncLimit = 500
+)
+
+var errSyncForbidden = errors.New("forbidden")
+
+// errSyncClientID - client_id уже занят записью другого ученика, класса или предмета
+var errSyncClientID = errors.New("client_id belongs to another record")
+
+type SyncHandler struct{}
+
+func NewSyncHandler() *SyncHandler {
+	return &SyncHandler{}
+}
+
+// SyncRecordMeta общие поля записи, изменённой офлайн
+type SyncRecordMeta struct {
+	ClientID        string `json:"client_id"`         // ID, созданный клиентом (UUID)
+	BaseSeq         int64  `json:"base_seq"`          // sync_seq серверной версии, которую клиент видел последней; 0 - новая запись
+	ClientUpdatedAt string `json:"client_updated_at"` // Время изменения на устройстве, RFC3339
+	Deleted         bool   `json:"deleted"`
+}
+
+// SyncAttendanceRecord отметка посещаемости, сделанная офлайн
+type SyncAttendanceRecord struct {
+	SyncRecordMeta
+	StudentID    uint   `json:"student_id"`
+	ClassID      uint   `json:"class_id"`
+	ScheduleID   *uint  `json:"schedule_id,omitempty"`
+	SubjectID    *uint  `json:"subject_id,omitempty"`
+	Date         string `json:"date"` // YYYY-MM-DD
+	LessonNumber *int   `json:"lesson_number,omitempty"`
+	Status       string `json:"status"`
+	MinutesLate  int    `json:"minutes_late,omitempty"`
+	Comment      string `json:"comment,omitempty"`
+}
+
+// SyncGradeRecord оценка, выставленная офлайн
+type SyncGradeRecord struct {
+	SyncRecordMeta
+	StudentID uint   `json:"student_id"`
+	SubjectID uint   `json:"subject_id"`
+	Grade     int    `json:"grade"`
+	GradeType string `json:"grade_type,omitempty"`
+	Date      string `json:"date"` // YYYY-MM-DD
+	Comment   string `json:"comment,omitempty"`
+}
+
+// SyncAttendanceRequest пакет офлайн-отметок
+type SyncAttendanceRequest struct {
+	OnConflict string                 `json:"on_conflict"` // reject, client_wins, latest_wins
+	Records    []SyncAttendanceRecord `json:"records" binding:"required"`
+}
+
+// SyncGradesRequest пакет офлайн-оценок
+type SyncGradesRequest struct {
+	OnConflict string            `json:"on_conflict"` // reject, client_wins, latest_wins
+	Records    []SyncGradeRecord `json:"records" binding:"required"`
+}
+
+// SyncResult результат синхронизации одной записи
+type SyncResult struct {
+	ClientID string      `json:"client_id"`
+	Status   string      `json:"status"` // created, updated, deleted, unchanged, conflict, error
+	ID       uint        `json:"id,omitempty"`
+	SyncSeq  int64       `json:"sync_seq,omitempty"`
+	Error    string      `json:"error,omitempty"`
+	Server   interface{} `json:"server,omitempty"` // Серверная версия при конфликте
+}
+
+// syncRequestContext данные пользователя, общие для всех записей пакета
+type syncRequestContext struct {
+	userID     uint
+	schoolID   uint
+	role       interface{}
+	onConflict string
+	classIDs   map[uint]bool
+	db         *gorm.DB // Соединение с контекстом запроса для журнала аудита
+}
+
+// PushAttendance принимает пакет отметок посещаемости с устройства, работавшего офлайн.
+// Каждая запись сохраняется отдельно и получает свой результат.
+func (h *SyncHandler) PushAttendance(c *gin.Context) {
+	var req SyncAttendanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sc, ok := newSyncRequestContext(c, req.OnConflict, len(req.Records))
+	if !ok {
+		return
+	}
+
+	results := make([]SyncResult, 0, len(req.Records))
+	for _, record := range req.Records {
+		results = append(results, syncAttendance(sc, &record))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"results": results, "summary": syncSummary(results)})
+}
+
+// PushGrades принимает пакет оценок с устройства, работавшего офлайн
+func (h *SyncHandler) PushGrades(c *gin.Context) {
+	var req SyncGradesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sc, ok := newSyncRequestContext(c, req.OnConflict, len(req.Records))
+	if !ok {
+		return
+	}
+
+	results := make([]SyncResult, 0, len(req.Records))
+	for _, record := range req.Records {
+		results = append(results, syncGrade(sc, &record))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"results": results, "summary": syncSummary(results)})
+}
+
+// GetChanges отдаёт изменения посещаемости и оценок по классам пользователя
+// после курсора. Курсор - sync_seq последнего полученного изменения.
+func (h *SyncHandler) GetChanges(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	schoolID, _ := c.Get("school_id")
+	role, _ := c.Get("role")
+
+	cursor, err := strconv.ParseInt(c.DefaultQuery("cursor", "0"), 10, 64)
+	if err != nil || cursor < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultSyncLimit)))
+	if limit <= 0 || limit > maxSyncRecords {
+		limit = defaultSyncLimit
+	}
+
+	classIDs := syncClassIDs(userID.(uint), schoolID.(uint), role)
+	attendance := []models.Attendance{}
+	grades := []models.Grade{}
+	deleted := []models.SyncTombstone{}
+	nextCursor := cursor
+	hasMore := false
+
+	if len(classIDs) > 0 {
+		ids := make([]uint, 0, len(classIDs))
+		for id := range classIDs {
+			ids = append(ids, id)
+		}
+		var studentIDs []uint
+		database.DB.Table("class_students").Where("class_id IN ?", ids).Distinct().Pluck("user_id", &studentIDs)
+		if len(studentIDs) == 0 {
+			studentIDs = []uint{0}
+		}
+
+		attendanceQuery := func() *gorm.DB {
+			return database.DB.Where("class_id IN ? AND sync_seq > ?", ids, cursor)
+		}
+		gradeQuery := func() *gorm.DB {
+			return database.DB.Where("student_id IN ? AND sync_seq > ?", studentIDs, cursor)
+		}
+		tombstoneQuery := func() *gorm.DB {
+			return database.DB.Where("((entity = ? AND class_id IN ?) OR (entity = ? AND student_id IN ?)) AND seq > ?",
+				"attendance", ids, "grade", studentIDs, cursor)
+		}
+
+		// Сначала находим границу страницы по номерам изменений всех типов вместе
+		var seqs []int64
+		var part []int64
+		attendanceQuery().Model(&models.Attendance{}).Order("sync_seq").Limit(limit+1).Pluck("sync_seq", &part)
+		seqs = append(seqs, part...)
+		part = nil
+		gradeQuery().Model(&models.Grade{}).Order("sync_seq").Limit(limit+1).Pluck("sync_seq", &part)
+		seqs = append(seqs, part...)
+		part = nil
+		tombstoneQuery().Model(&models.SyncTombstone{}).Order("seq").Limit(limit+1).Pluck("seq", &part)
+		seqs = append(seqs, part...)
+		sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+
+		if len(seqs) > 0 {
+			upper := seqs[len(seqs)-1]
+			if len(seqs) > limit {
+				upper = seqs[limit-1]
+				hasMore = true
+			}
+			// Записи с одинаковым номером (массовое изменение) всегда попадают на одну страницу
+			attendanceQuery().Where("sync_seq <= ?", upper).Order("sync_seq").Find(&attendance)
+			gradeQuery().Where("sync_seq <= ?", upper).Order("sync_seq").Find(&grades)
+			tombstoneQuery().Where("seq <= ?", upper).Order("seq").Find(&deleted)
+			nextCursor = upper
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"attendance":  attendance,
+		"grades":      grades,
+		"deleted":     deleted,
+		"next_cursor": nextCursor,
+		"has_more":    hasMore,
+		"server_time": time.Now(),
+	})
+}
+
+// newSyncRequestContext проверяет параметры пакета и собирает данные пользователя
+func newSyncRequestContext(c *gin.Context, onConflict string, count int) (*syncRequestContext, bool) {
+	userID, _ := c.Get("user_id")
+	schoolID, _ := c.Get("school_id")
+	role, _ := c.Get("role")
+
+	switch onConflict {
+	case "":
+		onConflict = ConflictReject
+	case ConflictReject, ConflictClientWins, ConflictLatestWins:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid on_conflict (use reject, client_wins or latest_wins)"})
+		return nil, false
+	}
+	if count > maxSyncRecords {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d records per request", maxSyncRecords)})
+		return nil, false
+	}
+
+	return &syncRequestContext{
+		userID:     userID.(uint),
+		schoolID:   schoolID.(uint),
+		role:       role,
+		onConflict: onConflict,
+		classIDs:   syncClassIDs(userID.(uint), schoolID.(uint), role),
+		db:         db(c),
+	}, true
+}
+
+// syncAttendance сохраняет одну офлайн-отметку в отдельной транзакции
+func syncAttendance(sc *syncRequestContext, record *SyncAttendanceRecord) SyncResult {
+	result := SyncResult{ClientID: record.ClientID}
+
+	clientTime, msg := validateSyncMeta(&record.SyncRecordMeta)
+	if msg != "" {
+		return syncFailed(result, msg)
+	}
+	date, err := time.Parse("2006-01-02", record.Date)
+	if err != nil {
+		return syncFailed(result, "Invalid date format (use YYYY-MM-DD)")
+	}
+
+	// Урок расписания задаёт класс, предмет и номер урока
+	if record.ScheduleID != nil {
+		var schedule models.Schedule
+		if err := database.DB.Joins("JOIN classes ON classes.id = schedules.class_id").
+			Where("schedules.id = ? AND classes.school_id = ?", *record.ScheduleID, sc.schoolID).
+			First(&schedule).Error; err != nil {
+			return syncFailed(result, "Schedule not found")
+		}
+		record.ClassID = schedule.ClassID
+		record.SubjectID = &schedule.SubjectID
+		record.LessonNumber = &schedule.LessonNumber
+	}
+	if !sc.classIDs[record.ClassID] {
+		return syncFailed(result, "Class not found or not yours")
+	}
+	if !record.Deleted {
+		if msg := validateLateness(record.Status, &record.MinutesLate); msg != "" {
+			return syncFailed(result, msg)
+		}
+	}
+
+	var inClass int64
+	database.DB.Table("class_students").Where("class_id = ? AND user_id = ?", record.ClassID, record.StudentID).Count(&inClass)
+	if inClass == 0 {
+		return syncFailed(result, "Student is not in this class")
+	}
+
+	err = sc.db.Transaction(func(tx *gorm.DB) error {
+		// Повторная отправка той же записи находится по client_id, отметка с другого
+		// устройства - по ученику, дате и уроку
+		var existing models.Attendance
+		found := tx.Where("client_id = ?", record.ClientID).First(&existing).Error == nil
+		if found && (existing.ClassID != record.ClassID || existing.StudentID != record.StudentID) {
+			// client_id чужой отметки не даёт менять её: класс записи проверен выше
+			return errSyncClientID
+		}
+		if !found {
+			query := tx.Where("student_id = ? AND class_id = ? AND date = ?", record.StudentID, record.ClassID, date)
+			if record.ScheduleID != nil {
+				query = query.Where("schedule_id = ?", *record.ScheduleID)
+			} else {
+				if record.LessonNumber != nil {
+					query = query.Where("lesson_number = ?", *record.LessonNumber)
+				}
+				if record.SubjectID != nil {
+					query = query.Where("subject_id = ?", *record.SubjectID)
+				}
+			}
+			found = query.First(&existing).Error == nil
+		}
+
+		if !found {
+			if record.Deleted {
+				result.Status = SyncUnchanged
+				return nil
+			}
+			clientID := record.ClientID
+			attendance := models.Attendance{
+				StudentID:    record.StudentID,
+				ClassID:      record.ClassID,
+				ScheduleID:   record.ScheduleID,
+				SubjectID:    record.SubjectID,
+				Date:         date,
+				LessonNumber: record.LessonNumber,
+				Status:       record.Status,
+				MinutesLate:  record.MinutesLate,
+				Comment:      record.Comment,
+				MarkedBy:     &sc.userID,
+				ClientID:     &clientID,
+			}
+			applyApprovedExcuse(tx, &attendance)
+			if err := tx.Create(&attendance).Error; err != nil {
+				return err
+			}
+			result.Status, result.ID, result.SyncSeq = SyncCreated, attendance.ID, attendance.SyncSeq
+			return nil
+		}
+
+		same := !record.Deleted && existing.Status == record.Status &&
+			existing.MinutesLate == record.MinutesLate && existing.Comment == record.Comment
+		if same || (existing.Status == "excused" && record.Status == "absent" && existing.ExcuseID != nil) {
+			// Клиент прислал то, что уже есть на сервере (в т.ч. пропуск, ставший уважительным)
+			result.Status, result.ID, result.SyncSeq = SyncUnchanged, existing.ID, existing.SyncSeq
+			return nil
+		}
+		if !resolveSyncConflict(sc.onConflict, existing.SyncSeq, record.BaseSeq, existing.UpdatedAt, clientTime) {
+			result.Status, result.ID, result.SyncSeq, result.Server = SyncConflict, existing.ID, existing.SyncSeq, existing
+			return nil
+		}
+
+		if record.Deleted {
+			if err := tx.Delete(&existing).Error; err != nil {
+				return err
+			}
+			result.Status, result.ID = SyncDeleted, existing.ID
+			return nil
+		}
+
+		existing.Status = record.Status
+		existing.MinutesLate = record.MinutesLate
+		existing.Comment = record.Comment
+		existing.MarkedBy = &sc.userID
+		if existing.ClientID == nil {
+			clientID := record.ClientID
+			existing.ClientID = &clientID
+		}
+		applyApprovedExcuse(tx, &existing)
+		if err := tx.Save(&existing).Error; err != nil {
+			return err
+		}
+		result.Status, result.ID, result.SyncSeq = SyncUpdated, existing.ID, existing.SyncSeq
+		return nil
+	})
+	if errors.Is(err, errSyncClientID) {
+		return syncFailed(result, "client_id is already used by another attendance record")
+	}
+	if err != nil {
+		return syncFailed(result, "Failed to save attendance")
+	}
+	return result
+}
+
+// syncGrade сохраняет одну офлайн-оценку в отдельной транзакции
+func syncGrade(sc *syncRequestContext, record *SyncGradeRecord) SyncResult {
+	result := SyncResult{ClientID: record.ClientID}
+
+	clientTime, msg := validateSyncMeta(&record.SyncRecordMeta)
+	if msg != "" {
+		return syncFailed(result, msg)
+	}
+	date, err := time.Parse("2006-01-02", record.Date)
+	if err != nil && !record.Deleted {
+		return syncFailed(result, "Invalid date format (use YYYY-MM-DD)")
+	}
+	if !record.Deleted && (record.Grade < 1 || record.Grade > 5) {
+		return syncFailed(result, "grade must be between 1 and 5")
+	}
+
+	err = sc.db.Transaction(func(tx *gorm.DB) error {
+		var existing models.Grade
+		if err := tx.Where("client_id = ?", record.ClientID).First(&existing).Error; err != nil {
+			if record.Deleted {
+				result.Status = SyncUnchanged
+				return nil
+			}
+			if err := checkSyncGradeAccess(tx, sc, record.StudentID, record.SubjectID); err != nil {
+				return err
+			}
+
+			clientID := record.ClientID
+			grade := models.Grade{
+				StudentID: record.StudentID,
+				SubjectID: record.SubjectID,
+				TeacherID: sc.userID,
+				Grade:     record.Grade,
+				GradeType: record.GradeType,
+				Date:      date,
+				Comment:   record.Comment,
+				ClientID:  &clientID,
+			}
+			if err := tx.Create(&grade).Error; err != nil {
+				return err
+			}
+			result.Status, result.ID, result.SyncSeq = SyncCreated, grade.ID, grade.SyncSeq
+			return nil
+		}
+
+		// Как и в UpdateGrade, менять оценку может только поставивший её учитель или админ,
+		// и только оценку ученика своих классов
+		if sc.role != "admin" && existing.TeacherID != sc.userID {
+			return errSyncForbidden
+		}
+		if !syncStudentInScope(tx, sc, existing.StudentID) {
+			return errSyncForbidden
+		}
+		if !record.Deleted && (existing.StudentID != record.StudentID || existing.SubjectID != record.SubjectID) {
+			return errSyncClientID
+		}
+
+		same := !record.Deleted && existing.Grade == record.Grade && existing.GradeType == record.GradeType &&
+			existing.Comment == record.Comment && existing.Date.Format("2006-01-02") == record.Date
+		if same {
+			result.Status, result.ID, result.SyncSeq = SyncUnchanged, existing.ID, existing.SyncSeq
+			return nil
+		}
+		if !resolveSyncConflict(sc.onConflict, existing.SyncSeq, record.BaseSeq, existing.UpdatedAt, clientTime) {
+			result.Status, result.ID, result.SyncSeq, result.Server = SyncConflict, existing.ID, existing.SyncSeq, existing
+			return nil
+		}
+
+		if record.Deleted {
+			if err := tx.Delete(&existing).Error; err != nil {
+				return err
+			}
+			result.Status, result.ID = SyncDeleted, existing.ID
+			return nil
+		}
+
+		existing.Grade = record.Grade
+		existing.GradeType = record.GradeType
+		existing.Date = date
+		existing.Comment = record.Comment
+		if err := tx.Save(&existing).Error; err != nil {
+			return err
+		}
+		result.Status, result.ID, result.SyncSeq = SyncUpdated, existing.ID, existing.SyncSeq
+		return nil
+	})
+	if errors.Is(err, errSyncForbidden) {
+		return syncFailed(result, "Not authorized to change this grade")
+	}
+	if errors.Is(err, errSyncClientID) {
+		return syncFailed(result, "client_id is already used by another grade")
+	}
+	if err != nil {
+		return syncFailed(result, "Failed to save grade")
+	}
+	return result
+}
+
+// checkSyncGradeAccess - новую оценку можно поставить ученику своего класса по своему предмету
+func checkSyncGradeAccess(tx *gorm.DB, sc *syncRequestContext, studentID, subjectID uint) error {
+	if !syncStudentInScope(tx, sc, studentID) {
+		return errSyncForbidden
+	}
+
+	var subject models.Subject
+	if err := tx.Where("id = ? AND school_id = ?", subjectID, sc.schoolID).First(&subject).Error; err != nil {
+		return errSyncForbidden
+	}
+	if sc.role == "teacher" {
+		var count int64
+		tx.Table("teachers_subjects").Where("user_id = ? AND subject_id = ?", sc.userID, subjectID).Count(&count)
+		if count == 0 {
+			return errSyncForbidden
+		}
+	}
+	return nil
+}
+
+// syncStudentInScope проверяет, что ученик учится в одном из классов пользователя
+func syncStudentInScope(tx *gorm.DB, sc *syncRequestContext, studentID uint) bool {
+	var classIDs []uint
+	tx.Table("class_students").Where("user_id = ?", studentID).Pluck("class_id", &classIDs)
+	for _, id := range classIDs {
+		if sc.classIDs[id] {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveSyncConflict решает, можно ли применить клиентское изменение поверх серверной версии.
+// Конфликт - серверная запись изменилась после версии, которую видел клиент.
+func resolveSyncConflict(strategy string, serverSeq, baseSeq int64, serverUpdated, clientUpdated time.Time) bool {
+	if serverSeq <= baseSeq {
+		return true
+	}
+	switch strategy {
+	case ConflictClientWins:
+		return true
+	case ConflictLatestWins:
+		return clientUpdated.After(serverUpdated)
+	}
+	return false
+}
+
+// validateSyncMeta проверяет client_id и время изменения на устройстве
+func validateSyncMeta(meta *SyncRecordMeta) (time.Time, string) {
+	if meta.ClientID == "" || len(meta.ClientID) > 64 {
+		return time.Time{}, "client_id is required (up to 64 characters)"
+	}
+	clientTime, err := time.Parse(time.RFC3339, meta.ClientUpdatedAt)
+	if err != nil {
+		return time.Time{}, "Invalid client_updated_at (use RFC3339)"
+	}
+	// Часы устройства могут спешить: изменение "из будущего" считаем сделанным сейчас
+	if now := time.Now(); clientTime.After(now) {
+		clientTime = now
+	}
+	return clientTime, ""
+}
+
+// syncClassIDs - классы, которые пользователь синхронизирует: админ - все классы школы,
+// учитель - классы, где он классный руководитель или ведёт уроки
+func syncClassIDs(userID, schoolID uint, role interface{}) map[uint]bool {
+	var ids []uint
+	if role == "admin" {
+		database.DB.Model(&models.Class{}).Where("school_id = ?", schoolID).Pluck("id", &ids)
+	} else {
+		database.DB.Model(&models.Class{}).
+			Where("school_id = ? AND (homeroom_teacher_id = ? OR id IN (?))", schoolID, userID,
+				database.DB.Model(&models.Schedule{}).Select("class_id").Where("teacher_id = ?", userID)).
+			Pluck("id", &ids)
+	}
+
+	result := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		result[id] = true
+	}
+	return result
+}
+
+func syncFailed(result SyncResult, msg string) SyncResult {
+	result.Status = SyncError
+	result.Error = msg
+	return result
+}
+
+func syncSummary(results []SyncResult) map[string]int {
+	summary := make(map[string]int)
+	for _, r := range results {
+		summary[r.Status]++
+	}
+	return summary
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"classkeeper/internal/config"
+	"classkeeper/internal/trash"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// TrashHandler - корзина школы: удалённые записи, их восстановление и удаление навсегда
+type TrashHandler struct {
+	cfg *config.Config
+}
+
+func NewTrashHandler(cfg *config.Config) *TrashHandler {
+	return &TrashHandler{cfg: cfg}
+}
+
+// TrashItem - запись корзины с датой автоматического удаления
+type TrashItem struct {
+	trash.Item
+	PurgeAt *time.Time `json:"purge_at,omitempty"`
+}
+
+// ListTrash возвращает удалённые записи школы. Фильтр entity - имя таблицы
+// (users, classes, grades...).
+func (h *TrashHandler) ListTrash(c *gin.Context) {
+	schoolID, _ := c.Get("school_id")
+
+	items, err := trash.List(db(c), schoolID.(uint), c.Query("entity"))
+	if errors.Is(err, trash.ErrUnknownEntity) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown entity"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get trash"})
+		return
+	}
+
+	days := h.cfg.Trash.RetentionDays
+	result := make([]TrashItem, len(items))
+	for i, item := range items {
+		result[i] = TrashItem{Item: item}
+		if days > 0 {
+			purgeAt := item.DeletedAt.AddDate(0, 0, days)
+			result[i].PurgeAt = &purgeAt
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items":          result,
+		"entities":       trash.Entities(),
+		"retention_days": days,
+	})
+}
+
+// RestoreTrashItem возвращает запись из корзины. Если записи, на которые она
+// ссылается, тоже удалены, или такая же запись создана заново - 409 со списком причин.
+func (h *TrashHandler) RestoreTrashItem(c *gin.Context) {
+	h.apply(c, trash.Restore, "Item restored successfully", "Failed to restore item")
+}
+
+// PurgeTrashItem удаляет запись из корзины навсегда. Если на запись ещё
+// ссылаются другие - 409 со списком ссылок.
+func (h *TrashHandler) PurgeTrashItem(c *gin.Context) {
+	h.apply(c, trash.Purge, "Item deleted permanently", "Failed to delete item")
+}
+
+func (h *TrashHandler) apply(c *gin.Context, action func(*gorm.DB, uint, string, uint) error, success, failure string) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	schoolID, _ := c.Get("school_id")
+
+	err = action(db(c), schoolID.(uint), c.Param("entity"), uint(id))
+	var blocked *trash.BlockedError
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, gin.H{"message": success})
+	case errors.Is(err, trash.ErrUnknownEntity):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown entity"})
+	case errors.Is(err, trash.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found in trash"})
+	case errors.As(err, &blocked):
+		c.JSON(http.StatusConflict, gin.H{"error": failure, "blockers": blocked.Blockers})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": failure})
+	}
+}
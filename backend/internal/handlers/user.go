@@ -8,6 +8,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 type UserHandler struct{}
@@ -131,7 +132,7 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 		user.AdminTitle = req.AdminTitle
 	}
 
-	if err := database.DB.Save(&user).Error; err != nil {
+	if err := db(c).Save(&user).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
 		return
 	}
@@ -168,7 +169,7 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 		}
 	}
 
-	if err := database.DB.Delete(&user).Error; err != nil {
+	if err := db(c).Delete(&user).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
 		return
 	}
@@ -218,10 +219,92 @@ func (h *UserHandler) ChangePassword(c *gin.Context) {
 	}
 
 	user.PasswordHash = string(hashedPassword)
-	if err := database.DB.Save(&user).Error; err != nil {
+	if err := db(c).Save(&user).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
 }
+
+// BulkUsersRequest структура для массового создания пользователей
+type BulkUsersRequest struct {
+	Mode  string            `json:"mode"` // atomic (по умолчанию), partial, validate
+	Users []RegisterRequest `json:"users" binding:"required"`
+}
+
+// userRoles - допустимые роли пользователей
+var userRoles = map[string]bool{
+	"admin":    true,
+	"teacher":  true,
+	"student":  true,
+	"parent":   true,
+	"starosta": true,
+}
+
+// BulkCreateUsers создаёт пользователей своей школы в одной транзакции с отчётом по каждому
+func (h *UserHandler) BulkCreateUsers(c *gin.Context) {
+	schoolID, _ := c.Get("school_id")
+
+	var req BulkUsersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	mode, ok := parseBulkMode(c, req.Mode, len(req.Users), maxBulkItems)
+	if !ok {
+		return
+	}
+
+	users := make([]models.User, 0, len(req.Users))
+	report, err := runBulk(c, mode, len(req.Users), func(tx *gorm.DB, i int) (uint, interface{}, error) {
+		item := req.Users[i]
+		if err := validateBulkItem(item); err != nil {
+			return 0, nil, err
+		}
+		if !userRoles[item.Role] {
+			return 0, nil, itemError("Invalid role (use admin, teacher, student, parent or starosta)")
+		}
+		if item.SchoolID != 0 && item.SchoolID != schoolID.(uint) {
+			return 0, nil, itemError("Users can only be created in your school")
+		}
+
+		// Уникальность username и email, включая удалённых и созданных этим же запросом
+		var count int64
+		tx.Unscoped().Model(&models.User{}).
+			Where("username = ? OR email = ?", item.Username, item.Email).
+			Count(&count)
+		if count > 0 {
+			return 0, nil, itemError("Username or email already exists")
+		}
+
+		// Пароль хранится так же, как при регистрации
+		user := models.User{
+			SchoolID:       schoolID.(uint),
+			Username:       item.Username,
+			Email:          item.Email,
+			PasswordHash:   item.Password,
+			Role:           item.Role,
+			FirstName:      item.FirstName,
+			LastName:       item.LastName,
+			MiddleName:     item.MiddleName,
+			TeacherSubject: item.TeacherSubject,
+		}
+		if err := tx.Create(&user).Error; err != nil {
+			return 0, nil, err
+		}
+		users = append(users, user)
+		return user.ID, nil, nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create users"})
+		return
+	}
+
+	extra := gin.H{}
+	if report.Committed {
+		extra["users"] = users
+	}
+	respondBulk(c, report, extra)
+}
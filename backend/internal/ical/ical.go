@@ -0,0 +1,257 @@
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Event представляет одно событие VEVENT
+type Event struct {
+	UID         string
+	Summary     string
+	Description string
+	Location    string
+	Categories  []string
+	Start       time.Time
+	End         time.Time
+	AllDay      bool // Событие на целый день (DTSTART;VALUE=DATE)
+	Updated     time.Time
+}
+
+// Calendar представляет календарь VCALENDAR
+type Calendar struct {
+	Name     string
+	TimeZone string // Например "Europe/Moscow"
+	Events   []Event
+}
+
+const (
+	dateLayout     = "20060102"
+	dateTimeLayout = "20060102T150405"
+	utcLayout      = "20060102T150405Z"
+)
+
+// Write сериализует календарь в формат RFC 5545
+func (cal *Calendar) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	writeLine(bw, "BEGIN:VCALENDAR")
+	writeLine(bw, "VERSION:2.0")
+	writeLine(bw, "PRODID:-//ClassKeeper//ClassKeeper//RU")
+	writeLine(bw, "CALSCALE:GREGORIAN")
+	writeLine(bw, "METHOD:PUBLISH")
+	if cal.Name != "" {
+		writeLine(bw, "X-WR-CALNAME:"+escapeText(cal.Name))
+	}
+	if cal.TimeZone != "" {
+		writeLine(bw, "X-WR-TIMEZONE:"+cal.TimeZone)
+	}
+
+	stamp := time.Now().UTC().Format(utcLayout)
+	for _, e := range cal.Events {
+		writeLine(bw, "BEGIN:VEVENT")
+		writeLine(bw, "UID:"+e.UID)
+		if !e.Updated.IsZero() {
+			writeLine(bw, "DTSTAMP:"+e.Updated.UTC().Format(utcLayout))
+			writeLine(bw, "LAST-MODIFIED:"+e.Updated.UTC().Format(utcLayout))
+		} else {
+			writeLine(bw, "DTSTAMP:"+stamp)
+		}
+
+		if e.AllDay {
+			writeLine(bw, "DTSTART;VALUE=DATE:"+e.Start.Format(dateLayout))
+			end := e.End
+			if end.IsZero() || !end.After(e.Start) {
+				end = e.Start.AddDate(0, 0, 1)
+			}
+			writeLine(bw, "DTEND;VALUE=DATE:"+end.Format(dateLayout))
+		} else {
+			writeLine(bw, formatDateTime("DTSTART", e.Start, cal.TimeZone))
+			writeLine(bw, formatDateTime("DTEND", e.End, cal.TimeZone))
+		}
+
+		writeLine(bw, "SUMMARY:"+escapeText(e.Summary))
+		if e.Description != "" {
+			writeLine(bw, "DESCRIPTION:"+escapeText(e.Description))
+		}
+		if e.Location != "" {
+			writeLine(bw, "LOCATION:"+escapeText(e.Location))
+		}
+		if len(e.Categories) > 0 {
+			escaped := make([]string, len(e.Categories))
+			for i, c := range e.Categories {
+				escaped[i] = escapeText(c)
+			}
+			writeLine(bw, "CATEGORIES:"+strings.Join(escaped, ","))
+		}
+		writeLine(bw, "END:VEVENT")
+	}
+
+	writeLine(bw, "END:VCALENDAR")
+	return bw.Flush()
+}
+
+// Parse читает события из календаря в формате RFC 5545.
+// Поддерживается подмножество, достаточное для импорта праздников и каникул.
+func Parse(r io.Reader) (*Calendar, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	cal := &Calendar{}
+	var current *Event
+
+	for i, line := range lines {
+		name, params, value, ok := splitLine(line)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			current = &Event{}
+		case name == "END" && value == "VEVENT":
+			if current == nil {
+				return nil, fmt.Errorf("line %d: END:VEVENT without BEGIN", i+1)
+			}
+			if current.Start.IsZero() {
+				return nil, fmt.Errorf("line %d: VEVENT without DTSTART", i+1)
+			}
+			cal.Events = append(cal.Events, *current)
+			current = nil
+		case name == "X-WR-CALNAME" && current == nil:
+			cal.Name = unescapeText(value)
+		case name == "X-WR-TIMEZONE" && current == nil:
+			cal.TimeZone = value
+		case current != nil:
+			switch name {
+			case "UID":
+				current.UID = value
+			case "SUMMARY":
+				current.Summary = unescapeText(value)
+			case "DESCRIPTION":
+				current.Description = unescapeText(value)
+			case "LOCATION":
+				current.Location = unescapeText(value)
+			case "CATEGORIES":
+				for _, c := range strings.Split(value, ",") {
+					if c = strings.TrimSpace(unescapeText(c)); c != "" {
+						current.Categories = append(current.Categories, c)
+					}
+				}
+			case "DTSTART", "DTEND":
+				t, allDay, err := parseDate(value, params)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", i+1, err)
+				}
+				if name == "DTSTART" {
+					current.Start = t
+					current.AllDay = allDay
+				} else {
+					current.End = t
+				}
+			}
+		}
+	}
+
+	return cal, nil
+}
+
+// writeLine пишет строку, сворачивая её по 75 октетов согласно RFC 5545
+func writeLine(w *bufio.Writer, line string) {
+	const limit = 75
+	for len(line) > limit {
+		cut := limit
+		// Не разрываем многобайтовый символ UTF-8
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		w.WriteString(line[:cut])
+		w.WriteString("\r\n ")
+		line = line[cut:]
+	}
+	w.WriteString(line)
+	w.WriteString("\r\n")
+}
+
+func formatDateTime(name string, t time.Time, tz string) string {
+	if tz != "" {
+		if loc, err := time.LoadLocation(tz); err == nil {
+			return fmt.Sprintf("%s;TZID=%s:%s", name, tz, t.In(loc).Format(dateTimeLayout))
+		}
+	}
+	return name + ":" + t.UTC().Format(utcLayout)
+}
+
+func escapeText(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+	return r.Replace(s)
+}
+
+func unescapeText(s string) string {
+	r := strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+	return r.Replace(s)
+}
+
+// unfold читает строки, склеивая продолжения (строки, начинающиеся с пробела или табуляции)
+func unfold(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// splitLine разбирает строку вида NAME;PARAM=VALUE:value
+func splitLine(line string) (name string, params map[string]string, value string, ok bool) {
+	colon := strings.Index(line, ":")
+	if colon < 0 {
+		return "", nil, "", false
+	}
+
+	head := line[:colon]
+	value = line[colon+1:]
+
+	parts := strings.Split(head, ";")
+	name = strings.ToUpper(parts[0])
+	params = make(map[string]string)
+	for _, p := range parts[1:] {
+		if eq := strings.Index(p, "="); eq > 0 {
+			params[strings.ToUpper(p[:eq])] = strings.Trim(p[eq+1:], `"`)
+		}
+	}
+	return name, params, value, true
+}
+
+func parseDate(value string, params map[string]string) (time.Time, bool, error) {
+	if params["VALUE"] == "DATE" || len(value) == len(dateLayout) {
+		t, err := time.Parse(dateLayout, value)
+		return t, true, err
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse(utcLayout, value)
+		return t, false, err
+	}
+
+	loc := time.UTC
+	if tz := params["TZID"]; tz != "" {
+		if l, err := time.LoadLocation(tz); err == nil {
+			loc = l
+		}
+	}
+	t, err := time.ParseInLocation(dateTimeLayout, value, loc)
+	return t, false, err
+}
@@ -0,0 +1,282 @@
+package integrity
+
+import (
+	"fmt"
+
+	"classkeeper/internal/trash"
+)
+
+// students - роли учеников: староста тоже ученик
+var students = []string{"student", "starosta"}
+
+// roleRule - колонка со ссылкой на пользователя, у которого должна быть одна из ролей
+type roleRule struct {
+	table  string
+	column string
+	roles  []string
+	manual bool // Строку нельзя ни удалить, ни очистить автоматически: это оценки и отметки
+}
+
+// roleRules - те же проверки ролей, что делают обработчики при создании записей
+var roleRules = []roleRule{
+	{table: "classes", column: "homeroom_teacher_id", roles: []string{"teacher"}},
+	{table: "classes", column: "starosta_id", roles: students},
+	{table: "class_students", column: "user_id", roles: students},
+	{table: "teachers_subjects", column: "user_id", roles: []string{"teacher"}},
+	{table: "parent_students", column: "parent_id", roles: []string{"parent"}},
+	{table: "parent_students", column: "student_id", roles: students},
+	{table: "grades", column: "student_id", roles: students, manual: true},
+	{table: "attendances", column: "student_id", roles: students, manual: true},
+}
+
+// orphans находит ссылки на строки, которых нет в таблице даже среди удалённых в корзину
+// (ссылки на строки в корзине находит deletedReferences). Проверяются только живые
+// строки: удалённые в корзину проверяет корзина при восстановлении.
+func (c *checker) orphans(schoolID uint) ([]Finding, error) {
+	var findings []Finding
+	for _, ref := range trash.References() {
+		query, err := c.scoped(ref.Table, schoolID)
+		if err != nil {
+			return nil, err
+		}
+		keys, err := c.keyColumns(ref.Table)
+		if err != nil {
+			return nil, err
+		}
+		fix, err := c.referenceFix(ref.Table, ref.Column)
+		if err != nil {
+			return nil, err
+		}
+		part, err := collect(query.
+			Where(ref.Table+"."+ref.Column+" IS NOT NULL").
+			Where(fmt.Sprintf("NOT EXISTS (SELECT 1 FROM %s t WHERE t.id = %s.%s)", ref.Target, ref.Table, ref.Column)),
+			keys, Finding{Check: CheckOrphan, SchoolID: schoolID, Table: ref.Table, Column: ref.Column, Target: ref.Target, Fix: fix})
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, part...)
+	}
+	return findings, nil
+}
+
+// deletedReferences находит живые строки, которые ссылаются на удалённые в корзину:
+// например, оценки удалённого ученика. Предлагается восстановить строку из корзины,
+// а если её удалили намеренно - отвязать ссылку (Alternative). Строки таблиц без
+// корзины можно только отвязать.
+func (c *checker) deletedReferences(schoolID uint) ([]Finding, error) {
+	restorable := make(map[string]bool)
+	for _, name := range trash.Entities() {
+		restorable[name] = true
+	}
+
+	var findings []Finding
+	for _, ref := range trash.References() {
+		targetCols, err := c.columnTypes(ref.Target)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := targetCols["deleted_at"]; !ok {
+			continue
+		}
+		query, err := c.scoped(ref.Table, schoolID)
+		if err != nil {
+			return nil, err
+		}
+		keys, err := c.keyColumns(ref.Table)
+		if err != nil {
+			return nil, err
+		}
+		detach, err := c.referenceFix(ref.Table, ref.Column)
+		if err != nil {
+			return nil, err
+		}
+		template := Finding{Check: CheckDeletedReference, SchoolID: schoolID, Table: ref.Table, Column: ref.Column, Target: ref.Target, Fix: detach}
+		if restorable[ref.Target] {
+			template.Fix = Fix{Action: FixRestore, Description: fmt.Sprintf("restore the %s row from the trash", ref.Target)}
+			template.Alternative = &detach
+		}
+		part, err := collect(query.
+			Where(fmt.Sprintf("EXISTS (SELECT 1 FROM %s t WHERE t.id = %s.%s AND t.deleted_at IS NOT NULL)", ref.Target, ref.Table, ref.Column)),
+			keys, template)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, part...)
+	}
+	return findings, nil
+}
+
+// crossSchool находит строки школы, которые ссылаются на строки другой школы:
+// например, оценку по предмету чужой школы или ученика чужой школы в классе
+func (c *checker) crossSchool(schoolID uint) ([]Finding, error) {
+	var findings []Finding
+	for _, ref := range trash.References() {
+		query, err := c.scoped(ref.Table, schoolID)
+		if err != nil {
+			return nil, err
+		}
+		keys, err := c.keyColumns(ref.Table)
+		if err != nil {
+			return nil, err
+		}
+		fix, err := c.referenceFix(ref.Table, ref.Column)
+		if err != nil {
+			return nil, err
+		}
+		// Условие школы цели без префикса относится к строке t подзапроса
+		scope, args, err := schoolScope(ref.Target, schoolID)
+		if err != nil {
+			return nil, err
+		}
+		part, err := collect(query.
+			Where(fmt.Sprintf("EXISTS (SELECT 1 FROM %s t WHERE t.id = %s.%s AND NOT (%s))", ref.Target, ref.Table, ref.Column, scope), args...),
+			keys, Finding{Check: CheckCrossSchool, SchoolID: schoolID, Table: ref.Table, Column: ref.Column, Target: ref.Target, Fix: fix})
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, part...)
+	}
+	return findings, nil
+}
+
+// roles находит ссылки на пользователей не с той ролью и старост, которые не учатся
+// в своём классе
+func (c *checker) roles(schoolID uint) ([]Finding, error) {
+	var findings []Finding
+	for _, rule := range roleRules {
+		query, err := c.scoped(rule.table, schoolID)
+		if err != nil {
+			return nil, err
+		}
+		keys, err := c.keyColumns(rule.table)
+		if err != nil {
+			return nil, err
+		}
+		fix := Fix{Action: FixNone, Description: fmt.Sprintf("change the role of the user or fix %s.%s by hand", rule.table, rule.column)}
+		if !rule.manual {
+			if fix, err = c.referenceFix(rule.table, rule.column); err != nil {
+				return nil, err
+			}
+		}
+		part, err := collect(query.
+			Where(fmt.Sprintf("EXISTS (SELECT 1 FROM users t WHERE t.id = %s.%s AND t.role NOT IN ?)", rule.table, rule.column), rule.roles),
+			keys, Finding{Check: CheckRole, SchoolID: schoolID, Table: rule.table, Column: rule.column, Target: "users",
+				Reason: ReasonWrongRole, Expected: rule.roles, Fix: fix})
+		if err != nil {
+			return nil, err
+		}
+		if err := c.fillRoles(part); err != nil {
+			return nil, err
+		}
+		findings = append(findings, part...)
+	}
+
+	// Староста выбирается из учеников класса
+	query, err := c.scoped("classes", schoolID)
+	if err != nil {
+		return nil, err
+	}
+	fix, err := c.referenceFix("classes", "starosta_id")
+	if err != nil {
+		return nil, err
+	}
+	part, err := collect(query.
+		Where("classes.starosta_id IS NOT NULL").
+		Where("EXISTS (SELECT 1 FROM users t WHERE t.id = classes.starosta_id AND t.role IN ?)", students).
+		Where("NOT EXISTS (SELECT 1 FROM class_students cs WHERE cs.class_id = classes.id AND cs.user_id = classes.starosta_id)"),
+		[]string{"id"}, Finding{Check: CheckRole, SchoolID: schoolID, Table: "classes", Column: "starosta_id", Target: "users",
+			Reason: ReasonNotMember, Fix: fix})
+	if err != nil {
+		return nil, err
+	}
+	if err := c.fillRoles(part); err != nil {
+		return nil, err
+	}
+	return append(findings, part...), nil
+}
+
+// fillRoles дописывает в находки роль пользователя из колонки Value
+func (c *checker) fillRoles(findings []Finding) error {
+	if len(findings) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(findings))
+	for i, f := range findings {
+		ids[i] = f.Value
+	}
+	var users []struct {
+		ID   uint
+		Role string
+	}
+	if err := c.db.Table("users").Select("id, role").Where("id IN ?", ids).Scan(&users).Error; err != nil {
+		return err
+	}
+	roles := make(map[uint]string, len(users))
+	for _, u := range users {
+		roles[u.ID] = u.Role
+	}
+	for i := range findings {
+		findings[i].Role = roles[findings[i].Value]
+	}
+	return nil
+}
+
+// duplicateAttendance находит несколько живых отметок ученика за один урок: в классе
+// за день и номер урока (или за день без номера урока). Остаётся отметка, привязанная
+// к уроку расписания, а из равных - изменённая последней; остальные удаляются.
+func (c *checker) duplicateAttendance(schoolID uint) ([]Finding, error) {
+	query, err := c.scoped("attendances", schoolID)
+	if err != nil {
+		return nil, err
+	}
+	fix, err := deleteFix(c, "attendances")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := query.
+		Select("attendances.id, attendances.student_id, attendances.class_id, attendances.date, COALESCE(attendances.lesson_number, 0)").
+		Where(`EXISTS (SELECT 1 FROM attendances b WHERE b.deleted_at IS NULL AND b.id <> attendances.id
+			AND b.student_id = attendances.student_id AND b.class_id = attendances.class_id AND b.date = attendances.date
+			AND COALESCE(b.lesson_number, 0) = COALESCE(attendances.lesson_number, 0))`).
+		Order("attendances.student_id, attendances.class_id, attendances.date, COALESCE(attendances.lesson_number, 0), " +
+			"attendances.schedule_id IS NULL, attendances.updated_at DESC, attendances.id DESC").
+		Rows()
+	if err != nil {
+		return nil, fmt.Errorf("check attendances: %w", err)
+	}
+	defer rows.Close()
+
+	type slot struct {
+		studentID, classID uint
+		date               string
+		lesson             int
+	}
+	var findings []Finding
+	var current slot
+	var kept uint
+	for rows.Next() {
+		var id uint
+		var s slot
+		if err := rows.Scan(&id, &s.studentID, &s.classID, &s.date, &s.lesson); err != nil {
+			return nil, err
+		}
+		if len(s.date) > 10 {
+			s.date = s.date[:10] // SQLite и PostgreSQL отдают дату со временем
+		}
+		if kept == 0 || s != current {
+			current, kept = s, id
+			continue
+		}
+		findings = append(findings, Finding{
+			Check:    CheckDuplicateAttendance,
+			SchoolID: schoolID,
+			Table:    "attendances",
+			Key:      map[string]uint{"id": id},
+			Value:    kept,
+			Target:   "attendances",
+			Fix: Fix{Action: fix.Action, Description: fmt.Sprintf("%s, keep attendance %d for student %d on %s",
+				fix.Description, kept, s.studentID, s.date)},
+		})
+	}
+	return findings, rows.Err()
+}
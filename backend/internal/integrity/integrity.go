@@ -0,0 +1,337 @@
+// Package integrity проверяет целостность данных: ссылки на несуществующие записи, на
+// удалённые в корзину и на записи другой школы, пользователей не с той ролью и повторные отметки посещаемости.
+// В SQLite внешние ключи не проверяются, поэтому такие строки появляются после ручных
+// правок базы, прерванных импортов и ошибок в коде. Для каждой проблемы предлагается
+// исправление, которое Repair может применить или только показать.
+package integrity
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"classkeeper/internal/backup"
+	"classkeeper/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Виды проблем
+const (
+	CheckOrphan              = "orphaned_reference"     // Ссылка на строку, которой нет
+	CheckDeletedReference    = "deleted_reference"      // Ссылка на строку в корзине
+	CheckCrossSchool         = "cross_school_reference" // Ссылка на строку другой школы
+	CheckRole                = "role_mismatch"          // Пользователь не с той ролью
+	CheckDuplicateAttendance = "duplicate_attendance"   // Две отметки ученика за один урок
+)
+
+// Checks - все виды проблем в порядке проверки
+var Checks = []string{CheckOrphan, CheckDeletedReference, CheckCrossSchool, CheckRole, CheckDuplicateAttendance}
+
+// RepairChecks - виды проблем, которые Repair исправляет по умолчанию. Ссылки на строки
+// в корзине обычно остаются после намеренного удаления (оценки удалённого ученика), а их
+// исправление восстанавливает удалённое, поэтому deleted_reference исправляется только
+// по явному запросу.
+var RepairChecks = []string{CheckOrphan, CheckCrossSchool, CheckRole, CheckDuplicateAttendance}
+
+// Исправления
+const (
+	FixClear   = "clear"   // Очистить колонку
+	FixDelete  = "delete"  // Удалить строку (в корзину, если у таблицы она есть)
+	FixRestore = "restore" // Восстановить из корзины строку, на которую ссылается колонка
+	FixNone    = "none"    // Автоматического исправления нет, нужно разобраться вручную
+)
+
+// Причины несоответствия роли
+const (
+	ReasonWrongRole = "wrong_role"       // У пользователя другая роль
+	ReasonNotMember = "not_class_member" // Староста не учится в этом классе
+)
+
+// ErrUnknownCheck - неизвестный вид проблемы
+var ErrUnknownCheck = errors.New("unknown integrity check")
+
+// Finding - найденная проблема в одной строке
+type Finding struct {
+	Check    string          `json:"check"`
+	SchoolID uint            `json:"school_id,omitempty"` // Школа строки, если известна
+	Table    string          `json:"table"`
+	Key      map[string]uint `json:"key"`              // Первичный ключ строки
+	Column   string          `json:"column,omitempty"` // Колонка с проблемой
+	Value    uint            `json:"value,omitempty"`  // Значение колонки; для повторной отметки - ID оставляемой
+	Target   string          `json:"target,omitempty"` // Таблица, на которую ссылается колонка
+	Reason   string          `json:"reason,omitempty"` // Уточнение для role_mismatch
+	Role     string          `json:"role,omitempty"`   // Роль пользователя для role_mismatch
+	Expected []string        `json:"expected,omitempty"`
+	Fix      Fix             `json:"fix"`
+	// Alternative - другое исправление, которое можно сделать вручную: для ссылки на
+	// строку в корзине - отвязать ссылку, если строку удалили намеренно
+	Alternative *Fix `json:"alternative,omitempty"`
+}
+
+// Fix - предлагаемое исправление
+type Fix struct {
+	Action      string `json:"action"` // clear, delete, restore, none
+	Description string `json:"description"`
+}
+
+// Report - результат проверки
+type Report struct {
+	SchoolID uint           `json:"school_id,omitempty"` // 0 - весь экземпляр
+	Checks   []string       `json:"checks"`
+	Counts   map[string]int `json:"counts"` // вид проблемы -> число строк
+	Findings []Finding      `json:"findings"`
+}
+
+// Failed сообщает, найдены ли проблемы
+func (r *Report) Failed() bool {
+	return len(r.Findings) > 0
+}
+
+func (r *Report) add(findings []Finding) {
+	for _, f := range findings {
+		r.Counts[f.Check]++
+	}
+	r.Findings = append(r.Findings, findings...)
+}
+
+// extraScopes - условия выборки строк школы из таблиц, которые не входят в архив.
+// Параметры - ID школы.
+var extraScopes = map[string]string{
+	"calendar_feeds":    "user_id IN (SELECT id FROM users WHERE school_id = ?)",
+	"check_in_sessions": "schedule_id IN (SELECT id FROM schedules WHERE class_id IN (SELECT id FROM classes WHERE school_id = ?))",
+	"check_ins":         "student_id IN (SELECT id FROM users WHERE school_id = ?)",
+}
+
+// extraModels - модели таблиц, которые не входят в архив
+var extraModels = map[string]interface{}{
+	"calendar_feeds":    &models.CalendarFeed{},
+	"check_in_sessions": &models.CheckInSession{},
+	"check_ins":         &models.CheckIn{},
+}
+
+// Check проверяет данные школы schoolID или всего экземпляра (schoolID = 0). checks -
+// виды проблем, по умолчанию все. При проверке одной школы строки, потерявшие ссылку
+// на саму школу (например, оценка удалённого навсегда ученика), не видны: их находит
+// только проверка экземпляра.
+func Check(db *gorm.DB, schoolID uint, checks ...string) (*Report, error) {
+	if len(checks) == 0 {
+		checks = Checks
+	}
+	c := &checker{db: db, columns: make(map[string]map[string]gorm.ColumnType)}
+	runs := map[string]func(uint) ([]Finding, error){
+		CheckOrphan:              c.orphans,
+		CheckDeletedReference:    c.deletedReferences,
+		CheckCrossSchool:         c.crossSchool,
+		CheckRole:                c.roles,
+		CheckDuplicateAttendance: c.duplicateAttendance,
+	}
+	for _, check := range checks {
+		if runs[check] == nil {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownCheck, check)
+		}
+	}
+
+	report := &Report{
+		SchoolID: schoolID,
+		Checks:   checks,
+		Counts:   make(map[string]int),
+		Findings: []Finding{},
+	}
+	for _, check := range checks {
+		var findings []Finding
+		var err error
+		if check == CheckOrphan || schoolID != 0 {
+			findings, err = runs[check](schoolID)
+		} else {
+			// Остальные проверки сравнивают строки со школой, поэтому экземпляр
+			// проверяется по школам, включая удалённые в корзину
+			findings, err = c.eachSchool(runs[check])
+		}
+		if err != nil {
+			return nil, err
+		}
+		report.add(findings)
+	}
+	return report, nil
+}
+
+// checker - одна проверка; запоминает колонки таблиц
+type checker struct {
+	db      *gorm.DB
+	columns map[string]map[string]gorm.ColumnType
+}
+
+func (c *checker) eachSchool(run func(uint) ([]Finding, error)) ([]Finding, error) {
+	var ids []uint
+	if err := c.db.Unscoped().Model(&models.School{}).Order("id").Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	var findings []Finding
+	for _, id := range ids {
+		part, err := run(id)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, part...)
+	}
+	return findings, nil
+}
+
+// columnTypes возвращает колонки таблицы. Migrator.HasColumn в SQLite ищет имя в тексте
+// CREATE TABLE и находит id в REFERENCES classes(id) связующих таблиц.
+func (c *checker) columnTypes(table string) (map[string]gorm.ColumnType, error) {
+	if cols, ok := c.columns[table]; ok {
+		return cols, nil
+	}
+	types, err := c.db.Migrator().ColumnTypes(table)
+	if err != nil {
+		return nil, err
+	}
+	cols := make(map[string]gorm.ColumnType, len(types))
+	for _, t := range types {
+		cols[t.Name()] = t
+	}
+	c.columns[table] = cols
+	return cols, nil
+}
+
+// scoped возвращает запрос к живым строкам таблицы в школе schoolID (0 - во всех школах)
+func (c *checker) scoped(table string, schoolID uint) (*gorm.DB, error) {
+	query := c.db.Table(table)
+	cols, err := c.columnTypes(table)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := cols["deleted_at"]; ok {
+		query = query.Where(table + ".deleted_at IS NULL")
+	}
+	if schoolID == 0 {
+		return query, nil
+	}
+	scope, args, err := schoolScope(table, schoolID)
+	if err != nil {
+		return nil, err
+	}
+	return query.Where(scope, args...), nil
+}
+
+// keyColumns - первичный ключ таблицы: id или пара колонок связующей таблицы
+func (c *checker) keyColumns(table string) ([]string, error) {
+	cols, err := c.columnTypes(table)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := cols["id"]; ok {
+		return []string{"id"}, nil
+	}
+	var keys []string
+	for _, ref := range backup.References() {
+		if ref.Table == table {
+			keys = append(keys, ref.Column)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no key columns for table %s", table)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// referenceFix предлагает исправление ссылки: очистить колонку, если она может быть
+// пустой, иначе удалить строку. Колонки ключа связующих таблиц SQLite считает
+// допускающими NULL, поэтому они проверяются отдельно.
+func (c *checker) referenceFix(table, column string) (Fix, error) {
+	cols, err := c.columnTypes(table)
+	if err != nil {
+		return Fix{}, err
+	}
+	keys, err := c.keyColumns(table)
+	if err != nil {
+		return Fix{}, err
+	}
+	key := false
+	for _, k := range keys {
+		key = key || k == column
+	}
+	if nullable, ok := cols[column].Nullable(); ok && nullable && !key {
+		return Fix{Action: FixClear, Description: fmt.Sprintf("set %s.%s to NULL", table, column)}, nil
+	}
+	return deleteFix(c, table)
+}
+
+func deleteFix(c *checker, table string) (Fix, error) {
+	cols, err := c.columnTypes(table)
+	if err != nil {
+		return Fix{}, err
+	}
+	if _, ok := cols["deleted_at"]; ok {
+		return Fix{Action: FixDelete, Description: fmt.Sprintf("move the %s row to the trash", table)}, nil
+	}
+	return Fix{Action: FixDelete, Description: fmt.Sprintf("delete the %s row", table)}, nil
+}
+
+// collect выполняет запрос, который выбирает ключ строки и колонку value, и
+// возвращает по находке на строку
+func collect(query *gorm.DB, keys []string, template Finding) ([]Finding, error) {
+	rows, err := query.
+		Select(strings.Join(append(qualify(template.Table, keys), template.Table+"."+template.Column+" AS value"), ", ")).
+		Order(strings.Join(qualify(template.Table, keys), ", ")).
+		Rows()
+	if err != nil {
+		return nil, fmt.Errorf("check %s.%s: %w", template.Table, template.Column, err)
+	}
+	defer rows.Close()
+
+	var findings []Finding
+	for rows.Next() {
+		values := make([]uint, len(keys)+1)
+		dest := make([]interface{}, len(values))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		f := template
+		f.Key = make(map[string]uint, len(keys))
+		for i, k := range keys {
+			f.Key[k] = values[i]
+		}
+		f.Value = values[len(keys)]
+		findings = append(findings, f)
+	}
+	return findings, rows.Err()
+}
+
+// schoolScope возвращает условие выборки строк школы из таблицы и его параметры
+func schoolScope(table string, schoolID uint) (string, []interface{}, error) {
+	scope, ok := backup.SchoolScope(table)
+	if !ok {
+		if scope, ok = extraScopes[table]; !ok {
+			return "", nil, fmt.Errorf("no school scope for table %s", table)
+		}
+	}
+	args := make([]interface{}, strings.Count(scope, "?"))
+	for i := range args {
+		args[i] = schoolID
+	}
+	return scope, args, nil
+}
+
+// modelOf возвращает модель таблицы
+func modelOf(table string) interface{} {
+	if model, ok := backup.Model(table); ok {
+		return model
+	}
+	return extraModels[table]
+}
+
+func qualify(table string, columns []string) []string {
+	result := make([]string, len(columns))
+	for i, column := range columns {
+		result[i] = table + "." + column
+	}
+	return result
+}
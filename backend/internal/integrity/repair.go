@@ -0,0 +1,164 @@
+package integrity
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"classkeeper/internal/audit"
+	"classkeeper/internal/trash"
+
+	"gorm.io/gorm"
+)
+
+// errDryRun откатывает транзакцию пробного исправления
+var errDryRun = errors.New("dry run")
+
+// RepairOptions - параметры исправления
+type RepairOptions struct {
+	// DryRun - только показать результат: исправления выполняются в транзакции,
+	// которая откатывается
+	DryRun bool
+	// Checks - виды проблем, по умолчанию RepairChecks
+	Checks []string
+}
+
+// RepairResult - результат исправления
+type RepairResult struct {
+	DryRun    bool      `json:"dry_run"`
+	Fixed     []Finding `json:"fixed"`     // Исправленные проблемы (при DryRun - которые будут исправлены)
+	Manual    []Finding `json:"manual"`    // Проблемы без автоматического исправления
+	Remaining *Report   `json:"remaining"` // Проверка после исправления
+}
+
+// Failed сообщает, остались ли проблемы после исправления
+func (r *RepairResult) Failed() bool {
+	return r.Remaining.Failed()
+}
+
+// Repair исправляет проблемы школы schoolID или всего экземпляра (schoolID = 0) так,
+// как предлагают находки Check. Строки удаляются, меняются и восстанавливаются через
+// модели и корзину: всё попадает в журнал аудита, офлайн-клиенты узнают об удалённых
+// отметках и оценках. Удаление может открыть новые проблемы, а строку, которую корзина
+// не даёт восстановить, - не исправить; они видны в Remaining.
+func Repair(db *gorm.DB, schoolID uint, opts RepairOptions) (*RepairResult, error) {
+	checks := opts.Checks
+	if len(checks) == 0 {
+		checks = RepairChecks
+	}
+	result := &RepairResult{DryRun: opts.DryRun, Fixed: []Finding{}, Manual: []Finding{}}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		report, err := Check(tx, schoolID, checks...)
+		if err != nil {
+			return err
+		}
+		c := &checker{db: tx, columns: make(map[string]map[string]gorm.ColumnType)}
+		counts := make(map[string]audit.Change)
+		done := make(map[string]bool)
+		for _, f := range report.Findings {
+			if f.Fix.Action == FixNone {
+				result.Manual = append(result.Manual, f)
+				continue
+			}
+			fixed, err := c.apply(f, done)
+			if err != nil {
+				return fmt.Errorf("repair %s %v: %w", f.Table, f.Key, err)
+			}
+			if !fixed {
+				continue
+			}
+			result.Fixed = append(result.Fixed, f)
+			n, _ := counts[f.Check].New.(int)
+			counts[f.Check] = audit.Change{New: n + 1}
+		}
+
+		if result.Remaining, err = Check(tx, schoolID, report.Checks...); err != nil {
+			return err
+		}
+		if opts.DryRun {
+			return errDryRun
+		}
+		if len(result.Fixed) == 0 {
+			return nil
+		}
+		return audit.Record(tx, schoolID, audit.ActionRepair, "schools", schoolID, counts)
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		return nil, err
+	}
+	return result, nil
+}
+
+// apply выполняет исправление одной находки и сообщает, исправлена ли она. done - уже
+// удалённые строки и восстановленные цели: одна строка может попасть в несколько находок.
+func (c *checker) apply(f Finding, done map[string]bool) (bool, error) {
+	if f.Fix.Action == FixRestore {
+		return c.restore(f, done)
+	}
+
+	keys := make([]string, 0, len(f.Key))
+	for k := range f.Key {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	args := make([]interface{}, len(keys))
+	for i, k := range keys {
+		args[i] = f.Key[k]
+	}
+	rowKey := fmt.Sprintf("%s %v", f.Table, args)
+	if done[rowKey] {
+		return true, nil
+	}
+
+	id, ok := f.Key["id"]
+	if !ok {
+		// У связующих таблиц нет моделей с хуками и нет корзины: строки удаляются
+		// с записью в журнал аудита о каждой
+		if f.Fix.Action != FixDelete {
+			return false, fmt.Errorf("unsupported fix %s", f.Fix.Action)
+		}
+		done[rowKey] = true
+		return true, trash.DeleteLinks(c.db, f.SchoolID, f.Table, f.Key)
+	}
+
+	model := modelOf(f.Table)
+	if model == nil {
+		return false, fmt.Errorf("no model for table %s", f.Table)
+	}
+	row := reflect.New(reflect.TypeOf(model).Elem()).Interface()
+	if err := c.db.First(row, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return true, nil
+		}
+		return false, err
+	}
+	switch f.Fix.Action {
+	case FixClear:
+		return true, c.db.Model(row).Update(f.Column, nil).Error
+	case FixDelete:
+		done[rowKey] = true
+		return true, c.db.Delete(row).Error
+	}
+	return false, fmt.Errorf("unsupported fix %s", f.Fix.Action)
+}
+
+// restore восстанавливает из корзины строку, на которую ссылается находка. Строку,
+// которую корзина не даёт восстановить (она сама ссылается на удалённое или уже
+// создана заново), находка оставляет неисправленной.
+func (c *checker) restore(f Finding, done map[string]bool) (bool, error) {
+	target := fmt.Sprintf("restore %s %d", f.Target, f.Value)
+	if done[target] {
+		return true, nil
+	}
+	var blocked *trash.BlockedError
+	err := trash.Restore(c.db, f.SchoolID, f.Target, f.Value)
+	switch {
+	case errors.As(err, &blocked), errors.Is(err, trash.ErrNotFound):
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+	done[target] = true
+	return true, nil
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"classkeeper/internal/audit"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader - заголовок с ID запроса. Клиент может передать свой ID,
+// сервер возвращает его в ответе; по нему ищутся записи журнала аудита.
+const RequestIDHeader = "X-Request-ID"
+
+const maxRequestIDLength = 64
+
+// AuditMiddleware присваивает запросу ID и кладёт в контекст запроса сведения
+// для журнала аудита. Автора запроса дописывает AuthMiddleware.
+func AuditMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		}
+		c.Set("request_id", requestID)
+		c.Header(RequestIDHeader, requestID)
+
+		scope := &audit.Scope{
+			RequestID: requestID,
+			IP:        c.ClientIP(),
+			Method:    c.Request.Method,
+			Path:      c.Request.URL.Path,
+		}
+		c.Request = c.Request.WithContext(audit.NewContext(c.Request.Context(), scope))
+
+		c.Next()
+	}
+}
+
+// validRequestID принимает только короткие ID из букв, цифр, '-' и '_'
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
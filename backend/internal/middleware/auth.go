@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"classkeeper/internal/audit"
 	"classkeeper/internal/config"
 	"net/http"
 	"strings"
@@ -52,6 +53,9 @@ func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 			c.Set("user_id", claims.UserID)
 			c.Set("school_id", claims.SchoolID)
 			c.Set("role", claims.Role)
+			if scope := audit.FromContext(c.Request.Context()); scope != nil {
+				scope.SetUser(claims.UserID, claims.SchoolID, claims.Role)
+			}
 		} else {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
 			c.Abort()
@@ -85,12 +89,30 @@ func RequireRole(roles ...string) gin.HandlerFunc {
 	}
 }
 
+// RequireBackupOperator пускает к копиям всего экземпляра только админов школы
+// оператора (BACKUP_OPERATOR_SCHOOL). Админы остальных школ выгружают только свою
+// школу; если школа оператора не задана, копиями управляют из командной строки.
+func RequireBackupOperator(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, _ := c.Get("role")
+		schoolID, _ := c.Get("school_id")
+		operator := cfg.Backup.OperatorSchoolID
+		if operator == 0 || role != "admin" || schoolID != operator {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Instance backups are managed by the server operator"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
 // CORS middleware
 func CORSMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Authorization")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Authorization, X-Request-ID, X-Demo-Key")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "Content-Disposition, X-Request-ID")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 
 		if c.Request.Method == "OPTIONS" {
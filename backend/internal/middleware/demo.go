@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"classkeeper/internal/config"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BlockInDemo закрывает маршрут в демо-режиме. Посетитель может менять что угодно в
+// своей песочнице, но не действия над всем экземпляром: восстановление архива,
+// резервное копирование, создание школ и просмотр чужих школ.
+func BlockInDemo(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cfg.Demo.Enabled {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not available in demo mode"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -1,9 +1,13 @@
 package models
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // School представляет школу
@@ -27,7 +31,8 @@ type School struct {
 // User представляет пользователя системы
 type User struct {
 	ID           uint           `gorm:"primaryKey" json:"id"`
-	SchoolID     uint           `gorm:"not null;index" json:"school_id"`
+	SchoolID     uint           `gorm:"not null;index;uniqueIndex:idx_users_external" json:"school_id"`
+	ExternalID   *string        `gorm:"size:64;uniqueIndex:idx_users_external" json:"external_id,omitempty"` // Код из внешней системы (ключ импорта)
 	Username     string         `gorm:"unique;not null;size:50" json:"username"`
 	Email        string         `gorm:"unique;not null;size:100" json:"email"`
 	PasswordHash string         `gorm:"not null;size:255" json:"-"`
@@ -38,6 +43,9 @@ type User struct {
 	AdminTitle   string         `gorm:"size:100" json:"admin_title,omitempty"` // Должность админа (завуч, старший учитель и т.д.)
 	TeacherSubject string       `gorm:"size:100" json:"teacher_subject,omitempty"` // Предмет учителя
 	AvatarURL    string         `gorm:"size:500" json:"avatar_url,omitempty"`
+	AnonymizedAt *time.Time     `json:"anonymized_at,omitempty"` // Персональные данные стёрты по запросу или сроку хранения
+	FailedLogins int            `gorm:"not null;default:0" json:"-"`      // Неудачных попыток входа подряд
+	LockedUntil  *time.Time     `json:"locked_until,omitempty"`          // Вход заблокирован после неудачных попыток
 	CreatedAt    time.Time      `json:"created_at"`
 	UpdatedAt    time.Time      `json:"updated_at"`
 	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
@@ -49,7 +57,8 @@ type User struct {
 // Class представляет класс в школе
 type Class struct {
 	ID                 uint           `gorm:"primaryKey" json:"id"`
-	SchoolID           uint           `gorm:"not null;index" json:"school_id"`
+	SchoolID           uint           `gorm:"not null;index;uniqueIndex:idx_classes_external" json:"school_id"`
+	ExternalID         *string        `gorm:"size:64;uniqueIndex:idx_classes_external" json:"external_id,omitempty"` // Код из внешней системы (ключ импорта)
 	Name               string         `gorm:"not null;size:50" json:"name"` // "9А", "11Б"
 	Year               string         `gorm:"not null;size:20" json:"year"` // учебный год "2025-2026"
 	HomeroomTeacherID  *uint          `json:"homeroom_teacher_id,omitempty"`
@@ -110,20 +119,28 @@ type Attendance struct {
 	ID           uint           `gorm:"primaryKey" json:"id"`
 	StudentID    uint           `gorm:"not null;index" json:"student_id"`
 	ClassID      uint           `gorm:"not null;index" json:"class_id"`
+	ScheduleID   *uint          `gorm:"index" json:"schedule_id,omitempty"` // Урок расписания, на котором отмечено присутствие
 	SubjectID    *uint          `gorm:"index" json:"subject_id,omitempty"`
 	Date         time.Time      `gorm:"not null;type:date;index" json:"date"`
 	LessonNumber *int           `json:"lesson_number,omitempty"`
 	Status       string         `gorm:"not null;size:20" json:"status"` // present, absent, late, excused
+	MinutesLate  int            `gorm:"not null;default:0" json:"minutes_late,omitempty"` // Для статуса late
 	Comment      string         `gorm:"type:text" json:"comment,omitempty"`
 	MarkedBy     *uint          `json:"marked_by,omitempty"`
+	ExcuseID     *uint          `gorm:"index" json:"excuse_id,omitempty"` // Одобренное заявление, по которому пропуск уважительный
+	ClientID     *string        `gorm:"size:64;uniqueIndex" json:"client_id,omitempty"` // ID, созданный офлайн-клиентом
+	SyncSeq      int64          `gorm:"not null;default:0;index" json:"sync_seq"`      // Номер последнего изменения для синхронизации
 	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
 	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
 
 	// Связи
-	Student User     `gorm:"foreignKey:StudentID" json:"student,omitempty"`
-	Class   Class    `gorm:"foreignKey:ClassID" json:"class,omitempty"`
-	Subject *Subject `gorm:"foreignKey:SubjectID" json:"subject,omitempty"`
-	Marker  *User    `gorm:"foreignKey:MarkedBy" json:"marked_by_user,omitempty"`
+	Student  User           `gorm:"foreignKey:StudentID" json:"student,omitempty"`
+	Class    Class          `gorm:"foreignKey:ClassID" json:"class,omitempty"`
+	Schedule *Schedule      `gorm:"foreignKey:ScheduleID" json:"schedule,omitempty"`
+	Subject  *Subject       `gorm:"foreignKey:SubjectID" json:"subject,omitempty"`
+	Marker   *User          `gorm:"foreignKey:MarkedBy" json:"marked_by_user,omitempty"`
+	Excuse   *AbsenceNotice `gorm:"foreignKey:ExcuseID" json:"excuse,omitempty"`
 }
 
 // Grade представляет оценку ученика
@@ -136,7 +153,11 @@ type Grade struct {
 	GradeType string    `gorm:"size:20" json:"grade_type,omitempty"` // homework, test, exam, oral, final
 	Date      time.Time `gorm:"not null;type:date" json:"date"`
 	Comment   string    `gorm:"type:text" json:"comment,omitempty"`
+	ClientID  *string   `gorm:"size:64;uniqueIndex" json:"client_id,omitempty"` // ID, созданный офлайн-клиентом
+	SyncSeq   int64     `gorm:"not null;default:0;index" json:"sync_seq"`      // Номер последнего изменения для синхронизации
 	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 
 	// Связи
 	Student User    `gorm:"foreignKey:StudentID" json:"student,omitempty"`
@@ -153,13 +174,17 @@ type Homework struct {
 	Description  string         `gorm:"type:text;not null" json:"description"`
 	AssignedDate time.Time      `gorm:"type:date;not null" json:"assigned_date"`
 	DueDate      time.Time      `gorm:"type:date;not null" json:"due_date"`
+	EstimatedMinutes int        `gorm:"not null;default:0" json:"estimated_minutes"` // Оценка времени на выполнение
+	TemplateID   *uint          `gorm:"index" json:"template_id,omitempty"`   // Шаблон, по которому создано ДЗ
+	RecurrenceID *uint          `gorm:"index" json:"recurrence_id,omitempty"` // Правило повторения, создавшее ДЗ
 	CreatedAt    time.Time      `json:"created_at"`
 	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
 
 	// Связи
-	Class   Class   `gorm:"foreignKey:ClassID" json:"class,omitempty"`
-	Subject Subject `gorm:"foreignKey:SubjectID" json:"subject,omitempty"`
-	Teacher User    `gorm:"foreignKey:TeacherID" json:"teacher,omitempty"`
+	Class       Class        `gorm:"foreignKey:ClassID" json:"class,omitempty"`
+	Subject     Subject      `gorm:"foreignKey:SubjectID" json:"subject,omitempty"`
+	Teacher     User         `gorm:"foreignKey:TeacherID" json:"teacher,omitempty"`
+	Attachments []Attachment `gorm:"polymorphic:Owner;polymorphicValue:homework" json:"attachments,omitempty"`
 }
 
 // Announcement представляет объявление
@@ -172,18 +197,21 @@ type Announcement struct {
 	TargetRole    string    `gorm:"size:20" json:"target_role,omitempty"` // all, teachers, students, parents
 	TargetClassID *uint     `json:"target_class_id,omitempty"`
 	CreatedAt     time.Time `json:"created_at"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
 
 	// Связи
-	School      School `gorm:"foreignKey:SchoolID" json:"-"`
-	Author      User   `gorm:"foreignKey:AuthorID" json:"author,omitempty"`
-	TargetClass *Class `gorm:"foreignKey:TargetClassID" json:"target_class,omitempty"`
+	School      School       `gorm:"foreignKey:SchoolID" json:"-"`
+	Author      User         `gorm:"foreignKey:AuthorID" json:"author,omitempty"`
+	TargetClass *Class       `gorm:"foreignKey:TargetClassID" json:"target_class,omitempty"`
+	Attachments []Attachment `gorm:"polymorphic:Owner;polymorphicValue:announcement" json:"attachments,omitempty"`
 }
 
 // ParentStudent связывает родителя с учеником
 type ParentStudent struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	ParentID  uint      `gorm:"not null;index" json:"parent_id"`
-	StudentID uint      `gorm:"not null;index" json:"student_id"`
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	ParentID  uint           `gorm:"not null;index" json:"parent_id"`
+	StudentID uint           `gorm:"not null;index" json:"student_id"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 
 	// Связи
 	Parent    User      `gorm:"foreignKey:ParentID" json:"parent,omitempty"`
@@ -200,3 +228,494 @@ type ClassStudent struct {
 	Class   Class `gorm:"foreignKey:ClassID" json:"-"`
 	Student User  `gorm:"foreignKey:StudentID" json:"-"`
 }
+
+// CalendarEvent представляет запись школьного календаря: праздник, каникулы,
+// перенос рабочего дня или событие
+type CalendarEvent struct {
+	ID          uint           `gorm:"primaryKey" json:"id"`
+	SchoolID    uint           `gorm:"not null;index" json:"school_id"`
+	ClassID     *uint          `gorm:"index" json:"class_id,omitempty"` // Если указан - исключение только для этого класса
+	Type        string         `gorm:"not null;size:20" json:"type"`    // holiday, vacation, workday, day_off, event
+	Title       string         `gorm:"not null;size:255" json:"title"`
+	Description string         `gorm:"type:text" json:"description,omitempty"`
+	StartDate   time.Time      `gorm:"not null;type:date;index" json:"start_date"`
+	EndDate     time.Time      `gorm:"not null;type:date;index" json:"end_date"` // Включительно
+	WorkdayAs   string         `gorm:"size:20" json:"workday_as,omitempty"`      // Для переноса: по расписанию какого дня недели работаем
+	UID         string         `gorm:"size:255;index" json:"uid,omitempty"`      // UID из импортированного iCalendar
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// Связи
+	School School `gorm:"foreignKey:SchoolID" json:"-"`
+	Class  *Class `gorm:"foreignKey:ClassID" json:"class,omitempty"`
+}
+
+// CalendarFeed представляет персональную ссылку на iCalendar-ленту пользователя
+type CalendarFeed struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"not null;index" json:"user_id"`
+	Name       string     `gorm:"size:100" json:"name,omitempty"`        // Например "Телефон"
+	TokenHash  string     `gorm:"uniqueIndex;not null;size:64" json:"-"` // SHA-256 от токена
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+
+	// Связи
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+// HomeworkSubmission представляет сдачу домашнего задания учеником
+type HomeworkSubmission struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	HomeworkID     uint       `gorm:"not null;uniqueIndex:idx_submission_homework_student" json:"homework_id"`
+	StudentID      uint       `gorm:"not null;uniqueIndex:idx_submission_homework_student;index" json:"student_id"`
+	Status         string     `gorm:"not null;size:20" json:"status"` // not_started, submitted, late, returned
+	Answer         string     `gorm:"type:text" json:"answer,omitempty"`
+	SubmittedAt    *time.Time `json:"submitted_at,omitempty"`
+	TeacherComment string     `gorm:"type:text" json:"teacher_comment,omitempty"`
+	ReviewedBy     *uint      `json:"reviewed_by,omitempty"`
+	ReviewedAt     *time.Time `json:"reviewed_at,omitempty"`
+	GradeID        *uint      `gorm:"index" json:"grade_id,omitempty"` // Оценка, выставленная за работу
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+
+	// Связи
+	Homework    Homework     `gorm:"foreignKey:HomeworkID" json:"homework,omitempty"`
+	Student     User         `gorm:"foreignKey:StudentID" json:"student,omitempty"`
+	Reviewer    *User        `gorm:"foreignKey:ReviewedBy" json:"reviewer,omitempty"`
+	Grade       *Grade       `gorm:"foreignKey:GradeID" json:"grade,omitempty"`
+	Attachments []Attachment `gorm:"polymorphic:Owner;polymorphicValue:submission" json:"attachments,omitempty"`
+}
+
+// Attachment представляет загруженный файл. Владелец задаётся парой OwnerType/OwnerID
+// (homework, announcement, submission, avatar, school_logo); пустой OwnerType -
+// файл загружен, но ещё не прикреплён
+type Attachment struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	SchoolID    uint      `gorm:"not null;index" json:"school_id"`
+	UploadedBy  uint      `gorm:"not null;index" json:"uploaded_by"`
+	OwnerType   string    `gorm:"size:30;index:idx_attachment_owner" json:"owner_type,omitempty"`
+	OwnerID     uint      `gorm:"index:idx_attachment_owner" json:"owner_id,omitempty"`
+	FileName    string    `gorm:"not null;size:255" json:"file_name"`
+	ContentType string    `gorm:"not null;size:100" json:"content_type"`
+	Size        int64     `gorm:"not null" json:"size"`
+	Checksum    string    `gorm:"not null;size:64" json:"checksum"` // SHA-256
+	StorageKey  string    `gorm:"not null;size:255" json:"-"`
+	Backend     string    `gorm:"not null;size:20" json:"-"` // local, s3
+	CreatedAt   time.Time `json:"created_at"`
+
+	// Связи
+	Uploader User `gorm:"foreignKey:UploadedBy" json:"-"`
+}
+
+// HomeworkLoadLimit задаёт допустимую нагрузку домашними заданиями на один день
+// для параллели (GradeLevel 0 - значение по умолчанию для всех параллелей школы)
+type HomeworkLoadLimit struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	SchoolID   uint      `gorm:"not null;uniqueIndex:idx_load_limit_school_grade" json:"school_id"`
+	GradeLevel int       `gorm:"not null;uniqueIndex:idx_load_limit_school_grade" json:"grade_level"` // 1-11, 0 - все
+	MaxItems   int       `gorm:"not null" json:"max_items"`                                           // Заданий на день
+	MaxMinutes int       `gorm:"not null" json:"max_minutes"`                                         // Минут на день
+	Mode       string    `gorm:"not null;size:10;default:warn" json:"mode"`                           // warn, block
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// HomeworkTemplate представляет шаблон домашнего задания по предмету,
+// который можно выдавать разным классам и переносить на следующий учебный год
+type HomeworkTemplate struct {
+	ID               uint           `gorm:"primaryKey" json:"id"`
+	SchoolID         uint           `gorm:"not null;index" json:"school_id"`
+	SubjectID        uint           `gorm:"not null;index" json:"subject_id"`
+	TeacherID        uint           `gorm:"not null;index" json:"teacher_id"` // Автор шаблона
+	Title            string         `gorm:"not null;size:255" json:"title"`
+	Description      string         `gorm:"type:text;not null" json:"description"`
+	EstimatedMinutes int            `gorm:"not null;default:0" json:"estimated_minutes"`
+	Year             string         `gorm:"size:20;index" json:"year,omitempty"` // Учебный год "2025-2026"
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+	DeletedAt        gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// Связи
+	Subject Subject `gorm:"foreignKey:SubjectID" json:"subject,omitempty"`
+	Teacher User    `gorm:"foreignKey:TeacherID" json:"teacher,omitempty"`
+}
+
+// HomeworkRecurrence представляет правило автоматической выдачи ДЗ по шаблону
+// на уроках предмета в классе ("каждый урок в понедельник для 7А")
+type HomeworkRecurrence struct {
+	ID            uint           `gorm:"primaryKey" json:"id"`
+	TemplateID    uint           `gorm:"not null;index" json:"template_id"`
+	ClassID       uint           `gorm:"not null;index" json:"class_id"`
+	TeacherID     uint           `gorm:"not null;index" json:"teacher_id"`          // От чьего имени создаются ДЗ
+	DayOfWeek     string         `gorm:"size:20" json:"day_of_week,omitempty"`      // Пусто - каждый урок предмета
+	SkipHolidays  bool           `gorm:"not null" json:"skip_holidays"`            // false - урок в праздник переносит ДЗ на следующий учебный день
+	StartDate     time.Time      `gorm:"not null;type:date" json:"start_date"`
+	EndDate       *time.Time     `gorm:"type:date" json:"end_date,omitempty"`
+	Active        bool           `gorm:"not null" json:"active"`
+	LastGenerated *time.Time     `gorm:"type:date" json:"last_generated,omitempty"` // Последний обработанный день
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// Связи
+	Template HomeworkTemplate `gorm:"foreignKey:TemplateID" json:"template,omitempty"`
+	Class    Class            `gorm:"foreignKey:ClassID" json:"class,omitempty"`
+}
+
+// AbsenceNotice представляет заявление родителя об отсутствии ребёнка
+type AbsenceNotice struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	StudentID     uint       `gorm:"not null;index" json:"student_id"`
+	ClassID       uint       `gorm:"not null;index" json:"class_id"`
+	SubmittedBy   uint       `gorm:"not null;index" json:"submitted_by"` // Родитель
+	StartDate     time.Time  `gorm:"not null;type:date;index" json:"start_date"`
+	EndDate       time.Time  `gorm:"not null;type:date;index" json:"end_date"` // Включительно
+	Reason        string     `gorm:"not null;size:20" json:"reason"`          // illness, family, medical, competition, other
+	Comment       string     `gorm:"type:text" json:"comment,omitempty"`
+	Status        string     `gorm:"not null;size:20;index" json:"status"` // pending, approved, rejected
+	ReviewedBy    *uint      `json:"reviewed_by,omitempty"`
+	ReviewedAt    *time.Time `json:"reviewed_at,omitempty"`
+	ReviewComment string     `gorm:"type:text" json:"review_comment,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+
+	// Связи
+	Student     User         `gorm:"foreignKey:StudentID" json:"student,omitempty"`
+	Class       Class        `gorm:"foreignKey:ClassID" json:"class,omitempty"`
+	Parent      User         `gorm:"foreignKey:SubmittedBy" json:"parent,omitempty"`
+	Reviewer    *User        `gorm:"foreignKey:ReviewedBy" json:"reviewer,omitempty"`
+	Attachments []Attachment `gorm:"polymorphic:Owner;polymorphicValue:absence_notice" json:"attachments,omitempty"`
+}
+
+// LessonRegister отмечает, что журнал посещаемости урока за дату заполнен
+type LessonRegister struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	ScheduleID uint      `gorm:"not null;uniqueIndex:idx_register_lesson" json:"schedule_id"`
+	Date       time.Time `gorm:"not null;type:date;uniqueIndex:idx_register_lesson" json:"date"`
+	TakenBy    uint      `gorm:"not null" json:"taken_by"`
+	Present    int       `gorm:"not null" json:"present"`
+	Absent     int       `gorm:"not null" json:"absent"`
+	Late       int       `gorm:"not null" json:"late"`
+	Excused    int       `gorm:"not null" json:"excused"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+
+	// Связи
+	Schedule *Schedule `gorm:"foreignKey:ScheduleID" json:"schedule,omitempty"`
+	Teacher  *User     `gorm:"foreignKey:TakenBy" json:"teacher,omitempty"`
+}
+
+// AlertRule правило раннего предупреждения по посещаемости и оценкам
+type AlertRule struct {
+	ID            uint           `gorm:"primaryKey" json:"id"`
+	SchoolID      uint           `gorm:"not null;index" json:"school_id"`
+	Name          string         `gorm:"not null;size:255" json:"name"`
+	Type          string         `gorm:"not null;size:30" json:"type"`         // absence_rate, failing_streak, average_drop
+	SubjectID     *uint          `gorm:"index" json:"subject_id,omitempty"`    // Пусто - проверяется каждый предмет
+	Threshold     float64        `gorm:"not null" json:"threshold"`            // % пропусков, максимальная "плохая" оценка или падение среднего
+	WindowDays    int            `gorm:"not null" json:"window_days"`          // Период анализа в днях
+	Streak        int            `gorm:"not null" json:"streak,omitempty"`     // Для failing_streak: сколько оценок подряд
+	Severity      string         `gorm:"not null;size:20" json:"severity"`     // warning, critical
+	NotifyParents bool           `gorm:"not null" json:"notify_parents"`
+	Active        bool           `gorm:"not null;index" json:"active"`
+	CreatedBy     uint           `gorm:"not null" json:"created_by"`
+	LastRunAt     *time.Time     `json:"last_run_at,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// Связи
+	Subject *Subject `gorm:"foreignKey:SubjectID" json:"subject,omitempty"`
+}
+
+// StudentAlert предупреждение по ученику, открытое правилом раннего предупреждения
+type StudentAlert struct {
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	SchoolID        uint       `gorm:"not null;index" json:"school_id"`
+	RuleID          uint       `gorm:"not null;index" json:"rule_id"`
+	StudentID       uint       `gorm:"not null;index" json:"student_id"`
+	ClassID         uint       `gorm:"not null;index" json:"class_id"`
+	SubjectID       *uint      `gorm:"index" json:"subject_id,omitempty"`
+	AssignedTo      *uint      `gorm:"index" json:"assigned_to,omitempty"` // Классный руководитель
+	Status          string     `gorm:"not null;size:20;index" json:"status"` // open, acknowledged, resolved
+	Severity        string     `gorm:"not null;size:20" json:"severity"`
+	Message         string     `gorm:"not null;type:text" json:"message"`
+	Value           float64    `json:"value"` // Значение показателя на момент последней проверки
+	ParentsNotified bool       `gorm:"not null" json:"parents_notified"`
+	AcknowledgedBy  *uint      `json:"acknowledged_by,omitempty"`
+	AcknowledgedAt  *time.Time `json:"acknowledged_at,omitempty"`
+	ResolvedBy      *uint      `json:"resolved_by,omitempty"`
+	ResolvedAt      *time.Time `json:"resolved_at,omitempty"`
+	Resolution      string     `gorm:"type:text" json:"resolution,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+
+	// Связи
+	Rule     AlertRule `gorm:"foreignKey:RuleID" json:"rule,omitempty"`
+	Student  User      `gorm:"foreignKey:StudentID" json:"student,omitempty"`
+	Class    Class     `gorm:"foreignKey:ClassID" json:"class,omitempty"`
+	Subject  *Subject  `gorm:"foreignKey:SubjectID" json:"subject,omitempty"`
+	Assignee *User     `gorm:"foreignKey:AssignedTo" json:"assignee,omitempty"`
+}
+
+// Notification уведомление пользователя (например, родителю о предупреждении по ребёнку)
+type Notification struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	Type      string     `gorm:"not null;size:30" json:"type"` // alert
+	Title     string     `gorm:"not null;size:255" json:"title"`
+	Message   string     `gorm:"type:text" json:"message"`
+	RefID     *uint      `json:"ref_id,omitempty"` // Связанный объект, например StudentAlert
+	ReadAt    *time.Time `json:"read_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// CheckInSession сеанс самостоятельной отметки учеников на уроке по QR-коду или короткому коду
+type CheckInSession struct {
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	ScheduleID      uint       `gorm:"not null;index" json:"schedule_id"`
+	Date            time.Time  `gorm:"not null;type:date;index" json:"date"`
+	OpenedBy        uint       `gorm:"not null" json:"opened_by"`
+	Secret          string     `gorm:"not null;size:64" json:"-"` // Ключ для вычисления сменяющихся кодов
+	RotationSeconds int        `gorm:"not null" json:"rotation_seconds"`
+	LateAfter       int        `gorm:"not null" json:"late_after"` // Минут от начала урока, после которых отметка - late
+	LessonStart     time.Time  `gorm:"not null" json:"lesson_start"`
+	ExpiresAt       time.Time  `gorm:"not null" json:"expires_at"`
+	ClosedAt        *time.Time `json:"closed_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+
+	// Связи
+	Schedule *Schedule `gorm:"foreignKey:ScheduleID" json:"schedule,omitempty"`
+	Opener   *User     `gorm:"foreignKey:OpenedBy" json:"opener,omitempty"`
+	CheckIns []CheckIn `gorm:"foreignKey:SessionID" json:"check_ins,omitempty"`
+}
+
+// CheckIn отметка ученика в сеансе самостоятельной регистрации
+type CheckIn struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	SessionID    uint      `gorm:"not null;uniqueIndex:idx_checkin_student" json:"session_id"`
+	StudentID    uint      `gorm:"not null;uniqueIndex:idx_checkin_student" json:"student_id"`
+	AttendanceID uint      `gorm:"not null" json:"attendance_id"`
+	Method       string    `gorm:"not null;size:10" json:"method"` // qr, code
+	Window       int64     `gorm:"not null" json:"window"`         // Период действия кода, по которому отметился ученик
+	Status       string    `gorm:"not null;size:20" json:"status"`
+	MinutesLate  int       `gorm:"not null" json:"minutes_late,omitempty"`
+	IPAddress    string    `gorm:"size:64" json:"ip_address,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+
+	// Связи
+	Student User `gorm:"foreignKey:StudentID" json:"student,omitempty"`
+}
+
+// ReportCardComment представляет комментарий учителя в табеле ученика за учебный период.
+// SubjectID = 0 - общий комментарий классного руководителя, Term = 0 - комментарий за год.
+type ReportCardComment struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	StudentID uint      `gorm:"not null;uniqueIndex:idx_report_comment" json:"student_id"`
+	SubjectID uint      `gorm:"not null;default:0;uniqueIndex:idx_report_comment" json:"subject_id"`
+	Year      int       `gorm:"not null;uniqueIndex:idx_report_comment" json:"year"` // Год начала учебного года
+	Term      int       `gorm:"not null;default:0;uniqueIndex:idx_report_comment" json:"term"`
+	TeacherID uint      `gorm:"not null;index" json:"teacher_id"`
+	Comment   string    `gorm:"type:text;not null" json:"comment"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Связи
+	Teacher User `gorm:"foreignKey:TeacherID" json:"teacher,omitempty"`
+}
+
+// BackupRun - запуск резервного копирования всего экземпляра по расписанию или вручную
+type BackupRun struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	Method      string     `gorm:"not null;size:20" json:"method"`       // sqlite, pg_dump, archive
+	Trigger     string     `gorm:"not null;size:20" json:"trigger"`      // schedule, manual
+	Status      string     `gorm:"not null;size:20;index" json:"status"` // running, success, failed
+	Name        string     `gorm:"size:100" json:"name,omitempty"`       // Каталог копии в BACKUP_DIR
+	Files       int        `gorm:"not null;default:0" json:"files"`
+	Size        int64      `gorm:"not null;default:0" json:"size"`
+	Pruned      int        `gorm:"not null;default:0" json:"pruned"` // Старых копий удалено по политике хранения
+	Error       string     `gorm:"type:text" json:"error,omitempty"`
+	TriggeredBy *uint      `json:"triggered_by,omitempty"`
+	StartedAt   time.Time  `gorm:"not null;index" json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+}
+
+// AuditLog - запись журнала аудита: кто, когда и откуда создал, изменил или удалил
+// запись. Записи только добавляются; изменить или удалить их нельзя.
+type AuditLog struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	SchoolID  *uint     `gorm:"index" json:"school_id,omitempty"`
+	UserID    *uint     `gorm:"index" json:"user_id,omitempty"` // Пусто - фоновая задача или запрос без входа
+	Role      string    `gorm:"size:20" json:"role,omitempty"`
+	IP        string    `gorm:"size:45" json:"ip,omitempty"`
+	RequestID string    `gorm:"size:64;index" json:"request_id,omitempty"`
+	Method    string    `gorm:"size:10" json:"method,omitempty"`
+	Path      string    `gorm:"size:255" json:"path,omitempty"`
+	Action    string    `gorm:"not null;size:20;index" json:"action"` // create, update, delete, restore, anonymize, export, seed
+	Entity    string    `gorm:"not null;size:50;index" json:"entity"` // Таблица
+	EntityID  *uint     `gorm:"index" json:"entity_id,omitempty"`
+	Changes   string    `gorm:"type:text" json:"-"` // JSON: столбец -> {old, new}
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
+
+// DemoSandbox - отдельная школа с демонстрационными данными для одного посетителя
+// демо-режима. Посетитель получает ключ песочницы и входит в неё под любой ролью.
+type DemoSandbox struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	SchoolID  uint      `gorm:"not null;uniqueIndex" json:"school_id"`
+	KeyHash   string    `gorm:"uniqueIndex;not null;size:64" json:"-"` // SHA-256 от ключа посетителя
+	Prefix    string    `gorm:"not null;size:20" json:"prefix"`        // Префикс логинов песочницы
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SyncCounter - счётчик изменений отметок и оценок для офлайн-синхронизации.
+// У каждой школы свой счётчик, общий для посещаемости и оценок.
+type SyncCounter struct {
+	Name  string `gorm:"primaryKey;size:50" json:"name"`
+	Value int64  `gorm:"not null" json:"value"`
+}
+
+// SyncCounterChanges - имя общего счётчика, с которого начинаются счётчики школ
+const SyncCounterChanges = "changes"
+
+// ErrSyncSchoolUnknown - массовое изменение отметок или оценок без указания школы
+var ErrSyncSchoolUnknown = errors.New("sync: school of a bulk change is unknown")
+
+type syncSchoolKey struct{}
+
+// WithSyncSchool возвращает контекст, в котором массовые изменения отметок и оценок
+// (Model(&Attendance{}).Where(...).Updates) получают номер из счётчика школы schoolID
+func WithSyncSchool(ctx context.Context, schoolID uint) context.Context {
+	return context.WithValue(ctx, syncSchoolKey{}, schoolID)
+}
+
+// SyncTombstone запоминает удалённую запись, чтобы клиенты удалили её у себя при синхронизации
+type SyncTombstone struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Entity    string    `gorm:"not null;size:20" json:"entity"` // attendance, grade
+	EntityID  uint      `gorm:"not null" json:"entity_id"`
+	ClientID  *string   `gorm:"size:64" json:"client_id,omitempty"`
+	StudentID uint      `gorm:"not null;index" json:"student_id"`
+	ClassID   *uint     `gorm:"index" json:"class_id,omitempty"`
+	Seq       int64     `gorm:"not null;index" json:"sync_seq"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BeforeSave присваивает отметке новый номер изменения
+func (a *Attendance) BeforeSave(tx *gorm.DB) error {
+	return setSyncSeq(tx, &Class{}, a.ClassID)
+}
+
+// AfterDelete оставляет отметку удалённой для синхронизации
+func (a *Attendance) AfterDelete(tx *gorm.DB) error {
+	if a.ID == 0 {
+		return nil
+	}
+	classID := a.ClassID
+	return addTombstone(tx, &Class{}, classID, "attendance", a.ID, a.ClientID, a.StudentID, &classID)
+}
+
+// BeforeSave присваивает оценке новый номер изменения
+func (g *Grade) BeforeSave(tx *gorm.DB) error {
+	return setSyncSeq(tx, &User{}, g.StudentID)
+}
+
+// AfterDelete оставляет оценку удалённой для синхронизации
+func (g *Grade) AfterDelete(tx *gorm.DB) error {
+	if g.ID == 0 {
+		return nil
+	}
+	return addTombstone(tx, &User{}, g.StudentID, "grade", g.ID, g.ClientID, g.StudentID, nil)
+}
+
+// NextSyncSeq увеличивает счётчик изменений школы. Строка счётчика блокируется до конца
+// транзакции, поэтому номера видны клиентам в порядке фиксации изменений, а изменения
+// разных школ друг друга не ждут. Клиент синхронизирует классы одной школы, поэтому
+// его курсор идёт по одному счётчику.
+func NextSyncSeq(tx *gorm.DB, schoolID uint) (int64, error) {
+	db := tx.Session(&gorm.Session{NewDB: true, SkipHooks: true})
+	name := fmt.Sprintf("%s:%d", SyncCounterChanges, schoolID)
+	increment := func() (int64, error) {
+		result := db.Model(&SyncCounter{}).
+			Where("name = ?", name).
+			Update("value", gorm.Expr("value + 1"))
+		return result.RowsAffected, result.Error
+	}
+
+	updated, err := increment()
+	if err != nil {
+		return 0, err
+	}
+	if updated == 0 {
+		// Счётчик школы начинается с общего, чтобы номера были больше выданных раньше
+		// и курсоры клиентов не пропустили изменений
+		var base SyncCounter
+		if err := db.Where("name = ?", SyncCounterChanges).First(&base).Error; err != nil {
+			return 0, err
+		}
+		if err := db.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&SyncCounter{Name: name, Value: base.Value}).Error; err != nil {
+			return 0, err
+		}
+		if _, err := increment(); err != nil {
+			return 0, err
+		}
+	}
+
+	var counter SyncCounter
+	if err := db.Where("name = ?", name).First(&counter).Error; err != nil {
+		return 0, err
+	}
+	return counter.Value, nil
+}
+
+// syncSchoolID находит школу изменения по классу отметки или ученику оценки.
+// У массового изменения строки нет, и школа берётся из контекста (WithSyncSchool).
+func syncSchoolID(tx *gorm.DB, owner interface{}, ownerID uint) (uint, error) {
+	if ownerID == 0 {
+		if schoolID, ok := tx.Statement.Context.Value(syncSchoolKey{}).(uint); ok {
+			return schoolID, nil
+		}
+		return 0, ErrSyncSchoolUnknown
+	}
+	var schoolID uint
+	err := tx.Session(&gorm.Session{NewDB: true, SkipHooks: true}).Unscoped().
+		Model(owner).Where("id = ?", ownerID).Select("school_id").Scan(&schoolID).Error
+	return schoolID, err
+}
+
+func setSyncSeq(tx *gorm.DB, owner interface{}, ownerID uint) error {
+	schoolID, err := syncSchoolID(tx, owner, ownerID)
+	if err != nil {
+		return err
+	}
+	seq, err := NextSyncSeq(tx, schoolID)
+	if err != nil {
+		return err
+	}
+	tx.Statement.SetColumn("sync_seq", seq)
+	return nil
+}
+
+func addTombstone(tx *gorm.DB, owner interface{}, ownerID uint, entity string, id uint, clientID *string, studentID uint, classID *uint) error {
+	schoolID, err := syncSchoolID(tx, owner, ownerID)
+	if err != nil {
+		return err
+	}
+	seq, err := NextSyncSeq(tx, schoolID)
+	if err != nil {
+		return err
+	}
+	return tx.Session(&gorm.Session{NewDB: true}).Create(&SyncTombstone{
+		Entity:    entity,
+		EntityID:  id,
+		ClientID:  clientID,
+		StudentID: studentID,
+		ClassID:   classID,
+		Seq:       seq,
+	}).Error
+}
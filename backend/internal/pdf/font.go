@@ -0,0 +1,175 @@
+package pdf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Font - шрифт документа: стандартный Helvetica или встроенный TrueType.
+// Разобранный шрифт не изменяется и может использоваться в нескольких документах.
+type Font struct {
+	name string
+	ttf  *trueType
+}
+
+// Стандартные шрифты PDF. Программа шрифта не встраивается - программа просмотра
+// подставляет системный шрифт, кириллица выводится через таблицу Differences.
+var (
+	Helvetica     = &Font{name: "Helvetica"}
+	HelveticaBold = &Font{name: "Helvetica-Bold"}
+)
+
+// Name возвращает имя шрифта
+func (f *Font) Name() string {
+	return f.name
+}
+
+// HasGlyph сообщает, есть ли в шрифте символ r
+func (f *Font) HasGlyph(r rune) bool {
+	if f.ttf != nil {
+		_, ok := f.ttf.cmap[r]
+		return ok
+	}
+	return encodeStandard(r) != '?' || r == '?'
+}
+
+// Width возвращает ширину строки кеглем size в пунктах
+func (f *Font) Width(s string, size float64) float64 {
+	total := 0
+	for _, r := range s {
+		if f.ttf != nil {
+			total += f.ttf.advance(f.ttf.glyph(r))
+		} else {
+			total += f.standardWidth(encodeStandard(r))
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// Ширины символов 32..126 стандартных шрифтов (из метрик AFM), в 1/1000 кегля
+var (
+	helveticaWidths = [...]int{
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+	}
+	helveticaBoldWidths = [...]int{
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+	}
+)
+
+// extraGlyph - символ за пределами ASCII в кодировке стандартного шрифта
+type extraGlyph struct {
+	r     rune
+	name  string // Имя глифа по Adobe Glyph List
+	width int
+}
+
+// extraGlyphs занимают коды с 128 по порядку: кириллица, Ё/ё и типографские знаки.
+// Ширины кириллицы взяты из метрик Arial, совместимого по метрикам с Helvetica.
+var extraGlyphs = func() []extraGlyph {
+	upper := []int{667, 656, 667, 542, 677, 667, 923, 604, 719, 719, 583, 656, 833, 722, 778, 719,
+		667, 722, 611, 635, 760, 667, 740, 667, 917, 938, 792, 885, 656, 719, 1010, 722}
+	lower := []int{556, 573, 531, 365, 583, 556, 669, 458, 559, 559, 438, 583, 688, 552, 556, 542,
+		556, 500, 458, 500, 823, 500, 573, 521, 802, 823, 625, 719, 521, 510, 750, 542}
+
+	var glyphs []extraGlyph
+	// А..Я - afii10017..afii10049 без Ё (afii10023)
+	for i, w := range upper {
+		code := 10017 + i
+		if code >= 10023 {
+			code++
+		}
+		glyphs = append(glyphs, extraGlyph{rune('А' + i), fmt.Sprintf("afii%d", code), w})
+	}
+	// а..я - afii10065..afii10097 без ё (afii10071)
+	for i, w := range lower {
+		code := 10065 + i
+		if code >= 10071 {
+			code++
+		}
+		glyphs = append(glyphs, extraGlyph{rune('а' + i), fmt.Sprintf("afii%d", code), w})
+	}
+	return append(glyphs,
+		extraGlyph{'Ё', "afii10023", 667},
+		extraGlyph{'ё', "afii10071", 556},
+		extraGlyph{'№', "afii61352", 1073},
+		extraGlyph{'«', "guillemotleft", 556},
+		extraGlyph{'»', "guillemotright", 556},
+		extraGlyph{'–', "endash", 556},
+		extraGlyph{'—', "emdash", 1000},
+		extraGlyph{'…', "ellipsis", 1000},
+		extraGlyph{'•', "bullet", 350},
+		extraGlyph{'°', "degree", 400},
+		extraGlyph{'·', "periodcentered", 278},
+		extraGlyph{' ', "space", 278},
+	)
+}()
+
+// extraCodes - символ -> код в кодировке стандартного шрифта
+var extraCodes = func() map[rune]byte {
+	codes := make(map[rune]byte, len(extraGlyphs))
+	for i, g := range extraGlyphs {
+		codes[g.r] = byte(128 + i)
+	}
+	return codes
+}()
+
+// encodeStandard возвращает код символа; неизвестные символы заменяются на "?"
+func encodeStandard(r rune) byte {
+	if r >= 32 && r <= 126 {
+		return byte(r)
+	}
+	if code, ok := extraCodes[r]; ok {
+		return code
+	}
+	return '?'
+}
+
+func (f *Font) standardWidth(code byte) int {
+	if code == 127 {
+		return 0
+	}
+	if code < 128 {
+		if f.name == HelveticaBold.name {
+			return helveticaBoldWidths[code-32]
+		}
+		return helveticaWidths[code-32]
+	}
+	w := extraGlyphs[code-128].width
+	if f.name == HelveticaBold.name && w < 1000 {
+		// Жирное начертание шире примерно на 5%
+		w = w * 105 / 100
+	}
+	return w
+}
+
+// writeStandardFont записывает стандартный шрифт с кодировкой для кириллицы
+func writeStandardFont(pw *writer, f *Font) int {
+	last := 128 + len(extraGlyphs) - 1
+
+	var differences strings.Builder
+	differences.WriteString("128")
+	for _, g := range extraGlyphs {
+		differences.WriteString(" /" + g.name)
+	}
+
+	widths := make([]string, 0, last-31)
+	for code := 32; code <= last; code++ {
+		widths = append(widths, fmt.Sprint(f.standardWidth(byte(code))))
+	}
+
+	encodingID, id := pw.reserve(), pw.reserve()
+	pw.dict(encodingID, fmt.Sprintf("<< /Type /Encoding /BaseEncoding /WinAnsiEncoding /Differences [%s] >>", differences.String()))
+	pw.dict(id, fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding %d 0 R /FirstChar 32 /LastChar %d /Widths [%s] >>",
+		f.name, encodingID, last, strings.Join(widths, " ")))
+	return id
+}
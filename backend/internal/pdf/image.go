@@ -0,0 +1,77 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// ErrInvalidImage - формат изображения не поддерживается
+var ErrInvalidImage = errors.New("pdf: unsupported image format (use JPEG, PNG or GIF)")
+
+// Image - изображение для вставки в документ
+type Image struct {
+	Width, Height int // Размер в пикселях
+
+	data       []byte
+	filter     string // DCTDecode для JPEG, иначе данные сжимаются при записи
+	colorSpace string
+	decode     string
+}
+
+// ParseImage разбирает JPEG, PNG или GIF. JPEG встраивается без перекодирования,
+// остальные форматы переводятся в RGB; прозрачность накладывается на белый фон.
+func ParseImage(data []byte) (*Image, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	if format == "jpeg" {
+		img := &Image{Width: cfg.Width, Height: cfg.Height, data: data, filter: "DCTDecode"}
+		switch cfg.ColorModel {
+		case color.GrayModel:
+			img.colorSpace = "DeviceGray"
+		case color.CMYKModel:
+			// Adobe пишет CMYK в JPEG инвертированным
+			img.colorSpace, img.decode = "DeviceCMYK", " /Decode [1 0 1 0 1 0 1 0]"
+		default:
+			img.colorSpace = "DeviceRGB"
+		}
+		return img, nil
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	b := src.Bounds()
+	rgb := make([]byte, 0, b.Dx()*b.Dy()*3)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, a := src.At(x, y).RGBA()
+			// Альфа-предумноженные значения + белый фон
+			white := 0xFFFF - a
+			rgb = append(rgb, byte((r+white)>>8), byte((g+white)>>8), byte((bl+white)>>8))
+		}
+	}
+	return &Image{Width: b.Dx(), Height: b.Dy(), data: rgb, colorSpace: "DeviceRGB"}, nil
+}
+
+// writeImage записывает изображение и возвращает номер его объекта
+func (d *Document) writeImage(pw *writer, img *Image) int {
+	id := pw.reserve()
+	dict := fmt.Sprintf(" /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /%s /BitsPerComponent 8%s",
+		img.Width, img.Height, img.colorSpace, img.decode)
+	if img.filter != "" {
+		pw.stream(id, dict+" /Filter /"+img.filter, img.data, false)
+	} else {
+		pw.stream(id, dict, img.data, true)
+	}
+	return id
+}
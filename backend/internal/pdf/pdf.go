@@ -0,0 +1,339 @@
+package pdf
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Размер страницы A4 в пунктах
+const (
+	PageWidth  = 595.28
+	PageHeight = 841.89
+)
+
+// Стили прямоугольника
+const (
+	Stroke     = "S" // Только рамка
+	Fill       = "f" // Только заливка
+	FillStroke = "B" // Заливка и рамка
+)
+
+// Document - PDF-документ, собираемый в памяти.
+// Координаты задаются в пунктах от левого верхнего угла страницы,
+// y текста - базовая линия.
+type Document struct {
+	title   string
+	author  string
+	pages   []*bytes.Buffer
+	fonts   []*docFont
+	byFont  map[*Font]*docFont
+	images  []*docImage
+	byImage map[*Image]*docImage
+
+	font     *docFont
+	fontSize float64
+}
+
+// docFont - шрифт, используемый в документе, и набранные им символы
+type docFont struct {
+	font *Font
+	name string          // Имя ресурса: F1, F2...
+	used map[uint16]rune // Глиф -> символ (для встроенных TrueType)
+}
+
+type docImage struct {
+	image *Image
+	name  string
+}
+
+// New создаёт пустой документ формата A4
+func New() *Document {
+	return &Document{
+		byFont:  make(map[*Font]*docFont),
+		byImage: make(map[*Image]*docImage),
+	}
+}
+
+// SetInfo задаёт название и автора документа
+func (d *Document) SetInfo(title, author string) {
+	d.title, d.author = title, author
+}
+
+// AddPage начинает новую страницу. Шрифт сохраняется, цвета и толщина линий
+// сбрасываются к значениям по умолчанию.
+func (d *Document) AddPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+}
+
+// PageCount возвращает число страниц
+func (d *Document) PageCount() int {
+	return len(d.pages)
+}
+
+// SetFont выбирает шрифт и кегль для следующих вызовов Text
+func (d *Document) SetFont(font *Font, size float64) {
+	df := d.byFont[font]
+	if df == nil {
+		df = &docFont{font: font, name: fmt.Sprintf("F%d", len(d.fonts)+1), used: make(map[uint16]rune)}
+		d.fonts = append(d.fonts, df)
+		d.byFont[font] = df
+	}
+	d.font, d.fontSize = df, size
+}
+
+// TextWidth возвращает ширину строки текущим шрифтом
+func (d *Document) TextWidth(s string) float64 {
+	if d.font == nil {
+		return 0
+	}
+	return d.font.font.Width(s, d.fontSize)
+}
+
+// Text выводит строку с базовой линией в точке (x, y)
+func (d *Document) Text(x, y float64, s string) {
+	if d.font == nil || s == "" {
+		return
+	}
+	d.writef("BT /%s %.2f Tf %.2f %.2f Td <%s> Tj ET\n",
+		d.font.name, d.fontSize, x, PageHeight-y, d.font.encode(s))
+}
+
+// SplitText разбивает текст на строки не шире width (по словам и переводам строк)
+func (d *Document) SplitText(s string, width float64) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			if line != "" && d.TextWidth(candidate) > width {
+				lines = append(lines, line)
+				candidate = word
+			}
+			// Слово длиннее строки режем по символам
+			for d.TextWidth(candidate) > width && len([]rune(candidate)) > 1 {
+				runes := []rune(candidate)
+				n := len(runes) - 1
+				for n > 1 && d.TextWidth(string(runes[:n])) > width {
+					n--
+				}
+				lines = append(lines, string(runes[:n]))
+				candidate = string(runes[n:])
+			}
+			line = candidate
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// SetLineWidth задаёт толщину линий
+func (d *Document) SetLineWidth(w float64) {
+	d.writef("%.2f w\n", w)
+}
+
+// SetStrokeColor задаёт цвет линий (компоненты 0..1)
+func (d *Document) SetStrokeColor(r, g, b float64) {
+	d.writef("%.3f %.3f %.3f RG\n", r, g, b)
+}
+
+// SetFillColor задаёт цвет заливки и текста (компоненты 0..1)
+func (d *Document) SetFillColor(r, g, b float64) {
+	d.writef("%.3f %.3f %.3f rg\n", r, g, b)
+}
+
+// Line рисует отрезок
+func (d *Document) Line(x1, y1, x2, y2 float64) {
+	d.writef("%.2f %.2f m %.2f %.2f l S\n", x1, PageHeight-y1, x2, PageHeight-y2)
+}
+
+// Rect рисует прямоугольник с левым верхним углом (x, y) стилем Stroke, Fill или FillStroke
+func (d *Document) Rect(x, y, w, h float64, style string) {
+	d.writef("%.2f %.2f %.2f %.2f re %s\n", x, PageHeight-y-h, w, h, style)
+}
+
+// Image выводит изображение в прямоугольник с левым верхним углом (x, y)
+func (d *Document) Image(img *Image, x, y, w, h float64) {
+	di := d.byImage[img]
+	if di == nil {
+		di = &docImage{image: img, name: fmt.Sprintf("Im%d", len(d.images)+1)}
+		d.images = append(d.images, di)
+		d.byImage[img] = di
+	}
+	d.writef("q %.2f 0 0 %.2f %.2f %.2f cm /%s Do Q\n", w, h, x, PageHeight-y-h, di.name)
+}
+
+func (d *Document) writef(format string, args ...interface{}) {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+	fmt.Fprintf(d.pages[len(d.pages)-1], format, args...)
+}
+
+// encode переводит строку в байты шрифта (шестнадцатеричная запись)
+func (df *docFont) encode(s string) string {
+	var sb strings.Builder
+	if df.font.ttf == nil {
+		for _, r := range s {
+			fmt.Fprintf(&sb, "%02X", encodeStandard(r))
+		}
+		return sb.String()
+	}
+	for _, r := range s {
+		gid := df.font.ttf.glyph(r)
+		if _, ok := df.used[gid]; !ok {
+			df.used[gid] = r
+		}
+		fmt.Fprintf(&sb, "%04X", gid)
+	}
+	return sb.String()
+}
+
+// writer нумерует объекты и запоминает их смещения для таблицы xref
+type writer struct {
+	w       *bufio.Writer
+	n       int64
+	offsets []int64
+	err     error
+}
+
+func (pw *writer) Write(p []byte) (int, error) {
+	if pw.err != nil {
+		return 0, pw.err
+	}
+	n, err := pw.w.Write(p)
+	pw.n += int64(n)
+	pw.err = err
+	return n, err
+}
+
+func (pw *writer) printf(format string, args ...interface{}) {
+	fmt.Fprintf(pw, format, args...)
+}
+
+// reserve выделяет номер объекта до его записи
+func (pw *writer) reserve() int {
+	pw.offsets = append(pw.offsets, 0)
+	return len(pw.offsets)
+}
+
+// object начинает объект с заранее выделенным номером
+func (pw *writer) object(id int) {
+	pw.offsets[id-1] = pw.n
+	pw.printf("%d 0 obj\n", id)
+}
+
+// dict записывает объект-словарь
+func (pw *writer) dict(id int, body string) {
+	pw.object(id)
+	pw.printf("%s\nendobj\n", body)
+}
+
+// stream записывает объект-поток, сжимая данные, если они ещё не сжаты
+func (pw *writer) stream(id int, dict string, data []byte, compress bool) {
+	if compress {
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		zw.Write(data)
+		zw.Close()
+		data = buf.Bytes()
+		dict += " /Filter /FlateDecode"
+	}
+	pw.object(id)
+	pw.printf("<<%s /Length %d>>\nstream\n", dict, len(data))
+	pw.Write(data)
+	pw.printf("\nendstream\nendobj\n")
+}
+
+// Write сериализует документ
+func (d *Document) Write(w io.Writer) error {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+
+	pw := &writer{w: bufio.NewWriter(w)}
+	pw.printf("%%PDF-1.4\n%%\xE2\xE3\xCF\xD3\n")
+
+	catalog, pagesID := pw.reserve(), pw.reserve()
+
+	var resources strings.Builder
+	resources.WriteString("<< /ProcSet [/PDF /Text /ImageB /ImageC] /Font <<")
+	for _, df := range d.fonts {
+		id := d.writeFont(pw, df)
+		fmt.Fprintf(&resources, " /%s %d 0 R", df.name, id)
+	}
+	resources.WriteString(" >> /XObject <<")
+	for _, di := range d.images {
+		id := d.writeImage(pw, di.image)
+		fmt.Fprintf(&resources, " /%s %d 0 R", di.name, id)
+	}
+	resources.WriteString(" >> >>")
+	resourcesID := pw.reserve()
+	pw.dict(resourcesID, resources.String())
+
+	kids := make([]string, len(d.pages))
+	for i, page := range d.pages {
+		pageID, contentID := pw.reserve(), pw.reserve()
+		pw.dict(pageID, fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.2f %.2f] /Resources %d 0 R /Contents %d 0 R >>",
+			pagesID, PageWidth, PageHeight, resourcesID, contentID))
+		pw.stream(contentID, "", page.Bytes(), true)
+		kids[i] = fmt.Sprintf("%d 0 R", pageID)
+	}
+	pw.dict(pagesID, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids)))
+	pw.dict(catalog, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pagesID))
+
+	infoID := pw.reserve()
+	pw.dict(infoID, fmt.Sprintf("<< /Title %s /Author %s /Producer %s /CreationDate (D:%s) >>",
+		textString(d.title), textString(d.author), textString("ClassKeeper"), time.Now().UTC().Format("20060102150405Z")))
+
+	xref := pw.n
+	pw.printf("xref\n0 %d\n0000000000 65535 f \n", len(pw.offsets)+1)
+	for _, off := range pw.offsets {
+		pw.printf("%010d 00000 n \n", off)
+	}
+	pw.printf("trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n",
+		len(pw.offsets)+1, catalog, infoID, xref)
+
+	if pw.err != nil {
+		return pw.err
+	}
+	return pw.w.Flush()
+}
+
+// writeFont записывает шрифт и возвращает номер его объекта
+func (d *Document) writeFont(pw *writer, df *docFont) int {
+	if df.font.ttf == nil {
+		return writeStandardFont(pw, df.font)
+	}
+	return df.font.ttf.write(pw, df.used)
+}
+
+// textString кодирует строку метаданных в UTF-16BE
+func textString(s string) string {
+	var sb strings.Builder
+	sb.WriteString("<FEFF")
+	for _, u := range utf16.Encode([]rune(s)) {
+		fmt.Fprintf(&sb, "%04X", u)
+	}
+	sb.WriteString(">")
+	return sb.String()
+}
+
+// sortedGlyphs возвращает используемые глифы по возрастанию
+func sortedGlyphs(used map[uint16]rune) []uint16 {
+	gids := make([]uint16, 0, len(used))
+	for gid := range used {
+		gids = append(gids, gid)
+	}
+	sort.Slice(gids, func(a, b int) bool { return gids[a] < gids[b] })
+	return gids
+}
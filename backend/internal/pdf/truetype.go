@@ -0,0 +1,472 @@
+package pdf
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// ErrInvalidFont - файл не является шрифтом TrueType, пригодным для встраивания
+var ErrInvalidFont = errors.New("pdf: invalid or unsupported TrueType font")
+
+// trueType - разобранный шрифт TrueType (glyf/loca, без CFF)
+type trueType struct {
+	data       []byte
+	tables     map[string][]byte
+	name       string
+	unitsPerEm int
+	ascent     int
+	descent    int
+	capHeight  int
+	bbox       [4]int
+	numGlyphs  int
+	advances   []int // В единицах шрифта
+	cmap       map[rune]uint16
+	loca       []int // Смещения глифов в glyf, numGlyphs+1 значений
+}
+
+// ParseTrueType разбирает шрифт TrueType (.ttf) для встраивания в документы.
+// В документ попадают только использованные глифы.
+func ParseTrueType(data []byte) (*Font, error) {
+	t := &trueType{data: data, tables: make(map[string][]byte)}
+	if err := t.parse(); err != nil {
+		return nil, err
+	}
+	return &Font{name: t.name, ttf: t}, nil
+}
+
+func (t *trueType) parse() error {
+	d := t.data
+	if len(d) < 12 {
+		return ErrInvalidFont
+	}
+	if v := binary.BigEndian.Uint32(d); v != 0x00010000 && v != 0x74727565 { // 1.0 или 'true'
+		return ErrInvalidFont
+	}
+	numTables := int(binary.BigEndian.Uint16(d[4:]))
+	if len(d) < 12+numTables*16 {
+		return ErrInvalidFont
+	}
+	for i := 0; i < numTables; i++ {
+		rec := d[12+i*16:]
+		tag := string(rec[:4])
+		offset := int(binary.BigEndian.Uint32(rec[8:]))
+		length := int(binary.BigEndian.Uint32(rec[12:]))
+		if offset < 0 || length < 0 || offset+length > len(d) {
+			return ErrInvalidFont
+		}
+		t.tables[tag] = d[offset : offset+length]
+	}
+	for _, tag := range []string{"head", "hhea", "hmtx", "maxp", "cmap", "loca", "glyf"} {
+		if t.tables[tag] == nil {
+			return fmt.Errorf("%w: missing %s table", ErrInvalidFont, tag)
+		}
+	}
+
+	head, hhea, maxp := t.tables["head"], t.tables["hhea"], t.tables["maxp"]
+	if len(head) < 54 || len(hhea) < 36 || len(maxp) < 6 {
+		return ErrInvalidFont
+	}
+	t.unitsPerEm = int(binary.BigEndian.Uint16(head[18:]))
+	if t.unitsPerEm == 0 {
+		return ErrInvalidFont
+	}
+	for i := range t.bbox {
+		t.bbox[i] = t.scale(int(int16(binary.BigEndian.Uint16(head[36+i*2:]))))
+	}
+	t.ascent = t.scale(int(int16(binary.BigEndian.Uint16(hhea[4:]))))
+	t.descent = t.scale(int(int16(binary.BigEndian.Uint16(hhea[6:]))))
+	t.capHeight = t.ascent
+	if os2 := t.tables["OS/2"]; len(os2) >= 90 && binary.BigEndian.Uint16(os2) >= 2 {
+		t.capHeight = t.scale(int(int16(binary.BigEndian.Uint16(os2[88:]))))
+	}
+	t.numGlyphs = int(binary.BigEndian.Uint16(maxp[4:]))
+
+	// Ширины глифов
+	hmtx := t.tables["hmtx"]
+	numMetrics := int(binary.BigEndian.Uint16(hhea[34:]))
+	if numMetrics == 0 || len(hmtx) < numMetrics*4 {
+		return ErrInvalidFont
+	}
+	t.advances = make([]int, t.numGlyphs)
+	for i := range t.advances {
+		if i < numMetrics {
+			t.advances[i] = int(binary.BigEndian.Uint16(hmtx[i*4:]))
+		} else {
+			t.advances[i] = t.advances[numMetrics-1]
+		}
+	}
+
+	// Смещения глифов
+	loca := t.tables["loca"]
+	longOffsets := binary.BigEndian.Uint16(head[50:]) == 1
+	t.loca = make([]int, t.numGlyphs+1)
+	for i := range t.loca {
+		if longOffsets {
+			if len(loca) < (i+1)*4 {
+				return ErrInvalidFont
+			}
+			t.loca[i] = int(binary.BigEndian.Uint32(loca[i*4:]))
+		} else {
+			if len(loca) < (i+1)*2 {
+				return ErrInvalidFont
+			}
+			t.loca[i] = int(binary.BigEndian.Uint16(loca[i*2:])) * 2
+		}
+		if t.loca[i] > len(t.tables["glyf"]) || (i > 0 && t.loca[i] < t.loca[i-1]) {
+			return ErrInvalidFont
+		}
+	}
+
+	if err := t.parseCmap(); err != nil {
+		return err
+	}
+	t.name = t.postScriptName()
+	return nil
+}
+
+// parseCmap читает таблицу Unicode -> глиф (форматы 4 и 12)
+func (t *trueType) parseCmap() error {
+	cmap := t.tables["cmap"]
+	if len(cmap) < 4 {
+		return ErrInvalidFont
+	}
+	var best []byte
+	bestRank := 0
+	n := int(binary.BigEndian.Uint16(cmap[2:]))
+	for i := 0; i < n && 4+i*8+8 <= len(cmap); i++ {
+		rec := cmap[4+i*8:]
+		platform, encoding := binary.BigEndian.Uint16(rec), binary.BigEndian.Uint16(rec[2:])
+		offset := int(binary.BigEndian.Uint32(rec[4:]))
+		if offset+4 > len(cmap) {
+			continue
+		}
+		sub := cmap[offset:]
+		format := binary.BigEndian.Uint16(sub)
+		rank := 0
+		switch {
+		case format == 12 && (platform == 3 && encoding == 10 || platform == 0):
+			rank = 3
+		case format == 4 && (platform == 3 && encoding == 1 || platform == 0):
+			rank = 2
+		}
+		if rank > bestRank {
+			best, bestRank = sub, rank
+		}
+	}
+	if best == nil {
+		return fmt.Errorf("%w: no Unicode cmap", ErrInvalidFont)
+	}
+
+	t.cmap = make(map[rune]uint16)
+	if binary.BigEndian.Uint16(best) == 12 {
+		if len(best) < 16 {
+			return ErrInvalidFont
+		}
+		groups := int(binary.BigEndian.Uint32(best[12:]))
+		for i := 0; i < groups && 16+i*12+12 <= len(best); i++ {
+			g := best[16+i*12:]
+			start, end := binary.BigEndian.Uint32(g), binary.BigEndian.Uint32(g[4:])
+			gid := binary.BigEndian.Uint32(g[8:])
+			for r := start; r <= end && r <= 0x10FFFF; r++ {
+				t.cmap[rune(r)] = uint16(gid + r - start)
+			}
+		}
+		return nil
+	}
+
+	if len(best) < 14 {
+		return ErrInvalidFont
+	}
+	segCount := int(binary.BigEndian.Uint16(best[6:])) / 2
+	if len(best) < 16+segCount*8 {
+		return ErrInvalidFont
+	}
+	ends := best[14:]
+	starts := best[16+segCount*2:]
+	deltas := best[16+segCount*4:]
+	rangeOffsets := best[16+segCount*6:]
+	for i := 0; i < segCount; i++ {
+		start := int(binary.BigEndian.Uint16(starts[i*2:]))
+		end := int(binary.BigEndian.Uint16(ends[i*2:]))
+		delta := int(binary.BigEndian.Uint16(deltas[i*2:]))
+		rangeOffset := int(binary.BigEndian.Uint16(rangeOffsets[i*2:]))
+		for c := start; c <= end && c != 0xFFFF; c++ {
+			gid := 0
+			if rangeOffset == 0 {
+				gid = (c + delta) & 0xFFFF
+			} else {
+				pos := 16 + segCount*6 + i*2 + rangeOffset + (c-start)*2
+				if pos+2 > len(best) {
+					continue
+				}
+				if gid = int(binary.BigEndian.Uint16(best[pos:])); gid != 0 {
+					gid = (gid + delta) & 0xFFFF
+				}
+			}
+			if gid != 0 {
+				t.cmap[rune(c)] = uint16(gid)
+			}
+		}
+	}
+	return nil
+}
+
+// postScriptName читает PostScript-имя шрифта из таблицы name
+func (t *trueType) postScriptName() string {
+	name := t.tables["name"]
+	if len(name) >= 6 {
+		count := int(binary.BigEndian.Uint16(name[2:]))
+		storage := int(binary.BigEndian.Uint16(name[4:]))
+		for i := 0; i < count && 6+i*12+12 <= len(name); i++ {
+			rec := name[6+i*12:]
+			platform := binary.BigEndian.Uint16(rec)
+			id := binary.BigEndian.Uint16(rec[6:])
+			length := int(binary.BigEndian.Uint16(rec[8:]))
+			offset := storage + int(binary.BigEndian.Uint16(rec[10:]))
+			if id != 6 || offset+length > len(name) {
+				continue
+			}
+			raw := name[offset : offset+length]
+			var s string
+			if platform == 3 || platform == 0 {
+				u := make([]uint16, len(raw)/2)
+				for j := range u {
+					u[j] = binary.BigEndian.Uint16(raw[j*2:])
+				}
+				s = string(utf16.Decode(u))
+			} else {
+				s = string(raw)
+			}
+			s = strings.Map(func(r rune) rune {
+				if r <= 32 || r >= 127 || strings.ContainsRune("()<>[]{}/%#", r) {
+					return -1
+				}
+				return r
+			}, s)
+			if s != "" {
+				return s
+			}
+		}
+	}
+	return "EmbeddedFont"
+}
+
+// scale переводит единицы шрифта в 1/1000 кегля
+func (t *trueType) scale(v int) int {
+	return v * 1000 / t.unitsPerEm
+}
+
+// glyph возвращает глиф символа; отсутствующие символы заменяются на "?"
+func (t *trueType) glyph(r rune) uint16 {
+	if gid, ok := t.cmap[r]; ok {
+		return gid
+	}
+	if r == ' ' {
+		return t.cmap[' ']
+	}
+	return t.cmap['?']
+}
+
+// advance возвращает ширину глифа в 1/1000 кегля
+func (t *trueType) advance(gid uint16) int {
+	if int(gid) >= len(t.advances) {
+		return 0
+	}
+	return t.scale(t.advances[gid])
+}
+
+// subset собирает программу шрифта, в которой оставлены только нужные глифы
+// (и компоненты составных глифов). Номера глифов сохраняются, поэтому
+// CIDToGIDMap остаётся тождественным.
+func (t *trueType) subset(used map[uint16]rune) []byte {
+	glyf := t.tables["glyf"]
+	keep := map[uint16]bool{0: true}
+	queue := make([]uint16, 0, len(used))
+	for gid := range used {
+		queue = append(queue, gid)
+	}
+	for len(queue) > 0 {
+		gid := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		if keep[gid] || int(gid) >= t.numGlyphs {
+			continue
+		}
+		keep[gid] = true
+		queue = append(queue, t.components(glyf[t.loca[gid]:t.loca[gid+1]])...)
+	}
+
+	var newGlyf []byte
+	newLoca := make([]byte, (t.numGlyphs+1)*4)
+	for gid := 0; gid < t.numGlyphs; gid++ {
+		binary.BigEndian.PutUint32(newLoca[gid*4:], uint32(len(newGlyf)))
+		if keep[uint16(gid)] {
+			newGlyf = append(newGlyf, glyf[t.loca[gid]:t.loca[gid+1]]...)
+			for len(newGlyf)%4 != 0 {
+				newGlyf = append(newGlyf, 0)
+			}
+		}
+	}
+	binary.BigEndian.PutUint32(newLoca[t.numGlyphs*4:], uint32(len(newGlyf)))
+
+	head := append([]byte(nil), t.tables["head"]...)
+	binary.BigEndian.PutUint32(head[8:], 0)  // checkSumAdjustment
+	binary.BigEndian.PutUint16(head[50:], 1) // indexToLocFormat: длинные смещения
+
+	tables := map[string][]byte{
+		"head": head,
+		"hhea": t.tables["hhea"],
+		"hmtx": t.tables["hmtx"],
+		"maxp": t.tables["maxp"],
+		"loca": newLoca,
+		"glyf": newGlyf,
+	}
+	for _, tag := range []string{"cvt ", "fpgm", "prep"} {
+		if data := t.tables[tag]; data != nil {
+			tables[tag] = data
+		}
+	}
+	return buildSfnt(tables)
+}
+
+// components возвращает глифы, из которых состоит составной глиф
+func (t *trueType) components(g []byte) []uint16 {
+	if len(g) < 10 || int16(binary.BigEndian.Uint16(g)) >= 0 {
+		return nil
+	}
+	var ids []uint16
+	for pos := 10; pos+4 <= len(g); {
+		flags := binary.BigEndian.Uint16(g[pos:])
+		ids = append(ids, binary.BigEndian.Uint16(g[pos+2:]))
+		pos += 4
+		if flags&0x0001 != 0 { // ARG_1_AND_2_ARE_WORDS
+			pos += 4
+		} else {
+			pos += 2
+		}
+		switch {
+		case flags&0x0008 != 0: // WE_HAVE_A_SCALE
+			pos += 2
+		case flags&0x0040 != 0: // WE_HAVE_AN_X_AND_Y_SCALE
+			pos += 4
+		case flags&0x0080 != 0: // WE_HAVE_A_TWO_BY_TWO
+			pos += 8
+		}
+		if flags&0x0020 == 0 { // MORE_COMPONENTS
+			break
+		}
+	}
+	return ids
+}
+
+// buildSfnt собирает файл шрифта из таблиц
+func buildSfnt(tables map[string][]byte) []byte {
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	n := len(tags)
+	searchRange, entrySelector := 1, 0
+	for searchRange*2 <= n {
+		searchRange *= 2
+		entrySelector++
+	}
+	header := make([]byte, 12+n*16)
+	binary.BigEndian.PutUint32(header, 0x00010000)
+	binary.BigEndian.PutUint16(header[4:], uint16(n))
+	binary.BigEndian.PutUint16(header[6:], uint16(searchRange*16))
+	binary.BigEndian.PutUint16(header[8:], uint16(entrySelector))
+	binary.BigEndian.PutUint16(header[10:], uint16(n*16-searchRange*16))
+
+	var body []byte
+	for i, tag := range tags {
+		data := tables[tag]
+		rec := header[12+i*16:]
+		copy(rec, tag)
+		binary.BigEndian.PutUint32(rec[4:], tableChecksum(data))
+		binary.BigEndian.PutUint32(rec[8:], uint32(len(header)+len(body)))
+		binary.BigEndian.PutUint32(rec[12:], uint32(len(data)))
+		body = append(body, data...)
+		for len(body)%4 != 0 {
+			body = append(body, 0)
+		}
+	}
+	return append(header, body...)
+}
+
+func tableChecksum(data []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(data); i += 4 {
+		var word [4]byte
+		copy(word[:], data[i:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	return sum
+}
+
+// write встраивает подмножество шрифта как CIDFontType2 с кодировкой Identity-H
+func (t *trueType) write(pw *writer, used map[uint16]rune) int {
+	gids := sortedGlyphs(used)
+
+	// Префикс подмножества - шесть заглавных букв, зависящих от набора глифов
+	hash := sha1.New()
+	for _, gid := range gids {
+		binary.Write(hash, binary.BigEndian, gid)
+	}
+	sum := hash.Sum(nil)
+	tag := make([]byte, 6)
+	for i := range tag {
+		tag[i] = 'A' + sum[i]%26
+	}
+	baseFont := string(tag) + "+" + t.name
+
+	fontFile := t.subset(used)
+	fileID, descriptorID, cidID, toUnicodeID, id := pw.reserve(), pw.reserve(), pw.reserve(), pw.reserve(), pw.reserve()
+	pw.stream(fileID, fmt.Sprintf(" /Length1 %d", len(fontFile)), fontFile, true)
+	pw.dict(descriptorID, fmt.Sprintf("<< /Type /FontDescriptor /FontName /%s /Flags 32 /FontBBox [%d %d %d %d] /ItalicAngle 0 /Ascent %d /Descent %d /CapHeight %d /StemV 80 /FontFile2 %d 0 R >>",
+		baseFont, t.bbox[0], t.bbox[1], t.bbox[2], t.bbox[3], t.ascent, t.descent, t.capHeight, fileID))
+
+	var widths strings.Builder
+	for _, gid := range gids {
+		fmt.Fprintf(&widths, "%d [%d] ", gid, t.advance(gid))
+	}
+	pw.dict(cidID, fmt.Sprintf("<< /Type /Font /Subtype /CIDFontType2 /BaseFont /%s /CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> /FontDescriptor %d 0 R /CIDToGIDMap /Identity /DW 0 /W [%s] >>",
+		baseFont, descriptorID, strings.TrimSpace(widths.String())))
+
+	pw.stream(toUnicodeID, "", toUnicodeCMap(gids, used), true)
+	pw.dict(id, fmt.Sprintf("<< /Type /Font /Subtype /Type0 /BaseFont /%s /Encoding /Identity-H /DescendantFonts [%d 0 R] /ToUnicode %d 0 R >>",
+		baseFont, cidID, toUnicodeID))
+	return id
+}
+
+// toUnicodeCMap сопоставляет глифы символам, чтобы текст можно было копировать и искать
+func toUnicodeCMap(gids []uint16, used map[uint16]rune) []byte {
+	var sb strings.Builder
+	sb.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n")
+	sb.WriteString("/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n")
+	sb.WriteString("/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n")
+	sb.WriteString("1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n")
+	for start := 0; start < len(gids); start += 100 {
+		end := start + 100
+		if end > len(gids) {
+			end = len(gids)
+		}
+		fmt.Fprintf(&sb, "%d beginbfchar\n", end-start)
+		for _, gid := range gids[start:end] {
+			sb.WriteString(fmt.Sprintf("<%04X> <", gid))
+			for _, u := range utf16.Encode([]rune{used[gid]}) {
+				fmt.Fprintf(&sb, "%04X", u)
+			}
+			sb.WriteString(">\n")
+		}
+		sb.WriteString("endbfchar\n")
+	}
+	sb.WriteString("endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend\n")
+	return []byte(sb.String())
+}
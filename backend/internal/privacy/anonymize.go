@@ -0,0 +1,174 @@
+package privacy
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"classkeeper/internal/audit"
+	"classkeeper/internal/models"
+	"classkeeper/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+// subjectRoles - роли, данные которых можно обезличить
+var subjectRoles = map[string]string{
+	"student":  "Ученик",
+	"starosta": "Ученик",
+	"parent":   "Родитель",
+}
+
+// Anonymize стирает персональные данные ученика или родителя. Имя, логин, почта,
+// аватар и пароль заменяются, свободный текст о пользователе (комментарии к оценкам,
+// ответы, заявления) очищается, уведомления, ссылки на календарь, связи родитель-ребёнок
+// и загруженные файлы удаляются, а значения в журнале аудита скрываются.
+// Оценки, отметки и состав классов остаются, поэтому средние баллы и посещаемость
+// классов не меняются. reason записывается в журнал.
+func Anonymize(ctx context.Context, db *gorm.DB, store storage.Backend, userID uint, reason string) error {
+	var user models.User
+	if err := db.WithContext(ctx).Unscoped().First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotFound
+		}
+		return err
+	}
+	label, ok := subjectRoles[user.Role]
+	if !ok {
+		return ErrNotSubject
+	}
+	if user.AnonymizedAt != nil {
+		return ErrAnonymized
+	}
+
+	password, err := randomHex(32)
+	if err != nil {
+		return err
+	}
+
+	var files []models.Attachment
+	err = db.WithContext(models.WithSyncSchool(audit.WithoutLog(ctx), user.SchoolID)).Transaction(func(tx *gorm.DB) error {
+		tx = tx.Unscoped().Session(&gorm.Session{})
+		id := user.ID
+		now := time.Now()
+
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"username":        fmt.Sprintf("anon-%d", id),
+			"email":           fmt.Sprintf("anon-%d@anonymized.invalid", id),
+			"password_hash":   password,
+			"first_name":      "",
+			"last_name":       fmt.Sprintf("%s %d", label, id),
+			"middle_name":     "",
+			"admin_title":     "",
+			"teacher_subject": "",
+			"avatar_url":      "",
+			"external_id":     nil,
+			"anonymized_at":   now,
+		}).Error; err != nil {
+			return err
+		}
+
+		// Свободный текст о пользователе: в строках и в истории их изменений
+		byStudent := tx.Where("student_id = ?", id)
+		clear := []struct {
+			table   string
+			model   interface{}
+			where   *gorm.DB
+			columns []string
+		}{
+			{"grades", &models.Grade{}, byStudent, []string{"comment"}},
+			{"attendances", &models.Attendance{}, byStudent, []string{"comment"}},
+			{"homework_submissions", &models.HomeworkSubmission{}, byStudent, []string{"answer", "teacher_comment"}},
+			{"absence_notices", &models.AbsenceNotice{}, tx.Where("student_id = ? OR submitted_by = ?", id, id), []string{"comment", "review_comment"}},
+			{"student_alerts", &models.StudentAlert{}, byStudent, []string{"resolution"}},
+			{"report_card_comments", &models.ReportCardComment{}, byStudent, []string{"comment"}},
+			{"check_ins", &models.CheckIn{}, byStudent, []string{"ip_address"}},
+		}
+		for _, c := range clear {
+			var ids []uint
+			if err := tx.Model(c.model).Where(c.where).Pluck("id", &ids).Error; err != nil {
+				return err
+			}
+			if len(ids) == 0 {
+				continue
+			}
+			values := map[string]interface{}{}
+			for _, column := range c.columns {
+				values[column] = ""
+			}
+			if err := tx.Model(c.model).Where("id IN ?", ids).Updates(values).Error; err != nil {
+				return err
+			}
+			if err := audit.Redact(tx, c.table, ids, c.columns...); err != nil {
+				return err
+			}
+		}
+
+		// Файлы: загруженные пользователем, аватар, вложения его работ и заявлений
+		var submissionIDs, noticeIDs []uint
+		if err := tx.Model(&models.HomeworkSubmission{}).Where("student_id = ?", id).Pluck("id", &submissionIDs).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.AbsenceNotice{}).Where("student_id = ? OR submitted_by = ?", id, id).Pluck("id", &noticeIDs).Error; err != nil {
+			return err
+		}
+		query := tx.Where("uploaded_by = ? OR (owner_type = ? AND owner_id = ?)", id, "avatar", id)
+		if len(submissionIDs) > 0 {
+			query = query.Or("owner_type = ? AND owner_id IN ?", "submission", submissionIDs)
+		}
+		if len(noticeIDs) > 0 {
+			query = query.Or("owner_type = ? AND owner_id IN ?", "absence_notice", noticeIDs)
+		}
+		if err := query.Find(&files).Error; err != nil {
+			return err
+		}
+		if len(files) > 0 {
+			if err := tx.Delete(&files).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, d := range []struct {
+			model interface{}
+			where *gorm.DB
+		}{
+			{&models.Notification{}, tx.Where("user_id = ?", id)},
+			{&models.CalendarFeed{}, tx.Where("user_id = ?", id)},
+			{&models.ParentStudent{}, tx.Where("parent_id = ? OR student_id = ?", id, id)},
+		} {
+			if err := tx.Where(d.where).Delete(d.model).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := audit.Redact(tx, "users", []uint{id}); err != nil {
+			return err
+		}
+		changes := map[string]audit.Change{}
+		if reason != "" {
+			changes["reason"] = audit.Change{New: reason}
+		}
+		return audit.Record(tx, user.SchoolID, audit.ActionAnonymize, "users", id, changes)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if f.Backend == store.Name() {
+			store.Delete(ctx, f.StorageKey)
+		}
+	}
+	return nil
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,431 @@
+// Package privacy исполняет запросы субъектов персональных данных: выгрузка всех
+// данных ученика или родителя в машиночитаемом архиве и обезличивание, при котором
+// оценки и посещаемость остаются в статистике класса. Правило хранения обезличивает
+// выпускников и выбывших учеников через заданное число лет.
+package privacy
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"reflect"
+	"time"
+
+	"classkeeper/internal/models"
+	"classkeeper/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// ExportFormat - идентификатор формата архива персональных данных в манифесте
+	ExportFormat = "classkeeper-personal-data"
+	// ExportVersion - версия формата архива
+	ExportVersion = 1
+)
+
+var (
+	// ErrNotFound - пользователя нет
+	ErrNotFound = errors.New("user not found")
+	// ErrNotSubject - обезличить можно только ученика или родителя
+	ErrNotSubject = errors.New("only students and parents can be anonymized")
+	// ErrAnonymized - данные пользователя уже стёрты
+	ErrAnonymized = errors.New("user is already anonymized")
+)
+
+// ExportManifest описывает архив персональных данных
+type ExportManifest struct {
+	Format    string       `json:"format"`
+	Version   int          `json:"version"`
+	CreatedAt time.Time    `json:"created_at"`
+	User      ExportUser   `json:"user"`
+	Files     []ExportFile `json:"files"`
+	// Вложения, файлов которых не оказалось в хранилище
+	MissingFiles []uint `json:"missing_files,omitempty"`
+}
+
+// ExportUser - пользователь, чьи данные выгружены
+type ExportUser struct {
+	ID       uint   `json:"id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+// ExportFile - файл архива
+type ExportFile struct {
+	Path string `json:"path"`
+	Rows int    `json:"rows,omitempty"`
+	Size int64  `json:"size"`
+}
+
+// nameSQL - ФИО пользователя из таблицы с псевдонимом alias или логин, если ФИО не заполнено
+func nameSQL(alias string) string {
+	return fmt.Sprintf("COALESCE(NULLIF(TRIM(COALESCE(%[1]s.last_name, '') || ' ' || COALESCE(%[1]s.first_name, '') || ' ' || COALESCE(%[1]s.middle_name, '')), ''), %[1]s.username, '')", alias)
+}
+
+// Строки файлов архива
+type (
+	person struct {
+		ID   uint   `json:"id"`
+		Name string `json:"name"`
+		Role string `json:"role"`
+	}
+	classRow struct {
+		ID   uint   `json:"id"`
+		Name string `json:"name"`
+		Year string `json:"year"`
+	}
+	gradeRow struct {
+		ID        uint      `json:"id"`
+		Date      time.Time `json:"date"`
+		Subject   string    `json:"subject"`
+		Grade     int       `json:"grade"`
+		GradeType string    `json:"grade_type,omitempty"`
+		Comment   string    `json:"comment,omitempty"`
+		Teacher   string    `json:"teacher"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+	attendanceRow struct {
+		ID           uint      `json:"id"`
+		Date         time.Time `json:"date"`
+		LessonNumber *int      `json:"lesson_number,omitempty"`
+		Subject      string    `json:"subject,omitempty"`
+		Status       string    `json:"status"`
+		MinutesLate  int       `json:"minutes_late,omitempty"`
+		Comment      string    `json:"comment,omitempty"`
+		CreatedAt    time.Time `json:"created_at"`
+	}
+	homeworkRow struct {
+		ID             uint       `json:"id"`
+		Class          string     `json:"class"`
+		Subject        string     `json:"subject"`
+		Description    string     `json:"description"`
+		AssignedDate   time.Time  `json:"assigned_date"`
+		DueDate        time.Time  `json:"due_date"`
+		Status         *string    `json:"status,omitempty"`
+		Answer         *string    `json:"answer,omitempty"`
+		SubmittedAt    *time.Time `json:"submitted_at,omitempty"`
+		TeacherComment *string    `json:"teacher_comment,omitempty"`
+		Grade          *int       `json:"grade,omitempty"`
+	}
+	announcementRow struct {
+		ID         uint      `json:"id"`
+		Title      string    `json:"title"`
+		Content    string    `json:"content"`
+		TargetRole string    `json:"target_role,omitempty"`
+		Author     string    `json:"author"`
+		CreatedAt  time.Time `json:"created_at"`
+	}
+	absenceRow struct {
+		ID            uint       `json:"id"`
+		Student       string     `json:"student"`
+		SubmittedBy   string     `json:"submitted_by"`
+		StartDate     time.Time  `json:"start_date"`
+		EndDate       time.Time  `json:"end_date"`
+		Reason        string     `json:"reason"`
+		Comment       string     `json:"comment,omitempty"`
+		Status        string     `json:"status"`
+		ReviewComment string     `json:"review_comment,omitempty"`
+		ReviewedAt    *time.Time `json:"reviewed_at,omitempty"`
+		CreatedAt     time.Time  `json:"created_at"`
+	}
+	reportCommentRow struct {
+		Year    int    `json:"year"`
+		Term    int    `json:"term"`
+		Subject string `json:"subject,omitempty"`
+		Comment string `json:"comment"`
+		Teacher string `json:"teacher"`
+	}
+	alertRow struct {
+		ID         uint       `json:"id"`
+		Rule       string     `json:"rule"`
+		Severity   string     `json:"severity"`
+		Status     string     `json:"status"`
+		Message    string     `json:"message"`
+		Resolution string     `json:"resolution,omitempty"`
+		CreatedAt  time.Time  `json:"created_at"`
+		ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	}
+	activityRow struct {
+		CreatedAt time.Time       `json:"created_at"`
+		Action    string          `json:"action"`
+		Entity    string          `json:"entity"`
+		EntityID  *uint           `json:"entity_id,omitempty"`
+		IP        string          `json:"ip,omitempty"`
+		Changes   json.RawMessage `json:"changes,omitempty"`
+	}
+)
+
+// audienceRoles - адресат объявления (target_role) для роли пользователя
+var audienceRoles = map[string]string{
+	"student":  "students",
+	"starosta": "students",
+	"parent":   "parents",
+	"teacher":  "teachers",
+}
+
+// section - файл архива и запрос, который его заполняет
+type section struct {
+	name  string
+	query func(db *gorm.DB, user *models.User) (interface{}, error)
+}
+
+// sections - данные, связанные с пользователем
+var sections = []section{
+	{"profile", func(db *gorm.DB, user *models.User) (interface{}, error) {
+		var school models.School
+		if err := db.Unscoped().First(&school, user.SchoolID).Error; err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"user": user, "school": map[string]interface{}{"id": school.ID, "name": school.Name}}, nil
+	}},
+	{"classes", func(db *gorm.DB, user *models.User) (interface{}, error) {
+		rows := []classRow{}
+		err := db.Unscoped().Model(&models.Class{}).
+			Select("classes.id, classes.name, classes.year").
+			Joins("JOIN class_students ON class_students.class_id = classes.id").
+			Where("class_students.user_id = ?", user.ID).
+			Order("classes.year, classes.name").
+			Scan(&rows).Error
+		return rows, err
+	}},
+	{"family", func(db *gorm.DB, user *models.User) (interface{}, error) {
+		rows := []person{}
+		other, self := "student_id", "parent_id"
+		if user.Role != "parent" {
+			other, self = "parent_id", "student_id"
+		}
+		err := db.Model(&models.ParentStudent{}).
+			Select("users.id, "+nameSQL("users")+" AS name, users.role").
+			Joins("JOIN users ON users.id = parent_students."+other).
+			Where("parent_students."+self+" = ?", user.ID).
+			Order("users.id").
+			Scan(&rows).Error
+		return rows, err
+	}},
+	{"grades", func(db *gorm.DB, user *models.User) (interface{}, error) {
+		rows := []gradeRow{}
+		err := db.Model(&models.Grade{}).
+			Select("grades.id, grades.date, subjects.name AS subject, grades.grade, grades.grade_type, grades.comment, "+
+				nameSQL("teachers")+" AS teacher, grades.created_at").
+			Joins("LEFT JOIN subjects ON subjects.id = grades.subject_id").
+			Joins("LEFT JOIN users teachers ON teachers.id = grades.teacher_id").
+			Where("grades.student_id = ?", user.ID).
+			Order("grades.date, grades.id").
+			Scan(&rows).Error
+		return rows, err
+	}},
+	{"attendance", func(db *gorm.DB, user *models.User) (interface{}, error) {
+		rows := []attendanceRow{}
+		err := db.Model(&models.Attendance{}).
+			Select("attendances.id, attendances.date, attendances.lesson_number, subjects.name AS subject, "+
+				"attendances.status, attendances.minutes_late, attendances.comment, attendances.created_at").
+			Joins("LEFT JOIN subjects ON subjects.id = attendances.subject_id").
+			Where("attendances.student_id = ?", user.ID).
+			Order("attendances.date, attendances.lesson_number, attendances.id").
+			Scan(&rows).Error
+		return rows, err
+	}},
+	{"homework", func(db *gorm.DB, user *models.User) (interface{}, error) {
+		rows := []homeworkRow{}
+		if user.Role == "parent" {
+			return rows, nil
+		}
+		err := db.Model(&models.Homework{}).
+			Select("homeworks.id, classes.name AS class, subjects.name AS subject, homeworks.description, "+
+				"homeworks.assigned_date, homeworks.due_date, hs.status, hs.answer, hs.submitted_at, hs.teacher_comment, grades.grade").
+			Joins("LEFT JOIN classes ON classes.id = homeworks.class_id").
+			Joins("LEFT JOIN subjects ON subjects.id = homeworks.subject_id").
+			Joins("LEFT JOIN homework_submissions hs ON hs.homework_id = homeworks.id AND hs.student_id = ?", user.ID).
+			Joins("LEFT JOIN grades ON grades.id = hs.grade_id AND grades.deleted_at IS NULL").
+			Where("homeworks.class_id IN (SELECT class_id FROM class_students WHERE user_id = ?) OR hs.id IS NOT NULL", user.ID).
+			Order("homeworks.assigned_date, homeworks.id").
+			Scan(&rows).Error
+		return rows, err
+	}},
+	{"announcements", func(db *gorm.DB, user *models.User) (interface{}, error) {
+		rows := []announcementRow{}
+		err := db.Model(&models.Announcement{}).
+			Select("announcements.id, announcements.title, announcements.content, announcements.target_role, "+
+				nameSQL("authors")+" AS author, announcements.created_at").
+			Joins("LEFT JOIN users authors ON authors.id = announcements.author_id").
+			Where("announcements.school_id = ?", user.SchoolID).
+			Where("announcements.target_role IN ? OR announcements.target_class_id IN (SELECT class_id FROM class_students WHERE user_id = ?)",
+				[]string{"all", user.Role, audienceRoles[user.Role]}, user.ID).
+			Order("announcements.created_at, announcements.id").
+			Scan(&rows).Error
+		return rows, err
+	}},
+	{"absence_notices", func(db *gorm.DB, user *models.User) (interface{}, error) {
+		rows := []absenceRow{}
+		err := db.Model(&models.AbsenceNotice{}).
+			Select("absence_notices.id, "+nameSQL("students")+" AS student, "+nameSQL("parents")+" AS submitted_by, "+
+				"absence_notices.start_date, absence_notices.end_date, absence_notices.reason, absence_notices.comment, "+
+				"absence_notices.status, absence_notices.review_comment, absence_notices.reviewed_at, absence_notices.created_at").
+			Joins("LEFT JOIN users students ON students.id = absence_notices.student_id").
+			Joins("LEFT JOIN users parents ON parents.id = absence_notices.submitted_by").
+			Where("absence_notices.student_id = ? OR absence_notices.submitted_by = ?", user.ID, user.ID).
+			Order("absence_notices.start_date, absence_notices.id").
+			Scan(&rows).Error
+		return rows, err
+	}},
+	{"report_card_comments", func(db *gorm.DB, user *models.User) (interface{}, error) {
+		rows := []reportCommentRow{}
+		err := db.Model(&models.ReportCardComment{}).
+			Select("report_card_comments.year, report_card_comments.term, subjects.name AS subject, report_card_comments.comment, "+
+				nameSQL("teachers")+" AS teacher").
+			Joins("LEFT JOIN subjects ON subjects.id = report_card_comments.subject_id").
+			Joins("LEFT JOIN users teachers ON teachers.id = report_card_comments.teacher_id").
+			Where("report_card_comments.student_id = ?", user.ID).
+			Order("report_card_comments.year, report_card_comments.term, report_card_comments.subject_id").
+			Scan(&rows).Error
+		return rows, err
+	}},
+	{"alerts", func(db *gorm.DB, user *models.User) (interface{}, error) {
+		rows := []alertRow{}
+		err := db.Model(&models.StudentAlert{}).
+			Select("student_alerts.id, alert_rules.name AS rule, student_alerts.severity, student_alerts.status, "+
+				"student_alerts.message, student_alerts.resolution, student_alerts.created_at, student_alerts.resolved_at").
+			Joins("LEFT JOIN alert_rules ON alert_rules.id = student_alerts.rule_id").
+			Where("student_alerts.student_id = ?", user.ID).
+			Order("student_alerts.created_at, student_alerts.id").
+			Scan(&rows).Error
+		return rows, err
+	}},
+	{"notifications", func(db *gorm.DB, user *models.User) (interface{}, error) {
+		rows := []models.Notification{}
+		err := db.Where("user_id = ?", user.ID).Order("created_at, id").Find(&rows).Error
+		return rows, err
+	}},
+	{"activity", func(db *gorm.DB, user *models.User) (interface{}, error) {
+		var logs []models.AuditLog
+		if err := db.Where("user_id = ? OR (entity = ? AND entity_id = ?)", user.ID, "users", user.ID).
+			Order("id").Find(&logs).Error; err != nil {
+			return nil, err
+		}
+		rows := make([]activityRow, len(logs))
+		for i, l := range logs {
+			rows[i] = activityRow{CreatedAt: l.CreatedAt, Action: l.Action, Entity: l.Entity, EntityID: l.EntityID, IP: l.IP}
+			if l.Changes != "" {
+				rows[i].Changes = json.RawMessage(l.Changes)
+			}
+		}
+		return rows, nil
+	}},
+}
+
+// Export пишет в w ZIP-архив со всеми данными пользователя: профиль, классы,
+// родители или дети, оценки, посещаемость, домашние задания и ответы, объявления,
+// заявления об отсутствии, комментарии в табелях, предупреждения, уведомления,
+// история действий и загруженные файлы. Каждый раздел - JSON-файл.
+func Export(ctx context.Context, db *gorm.DB, store storage.Backend, userID uint, w io.Writer) (*ExportManifest, error) {
+	db = db.WithContext(ctx)
+
+	var user models.User
+	if err := db.Unscoped().First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	manifest := &ExportManifest{
+		Format:    ExportFormat,
+		Version:   ExportVersion,
+		CreatedAt: time.Now().UTC(),
+		User:      ExportUser{ID: user.ID, Username: user.Username, Role: user.Role},
+	}
+	zw := zip.NewWriter(w)
+
+	for _, s := range sections {
+		data, err := s.query(db, &user)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", s.name, err)
+		}
+		// Пустые разделы не пишутся, профиль пишется всегда
+		v := reflect.ValueOf(data)
+		isList := v.Kind() == reflect.Slice
+		if isList && v.Len() == 0 {
+			continue
+		}
+		file, err := writeJSON(zw, s.name+".json", data)
+		if err != nil {
+			return nil, err
+		}
+		if isList {
+			file.Rows = v.Len()
+		}
+		manifest.Files = append(manifest.Files, *file)
+	}
+
+	if err := exportAttachments(ctx, db, zw, store, &user, manifest); err != nil {
+		return nil, err
+	}
+
+	if _, err := writeJSON(zw, "manifest.json", manifest); err != nil {
+		return nil, err
+	}
+	return manifest, zw.Close()
+}
+
+// exportAttachments добавляет файлы, которые загрузил пользователь, и их описание
+func exportAttachments(ctx context.Context, db *gorm.DB, zw *zip.Writer, store storage.Backend, user *models.User, manifest *ExportManifest) error {
+	var attachments []models.Attachment
+	if err := db.Where("uploaded_by = ? OR (owner_type = ? AND owner_id = ?)", user.ID, "avatar", user.ID).
+		Order("id").Find(&attachments).Error; err != nil {
+		return err
+	}
+	if len(attachments) == 0 {
+		return nil
+	}
+
+	file, err := writeJSON(zw, "attachments.json", attachments)
+	if err != nil {
+		return err
+	}
+	file.Rows = len(attachments)
+	manifest.Files = append(manifest.Files, *file)
+
+	for _, a := range attachments {
+		if a.Backend != store.Name() {
+			manifest.MissingFiles = append(manifest.MissingFiles, a.ID)
+			continue
+		}
+		r, err := store.Get(ctx, a.StorageKey)
+		if err != nil {
+			manifest.MissingFiles = append(manifest.MissingFiles, a.ID)
+			continue
+		}
+		name := fmt.Sprintf("files/%d/%s", a.ID, path.Base("/"+a.FileName))
+		fw, err := zw.Create(name)
+		if err == nil {
+			var size int64
+			size, err = io.Copy(fw, r)
+			manifest.Files = append(manifest.Files, ExportFile{Path: name, Size: size})
+		}
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeJSON(zw *zip.Writer, name string, data interface{}) (*ExportFile, error) {
+	content, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	fw, err := zw.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fw.Write(content); err != nil {
+		return nil, err
+	}
+	return &ExportFile{Path: name, Size: int64(len(content))}, nil
+}
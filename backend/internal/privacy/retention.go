@@ -0,0 +1,188 @@
+package privacy
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"classkeeper/internal/models"
+	"classkeeper/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+// RetentionReason - причина обезличивания по сроку хранения в журнале
+const RetentionReason = "retention"
+
+// Candidate - пользователь, срок хранения данных которого истёк
+type Candidate struct {
+	UserID   uint      `json:"user_id"`
+	SchoolID uint      `json:"school_id"`
+	Role     string    `json:"role"`
+	Name     string    `json:"name"`
+	LeftAt   time.Time `json:"left_at"` // Конец последнего учебного года или дата удаления
+}
+
+var yearPattern = regexp.MustCompile(`\d{4}`)
+
+// yearEnd возвращает последний день учебного года класса ("2025-2026" или "2025")
+func yearEnd(year string) (time.Time, bool) {
+	found := yearPattern.FindAllString(year, -1)
+	if len(found) == 0 {
+		return time.Time{}, false
+	}
+	end, _ := strconv.Atoi(found[len(found)-1])
+	if len(found) == 1 {
+		end++
+	}
+	return time.Date(end, time.May, 31, 0, 0, 0, 0, time.UTC), true
+}
+
+// Candidates возвращает учеников, которые окончили школу или выбыли раньше, чем
+// years лет назад, и родителей, все дети которых - такие ученики. Ученик выбыл,
+// если он удалён, и окончил школу, если закончились учебные годы всех его классов.
+// schoolID = 0 - все школы.
+func Candidates(db *gorm.DB, schoolID uint, years int, now time.Time) ([]Candidate, error) {
+	cutoff := now.AddDate(-years, 0, 0)
+
+	var users []models.User
+	query := db.Unscoped().
+		Where("role IN ? AND anonymized_at IS NULL", []string{"student", "starosta", "parent"}).
+		Order("id")
+	if schoolID != 0 {
+		query = query.Where("school_id = ?", schoolID)
+	}
+	if err := query.Find(&users).Error; err != nil {
+		return nil, err
+	}
+
+	var memberships []struct {
+		UserID uint
+		Year   string
+	}
+	if err := db.Table("class_students").
+		Select("class_students.user_id, classes.year").
+		Joins("JOIN classes ON classes.id = class_students.class_id").
+		Scan(&memberships).Error; err != nil {
+		return nil, err
+	}
+	lastYear := map[uint]time.Time{}
+	for _, m := range memberships {
+		end, ok := yearEnd(m.Year)
+		if ok && end.After(lastYear[m.UserID]) {
+			lastYear[m.UserID] = end
+		}
+	}
+
+	result := []Candidate{}
+	expired := map[uint]time.Time{}
+	var parents []models.User
+	for _, u := range users {
+		if u.Role == "parent" {
+			parents = append(parents, u)
+			continue
+		}
+		left, ok := lastYear[u.ID]
+		if u.DeletedAt.Valid && (!ok || u.DeletedAt.Time.Before(left)) {
+			left, ok = u.DeletedAt.Time, true
+		}
+		if !ok || !left.Before(cutoff) {
+			continue
+		}
+		expired[u.ID] = left
+		result = append(result, newCandidate(u, left))
+	}
+	if len(parents) == 0 {
+		return result, nil
+	}
+
+	var links []models.ParentStudent
+	if err := db.Find(&links).Error; err != nil {
+		return nil, err
+	}
+	var anonymized []uint
+	if err := db.Unscoped().Model(&models.User{}).Where("anonymized_at IS NOT NULL").Pluck("id", &anonymized).Error; err != nil {
+		return nil, err
+	}
+	gone := map[uint]bool{}
+	for _, id := range anonymized {
+		gone[id] = true
+	}
+	children := map[uint][]uint{}
+	for _, l := range links {
+		children[l.ParentID] = append(children[l.ParentID], l.StudentID)
+	}
+
+	for _, p := range parents {
+		kids := children[p.ID]
+		if len(kids) == 0 {
+			continue
+		}
+		var left time.Time
+		ok := true
+		for _, kid := range kids {
+			if gone[kid] {
+				continue
+			}
+			t, found := expired[kid]
+			if !found {
+				ok = false
+				break
+			}
+			if t.After(left) {
+				left = t
+			}
+		}
+		if ok {
+			result = append(result, newCandidate(p, left))
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool { return result[i].UserID < result[j].UserID })
+	return result, nil
+}
+
+func newCandidate(u models.User, left time.Time) Candidate {
+	name := u.LastName + " " + u.FirstName
+	if u.LastName == "" && u.FirstName == "" {
+		name = u.Username
+	}
+	return Candidate{UserID: u.ID, SchoolID: u.SchoolID, Role: u.Role, Name: name, LeftAt: left}
+}
+
+// ApplyRetention обезличивает всех кандидатов. Возвращает число обезличенных пользователей.
+func ApplyRetention(ctx context.Context, db *gorm.DB, store storage.Backend, schoolID uint, years int) (int, error) {
+	candidates, err := Candidates(db.WithContext(ctx), schoolID, years, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	done := 0
+	for _, c := range candidates {
+		if err := Anonymize(ctx, db, store, c.UserID, RetentionReason); err != nil {
+			return done, err
+		}
+		done++
+	}
+	return done, nil
+}
+
+// Start запускает ежедневное обезличивание выпускников. years = 0 - правило выключено.
+func Start(db *gorm.DB, store storage.Backend, years int, interval time.Duration) {
+	if years <= 0 {
+		return
+	}
+	go func() {
+		for {
+			n, err := ApplyRetention(context.Background(), db, store, 0, years)
+			if err != nil {
+				log.Printf("Data retention failed: %v", err)
+			} else if n > 0 {
+				log.Printf("Data retention: anonymized %d users", n)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
@@ -0,0 +1,160 @@
+// Package recurring создаёт домашние задания по правилам повторения
+// на основе расписания уроков и школьного календаря.
+package recurring
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"classkeeper/internal/calendar"
+	"classkeeper/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// lookahead - насколько далеко ищем следующий урок предмета для срока сдачи
+const lookahead = 60
+
+// Generate создаёт ДЗ по правилу для уроков с последнего обработанного дня
+// (или даты начала) по until включительно. Возвращает созданные задания.
+func Generate(db *gorm.DB, rule *models.HomeworkRecurrence, until time.Time) ([]models.Homework, error) {
+	from := calendar.Date(rule.StartDate)
+	if rule.LastGenerated != nil && !rule.LastGenerated.Before(from) {
+		from = calendar.Date(*rule.LastGenerated).AddDate(0, 0, 1)
+	}
+	to := calendar.Date(until)
+	if rule.EndDate != nil && rule.EndDate.Before(to) {
+		to = calendar.Date(*rule.EndDate)
+	}
+	if from.After(to) {
+		return nil, nil
+	}
+
+	var template models.HomeworkTemplate
+	if err := db.First(&template, rule.TemplateID).Error; err != nil {
+		return nil, fmt.Errorf("template %d: %w", rule.TemplateID, err)
+	}
+
+	var class models.Class
+	if err := db.First(&class, rule.ClassID).Error; err != nil {
+		return nil, fmt.Errorf("class %d: %w", rule.ClassID, err)
+	}
+
+	// Дни недели, в которые у класса есть урок предмета
+	var days []string
+	if err := db.Model(&models.Schedule{}).
+		Where("class_id = ? AND subject_id = ?", class.ID, template.SubjectID).
+		Distinct().
+		Pluck("day_of_week", &days).Error; err != nil {
+		return nil, err
+	}
+	lessonDays := make(map[string]bool)
+	for _, day := range days {
+		lessonDays[day] = true
+	}
+
+	cal, err := calendar.Load(db, class.SchoolID, &class.ID, from, to.AddDate(0, 0, lookahead))
+	if err != nil {
+		return nil, err
+	}
+
+	var created []models.Homework
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+			dayName, working := cal.ScheduleDay(d)
+			assigned := d
+			if !working {
+				if rule.SkipHolidays {
+					continue
+				}
+				// Урок выпал на праздник - выдаём ДЗ в ближайший учебный день
+				dayName = calendar.DayName(d)
+				assigned = cal.NextWorkingDay(d)
+			}
+
+			if !lessonDays[dayName] || (rule.DayOfWeek != "" && rule.DayOfWeek != dayName) {
+				continue
+			}
+
+			// Повторный запуск не должен дублировать задания
+			var count int64
+			tx.Model(&models.Homework{}).
+				Where("recurrence_id = ? AND assigned_date = ?", rule.ID, assigned).
+				Count(&count)
+			if count > 0 {
+				continue
+			}
+
+			templateID, recurrenceID := template.ID, rule.ID
+			homework := models.Homework{
+				ClassID:          class.ID,
+				SubjectID:        template.SubjectID,
+				TeacherID:        rule.TeacherID,
+				Description:      template.Description,
+				AssignedDate:     assigned,
+				DueDate:          NextLesson(cal, lessonDays, assigned),
+				EstimatedMinutes: template.EstimatedMinutes,
+				TemplateID:       &templateID,
+				RecurrenceID:     &recurrenceID,
+			}
+			if err := tx.Create(&homework).Error; err != nil {
+				return err
+			}
+			created = append(created, homework)
+		}
+
+		rule.LastGenerated = &to
+		return tx.Model(rule).Update("last_generated", to).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// GenerateAll обрабатывает все активные правила до until включительно
+func GenerateAll(db *gorm.DB, until time.Time) (int, error) {
+	var rules []models.HomeworkRecurrence
+	if err := db.Where("active = ?", true).Find(&rules).Error; err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for i := range rules {
+		created, err := Generate(db, &rules[i], until)
+		if err != nil {
+			log.Printf("Recurring homework %d: %v", rules[i].ID, err)
+			continue
+		}
+		total += len(created)
+	}
+	return total, nil
+}
+
+// Start запускает фоновую выдачу повторяющихся ДЗ: задания создаются в день урока
+func Start(db *gorm.DB, interval time.Duration) {
+	go func() {
+		for {
+			if total, err := GenerateAll(db, time.Now()); err != nil {
+				log.Printf("Recurring homework generation failed: %v", err)
+			} else if total > 0 {
+				log.Printf("Recurring homework: created %d assignments", total)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// NextLesson возвращает дату следующего урока предмета после after - срок сдачи ДЗ.
+// Если урок не найден, срок - ближайший учебный день через неделю.
+func NextLesson(cal *calendar.Calendar, lessonDays map[string]bool, after time.Time) time.Time {
+	for i := 1; i <= lookahead; i++ {
+		d := after.AddDate(0, 0, i)
+		if name, ok := cal.ScheduleDay(d); ok && lessonDays[name] {
+			return d
+		}
+	}
+	return cal.NextWorkingDay(after.AddDate(0, 0, 7))
+}
@@ -0,0 +1,86 @@
+package seed
+
+// subject - предмет учебного плана и число уроков в неделю
+type subject struct {
+	name  string
+	hours int
+	room  int // Первый кабинет предмета
+}
+
+// curriculum - учебный план одного класса: 29 уроков в неделю, по 5-6 в день
+var curriculum = []subject{
+	{"Математика", 5, 301},
+	{"Русский язык", 4, 201},
+	{"Литература", 3, 205},
+	{"Английский язык", 3, 210},
+	{"История", 2, 215},
+	{"Обществознание", 1, 215},
+	{"Физика", 2, 310},
+	{"Химия", 2, 315},
+	{"Биология", 2, 320},
+	{"География", 2, 220},
+	{"Информатика", 1, 325},
+	{"Физкультура", 2, 100},
+}
+
+// lessonTimes - звонки: начало и конец уроков по номеру
+var lessonTimes = [][2]string{
+	{"08:30", "09:15"}, {"09:25", "10:10"}, {"10:30", "11:15"},
+	{"11:35", "12:20"}, {"12:30", "13:15"}, {"13:25", "14:10"},
+}
+
+// lessonsPerDay - число уроков в понедельник-пятницу
+var lessonsPerDay = []int{6, 6, 6, 6, 5}
+
+var classLetters = []string{"А", "Б", "В", "Г", "Д"}
+
+var (
+	maleNames = []string{"Александр", "Алексей", "Андрей", "Артём", "Богдан", "Вадим", "Виктор", "Владимир",
+		"Глеб", "Григорий", "Даниил", "Денис", "Дмитрий", "Егор", "Иван", "Игорь", "Илья", "Кирилл",
+		"Константин", "Лев", "Максим", "Марк", "Матвей", "Михаил", "Никита", "Николай", "Олег", "Павел",
+		"Роман", "Сергей", "Степан", "Тимофей", "Фёдор", "Юрий", "Ярослав"}
+	femaleNames = []string{"Алина", "Алиса", "Анастасия", "Анна", "Валерия", "Варвара", "Вера", "Виктория",
+		"Дарья", "Ева", "Екатерина", "Елена", "Елизавета", "Ирина", "Ксения", "Маргарита", "Марина",
+		"Мария", "Милана", "Надежда", "Наталья", "Ольга", "Полина", "Светлана", "София", "Таисия",
+		"Татьяна", "Ульяна", "Юлия"}
+	lastNames = []string{"Андреев", "Белов", "Богданов", "Васильев", "Виноградов", "Волков", "Воробьёв",
+		"Гаврилов", "Голубев", "Громов", "Давыдов", "Егоров", "Жуков", "Зайцев", "Иванов", "Ильин",
+		"Калинин", "Киселёв", "Ковалёв", "Комаров", "Крылов", "Кузнецов", "Лебедев", "Макаров",
+		"Медведев", "Миронов", "Морозов", "Никитин", "Новиков", "Орлов", "Павлов", "Петров", "Поляков",
+		"Попов", "Романов", "Семёнов", "Смирнов", "Соколов", "Соловьёв", "Степанов", "Тарасов",
+		"Фёдоров", "Фролов", "Чернов", "Шевцов", "Яковлев"}
+	// Отчества в мужской и женской форме
+	middleNames = [][2]string{{"Александрович", "Александровна"}, {"Алексеевич", "Алексеевна"},
+		{"Андреевич", "Андреевна"}, {"Викторович", "Викторовна"}, {"Владимирович", "Владимировна"},
+		{"Дмитриевич", "Дмитриевна"}, {"Евгеньевич", "Евгеньевна"}, {"Иванович", "Ивановна"},
+		{"Игоревич", "Игоревна"}, {"Максимович", "Максимовна"}, {"Михайлович", "Михайловна"},
+		{"Николаевич", "Николаевна"}, {"Олегович", "Олеговна"}, {"Павлович", "Павловна"},
+		{"Романович", "Романовна"}, {"Сергеевич", "Сергеевна"}, {"Юрьевич", "Юрьевна"}}
+)
+
+// homeworkTasks - задания по предметам; %d - номер параграфа, упражнения или страницы
+var homeworkTasks = map[string][]string{
+	"Математика":      {"№ %d, %d, %d", "Параграф %d, задачи после параграфа", "Самостоятельная работа, вариант %d", "Повторить формулы, № %d"},
+	"Русский язык":    {"Упражнение %d", "Параграф %d, правило наизусть, упр. %d", "Словарный диктант: слова на с. %d"},
+	"Литература":      {"Прочитать главы %d-%d", "Выучить стихотворение, с. %d", "Сочинение-рассуждение по прочитанному"},
+	"Английский язык": {"Ex. %d, p. %d", "Слова урока %d наизусть", "Workbook p. %d"},
+	"История":         {"Параграф %d, вопросы в конце", "Параграф %d, даты в тетрадь", "Подготовить сообщение по теме урока"},
+	"Обществознание":  {"Параграф %d", "Параграф %d, задание %d в рубрике «В классе и дома»"},
+	"Физика":          {"Параграф %d, упр. %d", "Лабораторная работа: оформить отчёт", "Задачи %d, %d"},
+	"Химия":           {"Параграф %d, задачи %d-%d", "Уравнения реакций, с. %d"},
+	"Биология":        {"Параграф %d, рисунок в тетрадь", "Параграф %d, вопросы %d-%d"},
+	"География":       {"Параграф %d, контурная карта", "Параграф %d, вопросы после параграфа"},
+	"Информатика":     {"Параграф %d", "Задание %d в электронном практикуме"},
+	"Физкультура":     {"Комплекс утренней гимнастики", "Подготовить форму к сдаче нормативов"},
+}
+
+// announcements - объявления администрации
+var announcements = []struct {
+	title, content, role string
+}{
+	{"Родительское собрание", "Общешкольное родительское собрание пройдёт в четверг в 18:30 в актовом зале.", "parents"},
+	{"Школьная форма", "Напоминаем о требованиях к внешнему виду учащихся.", "all"},
+	{"Педагогический совет", "Педсовет по итогам четверти - в пятницу после шестого урока.", "teachers"},
+	{"Олимпиады", "Открыта запись на школьный этап всероссийской олимпиады школьников.", "students"},
+	{"Медосмотр", "Плановый медосмотр учащихся пройдёт на следующей неделе по графику.", "all"},
+}
@@ -0,0 +1,735 @@
+// Package seed заполняет школу демонстрационными данными: предметы, учителя, классы,
+// ученики и родители, недельное расписание, календарь, отметки посещаемости, оценки,
+// домашние задания и объявления за выбранный период. Данные создаются через модели
+// сервера и полностью определяются зерном генератора: одинаковые параметры дают
+// одинаковую школу.
+package seed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"classkeeper/internal/audit"
+	"classkeeper/internal/calendar"
+	"classkeeper/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// DefaultPassword - пароль созданных пользователей, если не задан другой
+const DefaultPassword = "password123"
+
+// Size - размер школы
+type Size struct {
+	Classes          int `json:"classes"`
+	StudentsPerClass int `json:"students_per_class"`
+}
+
+// Sizes - готовые размеры школы
+var Sizes = map[string]Size{
+	"small":  {Classes: 3, StudentsPerClass: 12},
+	"medium": {Classes: 10, StudentsPerClass: 25},
+	"large":  {Classes: 33, StudentsPerClass: 28},
+}
+
+var (
+	// ErrUsernameTaken - логины с этим префиксом уже заняты
+	ErrUsernameTaken = errors.New("usernames with this prefix are already taken")
+	// ErrInvalidOptions - неверные параметры заполнения
+	ErrInvalidOptions = errors.New("invalid seed options")
+)
+
+// Options - параметры заполнения
+type Options struct {
+	SchoolID   uint   // Школа для заполнения; 0 - создать новую школу с администратором
+	SchoolName string // Название новой школы
+	Size
+	From time.Time // Период уроков: отметки, оценки и ДЗ создаются за учебные дни периода
+	To   time.Time
+	Seed int64
+	// Password - пароль всех созданных пользователей
+	Password string
+	// Prefix - префикс логинов. Логины уникальны во всём экземпляре, поэтому для второй
+	// школы нужен свой префикс.
+	Prefix string
+}
+
+// Report - что создано
+type Report struct {
+	SchoolID       uint              `json:"school_id"`
+	Seed           int64             `json:"seed"`
+	From           string            `json:"from"`
+	To             string            `json:"to"`
+	Users          map[string]int    `json:"users"`  // роль -> число
+	Logins         map[string]string `json:"logins"` // роль -> логин первого пользователя
+	Subjects       int               `json:"subjects"`
+	Classes        int               `json:"classes"`
+	Schedules      int               `json:"schedules"`
+	CalendarEvents int               `json:"calendar_events"`
+	Attendance     int               `json:"attendance"`
+	Grades         int               `json:"grades"`
+	Homework       int               `json:"homework"`
+	Announcements  int               `json:"announcements"`
+}
+
+// student - ученик и его склонности, от которых зависят оценки и пропуски
+type student struct {
+	id        uint
+	ability   float64 // Средняя оценка
+	absence   float64 // Вероятность пропустить урок
+	sickUntil time.Time
+}
+
+type class struct {
+	model    models.Class
+	level    int
+	students []*student
+	teachers map[uint]uint // предмет -> учитель
+}
+
+type generator struct {
+	tx     *gorm.DB
+	rng    *rand.Rand
+	opts   Options
+	report *Report
+	school models.School
+	admin  uint
+
+	subjects  []models.Subject
+	rooms     map[uint]int    // предмет -> кабинет
+	names     map[uint]string // предмет -> название
+	teachers  map[uint][]uint // предмет -> учителя
+	classes   []*class
+	schedules []models.Schedule
+	// lessonDays - дни недели, в которые у класса есть предмет: класс/предмет/день
+	lessonDays map[string]bool
+	events     []models.CalendarEvent
+	syncSeq    int64
+}
+
+// Run заполняет школу. Всё создаётся в одной транзакции; в журнал аудита попадает
+// одна запись о заполнении, а не каждая строка.
+func Run(ctx context.Context, db *gorm.DB, opts Options) (*Report, error) {
+	if opts.Classes <= 0 || opts.StudentsPerClass <= 0 || opts.Classes > len(classLetters)*7 {
+		return nil, fmt.Errorf("%w: classes must be 1-%d and students per class positive", ErrInvalidOptions, len(classLetters)*7)
+	}
+	if opts.From.IsZero() || opts.To.IsZero() {
+		opts.From, opts.To = calendar.AcademicYear(time.Now())
+		if today := calendar.Date(time.Now()); today.Before(opts.To) {
+			opts.To = today
+		}
+	}
+	opts.From, opts.To = calendar.Date(opts.From), calendar.Date(opts.To)
+	if opts.To.Before(opts.From) {
+		return nil, fmt.Errorf("%w: the period ends before it starts", ErrInvalidOptions)
+	}
+	if opts.Password == "" {
+		opts.Password = DefaultPassword
+	}
+
+	var taken int64
+	if err := db.Unscoped().Model(&models.User{}).
+		Where("username IN ?", []string{opts.Prefix + "admin", opts.Prefix + "teacher1", opts.Prefix + "student1", opts.Prefix + "parent1"}).
+		Count(&taken).Error; err != nil {
+		return nil, err
+	}
+	if taken > 0 {
+		return nil, ErrUsernameTaken
+	}
+
+	g := &generator{
+		rng:  rand.New(rand.NewSource(opts.Seed)),
+		opts: opts,
+		report: &Report{
+			Seed:   opts.Seed,
+			From:   opts.From.Format(calendar.DateLayout),
+			To:     opts.To.Format(calendar.DateLayout),
+			Users:  make(map[string]int),
+			Logins: make(map[string]string),
+		},
+		rooms:      make(map[uint]int),
+		names:      make(map[uint]string),
+		lessonDays: make(map[string]bool),
+		teachers:   make(map[uint][]uint),
+	}
+	err := db.WithContext(audit.WithoutLog(ctx)).Transaction(func(tx *gorm.DB) error {
+		g.tx = tx
+		for _, step := range []func() error{
+			g.createSchool, g.createSubjects, g.createClasses, g.createSchedule,
+			g.createCalendar, g.createLessons, g.createAnnouncements,
+		} {
+			if err := step(); err != nil {
+				return err
+			}
+		}
+		return audit.Record(tx, g.school.ID, audit.ActionSeed, "schools", g.school.ID, map[string]audit.Change{
+			"seed":    {New: opts.Seed},
+			"classes": {New: opts.Classes},
+			"from":    {New: g.report.From},
+			"to":      {New: g.report.To},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return g.report, nil
+}
+
+// createSchool создаёт школу с администратором или находит существующую
+func (g *generator) createSchool() error {
+	if g.opts.SchoolID != 0 {
+		if err := g.tx.First(&g.school, g.opts.SchoolID).Error; err != nil {
+			return err
+		}
+		g.report.SchoolID = g.school.ID
+		if g.school.AdminID != nil {
+			g.admin = *g.school.AdminID
+			return nil
+		}
+	} else {
+		g.school.Name = g.opts.SchoolName
+		if g.school.Name == "" {
+			g.school.Name = fmt.Sprintf("Школа №%d", 1+g.rng.Intn(200))
+		}
+		g.school.Address = fmt.Sprintf("г. Примерный, ул. Школьная, д. %d", 1+g.rng.Intn(50))
+		if err := g.tx.Create(&g.school).Error; err != nil {
+			return err
+		}
+		g.report.SchoolID = g.school.ID
+	}
+
+	admin, err := g.createUser("admin", "admin", false)
+	if err != nil {
+		return err
+	}
+	g.admin = admin.ID
+	return g.tx.Model(&g.school).Update("admin_id", admin.ID).Error
+}
+
+// createUser создаёт пользователя со случайным ФИО. username пусто - роль и номер.
+func (g *generator) createUser(role, username string, female bool) (*models.User, error) {
+	last := lastNames[g.rng.Intn(len(lastNames))]
+	return g.createUserNamed(role, username, female, last)
+}
+
+func (g *generator) createUserNamed(role, username string, female bool, lastName string) (*models.User, error) {
+	g.report.Users[role]++
+	if username == "" {
+		kind := role
+		if role == "starosta" {
+			kind = "student"
+		}
+		username = fmt.Sprintf("%s%d", kind, g.countOf(kind))
+	}
+	first := maleNames[g.rng.Intn(len(maleNames))]
+	middle := middleNames[g.rng.Intn(len(middleNames))][0]
+	if female {
+		first = femaleNames[g.rng.Intn(len(femaleNames))]
+		middle = middleNames[g.rng.Intn(len(middleNames))][1]
+		lastName = lastName + "а"
+	}
+	user := &models.User{
+		SchoolID:     g.school.ID,
+		Username:     g.opts.Prefix + username,
+		Email:        g.opts.Prefix + username + "@example.org",
+		PasswordHash: g.opts.Password,
+		Role:         role,
+		FirstName:    first,
+		LastName:     lastName,
+		MiddleName:   middle,
+	}
+	if err := g.tx.Create(user).Error; err != nil {
+		return nil, err
+	}
+	if _, ok := g.report.Logins[role]; !ok {
+		g.report.Logins[role] = user.Username
+	}
+	return user, nil
+}
+
+// countOf - номер следующего логина роли (ученики и старосты нумеруются вместе)
+func (g *generator) countOf(kind string) int {
+	if kind == "student" {
+		return g.report.Users["student"] + g.report.Users["starosta"]
+	}
+	return g.report.Users[kind]
+}
+
+// createSubjects создаёт предметы учебного плана (или берёт существующие с тем же
+// названием) и учителей: по нагрузке около 24 уроков в неделю на учителя
+func (g *generator) createSubjects() error {
+	for _, s := range curriculum {
+		var subject models.Subject
+		err := g.tx.Where("school_id = ? AND name = ?", g.school.ID, s.name).First(&subject).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			subject = models.Subject{SchoolID: g.school.ID, Name: s.name}
+			err = g.tx.Create(&subject).Error
+			g.report.Subjects++
+		}
+		if err != nil {
+			return err
+		}
+		g.subjects = append(g.subjects, subject)
+		g.rooms[subject.ID] = s.room
+		g.names[subject.ID] = s.name
+
+		count := int(math.Ceil(float64(s.hours*g.opts.Classes) / 24))
+		var teachers []models.User
+		for i := 0; i < count; i++ {
+			teacher, err := g.createUser("teacher", "", g.rng.Float64() < 0.75)
+			if err != nil {
+				return err
+			}
+			if err := g.tx.Model(teacher).Update("teacher_subject", s.name).Error; err != nil {
+				return err
+			}
+			teachers = append(teachers, *teacher)
+			g.teachers[subject.ID] = append(g.teachers[subject.ID], teacher.ID)
+		}
+		if err := g.tx.Model(&subject).Association("Teachers").Append(&teachers); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createClasses создаёт классы с 5 по 11 параллель, учеников, родителей и старост.
+// Часть учеников - братья и сёстры из других классов с общими родителями.
+func (g *generator) createClasses() error {
+	academicStart, _ := calendar.AcademicYear(g.opts.From)
+	year := fmt.Sprintf("%d-%d", academicStart.Year(), academicStart.Year()+1)
+
+	// Новые классы продолжают буквы уже созданных в этом учебном году
+	var existing int64
+	if err := g.tx.Model(&models.Class{}).Where("school_id = ? AND year = ?", g.school.ID, year).
+		Count(&existing).Error; err != nil {
+		return err
+	}
+	offset := int(existing+6) / 7 * 7
+	if offset+g.opts.Classes > len(classLetters)*7 {
+		return fmt.Errorf("%w: the school already has %d classes in %s", ErrInvalidOptions, existing, year)
+	}
+
+	// Классные руководители - учителя по очереди
+	var homeroom []uint
+	for _, s := range g.subjects {
+		homeroom = append(homeroom, g.teachers[s.ID]...)
+	}
+
+	type family struct {
+		lastName string
+		parents  []uint
+	}
+	var families []family
+
+	for i := 0; i < g.opts.Classes; i++ {
+		level := 5 + i%7
+		c := &class{level: level, teachers: make(map[uint]uint)}
+		teacherID := homeroom[i%len(homeroom)]
+		c.model = models.Class{
+			SchoolID:          g.school.ID,
+			Name:              fmt.Sprintf("%d%s", level, classLetters[(offset+i)/7]),
+			Year:              year,
+			HomeroomTeacherID: &teacherID,
+		}
+		if err := g.tx.Create(&c.model).Error; err != nil {
+			return err
+		}
+		g.report.Classes++
+
+		var members []models.User
+		for j := 0; j < g.opts.StudentsPerClass; j++ {
+			role := "student"
+			if j == 0 {
+				role = "starosta"
+			}
+			female := g.rng.Intn(2) == 0
+
+			// Каждый десятый ученик - брат или сестра ученика другого класса
+			var fam *family
+			if len(families) > 0 && g.rng.Float64() < 0.1 {
+				fam = &families[g.rng.Intn(len(families))]
+			}
+			lastName := lastNames[g.rng.Intn(len(lastNames))]
+			if fam != nil {
+				lastName = fam.lastName
+			}
+			user, err := g.createUserNamed(role, "", female, lastName)
+			if err != nil {
+				return err
+			}
+			members = append(members, *user)
+			c.students = append(c.students, g.newStudent(user.ID))
+
+			if fam == nil {
+				families = append(families, family{lastName: lastName})
+				fam = &families[len(families)-1]
+				// Мама почти всегда, папа - у каждого третьего
+				if g.rng.Float64() < 0.9 {
+					parent, err := g.createUserNamed("parent", "", true, lastName)
+					if err != nil {
+						return err
+					}
+					fam.parents = append(fam.parents, parent.ID)
+				}
+				if len(fam.parents) == 0 || g.rng.Float64() < 0.35 {
+					parent, err := g.createUserNamed("parent", "", false, lastName)
+					if err != nil {
+						return err
+					}
+					fam.parents = append(fam.parents, parent.ID)
+				}
+			}
+			for _, parentID := range fam.parents {
+				if err := g.tx.Create(&models.ParentStudent{ParentID: parentID, StudentID: user.ID}).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := g.tx.Model(&c.model).Association("Students").Append(&members); err != nil {
+			return err
+		}
+		starosta := members[0].ID
+		if err := g.tx.Model(&c.model).Update("starosta_id", starosta).Error; err != nil {
+			return err
+		}
+
+		// Учитель по каждому предмету - по очереди среди учителей предмета
+		for _, s := range g.subjects {
+			teachers := g.teachers[s.ID]
+			c.teachers[s.ID] = teachers[i%len(teachers)]
+		}
+		g.classes = append(g.classes, c)
+	}
+	return nil
+}
+
+// newStudent задаёт успеваемость и склонность к пропускам: большинство учится на 4,
+// у каждого двадцатого - частые пропуски
+func (g *generator) newStudent(id uint) *student {
+	s := &student{id: id}
+	s.ability = math.Max(2.6, math.Min(4.9, 3.9+g.rng.NormFloat64()*0.55))
+	s.absence = 0.02 + g.rng.Float64()*0.04
+	if g.rng.Float64() < 0.05 {
+		s.absence = 0.15 + g.rng.Float64()*0.15
+	}
+	return s
+}
+
+// createSchedule раскладывает уроки учебного плана по дням недели так, чтобы учитель
+// не вёл два урока одновременно и один предмет был не чаще двух раз в день
+func (g *generator) createSchedule() error {
+	busy := make(map[string]bool) // учитель/день/урок
+	days := []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+
+	for _, c := range g.classes {
+		var lessons []uint
+		for i, s := range curriculum {
+			for h := 0; h < s.hours; h++ {
+				lessons = append(lessons, g.subjects[i].ID)
+			}
+		}
+		g.rng.Shuffle(len(lessons), func(i, j int) { lessons[i], lessons[j] = lessons[j], lessons[i] })
+
+		for d, weekday := range days {
+			perDay := make(map[uint]int)
+			for number := 1; number <= lessonsPerDay[d] && len(lessons) > 0; number++ {
+				pick := -1
+				for i, subjectID := range lessons {
+					key := fmt.Sprintf("%d/%d/%d", c.teachers[subjectID], weekday, number)
+					if !busy[key] && perDay[subjectID] < 2 {
+						pick = i
+						break
+					}
+				}
+				if pick < 0 {
+					pick = 0
+				}
+				subjectID := lessons[pick]
+				lessons = append(lessons[:pick], lessons[pick+1:]...)
+				perDay[subjectID]++
+
+				teacherID := c.teachers[subjectID]
+				g.lessonDays[fmt.Sprintf("%d/%d/%s", c.model.ID, subjectID, calendar.DayName(dateOf(weekday)))] = true
+				busy[fmt.Sprintf("%d/%d/%d", teacherID, weekday, number)] = true
+				g.schedules = append(g.schedules, models.Schedule{
+					ClassID:      c.model.ID,
+					SubjectID:    subjectID,
+					TeacherID:    &teacherID,
+					DayOfWeek:    calendar.DayName(dateOf(weekday)),
+					LessonNumber: number,
+					StartTime:    lessonTimes[number-1][0],
+					EndTime:      lessonTimes[number-1][1],
+					RoomNumber:   fmt.Sprintf("%d", g.rooms[subjectID]+int(c.teachers[subjectID]%5)),
+				})
+			}
+		}
+	}
+	if err := g.tx.CreateInBatches(&g.schedules, 200).Error; err != nil {
+		return err
+	}
+	g.report.Schedules = len(g.schedules)
+	return nil
+}
+
+// dateOf - любая дата с этим днём недели
+func dateOf(weekday time.Weekday) time.Time {
+	d := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC) // понедельник
+	return d.AddDate(0, 0, (int(weekday)+6)%7)
+}
+
+// createCalendar добавляет каникулы и праздники учебных лет периода, если в календаре
+// школы на эти годы ещё ничего нет
+func (g *generator) createCalendar() error {
+	first, _ := calendar.AcademicYear(g.opts.From)
+	last, _ := calendar.AcademicYear(g.opts.To)
+	for y := first.Year(); y <= last.Year(); y++ {
+		from := time.Date(y, time.September, 1, 0, 0, 0, 0, time.UTC)
+		to := time.Date(y+1, time.May, 31, 0, 0, 0, 0, time.UTC)
+
+		var existing []models.CalendarEvent
+		if err := g.tx.Where("school_id = ? AND start_date <= ? AND end_date >= ?", g.school.ID, to, from).
+			Find(&existing).Error; err != nil {
+			return err
+		}
+		if len(existing) > 0 {
+			g.events = append(g.events, existing...)
+			continue
+		}
+
+		date := func(year int, month time.Month, day int) time.Time {
+			return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+		}
+		events := []models.CalendarEvent{
+			{Type: calendar.TypeVacation, Title: "Осенние каникулы", StartDate: date(y, time.October, 27), EndDate: date(y, time.November, 4)},
+			{Type: calendar.TypeVacation, Title: "Зимние каникулы", StartDate: date(y, time.December, 29), EndDate: date(y+1, time.January, 8)},
+			{Type: calendar.TypeHoliday, Title: "День защитника Отечества", StartDate: date(y+1, time.February, 23), EndDate: date(y+1, time.February, 23)},
+			{Type: calendar.TypeHoliday, Title: "Международный женский день", StartDate: date(y+1, time.March, 8), EndDate: date(y+1, time.March, 8)},
+			{Type: calendar.TypeVacation, Title: "Весенние каникулы", StartDate: date(y+1, time.March, 23), EndDate: date(y+1, time.March, 31)},
+			{Type: calendar.TypeHoliday, Title: "Праздник Весны и Труда", StartDate: date(y+1, time.May, 1), EndDate: date(y+1, time.May, 1)},
+			{Type: calendar.TypeHoliday, Title: "День Победы", StartDate: date(y+1, time.May, 9), EndDate: date(y+1, time.May, 9)},
+		}
+		for i := range events {
+			events[i].SchoolID = g.school.ID
+		}
+		if err := g.tx.Create(&events).Error; err != nil {
+			return err
+		}
+		g.events = append(g.events, events...)
+		g.report.CalendarEvents += len(events)
+	}
+	return nil
+}
+
+// createLessons проводит уроки каждого учебного дня периода: отметки всех учеников
+// класса и журнал урока, оценки (каждый восьмой урок предмета - контрольная для всех)
+// и домашние задания к следующему уроку предмета
+func (g *generator) createLessons() error {
+	seq, err := models.NextSyncSeq(g.tx, g.school.ID)
+	if err != nil {
+		return err
+	}
+	g.syncSeq = seq
+
+	cal := calendar.New(g.events, nil)
+	byDay := make(map[string]map[uint][]models.Schedule) // день недели -> класс -> уроки
+	for _, s := range g.schedules {
+		if byDay[s.DayOfWeek] == nil {
+			byDay[s.DayOfWeek] = make(map[uint][]models.Schedule)
+		}
+		byDay[s.DayOfWeek][s.ClassID] = append(byDay[s.DayOfWeek][s.ClassID], s)
+	}
+	lessonCount := make(map[string]int) // класс/предмет -> проведено уроков
+
+	for d := g.opts.From; !d.After(g.opts.To); d = d.AddDate(0, 0, 1) {
+		day, ok := cal.ScheduleDay(d)
+		if !ok {
+			continue
+		}
+		var attendances []models.Attendance
+		var grades []models.Grade
+		var homework []models.Homework
+		var registers []models.LessonRegister
+
+		for _, c := range g.classes {
+			// Заболевшие пропускают все уроки дня по уважительной причине
+			for _, s := range c.students {
+				if d.After(s.sickUntil) && g.rng.Float64() < s.absence/6 {
+					s.sickUntil = d.AddDate(0, 0, 2+g.rng.Intn(6))
+				}
+			}
+
+			for _, lesson := range byDay[day][c.model.ID] {
+				key := fmt.Sprintf("%d/%d", c.model.ID, lesson.SubjectID)
+				lessonCount[key]++
+				test := lessonCount[key]%8 == 0
+				teacherID := *lesson.TeacherID
+				register := models.LessonRegister{ScheduleID: lesson.ID, Date: d, TakenBy: teacherID}
+
+				for _, s := range c.students {
+					status, minutes := g.attendanceStatus(s, d)
+					scheduleID, subjectID, number := lesson.ID, lesson.SubjectID, lesson.LessonNumber
+					attendances = append(attendances, models.Attendance{
+						StudentID:    s.id,
+						ClassID:      c.model.ID,
+						ScheduleID:   &scheduleID,
+						SubjectID:    &subjectID,
+						Date:         d,
+						LessonNumber: &number,
+						Status:       status,
+						MinutesLate:  minutes,
+						MarkedBy:     &teacherID,
+						SyncSeq:      g.syncSeq,
+					})
+					switch status {
+					case "present":
+						register.Present++
+					case "late":
+						register.Late++
+					case "absent":
+						register.Absent++
+					case "excused":
+						register.Excused++
+					}
+
+					if status != "present" && status != "late" {
+						continue
+					}
+					gradeType := ""
+					switch {
+					case test:
+						gradeType = "test"
+					case g.rng.Float64() < 0.12:
+						gradeType = "oral"
+					case g.rng.Float64() < 0.08:
+						gradeType = "homework"
+					}
+					if gradeType != "" {
+						grades = append(grades, models.Grade{
+							StudentID: s.id,
+							SubjectID: lesson.SubjectID,
+							TeacherID: teacherID,
+							Grade:     g.gradeFor(s, test),
+							GradeType: gradeType,
+							Date:      d,
+							SyncSeq:   g.syncSeq,
+						})
+					}
+				}
+				registers = append(registers, register)
+
+				if g.rng.Float64() < 0.7 {
+					homework = append(homework, g.newHomework(cal, c, lesson, d))
+				}
+			}
+		}
+
+		// Хуки моделей пропускаются: номер синхронизации один на всё заполнение
+		tx := g.tx.Session(&gorm.Session{SkipHooks: true})
+		for _, batch := range []interface{}{&attendances, &grades, &homework, &registers} {
+			if err := tx.CreateInBatches(batch, 500).Error; err != nil {
+				return err
+			}
+		}
+		g.report.Attendance += len(attendances)
+		g.report.Grades += len(grades)
+		g.report.Homework += len(homework)
+	}
+	return nil
+}
+
+// attendanceStatus - отметка ученика на уроке
+func (g *generator) attendanceStatus(s *student, d time.Time) (string, int) {
+	if !d.After(s.sickUntil) {
+		return "excused", 0
+	}
+	r := g.rng.Float64()
+	switch {
+	case r < s.absence/3:
+		return "absent", 0
+	case r < s.absence/3+0.03:
+		return "late", 3 + g.rng.Intn(15)
+	}
+	return "present", 0
+}
+
+// gradeFor - оценка около средней ученика; за контрольные разброс больше
+func (g *generator) gradeFor(s *student, test bool) int {
+	spread := 0.7
+	if test {
+		spread = 0.9
+	}
+	grade := int(math.Round(s.ability + g.rng.NormFloat64()*spread))
+	return int(math.Max(2, math.Min(5, float64(grade))))
+}
+
+// newHomework - задание к следующему уроку предмета в этом классе
+func (g *generator) newHomework(cal *calendar.Calendar, c *class, lesson models.Schedule, d time.Time) models.Homework {
+	due := d.AddDate(0, 0, 7)
+	for next := d.AddDate(0, 0, 1); next.Before(d.AddDate(0, 0, 15)); next = next.AddDate(0, 0, 1) {
+		day, ok := cal.ScheduleDay(next)
+		if !ok {
+			continue
+		}
+		if g.lessonDays[fmt.Sprintf("%d/%d/%s", c.model.ID, lesson.SubjectID, day)] {
+			due = next
+			break
+		}
+	}
+
+	tasks := homeworkTasks[g.names[lesson.SubjectID]]
+	task := tasks[g.rng.Intn(len(tasks))]
+	args := []interface{}{}
+	for i := 0; i < countVerbs(task); i++ {
+		args = append(args, 1+g.rng.Intn(300))
+	}
+	sort.Slice(args, func(i, j int) bool { return args[i].(int) < args[j].(int) })
+
+	return models.Homework{
+		ClassID:          c.model.ID,
+		SubjectID:        lesson.SubjectID,
+		TeacherID:        *lesson.TeacherID,
+		Description:      fmt.Sprintf(task, args...),
+		AssignedDate:     d,
+		DueDate:          due,
+		EstimatedMinutes: 10 + 5*g.rng.Intn(7) + 2*c.level,
+	}
+}
+
+// countVerbs - число подстановок %d в шаблоне задания
+func countVerbs(format string) int {
+	n := 0
+	for i := 0; i+1 < len(format); i++ {
+		if format[i] == '%' && format[i+1] == 'd' {
+			n++
+		}
+	}
+	return n
+}
+
+// createAnnouncements публикует объявления администрации в разные дни периода
+func (g *generator) createAnnouncements() error {
+	days := int(g.opts.To.Sub(g.opts.From).Hours()/24) + 1
+	for _, a := range announcements {
+		created := g.opts.From.AddDate(0, 0, g.rng.Intn(days)).Add(time.Duration(8+g.rng.Intn(9)) * time.Hour)
+		announcement := models.Announcement{
+			SchoolID:   g.school.ID,
+			AuthorID:   g.admin,
+			Title:      a.title,
+			Content:    a.content,
+			TargetRole: a.role,
+			CreatedAt:  created,
+		}
+		if err := g.tx.Create(&announcement).Error; err != nil {
+			return err
+		}
+		g.report.Announcements++
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+// Тест S3-хранилища выполняется на MinIO или другом S3-совместимом сервере, если задан
+// STORAGE_TEST_S3_ENDPOINT, например:
+//
+//	docker run -d -p 9000:9000 minio/minio server /data
+//	STORAGE_TEST_S3_ENDPOINT=localhost:9000 go test ./internal/storage
+//
+// Бакет создаётся, если его нет. Ключи по умолчанию - minioadmin/minioadmin.
+func testS3Options(t *testing.T) S3Options {
+	t.Helper()
+	endpoint := os.Getenv("STORAGE_TEST_S3_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("STORAGE_TEST_S3_ENDPOINT is not set")
+	}
+	env := func(key, defaultValue string) string {
+		if value := os.Getenv(key); value != "" {
+			return value
+		}
+		return defaultValue
+	}
+	return S3Options{
+		Endpoint:  endpoint,
+		Region:    env("STORAGE_TEST_S3_REGION", "us-east-1"),
+		Bucket:    env("STORAGE_TEST_S3_BUCKET", "classkeeper-test"),
+		AccessKey: env("STORAGE_TEST_S3_ACCESS_KEY", "minioadmin"),
+		SecretKey: env("STORAGE_TEST_S3_SECRET_KEY", "minioadmin"),
+		UseSSL:    os.Getenv("STORAGE_TEST_S3_USE_SSL") == "true",
+	}
+}
+
+// ensureBucket создаёт бакет запросом к его корню тем же подписанным клиентом
+func ensureBucket(t *testing.T, b *S3Backend) {
+	t.Helper()
+	req, err := b.newRequest(context.Background(), http.MethodPut, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.sign(req, nil)
+	resp, err := b.client.Do(req)
+	if err != nil {
+		t.Fatalf("create bucket: %v", err)
+	}
+	defer resp.Body.Close()
+	// 409 - бакет уже есть
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusConflict {
+		t.Fatalf("create bucket: %v", s3Error(resp))
+	}
+}
+
+func TestS3Backend(t *testing.T) {
+	b, err := NewS3(testS3Options(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ensureBucket(t, b)
+
+	key, err := NewKey(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testBackend(t, b, key)
+
+	// Ключи с пробелами и кириллицей должны подписываться так же, как их кодирует сервер
+	testBackend(t, b, "school-1/тест/файл с пробелом+plus.txt")
+}
+
+func TestS3BackendWrongKey(t *testing.T) {
+	opts := testS3Options(t)
+	opts.SecretKey += "-wrong"
+	b, err := NewS3(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := b.Put(ctx, "school-1/denied", bytes.NewReader([]byte("x")), 1, ""); err == nil {
+		t.Fatal("Put with a wrong secret key succeeded")
+	}
+}
+
+func TestNewS3Options(t *testing.T) {
+	cases := map[string]S3Options{
+		"no endpoint":   {Bucket: "b", AccessKey: "a", SecretKey: "s"},
+		"no bucket":     {Endpoint: "localhost:9000", AccessKey: "a", SecretKey: "s"},
+		"no access key": {Endpoint: "localhost:9000", Bucket: "b", SecretKey: "s"},
+		"no secret key": {Endpoint: "localhost:9000", Bucket: "b", AccessKey: "a"},
+	}
+	for name, opts := range cases {
+		if _, err := NewS3(opts); err == nil {
+			t.Errorf("%s: NewS3 succeeded", name)
+		}
+	}
+
+	b, err := NewS3(S3Options{Endpoint: "localhost:9000", Bucket: "b", AccessKey: "a", SecretKey: "s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.opts.Region != "us-east-1" {
+		t.Errorf("default region = %q, want us-east-1", b.opts.Region)
+	}
+}
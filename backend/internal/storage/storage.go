@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"classkeeper/internal/config"
+)
+
+// ErrNotFound возвращается, если объекта нет в хранилище
+var ErrNotFound = errors.New("object not found")
+
+// Backend - хранилище файлов вложений
+type Backend interface {
+	// Name возвращает имя бэкенда (local, s3)
+	Name() string
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// New создаёт бэкенд хранилища согласно конфигурации
+func New(cfg *config.StorageConfig) (Backend, error) {
+	switch cfg.Backend {
+	case "local", "":
+		return NewLocal(cfg.LocalPath)
+	case "s3":
+		return NewS3(S3Options{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			UseSSL:    cfg.S3UseSSL,
+		})
+	default:
+		return nil, fmt.Errorf("unsupported storage backend: %s", cfg.Backend)
+	}
+}
+
+// NewKey генерирует ключ объекта вида school-1/2025/11/<random>
+func NewKey(schoolID uint) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("school-%d/%s/%s", schoolID, time.Now().Format("2006/01"), hex.EncodeToString(b)), nil
+}
+
+// LocalBackend хранит файлы в каталоге на диске
+type LocalBackend struct {
+	root string
+}
+
+// NewLocal создаёт локальное хранилище в каталоге root
+func NewLocal(root string) (*LocalBackend, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+	return &LocalBackend{root: root}, nil
+}
+
+func (b *LocalBackend) Name() string {
+	return "local"
+}
+
+func (b *LocalBackend) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	path, err := b.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	// Пишем во временный файл и переименовываем, чтобы не оставить обрезанный файл
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (b *LocalBackend) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := b.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (b *LocalBackend) Delete(ctx context.Context, key string) error {
+	path, err := b.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// path защищает от выхода за пределы каталога хранилища
+func (b *LocalBackend) path(key string) (string, error) {
+	clean := filepath.Clean("/" + key)
+	if strings.Contains(key, "..") || clean == "/" {
+		return "", fmt.Errorf("invalid storage key: %s", key)
+	}
+	return filepath.Join(b.root, clean), nil
+}
+
+// SignLink подписывает ссылку на скачивание вложения до момента expires
+func SignLink(secret string, attachmentID uint, expires time.Time) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "attachment:%d:%d", attachmentID, expires.Unix())
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ImageURL возвращает публичную ссылку на аватар или логотип, которую можно вставить
+// в <img>. Контрольная сумма файла в ссылке не даёт перебирать изображения по ID.
+func ImageURL(attachmentID uint, checksum string) string {
+	return fmt.Sprintf("/api/images/%d/%s", attachmentID, checksum)
+}
+
+// VerifyLink проверяет подпись и срок действия ссылки на скачивание
+func VerifyLink(secret string, attachmentID uint, expires, signature string) bool {
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return false
+	}
+	expected := SignLink(secret, attachmentID, time.Unix(unix, 0))
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
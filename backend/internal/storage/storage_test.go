@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testBackend проверяет запись, чтение и удаление объекта в хранилище
+func testBackend(t *testing.T, b Backend, key string) {
+	t.Helper()
+	ctx := context.Background()
+	data := []byte("домашнее задание")
+
+	if err := b.Put(ctx, key, bytes.NewReader(data), int64(len(data)), "text/plain"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	r, err := b.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	got, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("Get returned %q, want %q", got, data)
+	}
+
+	if err := b.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := b.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after Delete: got %v, want ErrNotFound", err)
+	}
+	if err := b.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete of a missing object: %v", err)
+	}
+}
+
+func TestLocalBackend(t *testing.T) {
+	b, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := NewKey(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(key, "school-1/") {
+		t.Fatalf("NewKey(1) = %q, want school-1/ prefix", key)
+	}
+	testBackend(t, b, key)
+}
+
+func TestLocalBackendPutReplaces(t *testing.T) {
+	root := t.TempDir()
+	b, err := NewLocal(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, content := range []string{"first version", "second"} {
+		if err := b.Put(ctx, "school-1/a", strings.NewReader(content), int64(len(content)), ""); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+	got, err := os.ReadFile(filepath.Join(root, "school-1", "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "second" {
+		t.Fatalf("file contains %q, want %q", got, "second")
+	}
+
+	// Временные файлы записи не остаются в каталоге
+	entries, err := os.ReadDir(filepath.Join(root, "school-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("directory has %d entries, want 1", len(entries))
+	}
+}
+
+func TestLocalBackendPath(t *testing.T) {
+	root := t.TempDir()
+	b := &LocalBackend{root: root}
+
+	valid := map[string]string{
+		"school-1/2025/11/abc": filepath.Join(root, "school-1", "2025", "11", "abc"),
+		"/school-1/abc":        filepath.Join(root, "school-1", "abc"),
+		"school-1//abc":        filepath.Join(root, "school-1", "abc"),
+	}
+	for key, want := range valid {
+		got, err := b.path(key)
+		if err != nil {
+			t.Errorf("path(%q): %v", key, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("path(%q) = %q, want %q", key, got, want)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"/",
+		"..",
+		"../secret",
+		"school-1/../../etc/passwd",
+		"school-1/..",
+		"/../outside",
+	}
+	for _, key := range invalid {
+		if got, err := b.path(key); err == nil {
+			t.Errorf("path(%q) = %q, want an error", key, got)
+		}
+	}
+
+	// Ключ с выходом за каталог не пишется, не читается и не удаляется
+	outside := filepath.Join(filepath.Dir(root), "outside.txt")
+	ctx := context.Background()
+	if err := b.Put(ctx, "../outside.txt", strings.NewReader("x"), 1, ""); err == nil {
+		t.Error("Put outside the root succeeded")
+	}
+	if _, err := os.Stat(outside); !os.IsNotExist(err) {
+		t.Errorf("file outside the root was created: %v", err)
+	}
+	if _, err := b.Get(ctx, "../outside.txt"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Get outside the root: got %v, want an invalid key error", err)
+	}
+	if err := b.Delete(ctx, "../outside.txt"); err == nil {
+		t.Error("Delete outside the root succeeded")
+	}
+}
+
+func TestSignLink(t *testing.T) {
+	const secret = "link-secret"
+	expires := time.Now().Add(time.Hour)
+	unix := strconv.FormatInt(expires.Unix(), 10)
+	signature := SignLink(secret, 42, expires)
+
+	if !VerifyLink(secret, 42, unix, signature) {
+		t.Fatal("valid link rejected")
+	}
+	if SignLink(secret, 42, expires) != signature {
+		t.Fatal("SignLink is not deterministic")
+	}
+
+	later := strconv.FormatInt(expires.Add(time.Hour).Unix(), 10)
+	cases := map[string]struct {
+		secret       string
+		attachmentID uint
+		expires      string
+		signature    string
+	}{
+		"other secret":     {"other-secret", 42, unix, signature},
+		"other attachment": {secret, 43, unix, signature},
+		"extended expiry":  {secret, 42, later, signature},
+		"tampered":         {secret, 42, unix, strings.Repeat("0", len(signature))},
+		"empty signature":  {secret, 42, unix, ""},
+		"invalid expiry":   {secret, 42, "tomorrow", signature},
+	}
+	for name, tc := range cases {
+		if VerifyLink(tc.secret, tc.attachmentID, tc.expires, tc.signature) {
+			t.Errorf("%s: link accepted", name)
+		}
+	}
+}
+
+func TestVerifyLinkExpired(t *testing.T) {
+	const secret = "link-secret"
+	expires := time.Now().Add(-time.Minute)
+	signature := SignLink(secret, 7, expires)
+	if VerifyLink(secret, 7, strconv.FormatInt(expires.Unix(), 10), signature) {
+		t.Fatal("expired link accepted")
+	}
+}
@@ -0,0 +1,654 @@
+// Package trash - корзина школы. Записи в приложении удаляются мягко (заполняется
+// deleted_at), и корзина показывает такие записи, восстанавливает их, если живы все
+// записи, на которые они ссылаются, и удаляет навсегда, если на них больше ничего
+// не ссылается. Записи, пролежавшие в корзине дольше срока хранения, удаляются
+// автоматически.
+package trash
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"classkeeper/internal/audit"
+	"classkeeper/internal/backup"
+	"classkeeper/internal/calendar"
+	"classkeeper/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+var (
+	// ErrUnknownEntity - такого вида записей нет в корзине
+	ErrUnknownEntity = errors.New("unknown entity")
+	// ErrNotFound - записи нет в корзине школы
+	ErrNotFound = errors.New("item not found in trash")
+)
+
+// Причины, по которым запись нельзя восстановить или удалить навсегда
+const (
+	ReasonDeleted    = "deleted"    // Запись, на которую ссылается восстанавливаемая, тоже в корзине
+	ReasonMissing    = "missing"    // Запись, на которую ссылается восстанавливаемая, удалена навсегда
+	ReasonConflict   = "conflict"   // Такая же запись уже создана заново
+	ReasonReferenced = "referenced" // На удаляемую запись ссылаются другие
+)
+
+// Blocker - причина, по которой запись нельзя восстановить или удалить навсегда
+type Blocker struct {
+	Reason string `json:"reason"`
+	Entity string `json:"entity"`           // Таблица связанной записи
+	Column string `json:"column,omitempty"` // Колонка со ссылкой
+	ID     uint   `json:"id,omitempty"`     // Связанная запись (при восстановлении)
+	Count  int64  `json:"count,omitempty"`  // Число ссылающихся строк (при удалении)
+}
+
+// BlockedError - восстановление или удаление невозможно, пока не устранены причины
+type BlockedError struct {
+	Blockers []Blocker
+}
+
+func (e *BlockedError) Error() string {
+	parts := make([]string, len(e.Blockers))
+	for i, b := range e.Blockers {
+		parts[i] = fmt.Sprintf("%s %s.%s", b.Reason, b.Entity, b.Column)
+	}
+	return "blocked by " + strings.Join(parts, ", ")
+}
+
+// Item - запись в корзине
+type Item struct {
+	Entity        string    `json:"entity"`
+	ID            uint      `json:"id"`
+	Title         string    `json:"title"`
+	DeletedAt     time.Time `json:"deleted_at"`
+	DeletedBy     *uint     `json:"deleted_by,omitempty"`
+	DeletedByName string    `json:"deleted_by_name,omitempty"`
+}
+
+// entity - вид записей корзины
+type entity struct {
+	table   string
+	model   interface{}
+	preload []string
+	// title - название записи для списка корзины
+	title func(row interface{}) string
+	// conflict проверяет, не создана ли заново такая же запись
+	conflict func(tx *gorm.DB, row interface{}) (bool, error)
+	// owner - тип владельца вложений (OwnerType); при удалении навсегда вложения открепляются
+	owner string
+}
+
+// entities - виды записей корзины. Записи ссылаются только на предыдущие виды,
+// поэтому при автоматической очистке виды обходятся с конца.
+var entities = []*entity{
+	{table: "users", model: &models.User{}, owner: "avatar", title: func(row interface{}) string {
+		u := row.(*models.User)
+		return userTitle(u) + ", " + u.Role
+	}},
+	{table: "subjects", model: &models.Subject{}, title: func(row interface{}) string {
+		return row.(*models.Subject).Name
+	}},
+	{table: "classes", model: &models.Class{}, title: func(row interface{}) string {
+		c := row.(*models.Class)
+		return c.Name + " (" + c.Year + ")"
+	}},
+	{table: "homework_templates", model: &models.HomeworkTemplate{}, title: func(row interface{}) string {
+		return row.(*models.HomeworkTemplate).Title
+	}},
+	{table: "schedules", model: &models.Schedule{}, preload: []string{"Class", "Subject"}, title: func(row interface{}) string {
+		s := row.(*models.Schedule)
+		return fmt.Sprintf("%s, %s, %s, урок %d", s.Class.Name, s.Subject.Name, s.DayOfWeek, s.LessonNumber)
+	}},
+	{table: "calendar_events", model: &models.CalendarEvent{}, title: func(row interface{}) string {
+		e := row.(*models.CalendarEvent)
+		return fmt.Sprintf("%s (%s - %s)", e.Title, e.StartDate.Format(calendar.DateLayout), e.EndDate.Format(calendar.DateLayout))
+	}},
+	{table: "homework_recurrences", model: &models.HomeworkRecurrence{}, preload: []string{"Template", "Class"}, title: func(row interface{}) string {
+		r := row.(*models.HomeworkRecurrence)
+		return r.Template.Title + ", " + r.Class.Name
+	}},
+	{table: "homeworks", model: &models.Homework{}, preload: []string{"Class", "Subject"}, owner: "homework", title: func(row interface{}) string {
+		h := row.(*models.Homework)
+		return fmt.Sprintf("%s, %s, до %s: %s", h.Class.Name, h.Subject.Name, h.DueDate.Format(calendar.DateLayout), shorten(h.Description, 60))
+	}},
+	{table: "grades", model: &models.Grade{}, preload: []string{"Student", "Subject"}, title: func(row interface{}) string {
+		g := row.(*models.Grade)
+		return fmt.Sprintf("%s, %s: %d (%s)", userTitle(&g.Student), g.Subject.Name, g.Grade, g.Date.Format(calendar.DateLayout))
+	}},
+	{table: "attendances", model: &models.Attendance{}, preload: []string{"Student"}, conflict: attendanceConflict, title: func(row interface{}) string {
+		a := row.(*models.Attendance)
+		return fmt.Sprintf("%s, %s: %s", userTitle(&a.Student), a.Date.Format(calendar.DateLayout), a.Status)
+	}},
+	{table: "announcements", model: &models.Announcement{}, owner: "announcement", title: func(row interface{}) string {
+		return row.(*models.Announcement).Title
+	}},
+	{table: "parent_students", model: &models.ParentStudent{}, preload: []string{"Parent", "Student"}, conflict: parentStudentConflict, title: func(row interface{}) string {
+		l := row.(*models.ParentStudent)
+		return userTitle(&l.Parent) + " → " + userTitle(&l.Student)
+	}},
+	{table: "alert_rules", model: &models.AlertRule{}, title: func(row interface{}) string {
+		return row.(*models.AlertRule).Name
+	}},
+}
+
+// softDeleted - таблицы, строки которых удаляются мягко
+var softDeleted = map[string]bool{"schools": true}
+
+func init() {
+	for _, e := range entities {
+		softDeleted[e.table] = true
+	}
+}
+
+// extraReferences - ссылки на записи корзины из таблиц, которые не входят в архив школы
+var extraReferences = []backup.Reference{
+	{Table: "calendar_feeds", Column: "user_id", Target: "users"},
+	{Table: "check_in_sessions", Column: "schedule_id", Target: "schedules"},
+	{Table: "check_in_sessions", Column: "opened_by", Target: "users"},
+	{Table: "check_ins", Column: "student_id", Target: "users"},
+	{Table: "check_ins", Column: "attendance_id", Target: "attendances"},
+}
+
+// cascades - строки, которые удаляются вместе с записью: связи классов и предметов
+// и личные данные пользователя. Остальные ссылки запрещают удаление навсегда.
+var cascades = map[string]bool{
+	"class_students.class_id":      true,
+	"class_students.user_id":       true,
+	"teachers_subjects.subject_id": true,
+	"teachers_subjects.user_id":    true,
+	"notifications.user_id":        true,
+	"calendar_feeds.user_id":       true,
+}
+
+// cascadeModels - модели таблиц из cascades. У связующих таблиц моделей нет, их строки
+// удаляются через DeleteLinks.
+var cascadeModels = map[string]interface{}{
+	"notifications":  &models.Notification{},
+	"calendar_feeds": &models.CalendarFeed{},
+}
+
+// authorColumns - ссылки на автора или ответственного. Удалённый пользователь не мешает
+// восстановлению: живые записи удалённых учителей тоже остаются в журнале.
+var authorColumns = map[string]bool{
+	"teacher_id":          true,
+	"homeroom_teacher_id": true,
+	"starosta_id":         true,
+	"author_id":           true,
+	"marked_by":           true,
+	"created_by":          true,
+}
+
+// Entities возвращает виды записей корзины (имена таблиц)
+func Entities() []string {
+	names := make([]string, len(entities))
+	for i, e := range entities {
+		names[i] = e.table
+	}
+	return names
+}
+
+func lookup(name string) (*entity, error) {
+	for _, e := range entities {
+		if e.table == name {
+			return e, nil
+		}
+	}
+	return nil, ErrUnknownEntity
+}
+
+// scoped ограничивает запрос удалёнными строками школы
+func (e *entity) scoped(db *gorm.DB, schoolID uint) *gorm.DB {
+	scope, _ := backup.SchoolScope(e.table)
+	args := make([]interface{}, strings.Count(scope, "?"))
+	for i := range args {
+		args[i] = schoolID
+	}
+	return db.Unscoped().Model(e.model).Where(scope, args...).Where("deleted_at IS NOT NULL")
+}
+
+// find загружает запись корзины школы
+func (e *entity) find(db *gorm.DB, schoolID, id uint) (interface{}, error) {
+	row := reflect.New(reflect.TypeOf(e.model).Elem()).Interface()
+	err := e.scoped(db, schoolID).Where("id = ?", id).First(row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	return row, err
+}
+
+// List возвращает записи корзины школы от недавно удалённых к давним.
+// Пустой entity - записи всех видов.
+func List(db *gorm.DB, schoolID uint, entityName string) ([]Item, error) {
+	list := entities
+	if entityName != "" {
+		e, err := lookup(entityName)
+		if err != nil {
+			return nil, err
+		}
+		list = []*entity{e}
+	}
+
+	items := []Item{}
+	for _, e := range list {
+		query := e.scoped(db, schoolID)
+		for _, name := range e.preload {
+			query = query.Preload(name, func(tx *gorm.DB) *gorm.DB { return tx.Unscoped() })
+		}
+		rows := reflect.New(reflect.SliceOf(reflect.TypeOf(e.model)))
+		if err := query.Find(rows.Interface()).Error; err != nil {
+			return nil, err
+		}
+		sch, err := parseSchema(db, e.model)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := 0; i < rows.Elem().Len(); i++ {
+			row := rows.Elem().Index(i).Interface()
+			rv := reflect.ValueOf(row).Elem()
+			item := Item{Entity: e.table, Title: e.title(row)}
+			id, _ := sch.PrioritizedPrimaryField.ValueOf(db.Statement.Context, rv)
+			item.ID = id.(uint)
+			deletedAt, _ := sch.LookUpField("DeletedAt").ValueOf(db.Statement.Context, rv)
+			item.DeletedAt = deletedAt.(gorm.DeletedAt).Time
+			items = append(items, item)
+		}
+	}
+
+	if err := fillDeletedBy(db, items); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].DeletedAt.After(items[j].DeletedAt) })
+	return items, nil
+}
+
+// fillDeletedBy находит в журнале аудита, кто удалил записи
+func fillDeletedBy(db *gorm.DB, items []Item) error {
+	ids := make(map[string][]uint)
+	for _, item := range items {
+		ids[item.Entity] = append(ids[item.Entity], item.ID)
+	}
+
+	type deletion struct {
+		Entity   string
+		EntityID uint
+		UserID   *uint
+	}
+	authors := make(map[string]*uint)
+	for name, list := range ids {
+		var deletions []deletion
+		if err := db.Model(&models.AuditLog{}).
+			Select("entity, entity_id, user_id").
+			Where("entity = ? AND action = ? AND entity_id IN ?", name, audit.ActionDelete, list).
+			Order("id").
+			Scan(&deletions).Error; err != nil {
+			return err
+		}
+		// Запись могли удалять и восстанавливать несколько раз - нужен последний
+		for _, d := range deletions {
+			authors[d.Entity+"/"+strconv.FormatUint(uint64(d.EntityID), 10)] = d.UserID
+		}
+	}
+
+	var userIDs []uint
+	for _, id := range authors {
+		if id != nil {
+			userIDs = append(userIDs, *id)
+		}
+	}
+	names := make(map[uint]string)
+	if len(userIDs) > 0 {
+		var users []models.User
+		if err := db.Unscoped().Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+			return err
+		}
+		for i := range users {
+			names[users[i].ID] = userTitle(&users[i])
+		}
+	}
+
+	for i := range items {
+		if id := authors[items[i].Entity+"/"+strconv.FormatUint(uint64(items[i].ID), 10)]; id != nil {
+			items[i].DeletedBy = id
+			items[i].DeletedByName = names[*id]
+		}
+	}
+	return nil
+}
+
+// Restore возвращает запись из корзины. Все записи, на которые она ссылается,
+// должны быть живы, а такая же запись не должна быть создана заново.
+func Restore(db *gorm.DB, schoolID uint, entityName string, id uint) error {
+	e, err := lookup(entityName)
+	if err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		row, err := e.find(tx, schoolID, id)
+		if err != nil {
+			return err
+		}
+
+		blockers, err := restoreBlockers(tx, e, row)
+		if err != nil {
+			return err
+		}
+		if e.conflict != nil {
+			conflict, err := e.conflict(tx, row)
+			if err != nil {
+				return err
+			}
+			if conflict {
+				blockers = append(blockers, Blocker{Reason: ReasonConflict, Entity: e.table})
+			}
+		}
+		if len(blockers) > 0 {
+			return &BlockedError{Blockers: blockers}
+		}
+
+		// Через модель, чтобы сработали хуки: восстановленные оценки и отметки
+		// получают новый номер изменения и снова приходят офлайн-клиентам
+		return tx.Unscoped().Model(row).Update("deleted_at", nil).Error
+	})
+}
+
+// restoreBlockers проверяет записи, на которые ссылается восстанавливаемая
+func restoreBlockers(tx *gorm.DB, e *entity, row interface{}) ([]Blocker, error) {
+	sch, err := parseSchema(tx, e.model)
+	if err != nil {
+		return nil, err
+	}
+	rv := reflect.ValueOf(row).Elem()
+
+	var blockers []Blocker
+	for _, ref := range backup.References() {
+		if ref.Table != e.table {
+			continue
+		}
+		field := sch.LookUpField(ref.Column)
+		if field == nil {
+			continue
+		}
+		value, zero := field.ValueOf(tx.Statement.Context, rv)
+		if zero {
+			continue
+		}
+		targetID, ok := toUint(value)
+		if !ok {
+			continue
+		}
+
+		var alive, total int64
+		if err := tx.Table(ref.Target).Where("id = ?", targetID).Count(&total).Error; err != nil {
+			return nil, err
+		}
+		alive = total
+		if total > 0 && softDeleted[ref.Target] {
+			if err := tx.Table(ref.Target).Where("id = ? AND deleted_at IS NULL", targetID).Count(&alive).Error; err != nil {
+				return nil, err
+			}
+		}
+		switch {
+		case total == 0:
+			blockers = append(blockers, Blocker{Reason: ReasonMissing, Entity: ref.Target, Column: ref.Column, ID: targetID})
+		case alive == 0 && !(ref.Target == "users" && authorColumns[ref.Column]):
+			blockers = append(blockers, Blocker{Reason: ReasonDeleted, Entity: ref.Target, Column: ref.Column, ID: targetID})
+		}
+	}
+	return blockers, nil
+}
+
+// attendanceConflict - за тот же урок ученику уже поставлена новая отметка
+func attendanceConflict(tx *gorm.DB, row interface{}) (bool, error) {
+	a := row.(*models.Attendance)
+	query := tx.Model(&models.Attendance{}).
+		Where("student_id = ? AND class_id = ? AND date = ?", a.StudentID, a.ClassID, a.Date)
+	if a.ScheduleID != nil {
+		query = query.Where("schedule_id = ?", *a.ScheduleID)
+	} else {
+		if a.LessonNumber != nil {
+			query = query.Where("lesson_number = ?", *a.LessonNumber)
+		}
+		if a.SubjectID != nil {
+			query = query.Where("subject_id = ?", *a.SubjectID)
+		}
+	}
+	var count int64
+	err := query.Count(&count).Error
+	return count > 0, err
+}
+
+// parentStudentConflict - родитель уже заново связан с ребёнком
+func parentStudentConflict(tx *gorm.DB, row interface{}) (bool, error) {
+	l := row.(*models.ParentStudent)
+	var count int64
+	err := tx.Model(&models.ParentStudent{}).
+		Where("parent_id = ? AND student_id = ?", l.ParentID, l.StudentID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// Purge удаляет запись из корзины навсегда. Связи классов и предметов и личные
+// данные пользователя удаляются вместе с ней, вложения открепляются; любые другие
+// ссылки на запись (в том числе из корзины) запрещают удаление.
+func Purge(db *gorm.DB, schoolID uint, entityName string, id uint) error {
+	e, err := lookup(entityName)
+	if err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		row, err := e.find(tx, schoolID, id)
+		if err != nil {
+			return err
+		}
+		return purge(tx, e, id, row)
+	})
+}
+
+func purge(tx *gorm.DB, e *entity, id uint, row interface{}) error {
+	blockers, err := purgeBlockers(tx, e, id)
+	if err != nil {
+		return err
+	}
+	if len(blockers) > 0 {
+		return &BlockedError{Blockers: blockers}
+	}
+
+	for _, ref := range References() {
+		if ref.Target != e.table || !cascades[ref.Table+"."+ref.Column] {
+			continue
+		}
+		var err error
+		if model, ok := cascadeModels[ref.Table]; ok {
+			err = tx.Where(ref.Column+" = ?", id).Delete(model).Error
+		} else {
+			err = DeleteLinks(tx, schoolOf(row), ref.Table, map[string]uint{ref.Column: id})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if e.owner != "" {
+		if err := tx.Model(&models.Attachment{}).
+			Where("owner_type = ? AND owner_id = ?", e.owner, id).
+			Updates(map[string]interface{}{"owner_type": "", "owner_id": 0}).Error; err != nil {
+			return err
+		}
+	}
+
+	// Хуки пропускаются: о мягком удалении оценок и отметок клиенты уже знают
+	return tx.Unscoped().Session(&gorm.Session{SkipHooks: true}).Delete(row).Error
+}
+
+// DeleteLinks удаляет строки связующей таблицы (class_students, teachers_subjects),
+// подходящие под conds, и пишет в журнал аудита запись о каждой, как при удалении
+// связи через ассоциацию: у этих таблиц нет моделей, и колбэки журнала их не видят.
+func DeleteLinks(tx *gorm.DB, schoolID uint, table string, conds map[string]uint) error {
+	columns := make([]string, 0, len(conds))
+	for column := range conds {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	where := make([]string, len(columns))
+	args := make([]interface{}, len(columns))
+	for i, column := range columns {
+		where[i] = column + " = ?"
+		args[i] = conds[column]
+	}
+	query := strings.Join(where, " AND ")
+
+	var rows []map[string]interface{}
+	if err := tx.Table(table).Where(query, args...).Find(&rows).Error; err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	if err := tx.Exec("DELETE FROM "+table+" WHERE "+query, args...).Error; err != nil {
+		return err
+	}
+	for _, r := range rows {
+		changes := make(map[string]audit.Change, len(r))
+		for column, value := range r {
+			if value != nil {
+				changes[column] = audit.Change{Old: value}
+			}
+		}
+		if err := audit.Record(tx, schoolID, audit.ActionDelete, table, 0, changes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// schoolOf возвращает школу записи корзины (0, если у записи нет school_id)
+func schoolOf(row interface{}) uint {
+	field := reflect.Indirect(reflect.ValueOf(row)).FieldByName("SchoolID")
+	if !field.IsValid() || field.Kind() != reflect.Uint {
+		return 0
+	}
+	return uint(field.Uint())
+}
+
+// purgeBlockers считает строки, которые ссылаются на запись
+func purgeBlockers(tx *gorm.DB, e *entity, id uint) ([]Blocker, error) {
+	var blockers []Blocker
+	for _, ref := range References() {
+		if ref.Target != e.table || cascades[ref.Table+"."+ref.Column] {
+			continue
+		}
+		var count int64
+		if err := tx.Table(ref.Table).Where(ref.Column+" = ?", id).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			blockers = append(blockers, Blocker{Reason: ReasonReferenced, Entity: ref.Table, Column: ref.Column, Count: count})
+		}
+	}
+	return blockers, nil
+}
+
+// References возвращает все ссылки между таблицами школы: из архива школы и из таблиц,
+// которые в архив не входят
+func References() []backup.Reference {
+	return append(backup.References(), extraReferences...)
+}
+
+// PurgeExpired удаляет навсегда записи всех школ, удалённые раньше before.
+// Возвращает число удалённых записей и записей, на которые ещё есть ссылки.
+func PurgeExpired(db *gorm.DB, before time.Time) (purged, blocked int, err error) {
+	for i := len(entities) - 1; i >= 0; i-- {
+		e := entities[i]
+		var ids []uint
+		if err := db.Unscoped().Model(e.model).
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", before).
+			Order("id").
+			Pluck("id", &ids).Error; err != nil {
+			return purged, blocked, err
+		}
+
+		for _, id := range ids {
+			err := db.Transaction(func(tx *gorm.DB) error {
+				row := reflect.New(reflect.TypeOf(e.model).Elem()).Interface()
+				if err := tx.Unscoped().First(row, id).Error; err != nil {
+					return err
+				}
+				return purge(tx, e, id, row)
+			})
+			var blockedErr *BlockedError
+			switch {
+			case errors.As(err, &blockedErr):
+				blocked++
+			case err != nil:
+				return purged, blocked, err
+			default:
+				purged++
+			}
+		}
+	}
+	return purged, blocked, nil
+}
+
+// Start запускает автоматическую очистку корзины от записей старше retention.
+// Нулевой срок выключает очистку.
+func Start(db *gorm.DB, retention, interval time.Duration) {
+	if retention <= 0 {
+		return
+	}
+	go func() {
+		for {
+			purged, blocked, err := PurgeExpired(db, time.Now().Add(-retention))
+			if err != nil {
+				log.Printf("Trash cleanup failed: %v", err)
+			} else if purged > 0 || blocked > 0 {
+				log.Printf("Trash cleanup: purged %d items, %d still referenced", purged, blocked)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// schemaCache - разобранные схемы моделей корзины
+var schemaCache = &sync.Map{}
+
+func parseSchema(db *gorm.DB, model interface{}) (*schema.Schema, error) {
+	return schema.Parse(model, schemaCache, db.NamingStrategy)
+}
+
+func toUint(value interface{}) (uint, bool) {
+	switch v := value.(type) {
+	case uint:
+		return v, true
+	case *uint:
+		if v != nil {
+			return *v, true
+		}
+	}
+	return 0, false
+}
+
+// userTitle возвращает "Фамилия Имя (логин)"
+func userTitle(u *models.User) string {
+	name := strings.Join(strings.Fields(u.LastName+" "+u.FirstName), " ")
+	if name == "" {
+		return u.Username
+	}
+	return name + " (" + u.Username + ")"
+}
+
+func shorten(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n]) + "…"
+}
@@ -0,0 +1,201 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ErrNoSheets - в книге нет ни одного листа
+var ErrNoSheets = errors.New("xlsx: workbook has no sheets")
+
+// maxPartSize - предел размера одной части архива после распаковки
+const maxPartSize = 64 << 20
+
+type workbookXML struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type relationshipsXML struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// richText - текст ячейки: простой <t> или набор фрагментов <r><t>
+type richText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (rt richText) String() string {
+	if len(rt.Runs) == 0 {
+		return rt.T
+	}
+	var sb strings.Builder
+	for _, r := range rt.Runs {
+		sb.WriteString(r.T)
+	}
+	return sb.String()
+}
+
+type sharedStringsXML struct {
+	Items []richText `xml:"si"`
+}
+
+type sheetXML struct {
+	Rows []struct {
+		Cells []struct {
+			Ref    string   `xml:"r,attr"`
+			Type   string   `xml:"t,attr"`
+			Value  string   `xml:"v"`
+			Inline richText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// ReadFirstSheet читает значения первого листа книги как таблицу строк.
+// Строки выравниваются по самой длинной, пустые ячейки - пустые строки.
+// Формулы не вычисляются: берётся сохранённое значение.
+func ReadFirstSheet(r io.ReaderAt, size int64) ([][]string, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("xlsx: %w", err)
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	var wb workbookXML
+	if err := decodePart(files, "xl/workbook.xml", &wb); err != nil {
+		return nil, err
+	}
+	if len(wb.Sheets) == 0 {
+		return nil, ErrNoSheets
+	}
+
+	// Путь листа берём из связей книги, по умолчанию - стандартный
+	sheetPath := "xl/worksheets/sheet1.xml"
+	var rels relationshipsXML
+	if err := decodePart(files, "xl/_rels/workbook.xml.rels", &rels); err == nil {
+		for _, rel := range rels.Relationships {
+			if rel.ID == wb.Sheets[0].RID {
+				if strings.HasPrefix(rel.Target, "/") {
+					sheetPath = strings.TrimPrefix(rel.Target, "/")
+				} else {
+					sheetPath = path.Join("xl", rel.Target)
+				}
+				break
+			}
+		}
+	}
+
+	var shared sharedStringsXML
+	if _, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := decodePart(files, "xl/sharedStrings.xml", &shared); err != nil {
+			return nil, err
+		}
+	}
+
+	var sheet sheetXML
+	if err := decodePart(files, sheetPath, &sheet); err != nil {
+		return nil, err
+	}
+
+	var table [][]string
+	width := 0
+	for _, row := range sheet.Rows {
+		var values []string
+		for i, cell := range row.Cells {
+			col := i
+			if cell.Ref != "" {
+				if idx, ok := columnIndex(cell.Ref); ok {
+					col = idx
+				}
+			}
+			for len(values) <= col {
+				values = append(values, "")
+			}
+
+			switch cell.Type {
+			case "s":
+				idx, err := strconv.Atoi(strings.TrimSpace(cell.Value))
+				if err != nil || idx < 0 || idx >= len(shared.Items) {
+					return nil, fmt.Errorf("xlsx: invalid shared string index in %s", cell.Ref)
+				}
+				values[col] = shared.Items[idx].String()
+			case "inlineStr":
+				values[col] = cell.Inline.String()
+			case "b":
+				if cell.Value == "1" {
+					values[col] = "TRUE"
+				} else {
+					values[col] = "FALSE"
+				}
+			default:
+				values[col] = cell.Value
+			}
+		}
+		if len(values) > width {
+			width = len(values)
+		}
+		table = append(table, values)
+	}
+
+	for i := range table {
+		for len(table[i]) < width {
+			table[i] = append(table[i], "")
+		}
+	}
+	return table, nil
+}
+
+// decodePart разбирает XML-часть архива
+func decodePart(files map[string]*zip.File, name string, v interface{}) error {
+	f, ok := files[name]
+	if !ok {
+		return fmt.Errorf("xlsx: missing %s", name)
+	}
+	if f.UncompressedSize64 > maxPartSize {
+		return fmt.Errorf("xlsx: %s is too large", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("xlsx: %w", err)
+	}
+	defer rc.Close()
+
+	if err := xml.NewDecoder(io.LimitReader(rc, maxPartSize)).Decode(v); err != nil {
+		return fmt.Errorf("xlsx: %s: %w", name, err)
+	}
+	return nil
+}
+
+// columnIndex возвращает номер столбца (с нуля) по ссылке вида "AB12"
+func columnIndex(ref string) (int, bool) {
+	col := 0
+	n := 0
+	for _, ch := range ref {
+		if ch < 'A' || ch > 'Z' {
+			break
+		}
+		col = col*26 + int(ch-'A'+1)
+		n++
+	}
+	if n == 0 {
+		return 0, false
+	}
+	return col - 1, true
+}
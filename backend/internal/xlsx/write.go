@@ -0,0 +1,360 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Стили ячеек (индексы в cellXfs из styles.xml)
+const (
+	StyleDefault = iota
+	StyleHeader  // Заголовок таблицы: жирный, серый фон, рамка, по центру
+	StyleCell    // Значение в рамке по центру
+	StyleText    // Текст в рамке по левому краю (ФИО)
+	StyleAlert   // Значение в рамке красным (пропуски, двойки)
+	StyleNumber  // Число с двумя знаками после запятой в рамке
+	StyleTitle   // Заголовок листа
+	StyleTotal   // Итог: жирное число с двумя знаками в рамке
+)
+
+// maxSheetName - Excel ограничивает имя листа 31 символом
+const maxSheetName = 31
+
+// Workbook - книга XLSX, собираемая в памяти
+type Workbook struct {
+	sheets []*Sheet
+}
+
+// Sheet - лист книги
+type Sheet struct {
+	name       string
+	cells      map[int]map[int]cell
+	merges     []string
+	widths     map[int]float64
+	freezeRows int
+	freezeCols int
+}
+
+type cell struct {
+	value interface{}
+	style int
+}
+
+// NewWorkbook создаёт пустую книгу
+func NewWorkbook() *Workbook {
+	return &Workbook{}
+}
+
+// AddSheet добавляет лист. Недопустимые символы в имени заменяются,
+// повторяющиеся имена получают номер.
+func (wb *Workbook) AddSheet(name string) *Sheet {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '-'
+		}
+		return r
+	}, strings.TrimSpace(name))
+	if name == "" {
+		name = fmt.Sprintf("Лист%d", len(wb.sheets)+1)
+	}
+	name = truncate(name, maxSheetName)
+
+	base := name
+	for n := 2; wb.hasSheet(name); n++ {
+		suffix := fmt.Sprintf(" (%d)", n)
+		name = truncate(base, maxSheetName-len([]rune(suffix))) + suffix
+	}
+
+	sheet := &Sheet{
+		name:   name,
+		cells:  make(map[int]map[int]cell),
+		widths: make(map[int]float64),
+	}
+	wb.sheets = append(wb.sheets, sheet)
+	return sheet
+}
+
+func (wb *Workbook) hasSheet(name string) bool {
+	for _, s := range wb.sheets {
+		if strings.EqualFold(s.name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Set записывает значение в ячейку (строка и столбец с нуля).
+// Поддерживаются string, целые и float64; nil оставляет ячейку пустой со стилем.
+func (s *Sheet) Set(row, col int, value interface{}, style int) {
+	if s.cells[row] == nil {
+		s.cells[row] = make(map[int]cell)
+	}
+	s.cells[row][col] = cell{value: value, style: style}
+}
+
+// Merge объединяет прямоугольник ячеек
+func (s *Sheet) Merge(row1, col1, row2, col2 int) {
+	if row1 == row2 && col1 == col2 {
+		return
+	}
+	s.merges = append(s.merges, CellRef(row1, col1)+":"+CellRef(row2, col2))
+}
+
+// SetColWidth задаёт ширину столбца в символах
+func (s *Sheet) SetColWidth(col int, width float64) {
+	s.widths[col] = width
+}
+
+// Freeze закрепляет первые rows строк и cols столбцов
+func (s *Sheet) Freeze(rows, cols int) {
+	s.freezeRows, s.freezeCols = rows, cols
+}
+
+// CellRef возвращает адрес ячейки вида "B3" (строка и столбец с нуля)
+func CellRef(row, col int) string {
+	return ColumnName(col) + strconv.Itoa(row+1)
+}
+
+// ColumnName возвращает буквенное имя столбца: 0 -> A, 26 -> AA
+func ColumnName(col int) string {
+	name := ""
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = string(rune('A'+(col-1)%26)) + name
+	}
+	return name
+}
+
+// Write сериализует книгу в формат Office Open XML
+func (wb *Workbook) Write(w io.Writer) error {
+	if len(wb.sheets) == 0 {
+		wb.AddSheet("")
+	}
+
+	zw := zip.NewWriter(w)
+	parts := []struct {
+		name  string
+		write func(io.Writer) error
+	}{
+		{"[Content_Types].xml", wb.writeContentTypes},
+		{"_rels/.rels", writeString(rootRels)},
+		{"xl/workbook.xml", wb.writeWorkbook},
+		{"xl/_rels/workbook.xml.rels", wb.writeWorkbookRels},
+		{"xl/styles.xml", writeString(stylesXML)},
+	}
+	for i, sheet := range wb.sheets {
+		parts = append(parts, struct {
+			name  string
+			write func(io.Writer) error
+		}{fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), sheet.write})
+	}
+
+	for _, part := range parts {
+		fw, err := zw.Create(part.name)
+		if err != nil {
+			return err
+		}
+		bw := bufio.NewWriter(fw)
+		if err := part.write(bw); err != nil {
+			return err
+		}
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func writeString(s string) func(io.Writer) error {
+	return func(w io.Writer) error {
+		_, err := io.WriteString(w, s)
+		return err
+	}
+}
+
+func (wb *Workbook) writeContentTypes(w io.Writer) error {
+	fmt.Fprint(w, xml.Header)
+	fmt.Fprint(w, `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	fmt.Fprint(w, `<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	fmt.Fprint(w, `<Default Extension="xml" ContentType="application/xml"/>`)
+	fmt.Fprint(w, `<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	fmt.Fprint(w, `<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	for i := range wb.sheets {
+		fmt.Fprintf(w, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1)
+	}
+	_, err := fmt.Fprint(w, `</Types>`)
+	return err
+}
+
+func (wb *Workbook) writeWorkbook(w io.Writer) error {
+	fmt.Fprint(w, xml.Header)
+	fmt.Fprint(w, `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	for i, sheet := range wb.sheets {
+		fmt.Fprintf(w, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, escape(sheet.name), i+1, i+1)
+	}
+	_, err := fmt.Fprint(w, `</sheets></workbook>`)
+	return err
+}
+
+func (wb *Workbook) writeWorkbookRels(w io.Writer) error {
+	fmt.Fprint(w, xml.Header)
+	fmt.Fprint(w, `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i := range wb.sheets {
+		fmt.Fprintf(w, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, i+1)
+	}
+	fmt.Fprintf(w, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, len(wb.sheets)+1)
+	_, err := fmt.Fprint(w, `</Relationships>`)
+	return err
+}
+
+func (s *Sheet) write(w io.Writer) error {
+	fmt.Fprint(w, xml.Header)
+	fmt.Fprint(w, `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">`)
+
+	if s.freezeRows > 0 || s.freezeCols > 0 {
+		fmt.Fprint(w, `<sheetViews><sheetView workbookViewId="0"><pane`)
+		if s.freezeCols > 0 {
+			fmt.Fprintf(w, ` xSplit="%d"`, s.freezeCols)
+		}
+		if s.freezeRows > 0 {
+			fmt.Fprintf(w, ` ySplit="%d"`, s.freezeRows)
+		}
+		pane := "bottomRight"
+		if s.freezeCols == 0 {
+			pane = "bottomLeft"
+		} else if s.freezeRows == 0 {
+			pane = "topRight"
+		}
+		fmt.Fprintf(w, ` topLeftCell="%s" activePane="%s" state="frozen"/></sheetView></sheetViews>`,
+			CellRef(s.freezeRows, s.freezeCols), pane)
+	}
+
+	if len(s.widths) > 0 {
+		cols := make([]int, 0, len(s.widths))
+		for col := range s.widths {
+			cols = append(cols, col)
+		}
+		sort.Ints(cols)
+		fmt.Fprint(w, `<cols>`)
+		for _, col := range cols {
+			fmt.Fprintf(w, `<col min="%d" max="%d" width="%.2f" customWidth="1"/>`, col+1, col+1, s.widths[col])
+		}
+		fmt.Fprint(w, `</cols>`)
+	}
+
+	fmt.Fprint(w, `<sheetData>`)
+	rows := make([]int, 0, len(s.cells))
+	for row := range s.cells {
+		rows = append(rows, row)
+	}
+	sort.Ints(rows)
+	for _, row := range rows {
+		fmt.Fprintf(w, `<row r="%d">`, row+1)
+		cols := make([]int, 0, len(s.cells[row]))
+		for col := range s.cells[row] {
+			cols = append(cols, col)
+		}
+		sort.Ints(cols)
+		for _, col := range cols {
+			writeCell(w, CellRef(row, col), s.cells[row][col])
+		}
+		fmt.Fprint(w, `</row>`)
+	}
+	fmt.Fprint(w, `</sheetData>`)
+
+	if len(s.merges) > 0 {
+		fmt.Fprintf(w, `<mergeCells count="%d">`, len(s.merges))
+		for _, ref := range s.merges {
+			fmt.Fprintf(w, `<mergeCell ref="%s"/>`, ref)
+		}
+		fmt.Fprint(w, `</mergeCells>`)
+	}
+
+	_, err := fmt.Fprint(w, `</worksheet>`)
+	return err
+}
+
+func writeCell(w io.Writer, ref string, c cell) {
+	style := ""
+	if c.style != StyleDefault {
+		style = fmt.Sprintf(` s="%d"`, c.style)
+	}
+
+	switch v := c.value.(type) {
+	case nil:
+		fmt.Fprintf(w, `<c r="%s"%s/>`, ref, style)
+	case int:
+		fmt.Fprintf(w, `<c r="%s"%s><v>%d</v></c>`, ref, style, v)
+	case int64:
+		fmt.Fprintf(w, `<c r="%s"%s><v>%d</v></c>`, ref, style, v)
+	case uint:
+		fmt.Fprintf(w, `<c r="%s"%s><v>%d</v></c>`, ref, style, v)
+	case float64:
+		fmt.Fprintf(w, `<c r="%s"%s><v>%s</v></c>`, ref, style, strconv.FormatFloat(v, 'f', -1, 64))
+	default:
+		fmt.Fprintf(w, `<c r="%s"%s t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`,
+			ref, style, escape(fmt.Sprint(v)))
+	}
+}
+
+// escape экранирует текст для XML, выбрасывая недопустимые в XML символы
+func escape(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' || r == '\r' || r >= 0x20 && r != 0xFFFE && r != 0xFFFF {
+			return r
+		}
+		return -1
+	}, s)
+	var sb strings.Builder
+	xml.EscapeText(&sb, []byte(s))
+	return sb.String()
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
+
+const rootRels = `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+
+// stylesXML задаёт стили в порядке констант Style*
+const stylesXML = `<?xml version="1.0" encoding="UTF-8"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="1"><numFmt numFmtId="164" formatCode="0.00"/></numFmts>
+<fonts count="4">
+<font><sz val="11"/><name val="Calibri"/></font>
+<font><b/><sz val="11"/><name val="Calibri"/></font>
+<font><sz val="11"/><color rgb="FFC00000"/><name val="Calibri"/></font>
+<font><b/><sz val="14"/><name val="Calibri"/></font>
+</fonts>
+<fills count="3">
+<fill><patternFill patternType="none"/></fill>
+<fill><patternFill patternType="gray125"/></fill>
+<fill><patternFill patternType="solid"><fgColor rgb="FFE7E6E6"/><bgColor indexed="64"/></patternFill></fill>
+</fills>
+<borders count="2">
+<border><left/><right/><top/><bottom/><diagonal/></border>
+<border><left style="thin"/><right style="thin"/><top style="thin"/><bottom style="thin"/><diagonal/></border>
+</borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="8">
+<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>
+<xf numFmtId="0" fontId="1" fillId="2" borderId="1" xfId="0" applyFont="1" applyFill="1" applyBorder="1" applyAlignment="1"><alignment horizontal="center" vertical="center" wrapText="1"/></xf>
+<xf numFmtId="0" fontId="0" fillId="0" borderId="1" xfId="0" applyBorder="1" applyAlignment="1"><alignment horizontal="center"/></xf>
+<xf numFmtId="0" fontId="0" fillId="0" borderId="1" xfId="0" applyBorder="1"/>
+<xf numFmtId="0" fontId="2" fillId="0" borderId="1" xfId="0" applyFont="1" applyBorder="1" applyAlignment="1"><alignment horizontal="center"/></xf>
+<xf numFmtId="164" fontId="0" fillId="0" borderId="1" xfId="0" applyNumberFormat="1" applyBorder="1" applyAlignment="1"><alignment horizontal="center"/></xf>
+<xf numFmtId="0" fontId="3" fillId="0" borderId="0" xfId="0" applyFont="1"/>
+<xf numFmtId="164" fontId="1" fillId="0" borderId="1" xfId="0" applyNumberFormat="1" applyFont="1" applyBorder="1" applyAlignment="1"><alignment horizontal="center"/></xf>
+</cellXfs>
+<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>
+</styleSheet>`
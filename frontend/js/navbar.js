@@ -64,6 +64,40 @@ function renderNavbar(currentPage) {
 
     // Устанавливаем имя пользователя - ЗАГРУЖАЕМ С СЕРВЕРА
     loadUserName();
+
+    if (userRole === 'admin') {
+        checkBackupStatus();
+    }
+}
+
+// Предупреждение администратору о неудачном резервном копировании
+async function checkBackupStatus() {
+    const token = localStorage.getItem('token');
+    const API_BASE = 'http://localhost:8080/api';
+
+    try {
+        const response = await fetch(`${API_BASE}/settings/backups`, {
+            headers: { 'Authorization': `Bearer ${token}` }
+        });
+        if (!response.ok) return;
+
+        const status = (await response.json()).status;
+        if (!status.failing || document.getElementById('backup-failure-banner')) return;
+
+        const banner = document.createElement('div');
+        banner.id = 'backup-failure-banner';
+        banner.style.cssText = 'background:#f5576c;color:white;padding:10px 20px;text-align:center;';
+        banner.innerHTML = '⚠️ Резервное копирование завершилось ошибкой. ' +
+            '<a href="/pages/settings.html" style="color:white;text-decoration:underline;">Подробнее в настройках</a>';
+        const navbar = document.querySelector('.navbar');
+        if (navbar) {
+            navbar.after(banner);
+        } else {
+            document.body.prepend(banner);
+        }
+    } catch (error) {
+        console.error('Error loading backup status:', error);
+    }
 }
 
 async function loadUserName() {
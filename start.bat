@@ -55,6 +55,6 @@ echo Press Ctrl+C to stop
 echo ========================================
 echo.
 
-go run main.go
+go run .
 
 pause
@@ -24,4 +24,4 @@ echo ""
 echo "========================================"
 echo ""
 
-go run main.go
+go run .